@@ -34,6 +34,8 @@ type ChannelCfg interface {
 	AnchorPeers() []*OrgAnchorPeer
 	Orderers() []string
 	Versions() *Versions
+	// Sequence returns the sequence number of the config, which is incremented by each config update
+	Sequence() uint64
 }
 
 // ChannelMembership helps identify a channel's members
@@ -56,4 +58,6 @@ type BlockchainInfoResponse struct {
 	BCI      *common.BlockchainInfo
 	Endorser string
 	Status   int32
+	// MSPID is the MSP ID of the endorser (empty if it couldn't be resolved)
+	MSPID string
 }
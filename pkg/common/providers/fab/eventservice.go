@@ -15,12 +15,25 @@ import (
 type BlockEvent struct {
 	// Block is the block that was committed
 	Block *cb.Block
+	// SequenceNum is the sequence number that was assigned to the event by the event dispatcher. Events
+	// of all types are numbered in the order in which they were processed by the dispatcher, so the
+	// sequence number may be used to reconstruct the order of events of different types (for example,
+	// of the chaincode and transaction status events of a block). The sequence numbers are increasing but not
+	// necessarily consecutive for a given consumer. They are only meaningful for a single instance of the
+	// event service and are restarted when a new instance is created.
+	SequenceNum uint64
+	// BlockHash is the hash of the block header (as computed by Fabric), which is the previous hash of the
+	// next block. It's only set if the event service was created with the block hash option (see
+	// dispatcher.WithBlockHash); otherwise it's nil.
+	BlockHash []byte
 }
 
 // FilteredBlockEvent contains the data for a filtered block event
 type FilteredBlockEvent struct {
 	// FilteredBlock contains a filtered version of the block that was committed
 	FilteredBlock *pb.FilteredBlock
+	// SequenceNum is the sequence number that was assigned to the event by the event dispatcher (see BlockEvent)
+	SequenceNum uint64
 }
 
 // TxStatusEvent contains the data for a transaction status event
@@ -29,6 +42,8 @@ type TxStatusEvent struct {
 	TxID string
 	// TxValidationCode is the status code of the commit
 	TxValidationCode pb.TxValidationCode
+	// SequenceNum is the sequence number that was assigned to the event by the event dispatcher (see BlockEvent)
+	SequenceNum uint64
 }
 
 // CCEvent contains the data for a chaincode event
@@ -42,6 +57,8 @@ type CCEvent struct {
 	// Payload contains the payload of the chaincode event
 	// NOTE: Payload will be nil for filtered events
 	Payload []byte
+	// SequenceNum is the sequence number that was assigned to the event by the event dispatcher (see BlockEvent)
+	SequenceNum uint64
 }
 
 // Registration is a handle that is returned from a successful RegisterXXXEvent.
@@ -58,7 +75,8 @@ type EventService interface {
 	// RegisterBlockEvent registers for block events. If the caller does not have permission
 	// to register for block events then an error is returned.
 	// Note that Unregister must be called when the registration is no longer needed.
-	// - filter is an optional filter that filters out unwanted events. (Note: Only one filter may be specified.)
+	// - filter is an optional list of filters that filter out unwanted events. A block is delivered if any
+	//   of the filters accepts it.
 	// - Returns the registration and a channel that is used to receive events. The channel
 	//   is closed when Unregister is called.
 	RegisterBlockEvent(filter ...BlockFilter) (Registration, <-chan *BlockEvent, error)
@@ -17,6 +17,7 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
 )
 
 // Client supplies the configuration and signing identity to client objects.
@@ -253,6 +254,17 @@ type reqContextKey string
 var ReqContextTimeoutOverrides = reqContextKey("timeout-overrides")
 var reqContextCommManager = reqContextKey("commManager")
 var reqContextClient = reqContextKey("clientContext")
+var reqContextCompression = reqContextKey("compression")
+var reqContextCorrelationID = reqContextKey("correlationID")
+
+// CorrelationIDHeader is the gRPC metadata key under which the correlation ID of a request
+// (see WithCorrelationID) is sent to the peers
+const CorrelationIDHeader = "x-correlation-id"
+
+type requestCompression struct {
+	compressor      string
+	excludedTargets map[string]bool
+}
 
 //WithTimeoutType sets timeout by type defined in config to request context
 func WithTimeoutType(timeoutType core.TimeoutType) ReqContextOptions {
@@ -335,3 +347,41 @@ func requestTimeoutOverride(ctx reqContext.Context, timeoutType core.TimeoutType
 	}
 	return timeoutOverrides[timeoutType]
 }
+
+// WithCompressor returns a copy of the request-scoped context which requests that the named
+// compressor (e.g. "gzip") be used for the gRPC calls made to targets with the context.
+// Calls to the given excluded targets (URLs or addresses) are not compressed.
+func WithCompressor(ctx reqContext.Context, compressor string, excludedTargets ...string) reqContext.Context {
+	compression := &requestCompression{
+		compressor:      compressor,
+		excludedTargets: make(map[string]bool),
+	}
+	for _, target := range excludedTargets {
+		compression.excludedTargets[endpoint.ToAddress(target)] = true
+	}
+	return reqContext.WithValue(ctx, reqContextCompression, compression)
+}
+
+// RequestCompressor extracts the name of the compressor to use for the given target (URL or address)
+// from the request-scoped context. False is returned if calls to the target should not be compressed.
+func RequestCompressor(ctx reqContext.Context, target string) (string, bool) {
+	compression, ok := ctx.Value(reqContextCompression).(*requestCompression)
+	if !ok || compression.compressor == "" || compression.excludedTargets[endpoint.ToAddress(target)] {
+		return "", false
+	}
+	return compression.compressor, true
+}
+
+// WithCorrelationID returns a copy of the request-scoped context that carries the given correlation ID.
+// The correlation ID is sent (as CorrelationIDHeader gRPC metadata) with the proposals that are sent
+// with the context, so that the logs of the peers may be tied back to the request.
+func WithCorrelationID(ctx reqContext.Context, correlationID string) reqContext.Context {
+	return reqContext.WithValue(ctx, reqContextCorrelationID, correlationID)
+}
+
+// RequestCorrelationID extracts the correlation ID from the request-scoped context.
+// False is returned if the context doesn't carry a correlation ID.
+func RequestCorrelationID(ctx reqContext.Context) (string, bool) {
+	correlationID, ok := ctx.Value(reqContextCorrelationID).(string)
+	return correlationID, ok && correlationID != ""
+}
@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+)
+
+// verifierComposite is implemented by verifiers that combine several verifiers
+type verifierComposite interface {
+	components() []ResponseVerifier
+}
+
+// allOfVerifier is a ResponseVerifier that requires all of its verifiers to accept the responses
+type allOfVerifier struct {
+	verifiers []ResponseVerifier
+}
+
+// AllOf returns a ResponseVerifier that combines the given verifiers (nil verifiers are ignored),
+// so that each verifier may check a single aspect of the responses (for example, the response status,
+// the endorsement signatures and the diversity of the endorsing MSPs). Verify runs the verifiers in order
+// and returns the error of the first verifier that rejects the response. Match runs all of the verifiers
+// and returns the errors of all the verifiers that reject the responses.
+func AllOf(verifiers ...ResponseVerifier) ResponseVerifier {
+	v := &allOfVerifier{}
+	for _, verifier := range verifiers {
+		if verifier != nil {
+			v.verifiers = append(v.verifiers, verifier)
+		}
+	}
+	return v
+}
+
+// Verify verifies the response with each of the verifiers and stops at the first error
+func (v *allOfVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	for _, verifier := range v.verifiers {
+		if err := verifier.Verify(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match matches the responses with each of the verifiers and returns the errors of all verifiers
+// that failed to match the responses
+func (v *allOfVerifier) Match(responses []*fab.TransactionProposalResponse) error {
+	var errs error
+	for _, verifier := range v.verifiers {
+		if err := verifier.Match(responses); err != nil {
+			errs = multi.Append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (v *allOfVerifier) components() []ResponseVerifier {
+	return v.verifiers
+}
@@ -0,0 +1,60 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	"github.com/pkg/errors"
+)
+
+// EndorserIdentity identifies an endorser by its MSP ID and (PEM encoded) certificate
+type EndorserIdentity struct {
+	MSPID       string
+	Certificate []byte
+}
+
+// EndorserAllowlistVerifier is a ResponseVerifier that rejects responses from
+// endorsers whose identity is not in the allowlist
+type EndorserAllowlistVerifier struct {
+	allowed []EndorserIdentity
+}
+
+// NewEndorserAllowlistVerifier returns a ResponseVerifier that only accepts responses
+// endorsed by one of the given identities. Note that the signature of the endorsement is
+// not verified; the allowlist is checked regardless of signature validity.
+func NewEndorserAllowlistVerifier(allowed []EndorserIdentity) *EndorserAllowlistVerifier {
+	return &EndorserAllowlistVerifier{allowed: allowed}
+}
+
+// Verify checks that the response was endorsed by an identity in the allowlist
+func (v *EndorserAllowlistVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	if response.ProposalResponse == nil || response.ProposalResponse.Endorsement == nil {
+		return errors.Errorf("missing endorsement in proposal response from endorser [%s]", response.Endorser)
+	}
+
+	sID := &mb.SerializedIdentity{}
+	if err := proto.Unmarshal(response.ProposalResponse.Endorsement.Endorser, sID); err != nil {
+		return errors.Wrapf(err, "unmarshal of endorser identity from endorser [%s] failed", response.Endorser)
+	}
+
+	for _, identity := range v.allowed {
+		if identity.MSPID == sID.Mspid && bytes.Equal(bytes.TrimSpace(identity.Certificate), bytes.TrimSpace(sID.IdBytes)) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("endorser [%s] of MSP [%s] is not in the allowlist", response.Endorser, sID.Mspid)
+}
+
+// Match is not used by this verifier and always succeeds
+func (v *EndorserAllowlistVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/pkg/errors"
+)
+
+// blockNotFoundMessages are contained in the message of the response that a peer returns when
+// the requested block doesn't exist (the message depends on the Fabric version)
+var blockNotFoundMessages = []string{
+	"Entry not found in index",
+	"no such block",
+}
+
+// BlockNotFoundError is returned by the block queries for each target that reports that the
+// requested block doesn't exist, for example, because it hasn't been produced yet
+type BlockNotFoundError struct {
+	// Endorser is the URL of the endorser
+	Endorser string
+	// Message is the message of the response
+	Message string
+}
+
+func (e *BlockNotFoundError) Error() string {
+	return fmt.Sprintf("block not found on %s: %s", e.Endorser, e.Message)
+}
+
+// IsBlockNotFound returns true if the given error (or one of the errors in a multi error) is a
+// BlockNotFoundError, in which case the block may be polled for until it's produced
+func IsBlockNotFound(err error) bool {
+	if errs, ok := err.(multi.Errors); ok {
+		for _, e := range errs {
+			if IsBlockNotFound(e) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := errors.Cause(err).(*BlockNotFoundError)
+	return ok
+}
+
+// isBlockRequest returns true if the request queries a block. Only the function is checked since the
+// name of the qscc system chaincode may be overridden (see WithQSCCName).
+func isBlockRequest(request fab.ChaincodeInvokeRequest) bool {
+	return request.Fcn == qsccBlockByNumber || request.Fcn == qsccBlockByHash || request.Fcn == qsccBlockByTxID
+}
+
+// extractBlockNotFound removes the responses that report that the block doesn't exist and
+// returns a BlockNotFoundError for each of them along with the given errors
+func extractBlockNotFound(responses []*fab.TransactionProposalResponse, errs error) ([]*fab.TransactionProposalResponse, error) {
+	remaining := responses[:0]
+	for _, response := range responses {
+		if response.Status != http.StatusOK {
+			if message := response.ProposalResponse.GetResponse().GetMessage(); isBlockNotFoundMessage(message) {
+				errs = multi.Append(errs, &BlockNotFoundError{Endorser: response.Endorser, Message: message})
+				continue
+			}
+		}
+		remaining = append(remaining, response)
+	}
+	return remaining, errs
+}
+
+func isBlockNotFoundMessage(message string) bool {
+	for _, m := range blockNotFoundMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+	return false
+}
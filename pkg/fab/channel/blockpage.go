@@ -0,0 +1,136 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+const blockCursorVersion = 1
+
+// blockCursor is the decoded form of the opaque cursor used by QueryBlockPage
+type blockCursor struct {
+	Version int    `json:"v"`
+	Next    uint64 `json:"next"`
+}
+
+// QueryBlockPage queries the ledger for a page of consecutive blocks starting at the position
+// encoded in the given cursor. An empty cursor starts at the genesis block. At most pageSize blocks
+// are returned, along with a cursor for the next page which may be persisted in order to resume
+// the iteration later (for example, after a restart). If the end of the ledger has been reached then
+// no blocks are returned and the returned cursor is the same as the given cursor.
+// The targets must agree (according to the verifier) on the contents of each block.
+func (c *Ledger) QueryBlockPage(reqCtx reqContext.Context, cursor string, pageSize int, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*common.Block, string, error) {
+	if pageSize <= 0 {
+		return nil, cursor, errors.New("page size must be greater than zero")
+	}
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, cursor, err
+	}
+	if len(targets) == 0 {
+		return nil, cursor, errors.New("target(s) required")
+	}
+
+	next, err := decodeBlockCursor(cursor)
+	if err != nil {
+		return nil, cursor, err
+	}
+
+	height, err := c.queryMinHeight(reqCtx, targets, verifier)
+	if err != nil {
+		return nil, cursor, err
+	}
+
+	var blocks []*common.Block
+	for ; next < height && len(blocks) < pageSize; next++ {
+		block, err := c.queryMatchingBlock(reqCtx, next, targets, verifier)
+		if err != nil {
+			// Return the blocks retrieved so far along with a cursor for the failed block
+			return blocks, encodeBlockCursor(next), errors.WithMessage(err, "query block page failed")
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, encodeBlockCursor(next), nil
+}
+
+// queryMinHeight returns the lowest block height reported by the targets
+// so that all blocks below the height are available on all targets
+func (c *Ledger) queryMinHeight(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (uint64, error) {
+	responses, err := c.QueryInfo(reqCtx, targets, verifier)
+	if len(responses) == 0 {
+		if err == nil {
+			err = errors.New("no responses from targets")
+		}
+		return 0, errors.WithMessage(err, "QueryInfo failed")
+	}
+
+	height := responses[0].BCI.Height
+	for _, r := range responses[1:] {
+		if r.BCI.Height < height {
+			height = r.BCI.Height
+		}
+	}
+	return height, nil
+}
+
+// queryMatchingBlock queries the targets for the given block and returns the block if all responses match
+func (c *Ledger) queryMatchingBlock(reqCtx reqContext.Context, blockNumber uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.Block, error) {
+	cir := createBlockByNumberInvokeRequest(c.opts.qsccName, c.chName, blockNumber)
+	tprs, err := c.queryChaincode(reqCtx, cir, targets, verifier)
+	if len(tprs) == 0 {
+		if err == nil {
+			err = errors.New("no responses from targets")
+		}
+		return nil, errors.WithMessage(err, fmt.Sprintf("query for block %d failed", blockNumber))
+	}
+
+	if verifier != nil {
+		if err := verifier.Match(tprs); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("responses for block %d do not match", blockNumber))
+		}
+	}
+
+	return createCommonBlock(tprs[0])
+}
+
+func encodeBlockCursor(next uint64) string {
+	// Marshalling of the cursor can't fail so the error is ignored
+	bytes, _ := json.Marshal(&blockCursor{Version: blockCursorVersion, Next: next})
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func decodeBlockCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid block cursor")
+	}
+
+	c := &blockCursor{}
+	if err := json.Unmarshal(bytes, c); err != nil {
+		return 0, errors.Wrap(err, "invalid block cursor")
+	}
+
+	if c.Version != blockCursorVersion {
+		return 0, errors.Errorf("unsupported block cursor version [%d]", c.Version)
+	}
+
+	return c.Next, nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/protoutil"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	"github.com/pkg/errors"
+)
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// VerifyBlockOrdererSignatures verifies the orderer signatures in the metadata of the given block.
+// The block must contain at least one signature and each signature must have been created by an
+// identity of one of the given orderer MSPs (keyed by MSP ID) over the signature metadata value, the
+// signature header and the ASN.1 encoding of the block header. Only ECDSA signatures are supported.
+// Note that the expiry of the signing certificates is not checked since the block may have been
+// signed before the certificate expired.
+func VerifyBlockOrdererSignatures(block *common.Block, ordererMSPs map[string]*mb.FabricMSPConfig) error {
+	if block == nil || block.Header == nil {
+		return errors.New("block header is required")
+	}
+	if block.Metadata == nil || len(block.Metadata.Metadata) <= int(common.BlockMetadataIndex_SIGNATURES) {
+		return errors.Errorf("block %d has no signature metadata", block.Header.Number)
+	}
+
+	metadata := &common.Metadata{}
+	if err := proto.Unmarshal(block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES], metadata); err != nil {
+		return errors.Wrapf(err, "unmarshal of signature metadata of block %d failed", block.Header.Number)
+	}
+	if len(metadata.Signatures) == 0 {
+		return errors.Errorf("block %d is not signed", block.Header.Number)
+	}
+
+	headerBytes, err := protoutil.BlockHeaderBytes(block.Header)
+	if err != nil {
+		return err
+	}
+
+	for _, signature := range metadata.Signatures {
+		data := concatBytes(metadata.Value, signature.SignatureHeader, headerBytes)
+		if err := verifyOrdererSignature(signature, data, ordererMSPs); err != nil {
+			return errors.WithMessage(err, "invalid orderer signature on block")
+		}
+	}
+
+	return nil
+}
+
+func verifyOrdererSignature(signature *common.MetadataSignature, data []byte, ordererMSPs map[string]*mb.FabricMSPConfig) error {
+	sigHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(signature.SignatureHeader, sigHeader); err != nil {
+		return errors.Wrap(err, "unmarshal of signature header failed")
+	}
+
+	sID := &mb.SerializedIdentity{}
+	if err := proto.Unmarshal(sigHeader.Creator, sID); err != nil {
+		return errors.Wrap(err, "unmarshal of signer identity failed")
+	}
+
+	mspConfig, ok := ordererMSPs[sID.Mspid]
+	if !ok {
+		return errors.Errorf("signer MSP [%s] is not a trusted orderer MSP", sID.Mspid)
+	}
+
+	return verifyIdentitySignature(sID, mspConfig, signature.Signature, data)
+}
+
+// verifyIdentitySignature verifies that the identity was issued by the MSP and that the signature
+// was created by the identity over the given data
+func verifyIdentitySignature(sID *mb.SerializedIdentity, mspConfig *mb.FabricMSPConfig, signature, data []byte) error {
+	cert, err := parseCertificate(sID.IdBytes)
+	if err != nil {
+		return errors.WithMessage(err, "invalid signer certificate")
+	}
+
+	if err := verifyCertificate(cert, mspConfig); err != nil {
+		return errors.WithMessage(err, "signer certificate is not issued by MSP "+sID.Mspid)
+	}
+
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+
+	sig := &ecdsaSignature{}
+	if _, err := asn1.Unmarshal(signature, sig); err != nil {
+		return errors.Wrap(err, "unmarshal of ECDSA signature failed")
+	}
+	if sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+		return errors.New("invalid ECDSA signature")
+	}
+
+	digest := sha256.Sum256(data)
+	if !ecdsa.Verify(publicKey, digest[:], sig.R, sig.S) {
+		return errors.Errorf("signature verification failed for signer of MSP [%s]", sID.Mspid)
+	}
+
+	return nil
+}
+
+// verifyCertificate verifies that the certificate chains to one of the root certificates of the MSP
+func verifyCertificate(cert *x509.Certificate, mspConfig *mb.FabricMSPConfig) error {
+	roots := x509.NewCertPool()
+	for _, root := range mspConfig.RootCerts {
+		rootCert, err := parseCertificate(root)
+		if err != nil {
+			return errors.WithMessage(err, "invalid MSP root certificate")
+		}
+		roots.AddCert(rootCert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range mspConfig.IntermediateCerts {
+		intermediateCert, err := parseCertificate(intermediate)
+		if err != nil {
+			return errors.WithMessage(err, "invalid MSP intermediate certificate")
+		}
+		intermediates.AddCert(intermediateCert)
+	}
+
+	// Verify as of the start of the validity period so that expired certificates are accepted
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   cert.NotBefore.Add(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+func parseCertificate(certBytes []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certBytes)
+	if block == nil {
+		return nil, errors.New("PEM decoding of certificate failed")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing of certificate failed")
+	}
+	return cert, nil
+}
+
+func concatBytes(slices ...[]byte) []byte {
+	var result []byte
+	for _, s := range slices {
+		result = append(result, s...)
+	}
+	return result
+}
+
+// BlockSignatureVerifier is a ResponseVerifier for block queries (such as QueryBlock) that
+// rejects blocks that weren't signed by one of the trusted orderer MSPs
+type BlockSignatureVerifier struct {
+	ordererMSPs map[string]*mb.FabricMSPConfig
+}
+
+// NewBlockSignatureVerifier returns a ResponseVerifier that verifies the orderer signatures
+// of the block in each response against the given orderer MSPs (keyed by MSP ID)
+func NewBlockSignatureVerifier(ordererMSPs map[string]*mb.FabricMSPConfig) *BlockSignatureVerifier {
+	return &BlockSignatureVerifier{ordererMSPs: ordererMSPs}
+}
+
+// Verify verifies the orderer signatures of the block in the response
+func (v *BlockSignatureVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	block, err := createCommonBlock(response)
+	if err != nil {
+		return err
+	}
+	return VerifyBlockOrdererSignatures(block, v.ordererMSPs)
+}
+
+// Match is not used by this verifier and always succeeds
+func (v *BlockSignatureVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/utils"
+	"github.com/pkg/errors"
+)
+
+// QueryBlockTimestamps queries the ledger for the blocks in the given (inclusive) range and returns
+// a representative timestamp for each block, keyed by block number. The timestamp is taken from the
+// channel header of the first transaction in the block. Note that this timestamp is set by the client
+// that created the transaction (or, for config blocks, by the submitter of the config update or the
+// orderer) and not when the block was cut, so it's subject to client clock skew and precedes the time
+// at which the block was created by at least the endorsement and ordering latency. Blocks whose first
+// transaction doesn't carry a timestamp (or that contain no transactions) are omitted from the result
+// and reported in the returned error. If a block can't be retrieved then the timestamps extracted so far
+// are returned along with the error.
+func (c *Ledger) QueryBlockTimestamps(reqCtx reqContext.Context, start, end uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) (map[uint64]time.Time, error) {
+	if start > end {
+		return nil, errors.Errorf("invalid block range [%d, %d]", start, end)
+	}
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps := make(map[uint64]time.Time)
+	var errs error
+	for blockNum := start; blockNum <= end; blockNum++ {
+		block, err := c.queryMatchingBlock(reqCtx, blockNum, targets, verifier)
+		if err != nil {
+			return timestamps, multi.Append(errs, errors.WithMessage(err, "query block timestamps failed"))
+		}
+
+		timestamp, err := blockTimestamp(block)
+		if err != nil {
+			errs = multi.Append(errs, errors.WithMessage(err, fmt.Sprintf("no timestamp for block %d", blockNum)))
+		} else {
+			timestamps[blockNum] = timestamp
+		}
+
+		if blockNum == end {
+			// Avoid overflow if end is the maximum block number
+			break
+		}
+	}
+
+	return timestamps, errs
+}
+
+// blockTimestamp returns the timestamp of the channel header of the first transaction in the block
+func blockTimestamp(block *common.Block) (time.Time, error) {
+	if block.Data == nil || len(block.Data.Data) == 0 {
+		return time.Time{}, errors.New("block contains no transactions")
+	}
+
+	env, err := utils.GetEnvelopeFromBlock(block.Data.Data[0])
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error extracting Envelope from block")
+	}
+
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error extracting Payload from envelope")
+	}
+	if payload.Header == nil {
+		return time.Time{}, errors.New("missing payload header")
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return time.Time{}, errors.Wrap(err, "error extracting ChannelHeader from payload")
+	}
+	if channelHeader.Timestamp == nil {
+		return time.Time{}, errors.New("channel header of first transaction has no timestamp")
+	}
+
+	timestamp, err := ptypes.Timestamp(channelHeader.Timestamp)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid timestamp in channel header")
+	}
+	return timestamp, nil
+}
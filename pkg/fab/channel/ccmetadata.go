@@ -0,0 +1,131 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/common/ccprovider"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+const lsccChaincodeData = "getccdata"
+
+// ChaincodeMetadata is the chaincode data that's recorded by lscc when a chaincode is instantiated
+type ChaincodeMetadata struct {
+	Name    string
+	Version string
+	Escc    string
+	Vscc    string
+	// Policy is the marshalled endorsement policy (a common.SignaturePolicyEnvelope)
+	Policy []byte
+	// InstantiationPolicy is the marshalled instantiation policy (a common.SignaturePolicyEnvelope)
+	InstantiationPolicy []byte
+	// ID is the fingerprint of the chaincode package
+	ID []byte
+}
+
+// InstantiatedChaincodes is the result of QueryInstantiatedChaincodesWithMetadata
+type InstantiatedChaincodes struct {
+	// Responses contains the response of each target, as returned by QueryInstantiatedChaincodes
+	Responses []*pb.ChaincodeQueryResponse
+	// Metadata contains the chaincode data of the chaincodes in the responses, keyed by chaincode
+	// name. Chaincodes whose data couldn't be read are missing (see Warnings).
+	Metadata map[string]*ChaincodeMetadata
+	// Warnings describes the chaincodes whose data couldn't be read, for example, since the
+	// caller isn't permitted to read the chaincode data from lscc
+	Warnings []string
+}
+
+// QueryInstantiatedChaincodesWithMetadata queries the instantiated chaincodes on this channel, as
+// QueryInstantiatedChaincodes does, and then queries lscc (getccdata) for the chaincode data of each of the
+// chaincodes, which includes the endorsement policy of the chaincode. The chaincode data is queried from the
+// same targets and the first verified response is used. If the data of a chaincode can't be read (lscc
+// requires the caller to be a channel reader) then a warning is returned in the result rather than an error.
+// Chaincode data is only available with the legacy lifecycle (see WithChaincodeLifecycle).
+func (c *Ledger) QueryInstantiatedChaincodesWithMetadata(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*InstantiatedChaincodes, error) {
+	responses, errs := c.QueryInstantiatedChaincodes(reqCtx, targets, verifier)
+	if len(responses) == 0 {
+		return nil, errs
+	}
+
+	result := &InstantiatedChaincodes{
+		Responses: responses,
+		Metadata:  make(map[string]*ChaincodeMetadata),
+	}
+
+	if c.opts.lifecycle == NewLifecycle {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("chaincode data isn't available with the %s chaincode lifecycle", c.opts.lifecycle))
+		return result, errs
+	}
+
+	for _, name := range chaincodeNames(responses) {
+		metadata, err := c.queryChaincodeMetadata(reqCtx, name, targets, verifier)
+		if err != nil {
+			logger.Debugf("Unable to read the chaincode data of chaincode [%s]: %s", name, err)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("unable to read the chaincode data of chaincode [%s]: %s", name, err))
+			continue
+		}
+		result.Metadata[name] = metadata
+	}
+
+	return result, errs
+}
+
+// queryChaincodeMetadata returns the chaincode data of the given chaincode from the first verified response
+func (c *Ledger) queryChaincodeMetadata(reqCtx reqContext.Context, name string, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*ChaincodeMetadata, error) {
+	cir := fab.ChaincodeInvokeRequest{
+		ChaincodeID: c.opts.lsccName,
+		Fcn:         lsccChaincodeData,
+		Args:        [][]byte{[]byte(c.chName), []byte(name)},
+	}
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
+
+	for _, tpr := range tprs {
+		data := &ccprovider.ChaincodeData{}
+		if err := proto.Unmarshal(tpr.ProposalResponse.GetResponse().Payload, data); err != nil {
+			errs = multi.Append(errs, errors.Wrapf(err, "unmarshal of chaincode data from target [%s] failed", tpr.Endorser))
+			continue
+		}
+		return &ChaincodeMetadata{
+			Name:                data.Name,
+			Version:             data.Version,
+			Escc:                data.Escc,
+			Vscc:                data.Vscc,
+			Policy:              data.Policy,
+			InstantiationPolicy: data.InstantiationPolicy,
+			ID:                  data.Id,
+		}, nil
+	}
+
+	if errs == nil {
+		return nil, errors.New("no chaincode data was returned")
+	}
+	return nil, errs
+}
+
+// chaincodeNames returns the distinct names of the chaincodes in the responses in sorted order
+func chaincodeNames(responses []*pb.ChaincodeQueryResponse) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, response := range responses {
+		for _, chaincode := range response.Chaincodes {
+			if !seen[chaincode.Name] {
+				seen[chaincode.Name] = true
+				names = append(names, chaincode.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,115 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+const chaincodeTokenVersion = 1
+
+// chaincodeToken is the decoded form of the opaque continuation token used by QueryInstantiatedChaincodesPage
+type chaincodeToken struct {
+	Version int    `json:"v"`
+	After   string `json:"after"`
+}
+
+// QueryInstantiatedChaincodesPage queries the instantiated chaincodes on this channel one page at a time.
+// The chaincodes are ordered by name and at most pageSize chaincodes, following the chaincode recorded in
+// the given continuation token, are returned in the response of each target. An empty token starts with the
+// first chaincode. The returned token is empty if there are no more chaincodes. Otherwise it continues after the
+// lowest last chaincode of the targets that have more chaincodes, so that no chaincode is skipped if the responses
+// of the targets differ (in which case some chaincodes may be returned again for the other targets). Note that lscc (and _lifecycle) return all of the chaincodes
+// to the client, so paging limits the size of the result but not of the responses from the targets.
+func (c *Ledger) QueryInstantiatedChaincodesPage(reqCtx reqContext.Context, token string, pageSize int, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*pb.ChaincodeQueryResponse, string, error) {
+	if pageSize <= 0 {
+		return nil, "", errors.New("page size must be greater than zero")
+	}
+
+	after, err := decodeChaincodeToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	responses, errs := c.QueryInstantiatedChaincodes(reqCtx, targets, verifier)
+
+	var last string
+	more := false
+	pages := make([]*pb.ChaincodeQueryResponse, len(responses))
+	for i, response := range responses {
+		page, hasMore := chaincodePage(response.Chaincodes, after, pageSize)
+		pages[i] = &pb.ChaincodeQueryResponse{Chaincodes: page}
+		if !hasMore {
+			continue
+		}
+		// A page with more chaincodes is full so its last chaincode follows the token's chaincode
+		if pageLast := page[len(page)-1].Name; !more || pageLast < last {
+			last = pageLast
+		}
+		more = true
+	}
+
+	if !more {
+		return pages, "", errs
+	}
+	return pages, encodeChaincodeToken(last), errs
+}
+
+// chaincodePage returns up to pageSize chaincodes (ordered by name) whose name follows the given name
+// and whether there are more chaincodes after the page
+func chaincodePage(chaincodes []*pb.ChaincodeInfo, after string, pageSize int) ([]*pb.ChaincodeInfo, bool) {
+	var remaining []*pb.ChaincodeInfo
+	for _, chaincode := range chaincodes {
+		if after == "" || chaincode.Name > after {
+			remaining = append(remaining, chaincode)
+		}
+	}
+	sort.SliceStable(remaining, func(i, j int) bool { return remaining[i].Name < remaining[j].Name })
+
+	if len(remaining) > pageSize {
+		return remaining[:pageSize], true
+	}
+	return remaining, false
+}
+
+func encodeChaincodeToken(after string) string {
+	// Marshalling of the token can't fail so the error is ignored
+	bytes, _ := json.Marshal(&chaincodeToken{Version: chaincodeTokenVersion, After: after})
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func decodeChaincodeToken(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+
+	bytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid chaincode continuation token")
+	}
+
+	t := &chaincodeToken{}
+	if err := json.Unmarshal(bytes, t); err != nil {
+		return "", errors.Wrap(err, "invalid chaincode continuation token")
+	}
+
+	if t.Version != chaincodeTokenVersion {
+		return "", errors.Errorf("unsupported chaincode continuation token version [%d]", t.Version)
+	}
+	if t.After == "" {
+		return "", errors.New("invalid chaincode continuation token: missing chaincode name")
+	}
+
+	return t.After, nil
+}
@@ -0,0 +1,47 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// limitedTarget only sends a request to the target when a slot of the shared semaphore is available
+type limitedTarget struct {
+	fab.ProposalProcessor
+	semaphore chan struct{}
+}
+
+// ProcessTransactionProposal waits for a free slot (or for the request context to be done)
+// before delegating to the target
+func (t *limitedTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	select {
+	case t.semaphore <- struct{}{}:
+	case <-reqCtx.Done():
+		return nil, errors.Wrap(reqCtx.Err(), "waiting to send proposal failed")
+	}
+	defer func() { <-t.semaphore }()
+
+	return t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+}
+
+// withConcurrencyLimit wraps the targets so that at most the given number of requests are in flight at a time
+func withConcurrencyLimit(targets []fab.ProposalProcessor, limit int) []fab.ProposalProcessor {
+	if len(targets) <= limit {
+		return targets
+	}
+
+	semaphore := make(chan struct{}, limit)
+	limitedTargets := make([]fab.ProposalProcessor, len(targets))
+	for i, target := range targets {
+		limitedTargets[i] = &limitedTarget{ProposalProcessor: target, semaphore: semaphore}
+	}
+	return limitedTargets
+}
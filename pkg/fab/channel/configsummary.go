@@ -0,0 +1,170 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	channelConfig "github.com/hyperledger/fabric-sdk-go/internal/github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+const (
+	ordererGroupKey     = channelConfig.OrdererGroupKey
+	applicationGroupKey = "Application"
+)
+
+// ConfigSummary contains the commonly used values of a channel config so that callers don't need
+// to walk the config group tree themselves
+type ConfigSummary struct {
+	// Envelope is the raw config envelope from which the summary was parsed
+	Envelope *common.ConfigEnvelope
+	// Sequence is the sequence number of the config
+	Sequence uint64
+	// OrdererAddresses contains the addresses of the orderers of the channel
+	OrdererAddresses []string
+	// OrdererOrgs contains the orderer organizations, sorted by MSP ID
+	OrdererOrgs []*OrgSummary
+	// ApplicationOrgs contains the application (peer) organizations, sorted by MSP ID
+	ApplicationOrgs []*OrgSummary
+}
+
+// OrgSummary contains the MSP of an organization in the channel config
+type OrgSummary struct {
+	// Name is the name of the organization's config group
+	Name string
+	// MSPID is the ID of the organization's MSP
+	MSPID string
+	// RootCerts contains the PEM encoded root CA certificates of the MSP
+	RootCerts [][]byte
+	// IntermediateCerts contains the PEM encoded intermediate CA certificates of the MSP
+	IntermediateCerts [][]byte
+	// TLSRootCerts contains the PEM encoded TLS root CA certificates of the MSP
+	TLSRootCerts [][]byte
+	// AnchorPeers contains the anchor peers of an application organization
+	AnchorPeers []*fab.OrgAnchorPeer
+}
+
+// MSPIDs returns the MSP IDs of the application organizations followed by those of the orderer organizations
+func (s *ConfigSummary) MSPIDs() []string {
+	var mspIDs []string
+	for _, org := range s.ApplicationOrgs {
+		mspIDs = append(mspIDs, org.MSPID)
+	}
+	for _, org := range s.OrdererOrgs {
+		mspIDs = append(mspIDs, org.MSPID)
+	}
+	return mspIDs
+}
+
+// QueryConfigSummary returns the summary of the current configuration of the channel
+// (see QueryConfigBlock and ParseConfigSummary)
+func (c *Ledger) QueryConfigSummary(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*ConfigSummary, error) {
+	configEnvelope, err := c.QueryConfigBlock(reqCtx, targets, verifier)
+	if err != nil && !IsStaleResult(err) {
+		return nil, err
+	}
+
+	summary, parseErr := ParseConfigSummary(configEnvelope)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return summary, err
+}
+
+// ParseConfigSummary parses the orderer addresses and the MSPs of the organizations from the given config envelope
+func ParseConfigSummary(configEnvelope *common.ConfigEnvelope) (*ConfigSummary, error) {
+	if configEnvelope == nil || configEnvelope.Config == nil || configEnvelope.Config.ChannelGroup == nil {
+		return nil, errors.New("config envelope does not contain a channel group")
+	}
+
+	channelGroup := configEnvelope.Config.ChannelGroup
+	summary := &ConfigSummary{
+		Envelope: configEnvelope,
+		Sequence: configEnvelope.Config.Sequence,
+	}
+
+	if value, ok := channelGroup.Values[channelConfig.OrdererAddressesKey]; ok {
+		addresses := &common.OrdererAddresses{}
+		if err := proto.Unmarshal(value.Value, addresses); err != nil {
+			return nil, errors.Wrap(err, "unmarshal orderer addresses from config failed")
+		}
+		summary.OrdererAddresses = addresses.Addresses
+	}
+
+	var err error
+	if summary.OrdererOrgs, err = parseOrgSummaries(channelGroup.Groups[ordererGroupKey]); err != nil {
+		return nil, errors.WithMessage(err, "parsing orderer organizations failed")
+	}
+	if summary.ApplicationOrgs, err = parseOrgSummaries(channelGroup.Groups[applicationGroupKey]); err != nil {
+		return nil, errors.WithMessage(err, "parsing application organizations failed")
+	}
+
+	return summary, nil
+}
+
+func parseOrgSummaries(group *common.ConfigGroup) ([]*OrgSummary, error) {
+	if group == nil {
+		return nil, nil
+	}
+
+	var orgs []*OrgSummary
+	for name, orgGroup := range group.Groups {
+		org, err := parseOrgSummary(name, orgGroup)
+		if err != nil {
+			return nil, err
+		}
+		if org != nil {
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].MSPID < orgs[j].MSPID })
+	return orgs, nil
+}
+
+// parseOrgSummary returns the summary of the organization's group or nil if the group doesn't define an MSP
+func parseOrgSummary(name string, group *common.ConfigGroup) (*OrgSummary, error) {
+	value, ok := group.Values[channelConfig.MSPKey]
+	if !ok {
+		return nil, nil
+	}
+
+	mspConfig := &mb.MSPConfig{}
+	if err := proto.Unmarshal(value.Value, mspConfig); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal MSPConfig of organization [%s] failed", name)
+	}
+	fabricMSPConfig := &mb.FabricMSPConfig{}
+	if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal FabricMSPConfig of organization [%s] failed", name)
+	}
+
+	org := &OrgSummary{
+		Name:              name,
+		MSPID:             fabricMSPConfig.Name,
+		RootCerts:         fabricMSPConfig.RootCerts,
+		IntermediateCerts: fabricMSPConfig.IntermediateCerts,
+		TLSRootCerts:      fabricMSPConfig.TlsRootCerts,
+	}
+
+	if value, ok := group.Values[channelConfig.AnchorPeersKey]; ok {
+		anchorPeers := &pb.AnchorPeers{}
+		if err := proto.Unmarshal(value.Value, anchorPeers); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal anchor peers of organization [%s] failed", name)
+		}
+		for _, anchorPeer := range anchorPeers.AnchorPeers {
+			org.AnchorPeers = append(org.AnchorPeers, &fab.OrgAnchorPeer{Org: name, Host: anchorPeer.Host, Port: anchorPeer.Port})
+		}
+	}
+
+	return org, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	"github.com/pkg/errors"
+)
+
+// SignatureInfo contains the identity of a signer of a config update along with the signature
+type SignatureInfo struct {
+	MSPID string
+	// Certificate is the (PEM encoded) certificate of the signer
+	Certificate []byte
+	Signature   []byte
+}
+
+// QueryLastConfigUpdate queries the current config block of the channel and returns the config update
+// that produced the current config along with the signatures that authorized the update. Note that the
+// signatures are not verified. An error is returned if the current config is the genesis config, which
+// was not produced by an update.
+func (c *Ledger) QueryLastConfigUpdate(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.ConfigUpdate, []*SignatureInfo, error) {
+	configEnvelope, err := c.QueryConfigBlock(reqCtx, targets, verifier)
+	if err != nil && !IsStaleResult(err) {
+		return nil, nil, err
+	}
+
+	if configEnvelope.LastUpdate == nil {
+		return nil, nil, errors.New("config envelope does not contain a last update (the config may be the genesis config)")
+	}
+
+	configUpdate, signatures, extractErr := extractConfigUpdate(configEnvelope.LastUpdate)
+	if extractErr != nil {
+		return nil, nil, extractErr
+	}
+	return configUpdate, signatures, err
+}
+
+// extractConfigUpdate decodes the config update and signatures from a config update transaction
+func extractConfigUpdate(envelope *common.Envelope) (*common.ConfigUpdate, []*SignatureInfo, error) {
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshal payload from last update failed")
+	}
+
+	configUpdateEnvelope := &common.ConfigUpdateEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configUpdateEnvelope); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshal config update envelope failed")
+	}
+
+	configUpdate := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(configUpdateEnvelope.ConfigUpdate, configUpdate); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshal config update failed")
+	}
+
+	var signatures []*SignatureInfo
+	for _, configSignature := range configUpdateEnvelope.Signatures {
+		sigHeader := &common.SignatureHeader{}
+		if err := proto.Unmarshal(configSignature.SignatureHeader, sigHeader); err != nil {
+			return nil, nil, errors.Wrap(err, "unmarshal of config signature header failed")
+		}
+
+		sID := &mb.SerializedIdentity{}
+		if err := proto.Unmarshal(sigHeader.Creator, sID); err != nil {
+			return nil, nil, errors.Wrap(err, "unmarshal of config signer identity failed")
+		}
+
+		signatures = append(signatures, &SignatureInfo{
+			MSPID:       sID.Mspid,
+			Certificate: sID.IdBytes,
+			Signature:   configSignature.Signature,
+		})
+	}
+
+	return configUpdate, signatures, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+)
+
+// TargetKeyFunc returns the logical identity of a target. Targets with the same (non-empty) key are
+// considered to be the same peer and only the first of them is queried. An empty key means that the
+// identity of the target is unknown and the target is never de-duplicated.
+type TargetKeyFunc func(target fab.ProposalProcessor) string
+
+type mspIDProvider interface {
+	MSPID() string
+}
+
+// DefaultTargetKey identifies a target by its MSP ID and endpoint, where the endpoint is the
+// host and port of the target's URL (the protocol is ignored and the host is compared case
+// insensitively). Targets that don't have a URL aren't identified.
+func DefaultTargetKey(target fab.ProposalProcessor) string {
+	p, ok := target.(urlProvider)
+	if !ok || p.URL() == "" {
+		return ""
+	}
+
+	var mspID string
+	if m, ok := target.(mspIDProvider); ok {
+		mspID = m.MSPID()
+	}
+	return mspID + "@" + strings.ToLower(endpoint.ToAddress(p.URL()))
+}
+
+// deduplicateTargets removes the targets that have the same logical identity as a previous
+// target so that a peer that was included more than once only responds once
+func deduplicateTargets(channelID string, targets []fab.ProposalProcessor, keyFunc TargetKeyFunc) []fab.ProposalProcessor {
+	seen := make(map[string]struct{})
+	var deduplicated []fab.ProposalProcessor
+	var duplicates []string
+	for _, target := range targets {
+		key := keyFunc(target)
+		if key != "" {
+			if _, ok := seen[key]; ok {
+				duplicates = append(duplicates, key)
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		deduplicated = append(deduplicated, target)
+	}
+
+	if len(duplicates) > 0 {
+		logger.Warnf("Duplicate targets were collapsed for channel [%s]: %v", channelID, duplicates)
+	}
+	return deduplicated
+}
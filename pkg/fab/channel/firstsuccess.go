@@ -0,0 +1,83 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// blockResult is the result of querying a single target for a block
+type blockResult struct {
+	block *common.Block
+	err   error
+}
+
+// QueryBlockFirstSuccess queries the targets for the block with the given number and returns the
+// first block that is successfully verified, rather than waiting for all of the targets to respond
+// (as QueryBlock does). Each target is queried separately, so the verifier verifies and matches the
+// response of a single target. Once a block is returned the outstanding proposals are cancelled. An
+// error is only returned if none of the targets returns a verified block, in which case the errors
+// of all of the targets are returned.
+func (c *Ledger) QueryBlockFirstSuccess(reqCtx reqContext.Context, blockNumber uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.Block, error) {
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+	targets = deduplicateTargets(c.chName, targets, c.opts.targetKey)
+	if len(targets) == 0 {
+		return nil, errors.New("target(s) required")
+	}
+
+	ctx, cancel := reqContext.WithCancel(reqCtx)
+	// Cancelling the context on return cancels the proposals that are still outstanding
+	defer cancel()
+
+	// The channel is buffered so that the queries that complete after the first success don't block
+	resultch := make(chan blockResult, len(targets))
+	for _, target := range targets {
+		go func(target fab.ProposalProcessor) {
+			block, err := c.queryBlockFromTarget(ctx, blockNumber, target, verifier)
+			resultch <- blockResult{block: block, err: err}
+		}(target)
+	}
+
+	var errs error
+	for range targets {
+		result := <-resultch
+		if result.err == nil {
+			return result.block, nil
+		}
+		errs = multi.Append(errs, result.err)
+	}
+	return nil, errors.WithMessage(errs, fmt.Sprintf("query for block %d failed on all targets", blockNumber))
+}
+
+// queryBlockFromTarget queries a single target for the block and verifies the response
+func (c *Ledger) queryBlockFromTarget(reqCtx reqContext.Context, blockNumber uint64, target fab.ProposalProcessor, verifier ResponseVerifier) (*common.Block, error) {
+	cir := createBlockByNumberInvokeRequest(c.opts.qsccName, c.chName, blockNumber)
+	tprs, err := c.queryTargets(reqCtx, cir, []fab.ProposalProcessor{target}, verifier)
+	if len(tprs) == 0 {
+		if err == nil {
+			err = errors.New("no response from target")
+		}
+		return nil, err
+	}
+
+	if verifier != nil {
+		if err := verifier.Match(tprs); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("failed to match response from %s", tprs[0].Endorser))
+		}
+	}
+
+	return createCommonBlock(tprs[0])
+}
@@ -0,0 +1,81 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// HeightRegressionError is returned by the FreshnessVerifier when an endorser reports
+// a ledger height that is lower than a height that it previously reported
+type HeightRegressionError struct {
+	Endorser       string
+	Height         uint64
+	PreviousHeight uint64
+}
+
+func (e *HeightRegressionError) Error() string {
+	return fmt.Sprintf("ledger height of endorser [%s] regressed from %d to %d", e.Endorser, e.PreviousHeight, e.Height)
+}
+
+// FreshnessVerifier is a stateful ResponseVerifier for QueryInfo responses that remembers the maximum
+// height reported by each endorser and rejects responses that report a lower height, which indicates that
+// the endorser's ledger was rolled back or replaced. A single instance should be used across queries
+// (it's safe for concurrent use).
+type FreshnessVerifier struct {
+	mutex   sync.Mutex
+	heights map[string]uint64
+}
+
+// NewFreshnessVerifier returns a new FreshnessVerifier
+func NewFreshnessVerifier() *FreshnessVerifier {
+	return &FreshnessVerifier{heights: make(map[string]uint64)}
+}
+
+// Verify rejects the response with a HeightRegressionError if the reported height is
+// lower than the maximum height previously reported by the endorser
+func (v *FreshnessVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	bci, err := createBlockchainInfo(response)
+	if err != nil {
+		return errors.WithMessage(err, "freshness verification requires a QueryInfo response")
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	previous, ok := v.heights[response.Endorser]
+	if ok && bci.Height < previous {
+		return &HeightRegressionError{Endorser: response.Endorser, Height: bci.Height, PreviousHeight: previous}
+	}
+
+	v.heights[response.Endorser] = bci.Height
+	return nil
+}
+
+// Match is not used by this verifier and always succeeds
+func (v *FreshnessVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
+
+// Reset forgets the heights of the given endorsers (or of all endorsers if none are given),
+// for example, after a peer's ledger was intentionally rebuilt
+func (v *FreshnessVerifier) Reset(endorsers ...string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if len(endorsers) == 0 {
+		v.heights = make(map[string]uint64)
+		return
+	}
+	for _, endorser := range endorsers {
+		delete(v.heights, endorser)
+	}
+}
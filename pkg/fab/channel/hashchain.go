@@ -0,0 +1,69 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/protoutil"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// BlockHeaderHash returns the hash of the block header, which is the SHA-256 hash of the ASN.1 encoding
+// of the header (as computed by Fabric). The hash of a block's header is the previous hash of the next block.
+func BlockHeaderHash(header *common.BlockHeader) ([]byte, error) {
+	return protoutil.BlockHeaderHash(header)
+}
+
+// BlockDataHash returns the hash of the block data, which is the SHA-256 hash of the concatenation of
+// the block's envelopes (as computed by Fabric)
+func BlockDataHash(data *common.BlockData) []byte {
+	var envelopes [][]byte
+	if data != nil {
+		envelopes = data.Data
+	}
+	hash := sha256.Sum256(concatBytes(envelopes...))
+	return hash[:]
+}
+
+// VerifyBlockHashChain verifies that the given blocks, which must be ordered by block number, form a valid
+// hash chain: the data hash in the header of each block must match the hash of the block's data, and the
+// previous hash of each block (other than the first) must match the header hash of the block before it.
+// The block numbers must also be consecutive. The index of the first block at which the chain breaks is
+// returned along with the error; -1 is returned if the chain is valid. Note that the first block is only
+// checked against its own data, so the caller must establish trust in the first block by other means
+// (for example, VerifyBlockOrdererSignatures).
+func VerifyBlockHashChain(blocks []*common.Block) (int, error) {
+	var previous *common.BlockHeader
+	for i, block := range blocks {
+		if block == nil || block.Header == nil {
+			return i, errors.Errorf("block at index %d has no header", i)
+		}
+
+		if !bytes.Equal(block.Header.DataHash, BlockDataHash(block.Data)) {
+			return i, errors.Errorf("data hash of block %d doesn't match the hash of its data", block.Header.Number)
+		}
+
+		if previous != nil {
+			if block.Header.Number != previous.Number+1 {
+				return i, errors.Errorf("block %d doesn't follow block %d", block.Header.Number, previous.Number)
+			}
+			previousHash, err := BlockHeaderHash(previous)
+			if err != nil {
+				return i, err
+			}
+			if !bytes.Equal(block.Header.PreviousHash, previousHash) {
+				return i, errors.Errorf("previous hash of block %d doesn't match the header hash of block %d", block.Header.Number, previous.Number)
+			}
+		}
+
+		previous = block.Header
+	}
+	return -1, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+	"github.com/pkg/errors"
+)
+
+// QueryHighestPeers queries the targets for their ledger height (see QueryInfo) and returns the targets
+// that report the maximum height, along with the height, so that subsequent queries (for example,
+// QueryBlock or QueryTransaction) may be routed to the most up-to-date peers. All of the targets at the
+// maximum height are returned, in the order of the given targets. The response of a target is mapped
+// back to the target by the target's address (the URL without the gRPC protocol); targets without a URL
+// are never selected. Errors from the targets that didn't respond are returned along with the selected targets.
+func (c *Ledger) QueryHighestPeers(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]fab.ProposalProcessor, uint64, error) {
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(targets) == 0 {
+		return nil, 0, errors.New("target(s) required")
+	}
+
+	responses, errs := c.QueryInfo(reqCtx, targets, verifier)
+	if IsStaleResult(errs) {
+		return nil, 0, errors.WithMessage(errs, "unable to determine the ledger height of the targets")
+	}
+
+	heights := make(map[string]uint64)
+	for _, r := range responses {
+		heights[endpoint.ToAddress(r.Endorser)] = r.BCI.Height
+	}
+
+	var maxHeight uint64
+	var highest []fab.ProposalProcessor
+	for _, target := range targets {
+		p, ok := target.(urlProvider)
+		if !ok {
+			continue
+		}
+		height, ok := heights[endpoint.ToAddress(p.URL())]
+		if !ok {
+			continue
+		}
+		if height > maxHeight || len(highest) == 0 {
+			maxHeight = height
+			highest = nil
+		}
+		if height == maxHeight {
+			highest = append(highest, target)
+		}
+	}
+
+	if len(highest) == 0 {
+		if errs == nil {
+			errs = errors.New("no responses from targets")
+		}
+		return nil, 0, errors.WithMessage(errs, "unable to determine the ledger height of the targets")
+	}
+
+	logger.Debugf("%d of %d target(s) are at the maximum height %d", len(highest), len(targets), maxHeight)
+	return highest, maxHeight, errs
+}
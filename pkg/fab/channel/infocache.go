@@ -0,0 +1,141 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+	"github.com/pkg/errors"
+)
+
+// infoCache holds the last BlockchainInfoResponse of each peer until the next block event. The responses are
+// keyed by peer address (the URL without the gRPC scheme) since that's how endorsers identify themselves.
+type infoCache struct {
+	eventService fab.EventService
+	reg          fab.Registration
+	closeOnce    sync.Once
+
+	mutex     sync.RWMutex
+	responses map[string]*fab.BlockchainInfoResponse
+	// generation is incremented whenever the cache is invalidated so that the responses
+	// of a query that was sent before a block event are not cached after the event
+	generation uint64
+	// disabled is set when the block event subscription ends, in which case nothing is cached
+	disabled bool
+}
+
+// newInfoCache subscribes to the filtered block events of the event service and
+// returns a cache that's invalidated whenever a block event is received
+func newInfoCache(eventService fab.EventService) (*infoCache, error) {
+	reg, eventch, err := eventService.RegisterFilteredBlockEvent()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to register for block events for the QueryInfo cache")
+	}
+
+	c := &infoCache{
+		eventService: eventService,
+		reg:          reg,
+		responses:    make(map[string]*fab.BlockchainInfoResponse),
+	}
+	go c.listen(eventch)
+	return c, nil
+}
+
+// listen invalidates the cache on each block event until the event channel is closed
+func (c *infoCache) listen(eventch <-chan *fab.FilteredBlockEvent) {
+	for event := range eventch {
+		if event.FilteredBlock != nil {
+			logger.Debugf("Invalidating QueryInfo cache on block %d", event.FilteredBlock.Number)
+		}
+		c.invalidate(false)
+	}
+
+	logger.Debugf("Block event subscription of the QueryInfo cache has ended; disabling the cache")
+	c.invalidate(true)
+}
+
+// close unregisters the block event subscription, which disables the cache
+func (c *infoCache) close() {
+	c.closeOnce.Do(func() {
+		c.eventService.Unregister(c.reg)
+	})
+}
+
+func (c *infoCache) invalidate(disable bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.responses = make(map[string]*fab.BlockchainInfoResponse)
+	c.generation++
+	if disable {
+		c.disabled = true
+	}
+}
+
+// lookup returns the cached responses of the given targets, the targets that have no cached
+// response and the current generation of the cache
+func (c *infoCache) lookup(targets []fab.ProposalProcessor) ([]*fab.BlockchainInfoResponse, []fab.ProposalProcessor, uint64) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var cached []*fab.BlockchainInfoResponse
+	var uncached []fab.ProposalProcessor
+	for _, target := range targets {
+		if p, ok := target.(urlProvider); ok {
+			if response, ok := c.responses[endpoint.ToAddress(p.URL())]; ok {
+				// Return a copy so that the cached response isn't modified by the caller
+				r := *response
+				cached = append(cached, &r)
+				continue
+			}
+		}
+		uncached = append(uncached, target)
+	}
+	return cached, uncached, c.generation
+}
+
+// put caches the responses unless the cache was invalidated after the given generation
+func (c *infoCache) put(generation uint64, responses []*fab.BlockchainInfoResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.disabled || c.generation != generation {
+		return
+	}
+	for _, response := range responses {
+		r := *response
+		c.responses[endpoint.ToAddress(response.Endorser)] = &r
+	}
+}
+
+// queryInfoCached returns the cached responses of the targets and queries the targets whose
+// responses aren't cached (or all targets if the cache is disabled)
+func (c *Ledger) queryInfoCached(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*fab.BlockchainInfoResponse, error) {
+	resolved, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) == 0 {
+		return c.queryInfo(reqCtx, targets, verifier)
+	}
+	resolved = deduplicateTargets(c.chName, resolved, c.opts.targetKey)
+
+	cached, uncached, generation := c.infoCache.lookup(resolved)
+	if len(uncached) == 0 {
+		logger.Debugf("Returning cached QueryInfo responses of %d target(s)", len(cached))
+		return cached, nil
+	}
+
+	responses, errs := c.queryInfo(reqCtx, uncached, verifier)
+	if !IsStaleResult(errs) {
+		c.infoCache.put(generation, responses)
+	}
+	return append(cached, responses...), errs
+}
@@ -0,0 +1,128 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"bytes"
+	reqContext "context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// PeerDivergence describes how the ledger of a peer diverges from the ledgers of the other peers
+type PeerDivergence struct {
+	Endorser string
+	Height   uint64
+	// Lag is the number of blocks by which the peer lags behind the maximum height
+	Lag uint64
+	// Forked is true if the peer is at the maximum height but its current block hash differs
+	// from the hash reported by most of the peers at the maximum height
+	Forked bool
+}
+
+// InfoDivergenceError is returned by QueryInfoConsensus if the peers don't agree on the height
+// and current block hash of the ledger
+type InfoDivergenceError struct {
+	// MaxHeight is the maximum height reported by the peers
+	MaxHeight uint64
+	// Heights contains the height reported by each peer
+	Heights map[string]uint64
+	// Divergences contains the peers that diverge, ordered by endorser
+	Divergences []*PeerDivergence
+}
+
+func (e *InfoDivergenceError) Error() string {
+	var divergences []string
+	for _, d := range e.Divergences {
+		if d.Forked {
+			divergences = append(divergences, fmt.Sprintf("%s forked at height %d", d.Endorser, d.Height))
+		} else {
+			divergences = append(divergences, fmt.Sprintf("%s lags by %d blocks", d.Endorser, d.Lag))
+		}
+	}
+	return fmt.Sprintf("peers diverge from max height %d: [%s] (heights: %v)", e.MaxHeight, strings.Join(divergences, ", "), e.Heights)
+}
+
+// QueryInfoConsensus queries the targets for the channel info and returns the height and current
+// block hash of the ledger if all of the targets agree on them. If the targets don't agree then an
+// InfoDivergenceError is returned which contains the height reported by each target and the targets
+// that lag behind the maximum height or that report a different current block hash (a fork). An
+// error is also returned if any of the targets fails to respond.
+func (c *Ledger) QueryInfoConsensus(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (uint64, []byte, error) {
+	responses, err := c.QueryInfo(reqCtx, targets, verifier)
+	if err != nil {
+		return 0, nil, errors.WithMessage(err, "QueryInfo failed")
+	}
+	if len(responses) == 0 {
+		return 0, nil, errors.New("no responses from targets")
+	}
+
+	return infoConsensus(responses)
+}
+
+func infoConsensus(responses []*fab.BlockchainInfoResponse) (uint64, []byte, error) {
+	// Order the responses so that ties between current block hashes are broken deterministically
+	responses = append([]*fab.BlockchainInfoResponse{}, responses...)
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Endorser < responses[j].Endorser })
+
+	heights := make(map[string]uint64)
+	var maxHeight uint64
+	for _, r := range responses {
+		heights[r.Endorser] = r.BCI.Height
+		if r.BCI.Height > maxHeight {
+			maxHeight = r.BCI.Height
+		}
+	}
+
+	// The current block hash that's reported by most of the peers at the maximum height
+	var hashes [][]byte
+	var counts []int
+	for _, r := range responses {
+		if r.BCI.Height != maxHeight {
+			continue
+		}
+		found := false
+		for i, hash := range hashes {
+			if bytes.Equal(hash, r.BCI.CurrentBlockHash) {
+				counts[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			hashes = append(hashes, r.BCI.CurrentBlockHash)
+			counts = append(counts, 1)
+		}
+	}
+	best := 0
+	for i, count := range counts {
+		if count > counts[best] {
+			best = i
+		}
+	}
+	currentBlockHash := hashes[best]
+
+	var divergences []*PeerDivergence
+	for _, r := range responses {
+		switch {
+		case r.BCI.Height < maxHeight:
+			divergences = append(divergences, &PeerDivergence{Endorser: r.Endorser, Height: r.BCI.Height, Lag: maxHeight - r.BCI.Height})
+		case !bytes.Equal(r.BCI.CurrentBlockHash, currentBlockHash):
+			divergences = append(divergences, &PeerDivergence{Endorser: r.Endorser, Height: r.BCI.Height, Forked: true})
+		}
+	}
+
+	if len(divergences) > 0 {
+		return 0, nil, &InfoDivergenceError{MaxHeight: maxHeight, Heights: heights, Divergences: divergences}
+	}
+
+	return maxHeight, currentBlockHash, nil
+}
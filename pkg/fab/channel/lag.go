@@ -0,0 +1,126 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/pkg/errors"
+)
+
+// LagRejectionEvent describes the targets that were rejected since their ledger height lagged
+// behind the maximum observed height by more than the configured maximum lag (see WithMaxLag)
+type LagRejectionEvent struct {
+	ChannelID string
+	MaxHeight uint64
+	MaxLag    uint64
+	// Rejected contains the height of each rejected target
+	Rejected map[string]uint64
+}
+
+// LagObserver may be implemented by an Observer in order to be notified of
+// the targets that were rejected for lagging too far behind
+type LagObserver interface {
+	TargetsLagging(event *LagRejectionEvent)
+}
+
+// isChannelInfoRequest returns true if the request is a QueryInfo request, in which case
+// lagging responses are filtered from the responses rather than by probing the targets. Only the
+// function is checked since the name of the qscc system chaincode may be overridden (see WithQSCCName).
+func isChannelInfoRequest(request fab.ChaincodeInvokeRequest) bool {
+	return request.Fcn == qsccChannelInfo
+}
+
+// filterLaggingResponses removes the responses whose height lags behind the maximum height of the responses
+func (c *Ledger) filterLaggingResponses(responses []*fab.BlockchainInfoResponse) ([]*fab.BlockchainInfoResponse, error) {
+	heights := make(map[string]uint64)
+	for _, r := range responses {
+		heights[r.Endorser] = r.BCI.Height
+	}
+
+	lagging, errs := c.laggingEndorsers(heights)
+	if len(lagging) == 0 {
+		return responses, nil
+	}
+
+	var filtered []*fab.BlockchainInfoResponse
+	for _, r := range responses {
+		if _, ok := lagging[r.Endorser]; !ok {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, errs
+}
+
+// excludeLaggingTargets probes the height of the targets and excludes the targets whose height lags
+// behind the maximum height. Targets that don't have a URL or that don't respond to the probe are kept.
+// Targets are matched to the endorsers of the probe responses by address (the URL without the gRPC scheme).
+func (c *Ledger) excludeLaggingTargets(reqCtx reqContext.Context, targets []fab.ProposalProcessor) ([]fab.ProposalProcessor, error) {
+	tprs, err := queryChaincode(reqCtx, c.chName, createChannelInfoInvokeRequest(c.opts.qsccName, c.chName), targets, nil, nil)
+	if err != nil {
+		logger.Debugf("Height probe for max lag returned error(s): %s", err)
+	}
+
+	heights := make(map[string]uint64)
+	for _, tpr := range tprs {
+		bci, err := createBlockchainInfo(tpr)
+		if err != nil {
+			continue
+		}
+		heights[endpoint.ToAddress(tpr.Endorser)] = bci.Height
+	}
+
+	lagging, errs := c.laggingEndorsers(heights)
+	if len(lagging) == 0 {
+		return targets, nil
+	}
+
+	var selected []fab.ProposalProcessor
+	for _, target := range targets {
+		if p, ok := target.(urlProvider); ok {
+			if _, ok := lagging[endpoint.ToAddress(p.URL())]; ok {
+				continue
+			}
+		}
+		selected = append(selected, target)
+	}
+	return selected, errs
+}
+
+// laggingEndorsers returns the endorsers whose height lags behind the maximum height by more than the
+// maximum lag. The rejections are logged and reported to the Observer if it implements LagObserver.
+func (c *Ledger) laggingEndorsers(heights map[string]uint64) (map[string]uint64, error) {
+	var maxHeight uint64
+	for _, height := range heights {
+		if height > maxHeight {
+			maxHeight = height
+		}
+	}
+
+	lagging := make(map[string]uint64)
+	var errs error
+	for endorser, height := range heights {
+		if maxHeight-height > c.opts.maxLag {
+			lagging[endorser] = height
+			errs = multi.Append(errs, errors.Errorf("rejected response from %s: height %d lags behind max height %d by more than %d blocks", endorser, height, maxHeight, c.opts.maxLag))
+		}
+	}
+
+	if len(lagging) == 0 {
+		return nil, nil
+	}
+
+	logger.Debugf("Targets rejected for lagging more than %d blocks behind max height %d: %v", c.opts.maxLag, maxHeight, lagging)
+	if o, ok := c.opts.observer.(LagObserver); ok {
+		o.TargetsLagging(&LagRejectionEvent{ChannelID: c.chName, MaxHeight: maxHeight, MaxLag: c.opts.maxLag, Rejected: lagging})
+	}
+
+	return lagging, errs
+}
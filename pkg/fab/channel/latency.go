@@ -0,0 +1,171 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// maxLatencySamples is the number of most recent samples that are kept for each target
+const maxLatencySamples = 100
+
+// LatencyStats keeps track of the observed response latency of targets. A single instance
+// may be shared by multiple Ledger clients (and is safe for concurrent use).
+// Targets are identified by URL; targets that don't have a URL are not tracked.
+type LatencyStats struct {
+	mutex   sync.RWMutex
+	samples map[string][]time.Duration
+}
+
+// NewLatencyStats returns a new LatencyStats
+func NewLatencyStats() *LatencyStats {
+	return &LatencyStats{samples: make(map[string][]time.Duration)}
+}
+
+// Record records the latency of a response from the given target
+func (s *LatencyStats) Record(target string, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	samples := append(s.samples[target], latency)
+	if len(samples) > maxLatencySamples {
+		samples = samples[len(samples)-maxLatencySamples:]
+	}
+	s.samples[target] = samples
+}
+
+// P95 returns the 95th percentile latency of the given target. False is returned
+// if no latency has been recorded for the target.
+func (s *LatencyStats) P95(target string) (time.Duration, bool) {
+	s.mutex.RLock()
+	samples := make([]time.Duration, len(s.samples[target]))
+	copy(samples, s.samples[target])
+	s.mutex.RUnlock()
+
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[(len(samples)*95+99)/100-1], true
+}
+
+// TargetSelectionEvent describes the targets that were selected for a query according to
+// their observed latency and the time remaining before the request deadline
+type TargetSelectionEvent struct {
+	ChannelID string
+	Remaining time.Duration
+	Selected  []string
+	Excluded  []string
+	// Fallback is true if no target was expected to respond in time and the fastest target was selected
+	Fallback bool
+}
+
+// TargetSelectionObserver may be implemented by an Observer in order to be notified
+// of the targets that were selected by deadline-aware target selection
+type TargetSelectionObserver interface {
+	TargetsSelected(event *TargetSelectionEvent)
+}
+
+type urlProvider interface {
+	URL() string
+}
+
+// latencyTarget records the latency of the responses of the target
+type latencyTarget struct {
+	fab.ProposalProcessor
+	url   string
+	stats *LatencyStats
+}
+
+// ProcessTransactionProposal delegates to the target and records the latency of successful responses
+func (t *latencyTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	start := time.Now()
+	resp, err := t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+	if err == nil {
+		t.stats.Record(t.url, time.Since(start))
+	}
+	return resp, err
+}
+
+// withLatencyTracking wraps the targets that have a URL so that their latency is recorded
+func withLatencyTracking(targets []fab.ProposalProcessor, stats *LatencyStats) []fab.ProposalProcessor {
+	tracked := make([]fab.ProposalProcessor, len(targets))
+	for i, target := range targets {
+		if p, ok := target.(urlProvider); ok {
+			tracked[i] = &latencyTarget{ProposalProcessor: target, url: p.URL(), stats: stats}
+		} else {
+			tracked[i] = target
+		}
+	}
+	return tracked
+}
+
+// selectTargetsForDeadline returns the targets whose p95 latency doesn't exceed the time remaining
+// before the deadline of the request context. Targets with no recorded latency are always selected.
+// If none of the targets qualify then the fastest target is selected.
+func selectTargetsForDeadline(reqCtx reqContext.Context, channelID string, targets []fab.ProposalProcessor, stats *LatencyStats, observer Observer) []fab.ProposalProcessor {
+	deadline, ok := reqCtx.Deadline()
+	if !ok || len(targets) == 0 {
+		return targets
+	}
+
+	event := &TargetSelectionEvent{ChannelID: channelID, Remaining: time.Until(deadline)}
+
+	var selected []fab.ProposalProcessor
+	var fastest fab.ProposalProcessor
+	var fastestURL string
+	var fastestLatency time.Duration
+	for _, target := range targets {
+		p, ok := target.(urlProvider)
+		if !ok {
+			selected = append(selected, target)
+			continue
+		}
+
+		latency, ok := stats.P95(p.URL())
+		if !ok || latency <= event.Remaining {
+			selected = append(selected, target)
+			event.Selected = append(event.Selected, p.URL())
+			continue
+		}
+
+		event.Excluded = append(event.Excluded, p.URL())
+		if fastest == nil || latency < fastestLatency {
+			fastest, fastestURL, fastestLatency = target, p.URL(), latency
+		}
+	}
+
+	if len(selected) == 0 {
+		selected = []fab.ProposalProcessor{fastest}
+		event.Selected = []string{fastestURL}
+		event.Excluded = removeString(event.Excluded, fastestURL)
+		event.Fallback = true
+	}
+
+	logger.Debugf("Targets selected for remaining time %s - selected: %v, excluded: %v, fallback: %t", event.Remaining, event.Selected, event.Excluded, event.Fallback)
+	if o, ok := observer.(TargetSelectionObserver); ok {
+		o.TargetsSelected(event)
+	}
+
+	return selected
+}
+
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
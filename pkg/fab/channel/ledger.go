@@ -8,11 +8,16 @@ package channel
 
 import (
 	reqContext "context"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/logging"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
@@ -27,11 +32,20 @@ var logger = logging.NewLogger("fabsdk/fab")
 const (
 	lscc           = "lscc"
 	lsccChaincodes = "getchaincodes"
+
+	// blockHashSize is the size (in bytes) of a block hash
+	blockHashSize = 32
 )
 
 // Ledger is a client that provides access to the underlying ledger of a channel.
+// A Ledger is safe for concurrent use by multiple goroutines: its options are not modified after
+// construction, and the state that is shared across queries (LatencyStats, FreshnessVerifier) is
+// synchronized. Observers, post-verify hooks and retry classifiers must also be safe for concurrent use.
 type Ledger struct {
-	chName string
+	chName     string
+	opts       ledgerOpts
+	staleCache *staleCache
+	infoCache  *infoCache
 }
 
 // ResponseVerifier checks transaction proposal response(s)
@@ -41,33 +55,99 @@ type ResponseVerifier interface {
 }
 
 // NewLedger constructs a Ledger client for the current context and named channel.
-func NewLedger(chName string) (*Ledger, error) {
+func NewLedger(chName string, opts ...Option) (*Ledger, error) {
 	l := Ledger{
 		chName: chName,
+		opts: ledgerOpts{
+			targetKey:       DefaultTargetKey,
+			maxBlockRange:   defaultMaxBlockRange,
+			maxResponseSize: defaultMaxResponseSize,
+			lsccName:        lscc,
+			qsccName:        qscc,
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(&l.opts); err != nil {
+			return nil, errors.WithMessage(err, "failed to apply ledger option")
+		}
+	}
+	if l.opts.staleFallback {
+		l.staleCache = newStaleCache()
+	}
+	if l.opts.infoCacheEvents != nil {
+		infoCache, err := newInfoCache(l.opts.infoCacheEvents)
+		if err != nil {
+			return nil, err
+		}
+		l.infoCache = infoCache
 	}
 	return &l, nil
 }
 
+// Close releases the resources held by the Ledger, i.e. it unregisters the block event subscription
+// of the QueryInfo cache (see WithInfoCache). The Ledger may still be used once it's closed, but
+// QueryInfo responses are no longer cached.
+func (c *Ledger) Close() {
+	if c.infoCache != nil {
+		c.infoCache.close()
+	}
+}
+
 // QueryInfo queries for various useful information on the state of the channel
-// (height, known peers).
+// (height, known peers). The MSP ID of the endorser of each response is resolved from the
+// identity of the endorsement or, failing that, from the target that returned the response.
+// The responses are cached until the next block event if WithInfoCache is set.
 func (c *Ledger) QueryInfo(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*fab.BlockchainInfoResponse, error) {
 	logger.Debug("queryInfo - start")
 
-	cir := createChannelInfoInvokeRequest(c.chName)
-	tprs, errs := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	var responses []*fab.BlockchainInfoResponse
+	var errs error
+	if c.infoCache != nil {
+		responses, errs = c.queryInfoCached(reqCtx, targets, verifier)
+	} else {
+		responses, errs = c.queryInfo(reqCtx, targets, verifier)
+	}
+
+	if c.opts.maxLagEnabled {
+		var lagErr error
+		responses, lagErr = c.filterLaggingResponses(responses)
+		if lagErr != nil {
+			errs = multi.Append(errs, lagErr)
+		}
+	}
+	return responses, errs
+}
+
+// queryInfo queries the targets for the blockchain info
+func (c *Ledger) queryInfo(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*fab.BlockchainInfoResponse, error) {
+	cir := createChannelInfoInvokeRequest(c.opts.qsccName, c.chName)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
 
 	responses := []*fab.BlockchainInfoResponse{}
 	for _, tpr := range tprs {
 		r, err := createBlockchainInfo(tpr)
 		if err != nil {
-			errs = multi.Append(errs, errors.WithMessage(err, "From target: "+tpr.Endorser))
+			errs = multi.Append(errs, newTargetError(tpr.Endorser, err, "From target: "+tpr.Endorser))
 		} else {
-			responses = append(responses, &fab.BlockchainInfoResponse{Endorser: tpr.Endorser, Status: tpr.Status, BCI: r})
+			responses = append(responses, &fab.BlockchainInfoResponse{Endorser: tpr.Endorser, Status: tpr.Status, BCI: r, MSPID: resolveMSPID(tpr, targets)})
 		}
 	}
 	return responses, errs
 }
 
+// QueryHeight queries the targets for the height of the channel's ledger (as QueryInfo does) and returns
+// the height reported by each endorser, keyed by the endorser's URL. The heights of the targets that
+// responded are returned along with the errors of the targets that didn't.
+func (c *Ledger) QueryHeight(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (map[string]uint64, error) {
+	responses, errs := c.QueryInfo(reqCtx, targets, verifier)
+
+	heights := make(map[string]uint64)
+	for _, response := range responses {
+		heights[response.Endorser] = response.BCI.GetHeight()
+	}
+	return heights, errs
+}
+
 func createBlockchainInfo(tpr *fab.TransactionProposalResponse) (*common.BlockchainInfo, error) {
 	response := common.BlockchainInfo{}
 	err := proto.Unmarshal(tpr.ProposalResponse.GetResponse().Payload, &response)
@@ -86,8 +166,8 @@ func (c *Ledger) QueryBlockByHash(reqCtx reqContext.Context, blockHash []byte, t
 		return nil, errors.New("blockHash is required")
 	}
 
-	cir := createBlockByHashInvokeRequest(c.chName, blockHash)
-	tprs, errs := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	cir := createBlockByHashInvokeRequest(c.opts.qsccName, c.chName, blockHash)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
 
 	responses, errors := getConfigBlocks(tprs)
 	errs = multi.Append(errs, errors)
@@ -95,6 +175,31 @@ func (c *Ledger) QueryBlockByHash(reqCtx reqContext.Context, blockHash []byte, t
 	return responses, errs
 }
 
+// QueryBlockByHashHex queries the ledger for Block by block hash, where the hash is given as a hex
+// string (as displayed in logs and explorer tools). An optional "0x" prefix is accepted. An error is
+// returned if the string isn't a valid hex encoded hash.
+func (c *Ledger) QueryBlockByHashHex(reqCtx reqContext.Context, blockHashHex string, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*common.Block, error) {
+	blockHash, err := decodeBlockHash(blockHashHex)
+	if err != nil {
+		return nil, err
+	}
+	return c.QueryBlockByHash(reqCtx, blockHash, targets, verifier)
+}
+
+// decodeBlockHash decodes the hex encoded block hash
+func decodeBlockHash(blockHashHex string) ([]byte, error) {
+	hashHex := strings.TrimPrefix(strings.TrimSpace(blockHashHex), "0x")
+	if len(hashHex) != 2*blockHashSize {
+		return nil, errors.Errorf("invalid block hash [%s]: expecting %d hex characters but got %d", blockHashHex, 2*blockHashSize, len(hashHex))
+	}
+
+	blockHash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid block hash [%s]", blockHashHex)
+	}
+	return blockHash, nil
+}
+
 // QueryBlockByTxID returns a block which contains a transaction
 // This query will be made to specified targets.
 // Returns the block.
@@ -104,8 +209,8 @@ func (c *Ledger) QueryBlockByTxID(reqCtx reqContext.Context, txID fab.Transactio
 		return nil, errors.New("txID is required")
 	}
 
-	cir := createBlockByTxIDInvokeRequest(c.chName, txID)
-	tprs, errs := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	cir := createBlockByTxIDInvokeRequest(c.opts.qsccName, c.chName, txID)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
 
 	responses, errors := getConfigBlocks(tprs)
 	errs = multi.Append(errs, errors)
@@ -113,13 +218,53 @@ func (c *Ledger) QueryBlockByTxID(reqCtx reqContext.Context, txID fab.Transactio
 	return responses, errs
 }
 
+// TxBlockLocation contains the block that contains a transaction and the
+// (zero-based) index of the transaction within the block's data
+type TxBlockLocation struct {
+	Block   *common.Block
+	TxIndex int
+}
+
+// QueryBlockAndTxIndexByTxID returns the block which contains a transaction along with the index of the
+// transaction within the block, so that the block doesn't need to be scanned again by the caller.
+// If more than one transaction in the block has the ID then the index of the first is returned.
+// This query will be made to specified targets.
+func (c *Ledger) QueryBlockAndTxIndexByTxID(reqCtx reqContext.Context, txID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*TxBlockLocation, error) {
+	blocks, errs := c.QueryBlockByTxID(reqCtx, txID, targets, verifier)
+
+	locations := []*TxBlockLocation{}
+	for _, block := range blocks {
+		index, err := txIndex(block, string(txID))
+		if err != nil {
+			errs = multi.Append(errs, err)
+			continue
+		}
+		locations = append(locations, &TxBlockLocation{Block: block, TxIndex: index})
+	}
+	return locations, errs
+}
+
+// txIndex returns the index of the first transaction in the block with the given ID.
+// Transactions that can't be parsed are skipped.
+func txIndex(block *common.Block, txID string) (int, error) {
+	if block.Data != nil {
+		for i, data := range block.Data.Data {
+			_, channelHeader, err := txChannelHeader(data)
+			if err == nil && channelHeader.TxId == txID {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.Errorf("transaction [%s] not found in block %d", txID, block.GetHeader().GetNumber())
+}
+
 func getConfigBlocks(tprs []*fab.TransactionProposalResponse) ([]*common.Block, error) {
 	responses := []*common.Block{}
 	var errs error
 	for _, tpr := range tprs {
 		r, err := createCommonBlock(tpr)
 		if err != nil {
-			errs = multi.Append(errs, errors.WithMessage(err, "From target: "+tpr.Endorser))
+			errs = multi.Append(errs, newTargetError(tpr.Endorser, err, "From target: "+tpr.Endorser))
 		} else {
 			responses = append(responses, r)
 		}
@@ -133,14 +278,92 @@ func getConfigBlocks(tprs []*fab.TransactionProposalResponse) ([]*common.Block,
 // It returns the block.
 func (c *Ledger) QueryBlock(reqCtx reqContext.Context, blockNumber uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*common.Block, error) {
 
-	cir := createBlockByNumberInvokeRequest(c.chName, blockNumber)
-	tprs, errs := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	cir := createBlockByNumberInvokeRequest(c.opts.qsccName, c.chName, blockNumber)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
 
 	responses, errors := getConfigBlocks(tprs)
 	errs = multi.Append(errs, errors)
 	return responses, errs
 }
 
+// QueryBlockByNumberRange queries the ledger for the blocks in the given (inclusive) range.
+// The targets are resolved once so that all of the blocks are queried from the same targets, which
+// must agree (according to the verifier) on the contents of each block. The blocks are returned in
+// ascending order. A block that can't be retrieved doesn't abort the query; it's omitted from the
+// result and its error is included in the returned error. The size of the range is limited (see
+// WithMaxBlockRange).
+func (c *Ledger) QueryBlockByNumberRange(reqCtx reqContext.Context, startBlock, endBlock uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*common.Block, error) {
+	if startBlock > endBlock {
+		return nil, errors.Errorf("invalid block range [%d, %d]", startBlock, endBlock)
+	}
+	if endBlock-startBlock >= c.opts.maxBlockRange {
+		return nil, errors.Errorf("block range [%d, %d] exceeds the maximum of %d blocks", startBlock, endBlock, c.opts.maxBlockRange)
+	}
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("target(s) required")
+	}
+
+	var blocks []*common.Block
+	err = c.scanBlocks(reqCtx, startBlock, endBlock, targets, verifier, func(block *common.Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	return blocks, err
+}
+
+// ScanBlocks queries the ledger for the blocks in the given (inclusive) range and invokes fn for each
+// block as soon as it's retrieved, in ascending order, so that the blocks don't need to be held in memory.
+// As with QueryBlockByNumberRange, all of the blocks are queried from the same targets and a block that
+// can't be retrieved is skipped and its error is included in the returned error. The scan stops if fn
+// returns an error (which is returned) or if the request context is done between blocks (in which case
+// the context error is returned).
+func (c *Ledger) ScanBlocks(reqCtx reqContext.Context, startBlock, endBlock uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier, fn func(*common.Block) error) error {
+	if startBlock > endBlock {
+		return errors.Errorf("invalid block range [%d, %d]", startBlock, endBlock)
+	}
+	if fn == nil {
+		return errors.New("block handler is required")
+	}
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("target(s) required")
+	}
+
+	return c.scanBlocks(reqCtx, startBlock, endBlock, targets, verifier, fn)
+}
+
+// scanBlocks queries the targets for each block in the range and invokes fn for each block that's retrieved
+func (c *Ledger) scanBlocks(reqCtx reqContext.Context, startBlock, endBlock uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier, fn func(*common.Block) error) error {
+	var errs error
+	for blockNum := startBlock; ; blockNum++ {
+		if err := reqCtx.Err(); err != nil {
+			return multi.Append(errs, errors.Wrapf(err, "block scan stopped before block %d", blockNum))
+		}
+
+		block, err := c.queryMatchingBlock(reqCtx, blockNum, targets, verifier)
+		if err != nil {
+			errs = multi.Append(errs, err)
+		} else if err := fn(block); err != nil {
+			return multi.Append(errs, errors.WithMessage(err, fmt.Sprintf("block handler failed for block %d", blockNum)))
+		}
+
+		if blockNum == endBlock {
+			break
+		}
+	}
+
+	return errs
+}
+
 func createCommonBlock(tpr *fab.TransactionProposalResponse) (*common.Block, error) {
 	response := common.Block{}
 	err := proto.Unmarshal(tpr.ProposalResponse.GetResponse().Payload, &response)
@@ -155,14 +378,14 @@ func createCommonBlock(tpr *fab.TransactionProposalResponse) (*common.Block, err
 // Returns the ProcessedTransaction information containing the transaction.
 func (c *Ledger) QueryTransaction(reqCtx reqContext.Context, transactionID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*pb.ProcessedTransaction, error) {
 
-	cir := createTransactionByIDInvokeRequest(c.chName, transactionID)
-	tprs, errs := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	cir := createTransactionByIDInvokeRequest(c.opts.qsccName, c.chName, transactionID)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
 
 	responses := []*pb.ProcessedTransaction{}
 	for _, tpr := range tprs {
 		r, err := createProcessedTransaction(tpr)
 		if err != nil {
-			errs = multi.Append(errs, errors.WithMessage(err, "From target: "+tpr.Endorser))
+			errs = multi.Append(errs, newTargetError(tpr.Endorser, err, "From target: "+tpr.Endorser))
 		} else {
 			responses = append(responses, r)
 		}
@@ -171,6 +394,80 @@ func (c *Ledger) QueryTransaction(reqCtx reqContext.Context, transactionID fab.T
 	return responses, errs
 }
 
+// QueryTransactionValidationCode queries the ledger for the validation code of the given transaction.
+// The validation code returned by each target is included in the response, so the caller can
+// determine whether the transaction was valid (or why it was rejected) without parsing the transaction.
+func (c *Ledger) QueryTransactionValidationCode(reqCtx reqContext.Context, transactionID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]pb.TxValidationCode, error) {
+	transactions, errs := c.QueryTransaction(reqCtx, transactionID, targets, verifier)
+
+	codes := []pb.TxValidationCode{}
+	for _, transaction := range transactions {
+		codes = append(codes, pb.TxValidationCode(transaction.ValidationCode))
+	}
+
+	return codes, errs
+}
+
+// QueryTransactions queries the ledger for each of the given transactions. The targets are resolved once
+// so that all of the transactions are queried from the same targets, which must agree (according to the
+// verifier) on each transaction. The transactions are queried in the given order and the results are keyed
+// by transaction ID. Partial success is returned: a transaction that can't be retrieved is omitted from the
+// result and its error is included in the returned error.
+func (c *Ledger) QueryTransactions(reqCtx reqContext.Context, txIDs []fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) (map[fab.TransactionID]*pb.ProcessedTransaction, error) {
+	if len(txIDs) == 0 {
+		return nil, errors.New("at least one transaction ID must be provided")
+	}
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("target(s) required")
+	}
+
+	var errs error
+	transactions := make(map[fab.TransactionID]*pb.ProcessedTransaction)
+	for _, txID := range txIDs {
+		if _, ok := transactions[txID]; ok {
+			continue
+		}
+
+		transaction, err := c.queryMatchingTransaction(reqCtx, txID, targets, verifier)
+		if err != nil {
+			errs = multi.Append(errs, err)
+			continue
+		}
+		transactions[txID] = transaction
+	}
+
+	return transactions, errs
+}
+
+// queryMatchingTransaction queries the targets for the given transaction and returns the transaction if the responses match
+func (c *Ledger) queryMatchingTransaction(reqCtx reqContext.Context, txID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*pb.ProcessedTransaction, error) {
+	cir := createTransactionByIDInvokeRequest(c.opts.qsccName, c.chName, txID)
+	tprs, err := c.queryChaincode(reqCtx, cir, targets, verifier)
+	if len(tprs) == 0 {
+		if err == nil {
+			err = errors.New("no responses from targets")
+		}
+		return nil, errors.WithMessage(err, fmt.Sprintf("query for transaction %s failed", txID))
+	}
+
+	if verifier != nil {
+		if err := verifier.Match(tprs); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("responses for transaction %s do not match", txID))
+		}
+	}
+
+	transaction, err := createProcessedTransaction(tprs[0])
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("query for transaction %s failed", txID))
+	}
+	return transaction, nil
+}
+
 func createProcessedTransaction(tpr *fab.TransactionProposalResponse) (*pb.ProcessedTransaction, error) {
 	response := pb.ProcessedTransaction{}
 	err := proto.Unmarshal(tpr.ProposalResponse.GetResponse().Payload, &response)
@@ -181,16 +478,17 @@ func createProcessedTransaction(tpr *fab.TransactionProposalResponse) (*pb.Proce
 }
 
 // QueryInstantiatedChaincodes queries the instantiated chaincodes on this channel.
-// This query will be made to specified targets.
+// This query will be made to specified targets. If the channel uses the new chaincode lifecycle
+// (see WithChaincodeLifecycle) then the committed chaincode definitions are queried from _lifecycle.
 func (c *Ledger) QueryInstantiatedChaincodes(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*pb.ChaincodeQueryResponse, error) {
-	cir := createChaincodeInvokeRequest()
-	tprs, errs := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	cir := createChaincodesInvokeRequest(c.opts.lifecycle, c.opts.lsccName)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
 
 	responses := []*pb.ChaincodeQueryResponse{}
 	for _, tpr := range tprs {
-		r, err := createChaincodeQueryResponse(tpr)
+		r, err := createChaincodesQueryResponse(c.opts.lifecycle, tpr)
 		if err != nil {
-			errs = multi.Append(errs, errors.WithMessage(err, "From target: "+tpr.Endorser))
+			errs = multi.Append(errs, newTargetError(tpr.Endorser, err, "From target: "+tpr.Endorser))
 		} else {
 			responses = append(responses, r)
 		}
@@ -210,26 +508,217 @@ func createChaincodeQueryResponse(tpr *fab.TransactionProposalResponse) (*pb.Cha
 // QueryConfigBlock returns the current configuration block for the specified channel. If the
 // peer doesn't belong to the channel, return error
 func (c *Ledger) QueryConfigBlock(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.ConfigEnvelope, error) {
+	configEnvelope, _, err := c.QueryConfigBlockWithBlock(reqCtx, targets, verifier)
+	return configEnvelope, err
+}
+
+// QueryConfigBlockWithBlock returns the current configuration of the specified channel along with the
+// config block from which it was extracted, for example, in order to track the number of the block. The
+// responses are matched by the verifier before the block is trusted. If the peer doesn't belong to the
+// channel, return error
+func (c *Ledger) QueryConfigBlockWithBlock(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.ConfigEnvelope, *common.Block, error) {
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if len(targets) == 0 {
-		return nil, errors.New("target(s) required")
+		return nil, nil, errors.New("target(s) required")
 	}
 
 	cir := createConfigBlockInvokeRequest(c.chName)
-	tprs, err := queryChaincode(reqCtx, c.chName, cir, targets, verifier)
+	return c.queryConfig(reqCtx, cir, targets, verifier)
+}
+
+// QueryConfigBlockByNumber returns the configuration of the channel as of the config block with the given
+// number (rather than the current configuration), for example, in order to reconstruct the policies of the
+// channel at a point in time. The config block is returned along with the configuration. An error is returned
+// if the block isn't a config block.
+func (c *Ledger) QueryConfigBlockByNumber(reqCtx reqContext.Context, blockNumber uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.ConfigEnvelope, *common.Block, error) {
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, nil, errors.New("target(s) required")
+	}
+
+	cir := createBlockByNumberInvokeRequest(c.opts.qsccName, c.chName, blockNumber)
+	configEnvelope, block, err := c.queryConfig(reqCtx, cir, targets, verifier)
+	if err != nil && configEnvelope == nil {
+		return nil, nil, errors.WithMessage(err, fmt.Sprintf("query for config block %d failed", blockNumber))
+	}
+	return configEnvelope, block, err
+}
+
+// queryConfig queries the targets with the given request for a config block and returns the configuration
+// from the block that's selected from the matched responses
+func (c *Ledger) queryConfig(reqCtx reqContext.Context, cir fab.ChaincodeInvokeRequest, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.ConfigEnvelope, *common.Block, error) {
+	tprs, err := c.queryChaincode(reqCtx, cir, targets, verifier)
 	if err != nil && len(tprs) == 0 {
-		return nil, errors.WithMessage(err, "queryChaincode failed")
+		return nil, nil, errors.WithMessage(err, "queryChaincode failed")
 	}
 
 	matchErr := verifier.Match(tprs)
 	if matchErr != nil {
-		return nil, matchErr
+		return nil, nil, matchErr
+	}
+
+	block, blockErr := selectConfigBlock(tprs, verifier)
+	if blockErr != nil {
+		return nil, nil, blockErr
+	}
+	if block == nil || block.Data == nil || len(block.Data.Data) == 0 {
+		return nil, nil, errors.New("config block data is nil")
+	}
+
+	configEnvelope, envErr := createConfigEnvelope(block.Data.Data[0])
+	if envErr != nil {
+		return nil, nil, envErr
+	}
+	if IsStaleResult(err) {
+		return configEnvelope, block, err
 	}
+	return configEnvelope, block, nil
 
-	block, _ := createCommonBlock(tprs[0])
+}
+
+// selectConfigBlock returns the config block from the payload selected by the verifier (if it, or a
+// verifier that it decorates, selects a payload) or otherwise from the first response
+func selectConfigBlock(tprs []*fab.TransactionProposalResponse, verifier ResponseVerifier) (*common.Block, error) {
+	selector, ok := payloadSelectorOf(verifier)
+	if !ok {
+		block, _ := createCommonBlock(tprs[0])
+		return block, nil
+	}
 
-	return createConfigEnvelope(block.Data.Data[0])
+	payload, err := selector.MajorityPayload(tprs)
+	if err != nil {
+		return nil, err
+	}
+	block := &common.Block{}
+	if err := proto.Unmarshal(payload, block); err != nil {
+		return nil, errors.Wrap(err, "unmarshal of config block failed")
+	}
+	if block.Data == nil || len(block.Data.Data) == 0 {
+		return nil, errors.New("config block data is nil")
+	}
+	return block, nil
+}
+
+// QueryConfigIfChanged returns the current configuration of the channel only if its sequence differs
+// from the given known sequence. The returned bool indicates whether the configuration changed; if it
+// didn't then a nil config envelope is returned. Note that the peer does not support conditional
+// config queries so the config block is still retrieved, but callers only need to process the config
+// when it has changed.
+func (c *Ledger) QueryConfigIfChanged(reqCtx reqContext.Context, knownSequence uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) (*common.ConfigEnvelope, bool, error) {
+	configEnvelope, err := c.QueryConfigBlock(reqCtx, targets, verifier)
+	if err != nil && !IsStaleResult(err) {
+		return nil, false, err
+	}
+
+	if configEnvelope.Config == nil {
+		return nil, false, errors.New("config envelope does not contain a config")
+	}
+
+	if configEnvelope.Config.Sequence == knownSequence {
+		logger.Debugf("channel config sequence [%d] is unchanged", knownSequence)
+		return nil, false, err
+	}
+
+	logger.Debugf("channel config sequence changed from [%d] to [%d]", knownSequence, configEnvelope.Config.Sequence)
+	return configEnvelope, true, err
+}
+
+// ChannelStatusError is returned by QueryChannelStatus when only one of the channel
+// height and config sequence could be retrieved. The value that was retrieved is still returned.
+type ChannelStatusError struct {
+	HeightErr    error
+	ConfigSeqErr error
+}
+
+// Error returns the error message
+func (e *ChannelStatusError) Error() string {
+	if e.HeightErr != nil {
+		return fmt.Sprintf("query for channel height failed: %s", e.HeightErr)
+	}
+	return fmt.Sprintf("query for config sequence failed: %s", e.ConfigSeqErr)
+}
+
+// QueryChannelStatus returns the current height of the channel (the maximum height reported by the targets)
+// along with the sequence of the channel's current config. The height and config are queried in parallel.
+// Since the config block is also queried, the verifier must be able to match config blocks (see
+// TransactionProposalResponseVerifier). If only one of the queries succeeds then the retrieved value is returned
+// along with a *ChannelStatusError. If stale fallback is enabled (see WithStaleFallback) and stale values are
+// returned then the error contains a StaleResultError (see IsStaleResult).
+func (c *Ledger) QueryChannelStatus(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (uint64, uint64, error) {
+	var height, configSeq uint64
+	var heightErr, configSeqErr error
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		height, heightErr = c.queryMaxHeight(reqCtx, targets, verifier)
+	}()
+
+	go func() {
+		defer wg.Done()
+		configEnvelope, err := c.QueryConfigBlock(reqCtx, targets, verifier)
+		if err != nil && !IsStaleResult(err) {
+			configSeqErr = err
+			return
+		}
+		if configEnvelope.Config == nil {
+			configSeqErr = errors.New("config envelope does not contain a config")
+			return
+		}
+		configSeq = configEnvelope.Config.Sequence
+		configSeqErr = err
+	}()
+
+	wg.Wait()
+
+	// Stale results (see WithStaleFallback) are returned with the StaleResultError(s)
+	heightStale, configSeqStale := IsStaleResult(heightErr), IsStaleResult(configSeqErr)
+	if (heightStale || configSeqStale) && (heightErr == nil || heightStale) && (configSeqErr == nil || configSeqStale) {
+		return height, configSeq, multi.New(heightErr, configSeqErr)
+	}
+
+	if heightErr != nil && configSeqErr != nil && !heightStale && !configSeqStale {
+		return 0, 0, multi.Append(errors.WithMessage(heightErr, "query for channel height failed"), errors.WithMessage(configSeqErr, "query for config sequence failed"))
+	}
+	if heightErr != nil || configSeqErr != nil {
+		return height, configSeq, &ChannelStatusError{HeightErr: heightErr, ConfigSeqErr: configSeqErr}
+	}
+
+	return height, configSeq, nil
+}
+
+// queryMaxHeight returns the highest block height reported by the targets
+func (c *Ledger) queryMaxHeight(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier ResponseVerifier) (uint64, error) {
+	responses, err := c.QueryInfo(reqCtx, targets, verifier)
+	if len(responses) == 0 {
+		if err == nil {
+			err = errors.New("no responses from targets")
+		}
+		return 0, err
+	}
 
+	var height uint64
+	for _, r := range responses {
+		if r.BCI.Height > height {
+			height = r.BCI.Height
+		}
+	}
+	if IsStaleResult(err) {
+		return height, err
+	}
+	return height, nil
 }
 
 func collectProposalResponses(tprs []*fab.TransactionProposalResponse) [][]byte {
@@ -241,47 +730,174 @@ func collectProposalResponses(tprs []*fab.TransactionProposalResponse) [][]byte
 	return responses
 }
 
-func queryChaincode(reqCtx reqContext.Context, channelID string, request fab.ChaincodeInvokeRequest, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*fab.TransactionProposalResponse, error) {
-	ctx, ok := contextImpl.RequestClientContext(reqCtx)
-	if !ok {
-		return nil, errors.New("failed get client context from reqContext for signProposal")
+// queryChaincode queries the given targets and, if stale fallback is enabled, falls back to the cached responses
+func (c *Ledger) queryChaincode(reqCtx reqContext.Context, request fab.ChaincodeInvokeRequest, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*fab.TransactionProposalResponse, error) {
+	tprs, err := c.queryTargets(reqCtx, request, targets, verifier)
+	if c.staleCache != nil {
+		return c.withStaleFallback(request, tprs, err)
 	}
-	txh, err := txn.NewHeader(ctx, channelID)
+	return tprs, err
+}
+
+// queryTargets applies the ledger options to the request context and queries the given targets
+func (c *Ledger) queryTargets(reqCtx reqContext.Context, request fab.ChaincodeInvokeRequest, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*fab.TransactionProposalResponse, error) {
+	targets, err := c.resolveTargets(targets)
 	if err != nil {
-		return nil, errors.WithMessage(err, "creation of transaction ID failed")
+		return nil, err
+	}
+
+	if timeout, ok := queryTimeout(reqCtx); ok {
+		var cancel reqContext.CancelFunc
+		reqCtx, cancel = reqContext.WithTimeout(reqCtx, timeout)
+		defer cancel()
+	}
+
+	targets = deduplicateTargets(c.chName, targets, c.opts.targetKey)
+	orderedTargets := targets
+
+	if c.opts.compressor != "" {
+		reqCtx = contextImpl.WithCompressor(reqCtx, c.opts.compressor, c.opts.uncompressedTargets...)
+	}
+
+	var lagErr error
+	if c.opts.maxLagEnabled && !isChannelInfoRequest(request) {
+		targets, lagErr = c.excludeLaggingTargets(reqCtx, targets)
+	}
+
+	if c.opts.latencyStats != nil {
+		targets = withLatencyTracking(selectTargetsForDeadline(reqCtx, c.chName, targets, c.opts.latencyStats, c.opts.observer), c.opts.latencyStats)
+	}
+
+	if c.opts.endorserTimeout > 0 {
+		targets = withEndorserTimeout(targets, c.opts.endorserTimeout)
+	}
+
+	if c.opts.concurrencyLimit > 0 {
+		targets = withConcurrencyLimit(targets, c.opts.concurrencyLimit)
+	}
+
+	if c.opts.retryClassifier != nil {
+		retryOpts := retry.DefaultOpts
+		if c.opts.retryOpts != nil {
+			retryOpts = *c.opts.retryOpts
+		}
+		targets = withRetry(targets, retryOpts, c.opts.retryClassifier)
+	}
+
+	targets = withTargetErrors(targets)
+
+	hooks := &responseHooks{
+		channelID:       c.chName,
+		postVerify:      c.opts.postVerify,
+		observer:        c.opts.observer,
+		keepRejected:    c.opts.keepRejected,
+		maxResponseSize: c.opts.maxResponseSize,
+	}
+	tprs, errs := queryChaincode(reqCtx, c.chName, request, targets, verifier, hooks)
+	if c.opts.orderedTargets {
+		tprs, errs = orderByTargets(orderedTargets, tprs, errs)
+	}
+	if lagErr != nil {
+		errs = multi.Append(errs, lagErr)
+	}
+	return tprs, errs
+}
+
+// responseHooks contains the optional hooks that are invoked while filtering responses
+type responseHooks struct {
+	channelID    string
+	postVerify   PostVerifyHook
+	observer     Observer
+	keepRejected bool
+	// maxResponseSize is the maximum size of the payload of a response (no limit if zero)
+	maxResponseSize int
+}
+
+func queryChaincode(reqCtx reqContext.Context, channelID string, request fab.ChaincodeInvokeRequest, targets []fab.ProposalProcessor, verifier ResponseVerifier, hooks *responseHooks) ([]*fab.TransactionProposalResponse, error) {
+	txh, err := queryHeader(reqCtx, channelID)
+	if err != nil {
+		return nil, err
 	}
 
 	tp, err := txn.CreateChaincodeInvokeProposal(txh, request)
 	if err != nil {
 		return nil, errors.WithMessage(err, "NewProposal failed")
 	}
+
+	// The correlation ID (if any) is sent to the targets by the endorsers (see WithCorrelationID)
+	if correlationID, ok := contextImpl.RequestCorrelationID(reqCtx); ok {
+		logger.Debugf("Sending query [%s:%s] with TxID [%s] and correlation ID [%s]", request.ChaincodeID, request.Fcn, tp.TxnID, correlationID)
+	}
+
 	tprs, errs := txn.SendProposal(reqCtx, tp, targets)
 
-	return filterResponses(tprs, errs, verifier)
+	if isBlockRequest(request) {
+		tprs, errs = extractBlockNotFound(tprs, errs)
+	}
+
+	return filterResponses(tprs, errs, verifier, hooks)
 }
 
-func filterResponses(responses []*fab.TransactionProposalResponse, errs error, verifier ResponseVerifier) ([]*fab.TransactionProposalResponse, error) {
+func filterResponses(responses []*fab.TransactionProposalResponse, errs error, verifier ResponseVerifier, hooks *responseHooks) ([]*fab.TransactionProposalResponse, error) {
 	filteredResponses := responses[:0]
 	for _, response := range responses {
 		if response.Status == http.StatusOK {
+			if hooks != nil && hooks.maxResponseSize > 0 {
+				if err := checkResponseSize(response, hooks.maxResponseSize); err != nil {
+					errs = multi.Append(errs, newTargetError(response.Endorser, err, ""))
+					if hooks.observer != nil {
+						hooks.observer.VerificationRejected(&VerificationRejectedEvent{
+							ChannelID: hooks.channelID,
+							Endorser:  response.Endorser,
+							Reason:    err.Error(),
+						})
+					}
+					continue
+				}
+			}
 			if verifier != nil {
 				if err := verifier.Verify(response); err != nil {
-					errs = multi.Append(errs, errors.Errorf("failed to verify response from %s: %s", response.Endorser, err))
+					errs = multi.Append(errs, newTargetError(response.Endorser, err, fmt.Sprintf("failed to verify response from %s", response.Endorser)))
+					if hooks != nil && hooks.observer != nil {
+						hooks.observer.VerificationRejected(&VerificationRejectedEvent{
+							ChannelID: hooks.channelID,
+							Endorser:  response.Endorser,
+							Reason:    err.Error(),
+						})
+					}
+					continue
+				}
+			}
+			if hooks != nil && hooks.postVerify != nil {
+				if err := hooks.postVerify(response); err != nil {
+					errs = multi.Append(errs, newTargetError(response.Endorser, err, fmt.Sprintf("post-verify hook failed for response from %s", response.Endorser)))
 					continue
 				}
 			}
 			filteredResponses = append(filteredResponses, response)
+		} else if hooks != nil && hooks.keepRejected {
+			errs = multi.Append(errs, newRejectedResponseError(response))
 		} else {
-			errs = multi.Append(errs, errors.Errorf("bad status from %s (%d)", response.Endorser, response.Status))
+			errs = multi.Append(errs, newTargetError(response.Endorser, errors.Errorf("bad status from %s (%d)", response.Endorser, response.Status), ""))
 		}
 	}
 
 	return filteredResponses, errs
 }
 
-func createChaincodeInvokeRequest() fab.ChaincodeInvokeRequest {
+// checkResponseSize returns an error if the payload of the response exceeds the given maximum size, so that
+// the response is rejected before the payload is unmarshalled
+func checkResponseSize(response *fab.TransactionProposalResponse, maxSize int) error {
+	size := len(response.ProposalResponse.GetResponse().GetPayload())
+	if size > maxSize {
+		return errors.Errorf("response from %s rejected: payload size %d bytes exceeds the maximum of %d bytes", response.Endorser, size, maxSize)
+	}
+	return nil
+}
+
+func createChaincodeInvokeRequest(lsccName string) fab.ChaincodeInvokeRequest {
 	cir := fab.ChaincodeInvokeRequest{
-		ChaincodeID: lscc,
+		ChaincodeID: lsccName,
 		Fcn:         lsccChaincodes,
 	}
 	return cir
@@ -311,3 +927,25 @@ func createConfigEnvelope(data []byte) (*common.ConfigEnvelope, error) {
 
 	return configEnvelope, nil
 }
+
+// resolveTargets returns the given targets or, if no targets are given and discovery is
+// enabled (see WithDiscovery), the peers currently provided by the discovery service
+func (c *Ledger) resolveTargets(targets []fab.ProposalProcessor) ([]fab.ProposalProcessor, error) {
+	if len(targets) > 0 || c.opts.discovery == nil {
+		return targets, nil
+	}
+
+	peers, err := c.opts.discovery.GetPeers()
+	if err != nil {
+		return nil, errors.WithMessage(err, "discovery of targets failed")
+	}
+	if len(peers) == 0 {
+		return nil, errors.New("discovery returned no peers")
+	}
+
+	discovered := make([]fab.ProposalProcessor, len(peers))
+	for i, peer := range peers {
+		discovered[i] = peer
+	}
+	return discovered, nil
+}
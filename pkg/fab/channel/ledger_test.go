@@ -6,22 +6,54 @@ SPDX-License-Identifier: Apache-2.0
 package channel
 
 import (
-	"errors"
+	"bytes"
+	reqContext "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-sdk-go/internal/github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
 	contextApi "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+	servicemocks "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/mocks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/mocks"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/txn"
 	mspmocks "github.com/hyperledger/fabric-sdk-go/pkg/msp/test/mockmsp"
 	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/protoutil"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/common/ccprovider"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
 	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/utils"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
 )
 
 var validRootCA = `-----BEGIN CERTIFICATE-----
@@ -84,205 +116,3251 @@ func TestChannelQueryBlock(t *testing.T) {
 
 }
 
+func TestQueryBlockNotFound(t *testing.T) {
+	channel, _ := setupTestLedger()
+	peer1 := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Status: 500, ResponseMessage: "Failed to get block number 100, error Entry not found in index"}
+	peer2 := mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Status: 500, ResponseMessage: "internal error"}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	blocks, err := channel.QueryBlock(reqCtx, 100, []fab.ProposalProcessor{&peer1}, nil)
+	assert.Error(t, err)
+	assert.Empty(t, blocks)
+	assert.True(t, IsBlockNotFound(err), "expecting block not found error but got: %s", err)
+	assert.Contains(t, err.Error(), "block not found on http://peer1.com")
+
+	// Other failures aren't reported as block not found
+	_, err = channel.QueryBlock(reqCtx, 100, []fab.ProposalProcessor{&peer2}, nil)
+	assert.Error(t, err)
+	assert.False(t, IsBlockNotFound(err))
+
+	// Only block queries report block not found
+	_, err = channel.QueryTransaction(reqCtx, "txid", []fab.ProposalProcessor{&peer1}, nil)
+	assert.Error(t, err)
+	assert.False(t, IsBlockNotFound(err))
+}
+
+func TestQueryBlockByHashHex(t *testing.T) {
+	channel, _ := setupTestLedger()
+	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Status: 200}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	hash := strings.Repeat("ab", 32)
+	_, err := channel.QueryBlockByHashHex(reqCtx, hash, []fab.ProposalProcessor{&peer}, nil)
+	assert.NoError(t, err)
+	_, err = channel.QueryBlockByHashHex(reqCtx, "0x"+strings.ToUpper(hash), []fab.ProposalProcessor{&peer}, nil)
+	assert.NoError(t, err)
+
+	_, err = channel.QueryBlockByHashHex(reqCtx, "abcd", []fab.ProposalProcessor{&peer}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expecting 64 hex characters but got 4")
+
+	_, err = channel.QueryBlockByHashHex(reqCtx, strings.Repeat("zz", 32), []fab.ProposalProcessor{&peer}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid block hash")
+
+	assert.Equal(t, 2, peer.ProcessProposalCalls, "expecting malformed hashes not to be sent to the peer")
+}
+
 func TestQueryInstantiatedChaincodes(t *testing.T) {
 	channel, _ := setupTestLedger()
 	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200}
 
-	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
-	defer cancel()
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	res, err := channel.QueryInstantiatedChaincodes(reqCtx, []fab.ProposalProcessor{&peer}, nil)
+
+	if err != nil || res == nil {
+		t.Fatalf("Test QueryInstatiated chaincode failed: %v", err)
+	}
+
+}
+
+func TestSystemChaincodeNames(t *testing.T) {
+	peer := &chaincodeNameRecorder{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 2)}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	_, _ = l.QueryInstantiatedChaincodes(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.Equal(t, []string{"qscc", "lscc"}, peer.names)
+
+	peer.names = nil
+	l, err = NewLedger("testChannel", WithLSCCName("mylscc"), WithQSCCName("myqscc"))
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	blocks, err := l.QueryBlock(reqCtx, 1, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 1)
+	_, _ = l.QueryInstantiatedChaincodes(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.Equal(t, []string{"myqscc", "myqscc", "mylscc"}, peer.names)
+
+	// Missing blocks are still detected with a renamed qscc
+	_, err = l.QueryBlock(reqCtx, 5, []fab.ProposalProcessor{peer}, nil)
+	assert.Error(t, err)
+
+	_, err = NewLedger("testChannel", WithLSCCName(""))
+	assert.Error(t, err, "expecting error for empty lscc name")
+	_, err = NewLedger("testChannel", WithQSCCName(""))
+	assert.Error(t, err, "expecting error for empty qscc name")
+}
+
+func TestQueryInstantiatedChaincodesWithNewLifecycle(t *testing.T) {
+	peer := newMockLedgerPeer("http://peer1.com", 0)
+	peer.definitions = &chaincodeDefinitionsResult{ChaincodeDefinitions: []*chaincodeDefinition{
+		{Name: "cc1", Sequence: 1, Version: "v1", EndorsementPlugin: "escc", ValidationPlugin: "vscc"},
+		{Name: "cc2", Sequence: 3, Version: "v2"},
+	}}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// The peer only supports _lifecycle so the lscc query (the default) fails
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	_, err = l.QueryInstantiatedChaincodes(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.Error(t, err)
+
+	l, err = NewLedger("testChannel", WithChaincodeLifecycle(NewLifecycle))
+	assert.NoError(t, err)
+	responses, err := l.QueryInstantiatedChaincodes(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 1) {
+		assert.Equal(t, []*pb.ChaincodeInfo{
+			{Name: "cc1", Version: "v1", Escc: "escc", Vscc: "vscc"},
+			{Name: "cc2", Version: "v2"},
+		}, responses[0].Chaincodes)
+	}
+
+	_, err = NewLedger("testChannel", WithChaincodeLifecycle(ChaincodeLifecycle(5)))
+	assert.Error(t, err, "expecting error for unsupported chaincode lifecycle")
+}
+
+func TestQueryInstantiatedChaincodesWithMetadata(t *testing.T) {
+	peer := newMockLedgerPeer("http://peer1.com", 0)
+	peer.chaincodes = []*pb.ChaincodeInfo{{Name: "cc2", Version: "v2"}, {Name: "cc1", Version: "v1"}}
+	peer.ccData = map[string]*ccprovider.ChaincodeData{
+		"cc1": {Name: "cc1", Version: "v1", Escc: "escc", Vscc: "vscc", Policy: []byte("policy"), InstantiationPolicy: []byte("ipolicy"), Id: []byte("id")},
+	}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	result, err := l.QueryInstantiatedChaincodesWithMetadata(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	if !assert.NotNil(t, result) {
+		t.FailNow()
+	}
+	assert.Len(t, result.Responses, 1)
+	assert.Equal(t, map[string]*ChaincodeMetadata{
+		"cc1": {Name: "cc1", Version: "v1", Escc: "escc", Vscc: "vscc", Policy: []byte("policy"), InstantiationPolicy: []byte("ipolicy"), ID: []byte("id")},
+	}, result.Metadata)
+	// The data of cc2 can't be read so a warning is returned rather than an error
+	if assert.Len(t, result.Warnings, 1) {
+		assert.Contains(t, result.Warnings[0], "[cc2]")
+	}
+
+	// The errors of all of the targets are included in the warning
+	peer2 := newMockLedgerPeer("http://peer2.com", 0)
+	peer2.chaincodes = peer.chaincodes
+	peer2.rawCCData = map[string][]byte{"cc2": []byte("invalid")}
+	result, err = l.QueryInstantiatedChaincodesWithMetadata(reqCtx, []fab.ProposalProcessor{peer, peer2}, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, result) && assert.Len(t, result.Warnings, 1) {
+		assert.Contains(t, result.Warnings[0], "[cc2]")
+		assert.Contains(t, result.Warnings[0], "unmarshal of chaincode data from target [http://peer2.com] failed")
+		assert.Contains(t, result.Warnings[0], "http://peer1.com")
+	}
+
+	// The chaincode data isn't available with the new lifecycle
+	peer.definitions = &chaincodeDefinitionsResult{ChaincodeDefinitions: []*chaincodeDefinition{{Name: "cc1", Sequence: 1, Version: "v1"}}}
+	l, err = NewLedger("testChannel", WithChaincodeLifecycle(NewLifecycle))
+	assert.NoError(t, err)
+	result, err = l.QueryInstantiatedChaincodesWithMetadata(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, result) {
+		assert.Len(t, result.Responses, 1)
+		assert.Empty(t, result.Metadata)
+		assert.Len(t, result.Warnings, 1)
+	}
+
+	// An error is returned if the chaincodes can't be queried
+	peer.chaincodes = nil
+	l, err = NewLedger("testChannel")
+	assert.NoError(t, err)
+	result, err = l.QueryInstantiatedChaincodesWithMetadata(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
+
+func TestQueryInstantiatedChaincodesPage(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	payload, err := proto.Marshal(&pb.ChaincodeQueryResponse{Chaincodes: []*pb.ChaincodeInfo{
+		{Name: "cc3", Version: "v1"}, {Name: "cc1", Version: "v1"}, {Name: "cc5", Version: "v2"}, {Name: "cc2", Version: "v1"}, {Name: "cc4", Version: "v1"},
+	}})
+	assert.NoError(t, err)
+	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200, Payload: payload}
+	targets := []fab.ProposalProcessor{&peer}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	var names []string
+	token := ""
+	for i := 0; i < 3; i++ {
+		responses, next, err := channel.QueryInstantiatedChaincodesPage(reqCtx, token, 2, targets, nil)
+		assert.NoError(t, err)
+		if !assert.Len(t, responses, 1) {
+			return
+		}
+		assert.True(t, len(responses[0].Chaincodes) <= 2)
+		for _, cc := range responses[0].Chaincodes {
+			names = append(names, cc.Name)
+		}
+		token = next
+	}
+	assert.Equal(t, []string{"cc1", "cc2", "cc3", "cc4", "cc5"}, names)
+	assert.Empty(t, token, "expecting empty token after the last page")
+
+	_, _, err = channel.QueryInstantiatedChaincodesPage(reqCtx, "", 0, targets, nil)
+	assert.Error(t, err, "expecting error for invalid page size")
+	_, _, err = channel.QueryInstantiatedChaincodesPage(reqCtx, "not a token!", 2, targets, nil)
+	assert.Error(t, err, "expecting error for malformed token")
+	_, _, err = channel.QueryInstantiatedChaincodesPage(reqCtx, base64.RawURLEncoding.EncodeToString([]byte(`{"v":2,"after":"cc1"}`)), 2, targets, nil)
+	assert.Error(t, err, "expecting error for unsupported token version")
+	_, _, err = channel.QueryInstantiatedChaincodesPage(reqCtx, base64.RawURLEncoding.EncodeToString([]byte(`{"v":1}`)), 2, targets, nil)
+	assert.Error(t, err, "expecting error for token without chaincode name")
+
+	// No chaincode is skipped if the responses of the targets differ
+	newPeer := func(name string, ccNames ...string) *mocks.MockPeer {
+		var chaincodes []*pb.ChaincodeInfo
+		for _, ccName := range ccNames {
+			chaincodes = append(chaincodes, &pb.ChaincodeInfo{Name: ccName, Version: "v1", Path: name})
+		}
+		payload, err := proto.Marshal(&pb.ChaincodeQueryResponse{Chaincodes: chaincodes})
+		assert.NoError(t, err)
+		return &mocks.MockPeer{MockName: name, MockURL: "http://" + name + ".com", MockRoles: []string{}, Status: 200, Payload: payload}
+	}
+	targets = []fab.ProposalProcessor{newPeer("peer1", "cc1", "cc2", "cc3", "cc4", "cc5"), newPeer("peer2", "cc1", "cc4", "cc5", "cc6")}
+
+	returned := make(map[string][]string)
+	token = ""
+	for i := 0; i < 5; i++ {
+		responses, next, err := channel.QueryInstantiatedChaincodesPage(reqCtx, token, 2, targets, nil)
+		assert.NoError(t, err)
+		for _, response := range responses {
+			for _, cc := range response.Chaincodes {
+				returned[cc.Path] = append(returned[cc.Path], cc.Name)
+			}
+		}
+		if token = next; token == "" {
+			break
+		}
+	}
+	assert.Empty(t, token, "expecting empty token after the last page")
+	assert.Equal(t, []string{"cc1", "cc2", "cc3", "cc4", "cc5"}, returned["peer1"])
+	assert.Equal(t, []string{"cc1", "cc4", "cc4", "cc5", "cc5", "cc6"}, returned["peer2"], "expecting chaincodes of peer2 to be returned again")
+}
+
+func TestQueryBlockAndTxIndexByTxID(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	block := servicemocks.NewBlock("testChannel",
+		servicemocks.NewTransaction("txid1", pb.TxValidationCode_VALID, common.HeaderType_ENDORSER_TRANSACTION),
+		servicemocks.NewTransaction("txid2", pb.TxValidationCode_VALID, common.HeaderType_ENDORSER_TRANSACTION),
+		servicemocks.NewTransaction("txid2", pb.TxValidationCode_DUPLICATE_TXID, common.HeaderType_ENDORSER_TRANSACTION),
+	)
+	block.Header.Number = 7
+	payload, err := proto.Marshal(block)
+	assert.NoError(t, err)
+	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200, Payload: payload}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	locations, err := channel.QueryBlockAndTxIndexByTxID(reqCtx, "txid2", []fab.ProposalProcessor{&peer}, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, locations, 1) {
+		assert.Equal(t, uint64(7), locations[0].Block.Header.Number)
+		assert.Equal(t, 1, locations[0].TxIndex, "expecting the first matching transaction")
+	}
+
+	locations, err = channel.QueryBlockAndTxIndexByTxID(reqCtx, "txid3", []fab.ProposalProcessor{&peer}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not found in block 7")
+	assert.Empty(t, locations)
+
+	_, err = channel.QueryBlockAndTxIndexByTxID(reqCtx, "", []fab.ProposalProcessor{&peer}, nil)
+	assert.Error(t, err, "expecting error for empty txID")
+}
+
+func TestQueryTransaction(t *testing.T) {
+	channel, _ := setupTestLedger()
+	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	res, err := channel.QueryTransaction(reqCtx, "txid", []fab.ProposalProcessor{&peer}, nil)
+
+	if err != nil || res == nil {
+		t.Fatal("Test QueryTransaction failed")
+	}
+}
+
+func TestQueryTransactionValidationCode(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	payload, err := proto.Marshal(&pb.ProcessedTransaction{ValidationCode: int32(pb.TxValidationCode_MVCC_READ_CONFLICT)})
+	assert.NoError(t, err)
+	peer1 := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Status: 200, Payload: payload}
+	peer2 := mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Status: 200, Payload: []byte("invalid")}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	codes, err := channel.QueryTransactionValidationCode(reqCtx, "txid", []fab.ProposalProcessor{&peer1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []pb.TxValidationCode{pb.TxValidationCode_MVCC_READ_CONFLICT}, codes)
+
+	// The error from the target with an invalid response is returned along with the valid codes
+	codes, err = channel.QueryTransactionValidationCode(reqCtx, "txid", []fab.ProposalProcessor{&peer1, &peer2}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "From target: http://peer2.com")
+	assert.Equal(t, []pb.TxValidationCode{pb.TxValidationCode_MVCC_READ_CONFLICT}, codes)
+}
+
+func TestQueryTransactions(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	transactions := map[string]*pb.ProcessedTransaction{
+		"tx1": {ValidationCode: int32(pb.TxValidationCode_VALID)},
+		"tx2": {ValidationCode: int32(pb.TxValidationCode_MVCC_READ_CONFLICT)},
+	}
+	peer1 := newMockLedgerPeer("http://peer1.com", 0)
+	peer1.transactions = transactions
+	peer2 := newMockLedgerPeer("http://peer2.com", 0)
+	peer2.transactions = transactions
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	_, err := channel.QueryTransactions(reqCtx, nil, []fab.ProposalProcessor{peer1}, nil)
+	assert.Error(t, err, "expecting error for no transaction IDs")
+	_, err = channel.QueryTransactions(reqCtx, []fab.TransactionID{"tx1"}, nil, nil)
+	assert.Error(t, err, "expecting error for no targets")
+
+	results, err := channel.QueryTransactions(reqCtx, []fab.TransactionID{"tx1", "tx2", "tx1"}, []fab.ProposalProcessor{peer1, peer2}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, int32(pb.TxValidationCode_VALID), results["tx1"].ValidationCode)
+	assert.Equal(t, int32(pb.TxValidationCode_MVCC_READ_CONFLICT), results["tx2"].ValidationCode)
+
+	// Partial success: the transaction that isn't found is omitted and its error is returned
+	results, err = channel.QueryTransactions(reqCtx, []fab.TransactionID{"tx1", "tx3"}, []fab.ProposalProcessor{peer1, peer2}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "query for transaction tx3 failed")
+	assert.Len(t, results, 1)
+	assert.NotNil(t, results["tx1"])
+
+	// Responses that don't match
+	results, err = channel.QueryTransactions(reqCtx, []fab.TransactionID{"tx1"}, []fab.ProposalProcessor{peer1, peer2}, &TestVerifier{matchErr: errors.New("mismatch")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "responses for transaction tx1 do not match")
+	assert.Empty(t, results)
+}
+
+func TestQueryInfo(t *testing.T) {
+	channel, _ := setupTestLedger()
+	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	res, err := channel.QueryInfo(reqCtx, []fab.ProposalProcessor{&peer}, nil)
+
+	if err != nil || res == nil {
+		t.Fatalf("Test QueryInfo failed: %v", err)
+	}
+}
+
+func TestQueryBlockRaw(t *testing.T) {
+	l, err := setupTestLedger()
+	if err != nil {
+		t.Fatalf("Failed to setup test ledger: %s", err)
+	}
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 3)
+	peer2 := newMockLedgerPeer("http://peer2.com", 3)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	responses, err := l.QueryBlockRaw(reqCtx, 2, []fab.ProposalProcessor{peer1, peer2}, nil)
+	assert.NoError(t, err)
+	if !assert.Len(t, responses, 2) {
+		return
+	}
+	for _, response := range responses {
+		assert.Equal(t, []byte(response.Endorser), response.Identity)
+		block := &common.Block{}
+		assert.NoError(t, proto.Unmarshal(response.Payload, block))
+		assert.Equal(t, uint64(2), block.Header.Number)
+	}
+
+	// The responses are verified
+	responses, err = l.QueryBlockRaw(reqCtx, 2, []fab.ProposalProcessor{peer1, peer2}, &endorserVerifier{rejected: "http://peer2.com"})
+	assert.Error(t, err)
+	if !assert.Len(t, responses, 1) {
+		return
+	}
+	assert.Equal(t, "http://peer1.com", responses[0].Endorser)
+
+	_, err = l.QueryBlockByHashRaw(reqCtx, nil, []fab.ProposalProcessor{peer1}, nil)
+	assert.Error(t, err)
+	_, err = l.QueryBlockByTxIDRaw(reqCtx, "", []fab.ProposalProcessor{peer1}, nil)
+	assert.Error(t, err)
+}
+
+func TestQueryBlockFirstSuccess(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 3)
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Error: errors.New("connection refused")}
+	blocking := &blockingTarget{ProposalProcessor: newMockLedgerPeer("http://peer3.com", 3), cancelled: make(chan struct{})}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	_, err := channel.QueryBlockFirstSuccess(reqCtx, 1, nil, nil)
+	assert.Error(t, err, "expecting error for no targets")
+
+	// The first verified block is returned without waiting for the other targets, which are cancelled
+	block, err := channel.QueryBlockFirstSuccess(reqCtx, 1, []fab.ProposalProcessor{blocking, peer2, peer1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), block.Header.Number)
+	select {
+	case <-blocking.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting the outstanding proposal to be cancelled")
+	}
+
+	// A response that fails verification is skipped
+	rejecting := newMockLedgerPeer("http://peer4.com", 3)
+	verifier := &endorserVerifier{rejected: "http://peer4.com"}
+	block, err = channel.QueryBlockFirstSuccess(reqCtx, 2, []fab.ProposalProcessor{rejecting, peer1}, verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), block.Header.Number)
+
+	// The errors of all targets are returned if none of them returns a verified block
+	// (a new mock peer is used since the query of the previous mock peer may still be outstanding)
+	peer5 := &mocks.MockPeer{MockName: "Peer5", MockURL: "http://peer5.com", Error: errors.New("connection refused")}
+	_, err = channel.QueryBlockFirstSuccess(reqCtx, 1, []fab.ProposalProcessor{peer1, peer5}, &TestVerifier{verifyErr: errors.New("verify error")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "query for block 1 failed on all targets")
+	assert.Contains(t, err.Error(), "verify error")
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestVerifyBlockHashChain(t *testing.T) {
+	newChain := func(n int) []*common.Block {
+		var blocks []*common.Block
+		var previousHash []byte
+		for i := 0; i < n; i++ {
+			data := &common.BlockData{Data: [][]byte{[]byte(fmt.Sprintf("tx%d-1", i)), []byte(fmt.Sprintf("tx%d-2", i))}}
+			header := &common.BlockHeader{Number: uint64(i + 10), PreviousHash: previousHash, DataHash: BlockDataHash(data)}
+			hash, err := BlockHeaderHash(header)
+			assert.NoError(t, err)
+			previousHash = hash
+			blocks = append(blocks, &common.Block{Header: header, Data: data})
+		}
+		return blocks
+	}
+
+	// The data hash is the hash of the concatenated envelopes
+	dataHash := sha256.Sum256([]byte("ab"))
+	assert.Equal(t, dataHash[:], BlockDataHash(&common.BlockData{Data: [][]byte{[]byte("a"), []byte("b")}}))
+
+	index, err := VerifyBlockHashChain(newChain(3))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, index)
+
+	index, err = VerifyBlockHashChain(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, index)
+
+	blocks := newChain(3)
+	blocks[1].Data.Data[0] = []byte("tampered")
+	index, err = VerifyBlockHashChain(blocks)
+	assert.Error(t, err)
+	assert.Equal(t, 1, index)
+	assert.Contains(t, err.Error(), "data hash of block 11")
+
+	blocks = newChain(3)
+	blocks[1].Header.PreviousHash = []byte("tampered")
+	index, err = VerifyBlockHashChain(blocks)
+	assert.Error(t, err)
+	assert.Equal(t, 1, index)
+	assert.Contains(t, err.Error(), "previous hash of block 11")
+
+	// A tampered header breaks the link to the next block
+	blocks = newChain(3)
+	blocks[1].Header.DataHash = BlockDataHash(&common.BlockData{})
+	blocks[1].Data = &common.BlockData{}
+	index, err = VerifyBlockHashChain(blocks)
+	assert.Error(t, err)
+	assert.Equal(t, 2, index)
+
+	blocks = newChain(3)
+	index, err = VerifyBlockHashChain([]*common.Block{blocks[0], blocks[2]})
+	assert.Error(t, err)
+	assert.Equal(t, 1, index)
+	assert.Contains(t, err.Error(), "block 12 doesn't follow block 10")
+
+	index, err = VerifyBlockHashChain([]*common.Block{newChain(1)[0], {}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, index)
+}
+
+func TestTargetErrors(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	transportErr := errors.New("connection refused")
+	peer1 := newMockLedgerPeer("http://peer1.com", 3)
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Error: transportErr}
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Status: http.StatusInternalServerError}
+	peer4 := newMockLedgerPeer("http://peer4.com", 3)
+
+	blocks, err := channel.QueryBlock(reqCtx, 1, []fab.ProposalProcessor{peer1, peer2, peer3, peer4}, &endorserVerifier{rejected: "http://peer4.com"})
+	assert.Len(t, blocks, 1)
+	assert.Error(t, err)
+
+	// The errors remain human-readable
+	assert.Contains(t, err.Error(), "From target: http://peer2.com: connection refused")
+	assert.Contains(t, err.Error(), "bad status from http://peer3.com (500)")
+	assert.Contains(t, err.Error(), "failed to verify response from http://peer4.com: endorser [http://peer4.com] is rejected")
+
+	targetErrs := make(map[string]*TargetError)
+	for _, targetErr := range TargetErrors(err) {
+		targetErrs[targetErr.Endorser] = targetErr
+	}
+	assert.Len(t, targetErrs, 3)
+	if assert.Contains(t, targetErrs, "http://peer2.com") {
+		assert.Equal(t, transportErr, errors.Cause(targetErrs["http://peer2.com"]), "expecting the cause to be the error of the target")
+	}
+	assert.Contains(t, targetErrs, "http://peer3.com")
+	assert.Contains(t, targetErrs, "http://peer4.com")
+
+	// The target errors are found in wrapped errors
+	assert.Len(t, TargetErrors(errors.WithMessage(err, "query failed")), 3)
+	assert.Empty(t, TargetErrors(errors.New("not a target error")))
+	assert.Empty(t, TargetErrors(nil))
+}
+
+func TestQueryHighestPeers(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 3)
+	peer2 := newMockLedgerPeer("http://peer2.com", 5)
+	peer3 := newMockLedgerPeer("http://peer3.com", 5)
+	peer4 := &mocks.MockPeer{MockName: "Peer4", MockURL: "http://peer4.com", Error: errors.New("connection refused")}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	_, _, err := channel.QueryHighestPeers(reqCtx, nil, nil)
+	assert.Error(t, err, "expecting error for no targets")
+
+	// All of the peers at the maximum height are returned
+	highest, height, err := channel.QueryHighestPeers(reqCtx, []fab.ProposalProcessor{peer1, peer2, peer3}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), height)
+	assert.Equal(t, []fab.ProposalProcessor{peer2, peer3}, highest)
+
+	// The error of a target that didn't respond is returned along with the selected targets
+	highest, height, err = channel.QueryHighestPeers(reqCtx, []fab.ProposalProcessor{peer1, peer4}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, uint64(3), height)
+	assert.Equal(t, []fab.ProposalProcessor{peer1}, highest)
+
+	_, _, err = channel.QueryHighestPeers(reqCtx, []fab.ProposalProcessor{peer4}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to determine the ledger height")
+}
+
+func TestQueryInfoMSPID(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	endorser, err := proto.Marshal(&mb.SerializedIdentity{Mspid: "Org1MSP", IdBytes: []byte("cert")})
+	assert.NoError(t, err)
+
+	// The MSP ID is resolved from the endorsement identity, or else from the target
+	peer1 := &mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockMSP: "OtherMSP", Status: 200, Endorser: endorser}
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", MockMSP: "Org2MSP", Status: 200}
+	peer3 := newMockLedgerPeer("http://peer3.com", 1)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	responses, err := channel.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2, peer3}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 3)
+
+	mspIDs := make(map[string]string)
+	for _, response := range responses {
+		mspIDs[response.Endorser] = response.MSPID
+	}
+	assert.Equal(t, map[string]string{"http://peer1.com": "Org1MSP", "http://peer2.com": "Org2MSP", "http://peer3.com": ""}, mspIDs)
+}
+
+func TestQueryHeight(t *testing.T) {
+	l, err := setupTestLedger()
+	if err != nil {
+		t.Fatalf("Failed to setup test ledger: %s", err)
+	}
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 2)
+	peer2 := newMockLedgerPeer("http://peer2.com", 5)
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Status: 500}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	heights, err := l.QueryHeight(reqCtx, []fab.ProposalProcessor{peer1, peer2}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"http://peer1.com": 2, "http://peer2.com": 5}, heights)
+
+	// The heights of the targets that responded are returned along with the errors
+	heights, err = l.QueryHeight(reqCtx, []fab.ProposalProcessor{peer1, peer3}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]uint64{"http://peer1.com": 2}, heights)
+}
+
+func TestQueryInfoCache(t *testing.T) {
+	_, err := NewLedger("testChannel", WithInfoCache(nil))
+	assert.Error(t, err)
+
+	eventService := newInfoCacheEventService()
+	l, err := NewLedger("testChannel", WithInfoCache(eventService))
+	assert.NoError(t, err)
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 2)
+	peer2 := newMockLedgerPeer("http://peer2.com", 2)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	queryHeights := func(targets ...fab.ProposalProcessor) map[string]uint64 {
+		responses, err := l.QueryInfo(reqCtx, targets, nil)
+		assert.NoError(t, err)
+		heights := make(map[string]uint64)
+		for _, response := range responses {
+			heights[response.Endorser] = response.BCI.Height
+		}
+		return heights
+	}
+
+	assert.Equal(t, map[string]uint64{"http://peer1.com": 2}, queryHeights(peer1))
+
+	// The response of peer1 is cached until the next block event whereas peer2 is queried
+	peer1.addBlocks(1)
+	peer2.addBlocks(1)
+	assert.Equal(t, map[string]uint64{"http://peer1.com": 2, "http://peer2.com": 3}, queryHeights(peer1, peer2))
+
+	// A block event invalidates the cache
+	eventService.eventch <- &fab.FilteredBlockEvent{FilteredBlock: &pb.FilteredBlock{Number: 2}}
+	waitForInfoHeight(t, queryHeights, peer1, 3)
+	assert.Equal(t, map[string]uint64{"http://peer1.com": 3, "http://peer2.com": 3}, queryHeights(peer1, peer2))
+
+	// Once the ledger is closed, the subscription is removed and nothing is cached
+	l.Close()
+	l.Close()
+	assert.Equal(t, 1, eventService.numUnregistered())
+	peer1.addBlocks(1)
+	waitForInfoHeight(t, queryHeights, peer1, 4)
+	peer1.addBlocks(1)
+	assert.Equal(t, map[string]uint64{"http://peer1.com": 5}, queryHeights(peer1))
+
+	// The responses of gRPC peers are identified by address rather than by URL
+	l, err = NewLedger("testChannel", WithInfoCache(newInfoCacheEventService()))
+	assert.NoError(t, err)
+	defer l.Close()
+
+	peer3 := newMockLedgerPeer("grpcs://peer3.com:7051", 2)
+	assert.Equal(t, map[string]uint64{"peer3.com:7051": 2}, queryHeights(peer3))
+	peer3.addBlocks(1)
+	assert.Equal(t, map[string]uint64{"peer3.com:7051": 2}, queryHeights(peer3), "expecting the cached response of the gRPC peer")
+}
+
+// waitForInfoHeight queries the peer until the returned height matches the expected height (i.e. the cache was invalidated)
+func waitForInfoHeight(t *testing.T, queryHeights func(targets ...fab.ProposalProcessor) map[string]uint64, peer *mockLedgerPeer, expected uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for queryHeights(peer)[peer.url] != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for height %d of %s", expected, peer.url)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// infoCacheEventService is an event service that delivers the filtered block events that are sent to eventch
+type infoCacheEventService struct {
+	*mocks.MockEventService
+	eventch      chan *fab.FilteredBlockEvent
+	mutex        sync.Mutex
+	unregistered int
+}
+
+func newInfoCacheEventService() *infoCacheEventService {
+	return &infoCacheEventService{
+		MockEventService: mocks.NewMockEventService(),
+		eventch:          make(chan *fab.FilteredBlockEvent),
+	}
+}
+
+// RegisterFilteredBlockEvent registers for filtered block events
+func (s *infoCacheEventService) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
+	return &struct{}{}, s.eventch, nil
+}
+
+// Unregister closes the event channel
+func (s *infoCacheEventService) Unregister(reg fab.Registration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unregistered++
+	close(s.eventch)
+}
+
+func (s *infoCacheEventService) numUnregistered() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.unregistered
+}
+
+func TestQueryWithDiscovery(t *testing.T) {
+	peer1 := &mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Status: 200}
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Status: 200}
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Status: 200}
+	discovery := mocks.NewMockDiscoveryService(nil, []fab.Peer{peer1, peer2})
+
+	l, err := NewLedger("testChannel", WithDiscovery(discovery))
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	responses, err := l.QueryInfo(reqCtx, nil, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	// Explicit targets override discovery
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer3}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "http://peer3.com", responses[0].Endorser)
+
+	// Membership changes are picked up
+	discovery.Peers = []fab.Peer{peer1, peer2, peer3}
+	responses, err = l.QueryInfo(reqCtx, nil, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 3)
+
+	discovery.Peers = []fab.Peer{}
+	_, err = l.QueryInfo(reqCtx, nil, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "discovery returned no peers")
+
+	discovery.Error = errors.New("discovery failed")
+	_, err = l.QueryConfigBlock(reqCtx, nil, &TestVerifier{})
+	assert.Error(t, err)
+
+	_, err = NewLedger("testChannel", WithDiscovery(nil))
+	assert.Error(t, err)
+}
+
+func TestMaxLag(t *testing.T) {
+	peer1 := newMockLedgerPeer("http://peer1.com", 10)
+	peer2 := newMockLedgerPeer("http://peer2.com", 8)
+	peer3 := newMockLedgerPeer("http://peer3.com", 5)
+	targets := []fab.ProposalProcessor{peer1, peer2, peer3}
+
+	observer := &testLagObserver{}
+	l, err := NewLedger("testChannel", WithMaxLag(2), WithObserver(observer))
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// Lagging responses are filtered from the QueryInfo responses
+	responses, err := l.QueryInfo(reqCtx, targets, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected response from http://peer3.com")
+	assert.Len(t, responses, 2)
+	assert.Len(t, observer.lagEvents, 1)
+	assert.Equal(t, uint64(10), observer.lagEvents[0].MaxHeight)
+	assert.Equal(t, map[string]uint64{"http://peer3.com": 5}, observer.lagEvents[0].Rejected)
+
+	// Lagging targets are excluded from other queries
+	blocks, err := l.QueryBlock(reqCtx, 4, targets, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Len(t, blocks, 2)
+	assert.Len(t, observer.lagEvents, 2)
+
+	// Zero lag only accepts the freshest targets
+	l, err = NewLedger("testChannel", WithMaxLag(0))
+	assert.NoError(t, err)
+	responses, _ = l.QueryInfo(reqCtx, targets, &TestVerifier{})
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "http://peer1.com", responses[0].Endorser)
+
+	// No lagging targets
+	l, err = NewLedger("testChannel", WithMaxLag(5))
+	assert.NoError(t, err)
+	blocks, err = l.QueryBlock(reqCtx, 4, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 3)
+
+	// The targets of gRPC peers are matched to the endorsers of the probe responses by address
+	grpcPeer1 := newMockLedgerPeer("grpcs://peer1.com:7051", 10)
+	grpcPeer2 := newMockLedgerPeer("grpcs://peer2.com:7051", 5)
+	l, err = NewLedger("testChannel", WithMaxLag(2))
+	assert.NoError(t, err)
+	blocks, err = l.QueryBlock(reqCtx, 4, []fab.ProposalProcessor{grpcPeer1, grpcPeer2}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected response from peer2.com:7051")
+	assert.Len(t, blocks, 1)
+}
+
+type testLagObserver struct {
+	testObserver
+	lagEvents []*LagRejectionEvent
+}
+
+func (o *testLagObserver) TargetsLagging(event *LagRejectionEvent) {
+	o.lagEvents = append(o.lagEvents, event)
+}
+
+func TestFreshnessVerifier(t *testing.T) {
+	peer1 := newMockLedgerPeer("http://peer1.com", 5)
+	peer2 := newMockLedgerPeer("http://peer2.com", 3)
+	verifier := NewFreshnessVerifier()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2}, verifier)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	// peer1's ledger is replaced with a shorter ledger
+	peer1.blocks = peer1.blocks[:2]
+	peer2.addBlocks(1)
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2}, verifier)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "http://peer2.com", responses[0].Endorser)
+	regressionErr, ok := errors.Cause(err).(*HeightRegressionError)
+	assert.True(t, ok, "expecting HeightRegressionError but got %v", err)
+	assert.Equal(t, "http://peer1.com", regressionErr.Endorser)
+	assert.Equal(t, uint64(2), regressionErr.Height)
+	assert.Equal(t, uint64(5), regressionErr.PreviousHeight)
+
+	verifier.Reset("http://peer1.com")
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2}, verifier)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	peer2.blocks = peer2.blocks[:1]
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer2}, verifier)
+	assert.Error(t, err)
+	verifier.Reset()
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer2}, verifier)
+	assert.NoError(t, err)
+}
+
+func TestQueryChannelStatus(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 3)
+	peer1.configBlock = builder.Build()
+	peer2 := newMockLedgerPeer("http://peer2.com", 5)
+	peer2.configBlock = peer1.configBlock
+	targets := []fab.ProposalProcessor{peer1, peer2}
+
+	height, configSeq, err := channel.QueryChannelStatus(reqCtx, targets, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), height)
+	assert.Equal(t, uint64(0), configSeq)
+
+	// Config query fails - the height is still returned
+	height, _, err = channel.QueryChannelStatus(reqCtx, targets, &TransactionProposalResponseVerifier{MinResponses: 3})
+	assert.Equal(t, uint64(5), height)
+	statusErr, ok := err.(*ChannelStatusError)
+	assert.True(t, ok, "expecting ChannelStatusError")
+	assert.Nil(t, statusErr.HeightErr)
+	assert.NotNil(t, statusErr.ConfigSeqErr)
+
+	// Both queries fail
+	badPeer := mocks.NewMockPeer("Peer1", "http://peer1.com")
+	badPeer.Status = http.StatusInternalServerError
+	_, _, err = channel.QueryChannelStatus(reqCtx, []fab.ProposalProcessor{badPeer}, &TransactionProposalResponseVerifier{MinResponses: 1})
+	assert.Error(t, err)
+	_, ok = err.(*ChannelStatusError)
+	assert.False(t, ok, "expecting plain error when both queries fail")
+}
+
+func TestQueryLastConfigUpdate(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+
+	peer := newMockLedgerPeer("http://peer1.com", 1)
+	peer.configBlock = builder.Build()
+	verifier := &TransactionProposalResponseVerifier{MinResponses: 1}
+
+	// The genesis config has no last update
+	_, _, err := channel.QueryLastConfigUpdate(reqCtx, []fab.ProposalProcessor{peer}, verifier)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not contain a last update")
+
+	configUpdate := &common.ConfigUpdate{ChannelId: "testchannel", WriteSet: &common.ConfigGroup{Version: 1}}
+	peer.configBlock = withLastUpdate(t, builder.Build(), configUpdate, &mb.SerializedIdentity{Mspid: "Org1MSP", IdBytes: []byte("cert1")}, []byte("signature1"))
+
+	update, signatures, err := channel.QueryLastConfigUpdate(reqCtx, []fab.ProposalProcessor{peer}, verifier)
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(configUpdate, update), "unexpected config update")
+	assert.Equal(t, []*SignatureInfo{{MSPID: "Org1MSP", Certificate: []byte("cert1"), Signature: []byte("signature1")}}, signatures)
+}
+
+// withLastUpdate sets the last update of the config in the given config block to a config update
+// transaction containing the given update, signed by the given signer
+func withLastUpdate(t *testing.T, block *common.Block, configUpdate *common.ConfigUpdate, signer *mb.SerializedIdentity, signature []byte) *common.Block {
+	creator, err := proto.Marshal(signer)
+	assert.NoError(t, err)
+	sigHeader, err := proto.Marshal(&common.SignatureHeader{Creator: creator})
+	assert.NoError(t, err)
+	configUpdateBytes, err := proto.Marshal(configUpdate)
+	assert.NoError(t, err)
+	configUpdateEnvelope, err := proto.Marshal(&common.ConfigUpdateEnvelope{
+		ConfigUpdate: configUpdateBytes,
+		Signatures:   []*common.ConfigSignature{{SignatureHeader: sigHeader, Signature: signature}},
+	})
+	assert.NoError(t, err)
+	lastUpdatePayload, err := proto.Marshal(&common.Payload{Data: configUpdateEnvelope})
+	assert.NoError(t, err)
+
+	envelope := &common.Envelope{}
+	assert.NoError(t, proto.Unmarshal(block.Data.Data[0], envelope))
+	payload := &common.Payload{}
+	assert.NoError(t, proto.Unmarshal(envelope.Payload, payload))
+	configEnvelope := &common.ConfigEnvelope{}
+	assert.NoError(t, proto.Unmarshal(payload.Data, configEnvelope))
+
+	configEnvelope.LastUpdate = &common.Envelope{Payload: lastUpdatePayload}
+
+	payload.Data, err = proto.Marshal(configEnvelope)
+	assert.NoError(t, err)
+	envelope.Payload, err = proto.Marshal(payload)
+	assert.NoError(t, err)
+	block.Data.Data[0], err = proto.Marshal(envelope)
+	assert.NoError(t, err)
+
+	return block
+}
+
+func TestStaleFallback(t *testing.T) {
+	ledger, err := NewLedger("testChannel", WithStaleFallback())
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer := newMockLedgerPeer("http://peer1.com", 3)
+	peer.configBlock = builder.Build()
+	badPeer := mocks.NewMockPeer("Peer1", "http://peer1.com")
+	badPeer.Status = http.StatusInternalServerError
+	verifier := &TransactionProposalResponseVerifier{MinResponses: 1}
+
+	// No cached result
+	_, err = ledger.QueryInfo(reqCtx, []fab.ProposalProcessor{badPeer}, nil)
+	assert.Error(t, err)
+	assert.False(t, IsStaleResult(err), "expecting failure when there's no cached result")
+
+	// Fresh results
+	infos, err := ledger.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	_, err = ledger.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{peer}, verifier)
+	assert.NoError(t, err)
+
+	// All targets fail - the cached results are returned
+	infos, err = ledger.QueryInfo(reqCtx, []fab.ProposalProcessor{badPeer}, nil)
+	assert.True(t, IsStaleResult(err), "expecting stale result")
+	assert.Len(t, infos, 1)
+	assert.Equal(t, uint64(3), infos[0].BCI.Height)
+	staleErr, ok := err.(*StaleResultError)
+	assert.True(t, ok)
+	assert.Error(t, staleErr.Err, "expecting the error of the failed query")
+	assert.False(t, staleErr.CachedAt.IsZero())
+
+	configEnvelope, err := ledger.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{badPeer}, verifier)
+	assert.True(t, IsStaleResult(err), "expecting stale config")
+	assert.NotNil(t, configEnvelope)
+
+	height, _, err := ledger.QueryChannelStatus(reqCtx, []fab.ProposalProcessor{badPeer}, verifier)
+	assert.True(t, IsStaleResult(err), "expecting stale channel status")
+	assert.Equal(t, uint64(3), height)
+
+	// Different queries are cached separately
+	_, err = ledger.QueryBlock(reqCtx, 1, []fab.ProposalProcessor{badPeer}, nil)
+	assert.Error(t, err)
+	assert.False(t, IsStaleResult(err), "expecting no cached result for block query")
+
+	// The fallback is disabled by default
+	ledger, err = NewLedger("testChannel")
+	assert.NoError(t, err)
+	_, err = ledger.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, nil)
+	assert.NoError(t, err)
+	_, err = ledger.QueryInfo(reqCtx, []fab.ProposalProcessor{badPeer}, nil)
+	assert.Error(t, err)
+	assert.False(t, IsStaleResult(err))
+}
+
+func TestStaleCacheKey(t *testing.T) {
+	key := staleCacheKey(fab.ChaincodeInvokeRequest{ChaincodeID: "qscc", Fcn: "GetBlockByHash", Args: [][]byte{[]byte("ch"), []byte("a/b")}})
+	assert.NotEqual(t, key, staleCacheKey(fab.ChaincodeInvokeRequest{ChaincodeID: "qscc", Fcn: "GetBlockByHash", Args: [][]byte{[]byte("ch"), []byte("a"), []byte("b")}}))
+	assert.NotEqual(t, key, staleCacheKey(fab.ChaincodeInvokeRequest{ChaincodeID: "qscc", Fcn: "GetBlockByHash", Args: [][]byte{[]byte("ch/a/b")}}))
+	assert.NotEqual(t, key, staleCacheKey(fab.ChaincodeInvokeRequest{ChaincodeID: "qscc/GetBlockByHash", Args: [][]byte{[]byte("ch"), []byte("a/b")}}))
+	assert.Equal(t, key, staleCacheKey(fab.ChaincodeInvokeRequest{ChaincodeID: "qscc", Fcn: "GetBlockByHash", Args: [][]byte{[]byte("ch"), []byte("a/b")}}))
+}
+
+func TestQueryConfigBlockWithBlock(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer := newMockLedgerPeer("http://peer1.com", 1)
+	peer.configBlock = builder.Build()
+	peer.configBlock.Header.Number = 12
+	targets := []fab.ProposalProcessor{peer}
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	configEnvelope, block, err := l.QueryConfigBlockWithBlock(reqCtx, targets, &TransactionProposalResponseVerifier{MinResponses: 1})
+	assert.NoError(t, err)
+	assert.NotNil(t, configEnvelope)
+	if assert.NotNil(t, block) {
+		assert.Equal(t, uint64(12), block.Header.Number)
+	}
+
+	// The block isn't returned if the responses don't match
+	configEnvelope, block, err = l.QueryConfigBlockWithBlock(reqCtx, targets, &TestVerifier{matchErr: errors.New("mismatch")})
+	assert.Error(t, err)
+	assert.Nil(t, configEnvelope)
+	assert.Nil(t, block)
+}
+
+func TestMinHeightVerifier(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer1 := newMockLedgerPeer("http://peer1.com", 1)
+	peer1.configBlock = builder.Build()
+	peer1.configBlock.Header.Number = 12
+	// peer2 is behind and returns an older config block
+	peer2 := newMockLedgerPeer("http://peer2.com", 1)
+	peer2.configBlock = builder.Build()
+	peer2.configBlock.Header.Number = 3
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	minHeight := uint64(13)
+	verifier := NewMinHeightVerifier(func() (uint64, error) { return minHeight, nil })
+
+	_, block, err := l.QueryConfigBlockWithBlock(reqCtx, []fab.ProposalProcessor{peer2, peer1}, verifier)
+	assert.NoError(t, err)
+	if assert.NotNil(t, block) {
+		assert.Equal(t, uint64(12), block.Header.Number, "expecting the config block of the peer that isn't behind")
+	}
+
+	_, _, err = l.QueryConfigBlockWithBlock(reqCtx, []fab.ProposalProcessor{peer2}, verifier)
+	assert.Error(t, err)
+	targetErrs := TargetErrors(err)
+	if !assert.Len(t, targetErrs, 1) {
+		t.FailNow()
+	}
+	staleErr, ok := errors.Cause(targetErrs[0].Err).(*StaleResponseError)
+	if assert.True(t, ok, "expecting StaleResponseError but got %v", err) {
+		assert.Equal(t, "http://peer2.com", staleErr.Endorser)
+		assert.Equal(t, uint64(4), staleErr.Height)
+		assert.Equal(t, uint64(13), staleErr.MinHeight)
+	}
+
+	// The threshold is controlled by the caller
+	minHeight = 4
+	_, block, err = l.QueryConfigBlockWithBlock(reqCtx, []fab.ProposalProcessor{peer2}, verifier)
+	assert.NoError(t, err)
+	if assert.NotNil(t, block) {
+		assert.Equal(t, uint64(3), block.Header.Number)
+	}
+
+	verifier = NewMinHeightVerifier(func() (uint64, error) { return 0, errors.New("no consensus") })
+	_, _, err = l.QueryConfigBlockWithBlock(reqCtx, []fab.ProposalProcessor{peer1}, verifier)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no consensus")
+}
+
+func TestQueryConfigBlockByNumber(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+		Index: 1,
+	}
+	peer := newMockLedgerPeer("http://peer1.com", 3)
+	peer.blocks[1] = builder.Build()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	verifier := &TransactionProposalResponseVerifier{MinResponses: 1}
+
+	configEnvelope, block, err := l.QueryConfigBlockByNumber(reqCtx, 1, []fab.ProposalProcessor{peer}, verifier)
+	assert.NoError(t, err)
+	if assert.NotNil(t, configEnvelope) && assert.NotNil(t, block) {
+		assert.NotNil(t, configEnvelope.Config)
+		assert.Equal(t, uint64(1), block.Header.Number)
+	}
+
+	_, _, err = l.QueryConfigBlockByNumber(reqCtx, 2, []fab.ProposalProcessor{peer}, verifier)
+	assert.Error(t, err, "expecting error for a block that isn't a config block")
+	assert.Contains(t, err.Error(), "query for config block 2 failed")
+
+	_, _, err = l.QueryConfigBlockByNumber(reqCtx, 5, []fab.ProposalProcessor{peer}, verifier)
+	assert.Error(t, err, "expecting error for a block that doesn't exist")
+
+	_, _, err = l.QueryConfigBlockByNumber(reqCtx, 1, nil, verifier)
+	assert.Error(t, err, "expecting error for no targets")
+}
+
+func TestQueryConfigSummary(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org2MSP", "Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer := newMockLedgerPeer("http://peer1.com", 1)
+	peer.configBlock = builder.Build()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	summary, err := l.QueryConfigSummary(reqCtx, []fab.ProposalProcessor{peer}, &TransactionProposalResponseVerifier{MinResponses: 1})
+	assert.NoError(t, err)
+	if !assert.NotNil(t, summary) {
+		return
+	}
+	assert.NotNil(t, summary.Envelope, "expecting the raw config envelope")
+	assert.Equal(t, []string{"localhost:9999"}, summary.OrdererAddresses)
+	assert.Equal(t, []string{"Org1MSP", "Org2MSP", "OrdererMSP"}, summary.MSPIDs())
+	if assert.Len(t, summary.ApplicationOrgs, 2) {
+		assert.Equal(t, [][]byte{[]byte(validRootCA)}, summary.ApplicationOrgs[0].RootCerts)
+	}
+
+	_, err = ParseConfigSummary(&common.ConfigEnvelope{})
+	assert.Error(t, err, "expecting error for config envelope without config")
+}
+
+func TestMajorityVerifier(t *testing.T) {
+	newResponse := func(payload string) *fab.TransactionProposalResponse {
+		return &fab.TransactionProposalResponse{
+			Endorser:         "peer",
+			Status:           http.StatusOK,
+			ProposalResponse: &pb.ProposalResponse{Response: &pb.Response{Status: http.StatusOK, Payload: []byte(payload)}},
+		}
+	}
+
+	verifier := NewMajorityVerifier()
+
+	_, err := verifier.MajorityPayload(nil)
+	assert.Error(t, err, "expecting error for no responses")
+
+	payload, err := verifier.MajorityPayload([]*fab.TransactionProposalResponse{newResponse("a")})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), payload)
+
+	payload, err = verifier.MajorityPayload([]*fab.TransactionProposalResponse{newResponse("b"), newResponse("a"), newResponse("a")})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), payload)
+
+	err = verifier.Match([]*fab.TransactionProposalResponse{newResponse("a"), newResponse("a"), newResponse("b"), newResponse("b")})
+	assert.Error(t, err, "expecting error for even split")
+
+	err = verifier.Match([]*fab.TransactionProposalResponse{newResponse("a"), newResponse("b"), newResponse("c")})
+	assert.Error(t, err, "expecting error when no payload has a majority")
+
+	assert.NoError(t, verifier.Verify(newResponse("a")))
+	bad := newResponse("a")
+	bad.ProposalResponse.Response.Status = http.StatusInternalServerError
+	assert.Error(t, verifier.Verify(bad))
+	assert.Error(t, verifier.Verify(&fab.TransactionProposalResponse{Endorser: "peer"}))
+
+	// The config block that the majority agree on is selected
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer1 := newMockLedgerPeer("http://peer1.com", 1)
+	peer1.configBlock = builder.Build()
+	builder.OrdererAddress = "localhost:8888"
+	peer2 := newMockLedgerPeer("http://peer2.com", 1)
+	peer2.configBlock = builder.Build()
+	peer3 := newMockLedgerPeer("http://peer3.com", 1)
+	peer3.configBlock = peer2.configBlock
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	configEnvelope, err := l.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{peer1, peer2, peer3}, verifier)
+	assert.NoError(t, err)
+	expected, err := createConfigEnvelope(peer2.configBlock.Data.Data[0])
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(expected, configEnvelope), "expecting the majority config")
+
+	_, err = l.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{peer1, peer2}, verifier)
+	assert.Error(t, err, "expecting error when there's no majority")
+}
+
+func TestMinMSPsVerifier(t *testing.T) {
+	newResponse := func(endorser string, mspID string) *fab.TransactionProposalResponse {
+		identity, err := proto.Marshal(&mb.SerializedIdentity{Mspid: mspID, IdBytes: []byte("cert")})
+		assert.NoError(t, err)
+		return &fab.TransactionProposalResponse{
+			Endorser:         endorser,
+			Status:           http.StatusOK,
+			ProposalResponse: &pb.ProposalResponse{Response: &pb.Response{Status: http.StatusOK}, Endorsement: &pb.Endorsement{Endorser: identity}},
+		}
+	}
+
+	verifier := NewMinMSPsVerifier(nil, 2)
+	assert.NoError(t, verifier.Verify(newResponse("peer1", "Org1MSP")))
+	assert.NoError(t, verifier.Match([]*fab.TransactionProposalResponse{newResponse("peer1", "Org1MSP"), newResponse("peer2", "Org2MSP")}))
+
+	err := verifier.Match([]*fab.TransactionProposalResponse{newResponse("peer1", "Org1MSP"), newResponse("peer2", "Org1MSP")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "responses from 1 distinct MSP(s) but at least 2 are required")
+
+	// Responses whose MSP can't be resolved don't count
+	unresolved := newResponse("peer3", "")
+	noEndorsement := &fab.TransactionProposalResponse{Endorser: "peer4", ProposalResponse: &pb.ProposalResponse{}}
+	err = verifier.Match([]*fab.TransactionProposalResponse{newResponse("peer1", "Org1MSP"), unresolved, noEndorsement})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to resolve the MSP of endorsers [peer3, peer4]")
+
+	// The decorated verifier is applied first
+	verifier = NewMinMSPsVerifier(&TestVerifier{verifyErr: errors.New("verify failed"), matchErr: errors.New("mismatch")}, 1)
+	assert.EqualError(t, verifier.Verify(newResponse("peer1", "Org1MSP")), "verify failed")
+	assert.EqualError(t, verifier.Match([]*fab.TransactionProposalResponse{newResponse("peer1", "Org1MSP")}), "mismatch")
+
+	// The config block selected by a decorated MajorityVerifier is returned
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer1 := newMockLedgerPeer("http://peer1.com", 1)
+	peer1.configBlock = builder.Build()
+	builder.OrdererAddress = "localhost:8888"
+	peer2 := newMockLedgerPeer("http://peer2.com", 1)
+	peer2.configBlock = builder.Build()
+	peer3 := newMockLedgerPeer("http://peer3.com", 1)
+	peer3.configBlock = peer2.configBlock
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	targets := []fab.ProposalProcessor{
+		&mspTarget{ProposalProcessor: peer1, mspID: "Org1MSP"},
+		&mspTarget{ProposalProcessor: peer2, mspID: "Org1MSP"},
+		&mspTarget{ProposalProcessor: peer3, mspID: "Org2MSP"},
+	}
+	configEnvelope, err := l.QueryConfigBlock(reqCtx, targets, NewMinMSPsVerifier(NewMajorityVerifier(), 2))
+	assert.NoError(t, err)
+	expected, err := createConfigEnvelope(peer2.configBlock.Data.Data[0])
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(expected, configEnvelope), "expecting the majority config")
+
+	_, err = l.QueryConfigBlock(reqCtx, targets, NewMinMSPsVerifier(NewMajorityVerifier(), 3))
+	assert.Error(t, err, "expecting error when the responses don't span enough MSPs")
+}
+
+func TestAllOfVerifier(t *testing.T) {
+	response := &fab.TransactionProposalResponse{Endorser: "peer1"}
+	responses := []*fab.TransactionProposalResponse{response}
+
+	first := &countingVerifier{}
+	second := &countingVerifier{TestVerifier: TestVerifier{verifyErr: errors.New("verify error 2"), matchErr: errors.New("match error 2")}}
+	third := &countingVerifier{TestVerifier: TestVerifier{verifyErr: errors.New("verify error 3"), matchErr: errors.New("match error 3")}}
+	verifier := AllOf(first, nil, second, third)
+
+	// Verify stops at the first verifier that rejects the response
+	err := verifier.Verify(response)
+	assert.EqualError(t, err, "verify error 2")
+	assert.Equal(t, 1, first.verified)
+	assert.Equal(t, 1, second.verified)
+	assert.Equal(t, 0, third.verified, "expecting verification to stop at the first error")
+
+	// Match runs all verifiers and returns all errors
+	err = verifier.Match(responses)
+	assert.Error(t, err)
+	errs, ok := err.(multi.Errors)
+	assert.True(t, ok, "expecting multi.Errors but got %T", err)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, err.Error(), "match error 2")
+	assert.Contains(t, err.Error(), "match error 3")
+	assert.Equal(t, 1, first.matched)
+	assert.Equal(t, 1, second.matched)
+	assert.Equal(t, 1, third.matched)
+
+	verifier = AllOf(first, &TestVerifier{})
+	assert.NoError(t, verifier.Verify(response))
+	assert.NoError(t, verifier.Match(responses))
+
+	assert.NoError(t, AllOf().Verify(response), "expecting no verifiers to accept the response")
+	assert.NoError(t, AllOf().Match(responses), "expecting no verifiers to accept the responses")
+
+	// The payload selector of a combined verifier is used to select the config block
+	selector, ok := payloadSelectorOf(AllOf(&TestVerifier{}, NewMinMSPsVerifier(NewMajorityVerifier(), 1)))
+	assert.True(t, ok, "expecting payload selector of the combined verifiers")
+	assert.IsType(t, &MajorityVerifier{}, selector)
+	_, ok = payloadSelectorOf(AllOf(&TestVerifier{}))
+	assert.False(t, ok, "expecting no payload selector")
+}
+
+// countingVerifier is a TestVerifier that counts the calls to Verify and Match
+type countingVerifier struct {
+	TestVerifier
+	verified int
+	matched  int
+}
+
+func (v *countingVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	v.verified++
+	return v.TestVerifier.Verify(response)
+}
+
+func (v *countingVerifier) Match(responses []*fab.TransactionProposalResponse) error {
+	v.matched++
+	return v.TestVerifier.Match(responses)
+}
+
+// mspTarget sets the endorser identity of the responses of the target to an identity of the given MSP
+type mspTarget struct {
+	fab.ProposalProcessor
+	mspID string
+}
+
+func (t *mspTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	response, err := t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := proto.Marshal(&mb.SerializedIdentity{Mspid: t.mspID, IdBytes: []byte(response.Endorser)})
+	if err != nil {
+		return nil, err
+	}
+	response.ProposalResponse.Endorsement = &pb.Endorsement{Endorser: identity, Signature: []byte("signature")}
+	return response, nil
+}
+
+func TestQueryInfoConsensus(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 5)
+	peer2 := newMockLedgerPeer("http://peer2.com", 5)
+	height, _, err := l.QueryInfoConsensus(reqCtx, []fab.ProposalProcessor{peer1, peer2}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), height)
+
+	peer3 := newMockLedgerPeer("http://peer3.com", 3)
+	_, _, err = l.QueryInfoConsensus(reqCtx, []fab.ProposalProcessor{peer1, peer2, peer3}, nil)
+	divergenceErr, ok := errors.Cause(err).(*InfoDivergenceError)
+	if assert.True(t, ok, "expecting InfoDivergenceError") {
+		assert.Equal(t, uint64(5), divergenceErr.MaxHeight)
+		assert.Equal(t, map[string]uint64{"http://peer1.com": 5, "http://peer2.com": 5, "http://peer3.com": 3}, divergenceErr.Heights)
+		assert.Equal(t, []*PeerDivergence{{Endorser: "http://peer3.com", Height: 3, Lag: 2}}, divergenceErr.Divergences)
+	}
+
+	// Forked peer
+	newResponse := func(endorser string, height uint64, hash string) *fab.BlockchainInfoResponse {
+		return &fab.BlockchainInfoResponse{Endorser: endorser, BCI: &common.BlockchainInfo{Height: height, CurrentBlockHash: []byte(hash)}}
+	}
+	height, hash, err := infoConsensus([]*fab.BlockchainInfoResponse{newResponse("peer1", 7, "a"), newResponse("peer2", 7, "a")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), height)
+	assert.Equal(t, []byte("a"), hash)
+
+	_, _, err = infoConsensus([]*fab.BlockchainInfoResponse{newResponse("peer3", 7, "b"), newResponse("peer1", 7, "a"), newResponse("peer2", 7, "a"), newResponse("peer4", 6, "c")})
+	divergenceErr, ok = err.(*InfoDivergenceError)
+	if assert.True(t, ok, "expecting InfoDivergenceError") {
+		assert.Equal(t, []*PeerDivergence{{Endorser: "peer3", Height: 7, Forked: true}, {Endorser: "peer4", Height: 6, Lag: 1}}, divergenceErr.Divergences)
+		assert.Contains(t, err.Error(), "peer3 forked at height 7")
+		assert.Contains(t, err.Error(), "peer4 lags by 1 blocks")
+	}
+
+	_, _, err = l.QueryInfoConsensus(reqCtx, []fab.ProposalProcessor{peer1, &flakyTarget{ProposalProcessor: peer2, failures: 1, err: errors.New("unavailable")}}, nil)
+	assert.Error(t, err, "expecting error when a target fails")
+}
+
+func TestQueryBlockByNumberRange(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer1 := newMockLedgerPeer("http://peer1.com", 5)
+	peer2 := newMockLedgerPeer("http://peer2.com", 5)
+	targets := []fab.ProposalProcessor{peer1, peer2}
+
+	l, err := NewLedger("testChannel", WithMaxBlockRange(4))
+	assert.NoError(t, err)
+
+	blocks, err := l.QueryBlockByNumberRange(reqCtx, 1, 3, targets, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, blocks, 3) {
+		for i, block := range blocks {
+			assert.Equal(t, uint64(i+1), block.Header.Number)
+		}
+	}
+
+	// A missing block doesn't abort the range
+	peer1.blocks[3].Data.Data[0] = []byte("mismatch")
+	blocks, err = l.QueryBlockByNumberRange(reqCtx, 2, 5, targets, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "block 3")
+	assert.Contains(t, err.Error(), "block 5")
+	if assert.Len(t, blocks, 2) {
+		assert.Equal(t, uint64(2), blocks[0].Header.Number)
+		assert.Equal(t, uint64(4), blocks[1].Header.Number)
+	}
+
+	_, err = l.QueryBlockByNumberRange(reqCtx, 0, 4, targets, nil)
+	assert.Error(t, err, "expecting error for range exceeding the maximum")
+	_, err = l.QueryBlockByNumberRange(reqCtx, 3, 2, targets, nil)
+	assert.Error(t, err, "expecting error for invalid range")
+	_, err = l.QueryBlockByNumberRange(reqCtx, 0, 1, nil, nil)
+	assert.Error(t, err, "expecting error for no targets")
+
+	_, err = NewLedger("testChannel", WithMaxBlockRange(0))
+	assert.Error(t, err)
+}
+
+func TestScanBlocks(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer := newMockLedgerPeer("http://peer1.com", 5)
+	targets := []fab.ProposalProcessor{peer}
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	var scanned []uint64
+	err = l.ScanBlocks(reqCtx, 1, 6, targets, nil, func(block *common.Block) error {
+		scanned = append(scanned, block.Header.Number)
+		return nil
+	})
+	assert.Error(t, err, "expecting error for missing block 5")
+	assert.Contains(t, err.Error(), "block 6")
+	assert.Equal(t, []uint64{1, 2, 3, 4}, scanned)
+
+	// The scan stops when the handler returns an error
+	handlerErr := errors.New("handler error")
+	scanned = nil
+	err = l.ScanBlocks(reqCtx, 0, 4, targets, nil, func(block *common.Block) error {
+		scanned = append(scanned, block.Header.Number)
+		if block.Header.Number == 2 {
+			return handlerErr
+		}
+		return nil
+	})
+	assert.Equal(t, handlerErr, errors.Cause(err))
+	assert.Equal(t, []uint64{0, 1, 2}, scanned)
+
+	// The scan stops when the context is canceled between blocks
+	scanCtx, scanCancel := reqContext.WithCancel(reqCtx)
+	defer scanCancel()
+	scanned = nil
+	err = l.ScanBlocks(scanCtx, 0, 4, targets, nil, func(block *common.Block) error {
+		scanned = append(scanned, block.Header.Number)
+		scanCancel()
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, reqContext.Canceled, errors.Cause(err))
+	assert.Equal(t, []uint64{0}, scanned)
+
+	assert.Error(t, l.ScanBlocks(reqCtx, 2, 1, targets, nil, func(*common.Block) error { return nil }))
+	assert.Error(t, l.ScanBlocks(reqCtx, 0, 1, targets, nil, nil))
+}
+
+func TestQueryBlockTimestamps(t *testing.T) {
+	ledger, _ := setupTestLedger()
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	start := time.Unix(1500000000, 0).UTC()
+	peer := newMockLedgerPeer("http://peer1.com", 0)
+	for i := 0; i < 3; i++ {
+		peer.blocks = append(peer.blocks, newTimestampedBlock(t, uint64(i), start.Add(time.Duration(i)*time.Second)))
+	}
+	// A block whose transaction has no timestamp
+	peer.blocks = append(peer.blocks, servicemocks.NewBlock("testChannel", servicemocks.NewTransaction("txid", pb.TxValidationCode_VALID, common.HeaderType_ENDORSER_TRANSACTION)))
+	peer.blocks[3].Header.Number = 3
+	targets := []fab.ProposalProcessor{peer}
+
+	timestamps, err := ledger.QueryBlockTimestamps(reqCtx, 0, 2, targets, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint64]time.Time{0: start, 1: start.Add(time.Second), 2: start.Add(2 * time.Second)}, timestamps)
+
+	timestamps, err = ledger.QueryBlockTimestamps(reqCtx, 2, 3, targets, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no timestamp for block 3")
+	assert.Equal(t, map[uint64]time.Time{2: start.Add(2 * time.Second)}, timestamps)
+
+	// Block 4 doesn't exist - the timestamps retrieved so far are returned
+	timestamps, err = ledger.QueryBlockTimestamps(reqCtx, 1, 4, targets, nil)
+	assert.Error(t, err)
+	assert.Len(t, timestamps, 2)
+
+	_, err = ledger.QueryBlockTimestamps(reqCtx, 2, 1, targets, nil)
+	assert.Error(t, err, "expecting error for invalid range")
+}
+
+// newTimestampedBlock returns a block containing a transaction with the given timestamp in its channel header
+func newTimestampedBlock(t *testing.T, number uint64, timestamp time.Time) *common.Block {
+	ts, err := ptypes.TimestampProto(timestamp)
+	assert.NoError(t, err)
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: fmt.Sprintf("txid%d", number), Timestamp: ts})
+	assert.NoError(t, err)
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}})
+	assert.NoError(t, err)
+	envelope, err := proto.Marshal(&common.Envelope{Payload: payload})
+	assert.NoError(t, err)
+
+	return &common.Block{
+		Header: &common.BlockHeader{Number: number},
+		Data:   &common.BlockData{Data: [][]byte{envelope}},
+	}
+}
+
+func TestQueryMultiChannelHeights(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	badPeer := mocks.NewMockPeer("Peer1", "http://peer1.com")
+	badPeer.Status = http.StatusInternalServerError
+
+	channelTargets := map[string][]fab.ProposalProcessor{
+		"channel1": {newMockLedgerPeer("http://peer1.com", 3), newMockLedgerPeer("http://peer2.com", 5)},
+		"channel2": {newMockLedgerPeer("http://peer1.com", 7)},
+		"channel3": {badPeer},
+	}
+
+	heights, err := QueryMultiChannelHeights(reqCtx, channelTargets, nil)
+	assert.Error(t, err, "expecting error for channel3")
+	assert.Contains(t, err.Error(), "channel3")
+	assert.Equal(t, map[string]uint64{"channel1": 5, "channel2": 7}, heights)
+
+	delete(channelTargets, "channel3")
+	heights, err = QueryMultiChannelHeights(reqCtx, channelTargets, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"channel1": 5, "channel2": 7}, heights)
+}
+
+func TestQueryConfig(t *testing.T) {
+	channel, _ := setupTestLedger()
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// empty targets
+	_, err := channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{}, nil)
+	if err == nil {
+		t.Fatalf("Should have failed due to empty targets")
+	}
+
+	// min endorsers <= 0
+	_, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{mocks.NewMockPeer("Peer1", "http://peer1.com")}, &TransactionProposalResponseVerifier{})
+	if err == nil {
+		t.Fatalf("Should have failed due to empty targets")
+	}
+
+	// peer without payload
+	_, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{mocks.NewMockPeer("Peer1", "http://peer1.com")}, &TransactionProposalResponseVerifier{MinResponses: 1})
+	if err == nil {
+		t.Fatalf("Should have failed due to nil block metadata")
+	}
+
+	// create config block builder in order to create valid payload
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy: "Admins",
+			MSPNames: []string{
+				"Org1MSP",
+				"Org2MSP",
+			},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+		Index:           0,
+		LastConfigIndex: 0,
+	}
+
+	payload, err := proto.Marshal(builder.Build())
+	if err != nil {
+		t.Fatalf("Failed to marshal mock block")
+	}
+
+	// peer with valid config block payload
+	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Payload: payload, Status: 200}
+
+	// fail with min endorsers
+	res, err := channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	if err == nil {
+		t.Fatalf("Should have failed with since there's one endorser and at least two are required")
+	}
+
+	// success with one endorser
+	res, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 1})
+	if err != nil || res == nil {
+		t.Fatalf("Test QueryConfig failed: %v", err)
+	}
+
+	// config unchanged
+	res, changed, err := channel.QueryConfigIfChanged(reqCtx, 0, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 1})
+	if err != nil || changed || res != nil {
+		t.Fatalf("Expecting unchanged config but got changed [%t], err: %v", changed, err)
+	}
+
+	// config changed since known sequence
+	res, changed, err = channel.QueryConfigIfChanged(reqCtx, 5, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 1})
+	if err != nil || !changed || res == nil {
+		t.Fatalf("Expecting changed config but got changed [%t], err: %v", changed, err)
+	}
+
+	_, _, err = channel.QueryConfigIfChanged(reqCtx, 0, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	if err == nil {
+		t.Fatalf("Should have failed with since there's one endorser and at least two are required")
+	}
+
+	// create second endorser with same payload
+	peer2 := mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", MockRoles: []string{}, MockCert: nil, Payload: payload, Status: 200}
+
+	// success with two endorsers
+	res, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer, &peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	if err != nil || res == nil {
+		t.Fatalf("Test QueryConfig failed: %v", err)
+	}
+
+	// Create different config block payload
+	builder2 := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy: "Admins",
+			MSPNames: []string{
+				"Org1MSP",
+			},
+			OrdererAddress: "builder2:9999",
+			RootCA:         validRootCA,
+		},
+		Index:           0,
+		LastConfigIndex: 0,
+	}
+
+	payload2, err := proto.Marshal(builder2.Build())
+	if err != nil {
+		t.Fatalf("Failed to marshal mock block 2")
+	}
+
+	// peer 2 now had different payload; query config block should fail
+	peer2.Payload = payload2
+	res, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer, &peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	if err == nil {
+		t.Fatalf("Should have failed for different block payloads")
+	}
+
+}
+
+func TestQueryConfigBlockDifferentMetadata(t *testing.T) {
+	channel, _ := setupTestLedger()
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy: "Admins",
+			MSPNames: []string{
+				"Org1MSP",
+				"Org2MSP",
+			},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+		Index:           0,
+		LastConfigIndex: 0,
+	}
+
+	b := builder.Build()
+	b.Metadata = &common.BlockMetadata{Metadata: [][]byte{[]byte("test1")}}
+
+	payload1, err := proto.Marshal(b)
+	assert.Nil(t, err, "Failed to marshal mock block")
+
+	b.Metadata = &common.BlockMetadata{Metadata: [][]byte{[]byte("test2")}}
+	payload2, err := proto.Marshal(b)
+	assert.Nil(t, err, "Failed to marshal mock block")
+
+	peer1 := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Payload: payload1, Status: 200}
+	peer2 := mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", MockRoles: []string{}, MockCert: nil, Payload: payload2, Status: 200}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	_, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer1, &peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.Nil(t, err, "Expected success querying blocks with identical block data payloads")
+}
+
+func TestFilterResponses(t *testing.T) {
+	tprs := []*fab.TransactionProposalResponse{}
+	err := fmt.Errorf("test")
+	for i := 0; i <= 100; i++ {
+		var s int
+		if i%2 == 0 {
+			s = 200
+		} else {
+			s = 500
+		}
+		tprs = append(tprs, &fab.TransactionProposalResponse{Status: int32(s)})
+	}
+	f, errs := filterResponses(tprs, err, &TestVerifier{}, nil)
+	assert.Len(t, f, 51)
+	assert.Len(t, errs.(multi.Errors), 51)
+}
+
+func TestFilterResponsesWithVerifyError(t *testing.T) {
+	tprs := []*fab.TransactionProposalResponse{}
+	err := fmt.Errorf("test")
+	tprs = append(tprs, &fab.TransactionProposalResponse{Status: 200})
+	f, errs := filterResponses(tprs, err, &TestVerifier{verifyErr: errors.New("error")}, nil)
+	assert.Len(t, f, 0)
+	assert.Len(t, errs.(multi.Errors), 2)
+}
+
+func TestFilterResponsesWithPostVerifyHook(t *testing.T) {
+	tprs := []*fab.TransactionProposalResponse{
+		{Endorser: "peer1", Status: 200},
+		{Endorser: "peer2", Status: 200},
+		{Endorser: "peer3", Status: 500},
+	}
+
+	var accepted []string
+	hook := func(response *fab.TransactionProposalResponse) error {
+		accepted = append(accepted, response.Endorser)
+		if response.Endorser == "peer2" {
+			return errors.New("rejected")
+		}
+		return nil
+	}
+
+	f, errs := filterResponses(tprs, nil, &TestVerifier{}, &responseHooks{postVerify: hook})
+	assert.Len(t, f, 1)
+	assert.Equal(t, "peer1", f[0].Endorser)
+	assert.Equal(t, []string{"peer1", "peer2"}, accepted, "hook should only be invoked for verified responses")
+	assert.Len(t, errs.(multi.Errors), 2)
+
+	// The hook is not invoked if verification fails
+	accepted = nil
+	tprs = []*fab.TransactionProposalResponse{{Endorser: "peer1", Status: 200}}
+	_, err := filterResponses(tprs, nil, &TestVerifier{verifyErr: errors.New("error")}, &responseHooks{postVerify: hook})
+	assert.Error(t, err)
+	assert.Empty(t, accepted)
+
+	// The hook is applied via the ledger option
+	peer := newMockLedgerPeer("http://peer1.com", 1)
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := NewLedger("testChannel", WithPostVerifyHook(hook))
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://peer1.com"}, accepted)
+}
+
+func TestVerificationRejectedObserver(t *testing.T) {
+	observer := &testObserver{}
+	peer := newMockLedgerPeer("http://peer1.com", 1)
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := NewLedger("testChannel", WithObserver(observer))
+	assert.NoError(t, err)
+
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Empty(t, observer.events)
+
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer}, &TestVerifier{verifyErr: errors.New("invalid signature")})
+	assert.Error(t, err)
+	assert.Len(t, observer.events, 1)
+	assert.Equal(t, &VerificationRejectedEvent{ChannelID: "testChannel", Endorser: "http://peer1.com", Reason: "invalid signature"}, observer.events[0])
+
+	// Bad status responses are not reported
+	tprs := []*fab.TransactionProposalResponse{{Endorser: "peer1", Status: 500}}
+	_, err = filterResponses(tprs, nil, &TestVerifier{verifyErr: errors.New("error")}, &responseHooks{observer: observer})
+	assert.Error(t, err)
+	assert.Len(t, observer.events, 1)
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	payload, err := proto.Marshal(&common.BlockchainInfo{Height: 10, CurrentBlockHash: make([]byte, 64)})
+	assert.NoError(t, err)
+	smallPayload, err := proto.Marshal(&common.BlockchainInfo{Height: 10})
+	assert.NoError(t, err)
+	peer1 := &mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Status: 200, Payload: payload}
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Status: 200, Payload: smallPayload}
+
+	_, err = NewLedger("testChannel", WithMaxResponseSize(0))
+	assert.Error(t, err, "expecting error for zero maximum response size")
+
+	// The default maximum accepts typical responses
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	observer := &testObserver{}
+	l, err = NewLedger("testChannel", WithMaxResponseSize(32), WithObserver(observer))
+	assert.NoError(t, err)
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("response from http://peer1.com rejected: payload size %d bytes exceeds the maximum of 32 bytes", len(payload)))
+	if assert.Len(t, responses, 1) {
+		assert.Equal(t, "http://peer2.com", responses[0].Endorser)
+	}
+	if assert.Len(t, observer.events, 1) {
+		assert.Equal(t, "http://peer1.com", observer.events[0].Endorser)
+	}
+}
+
+type testObserver struct {
+	events []*VerificationRejectedEvent
+}
+
+func (o *testObserver) VerificationRejected(event *VerificationRejectedEvent) {
+	o.events = append(o.events, event)
+}
+
+type testSelectionObserver struct {
+	testObserver
+	selections []*TargetSelectionEvent
+}
+
+func (o *testSelectionObserver) TargetsSelected(event *TargetSelectionEvent) {
+	o.selections = append(o.selections, event)
+}
+
+// concurrentObserver is an Observer that is safe for concurrent use
+type concurrentObserver struct {
+	mutex      sync.Mutex
+	rejections int
+	selections int
+	lagging    int
+}
+
+func (o *concurrentObserver) VerificationRejected(event *VerificationRejectedEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.rejections++
+}
+
+func (o *concurrentObserver) TargetsSelected(event *TargetSelectionEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.selections++
+}
+
+func (o *concurrentObserver) TargetsLagging(event *LagRejectionEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.lagging++
+}
+
+// TestLedgerConcurrentQueries shares a single Ledger (with all of its stateful options enabled) across
+// many goroutines. It's intended to be run with the race detector.
+func TestLedgerConcurrentQueries(t *testing.T) {
+	observer := &concurrentObserver{}
+	ledger, err := NewLedger("testChannel",
+		WithObserver(observer),
+		WithDeadlineAwareTargets(NewLatencyStats()),
+		WithRetryClassifier(nil),
+		WithMaxLag(10),
+		WithEndorserTimeout(5*time.Second),
+		WithResponseCompression("http://peer2.com"),
+		WithPostVerifyHook(func(response *fab.TransactionProposalResponse) error { return nil }),
+		WithStaleFallback(),
+	)
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer1 := newMockLedgerPeer("http://peer1.com", 5)
+	peer1.configBlock = builder.Build()
+	peer2 := newMockLedgerPeer("http://peer2.com", 5)
+	peer2.configBlock = peer1.configBlock
+	targets := []fab.ProposalProcessor{peer1, peer2}
+
+	freshnessVerifier := NewFreshnessVerifier()
+	verifier := &TransactionProposalResponseVerifier{MinResponses: 1}
+
+	const numGoroutines = 20
+	const numIterations = 5
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numIterations; j++ {
+				infos, err := ledger.QueryInfo(reqCtx, targets, freshnessVerifier)
+				assert.NoError(t, err)
+				assert.Len(t, infos, 2)
+
+				blocks, err := ledger.QueryBlock(reqCtx, 2, targets, verifier)
+				assert.NoError(t, err)
+				assert.Len(t, blocks, 2)
+
+				_, err = ledger.QueryConfigBlock(reqCtx, targets, verifier)
+				assert.NoError(t, err)
+
+				height, _, err := ledger.QueryChannelStatus(reqCtx, targets, verifier)
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(5), height)
+
+				pageBlocks, _, err := ledger.QueryBlockPage(reqCtx, "", 2, targets, verifier)
+				assert.NoError(t, err)
+				assert.Len(t, pageBlocks, 2)
+
+				// The mock peers don't support the following queries (or the blocks don't contain valid
+				// transactions) so only the code paths are exercised
+				_, _ = ledger.QueryBlockByHash(reqCtx, []byte("hash"), targets, verifier)
+				_, _ = ledger.QueryBlockByTxID(reqCtx, "txid", targets, verifier)
+				_, _ = ledger.QueryTransaction(reqCtx, "txid", targets, verifier)
+				_, _ = ledger.QueryInstantiatedChaincodes(reqCtx, targets, verifier)
+				_, _, _ = ledger.QueryConfigIfChanged(reqCtx, 0, targets, verifier)
+				_, _, _ = ledger.QueryLastConfigUpdate(reqCtx, targets, verifier)
+				_, _ = ledger.QueryTransactionsInBlockRange(reqCtx, 0, 1, targets, verifier)
+			}
+		}()
+	}
+	wg.Wait()
+
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+	assert.Equal(t, 0, observer.lagging, "expecting no lagging targets")
+}
+
+func TestLatencyStats(t *testing.T) {
+	stats := NewLatencyStats()
+	_, ok := stats.P95("peer1")
+	assert.False(t, ok)
+
+	for i := 1; i <= 100; i++ {
+		stats.Record("peer1", time.Duration(i)*time.Millisecond)
+	}
+	p95, ok := stats.P95("peer1")
+	assert.True(t, ok)
+	assert.Equal(t, 95*time.Millisecond, p95)
+
+	// Only the most recent samples are kept
+	for i := 0; i < maxLatencySamples; i++ {
+		stats.Record("peer1", time.Millisecond)
+	}
+	p95, _ = stats.P95("peer1")
+	assert.Equal(t, time.Millisecond, p95)
+}
+
+func TestDeadlineAwareTargets(t *testing.T) {
+	stats := NewLatencyStats()
+	stats.Record("http://slow.com", time.Minute)
+	stats.Record("http://slower.com", 2*time.Minute)
+
+	fast := newMockLedgerPeer("http://fast.com", 1)
+	slow := newMockLedgerPeer("http://slow.com", 1)
+	slower := newMockLedgerPeer("http://slower.com", 1)
+	unknown := newMockLedgerPeer("http://unknown.com", 1)
+	stats.Record("http://fast.com", time.Millisecond)
+
+	observer := &testSelectionObserver{}
+	l, err := NewLedger("testChannel", WithDeadlineAwareTargets(stats), WithObserver(observer))
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{fast, slow, unknown}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+	assert.Len(t, observer.selections, 1)
+	assert.Equal(t, []string{"http://fast.com", "http://unknown.com"}, observer.selections[0].Selected)
+	assert.Equal(t, []string{"http://slow.com"}, observer.selections[0].Excluded)
+	assert.False(t, observer.selections[0].Fallback)
+
+	// The latency of the queried targets is recorded
+	_, ok := stats.P95("http://unknown.com")
+	assert.True(t, ok)
+
+	// None of the targets qualify so the fastest is queried
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{slower, slow}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "http://slow.com", responses[0].Endorser)
+	assert.True(t, observer.selections[1].Fallback)
+	assert.Equal(t, []string{"http://slower.com"}, observer.selections[1].Excluded)
+
+	_, err = NewLedger("testChannel", WithDeadlineAwareTargets(nil))
+	assert.Error(t, err)
+}
+
+func TestRetryClassifier(t *testing.T) {
+	unavailable := status.New(status.EndorserServerStatus, int32(common.Status_SERVICE_UNAVAILABLE), "service unavailable", nil)
+	assert.True(t, DefaultRetryClassifier(unavailable))
+	assert.False(t, DefaultRetryClassifier(status.New(status.EndorserServerStatus, int32(common.Status_BAD_REQUEST), "bad request", nil)))
+	assert.False(t, DefaultRetryClassifier(errors.New("peer unavailable")))
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// No retries unless a classifier is configured
+	target := &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 1), failures: 1, err: unavailable}
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{target}, &TestVerifier{})
+	assert.Error(t, err)
+
+	target = &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 1), failures: 1, err: unavailable}
+	l, err = NewLedger("testChannel", WithRetryClassifier(nil))
+	assert.NoError(t, err)
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{target}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, 2, target.attempts)
+
+	// A custom classifier may treat other errors as retryable
+	peerErr := errors.New("peer is catching up")
+	target = &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 1), failures: 1, err: peerErr}
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{target}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, target.attempts)
+
+	l, err = NewLedger("testChannel", WithRetryClassifier(func(err error) bool { return err == peerErr }))
+	assert.NoError(t, err)
+	target = &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 1), failures: 1, err: peerErr}
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{target}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, 2, target.attempts)
+}
+
+func TestWithRetry(t *testing.T) {
+	unavailable := status.New(status.EndorserServerStatus, int32(common.Status_SERVICE_UNAVAILABLE), "service unavailable", nil)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	retryOpts := retry.Opts{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, BackoffFactor: 2}
+	l, err := NewLedger("testChannel", WithRetry(retryOpts))
+	assert.NoError(t, err)
+
+	// Only the failed target is retried
+	healthy := &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 1)}
+	flaky := &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer2.com", 1), failures: 3, err: unavailable}
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{healthy, flaky}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+	assert.Equal(t, 1, healthy.attempts)
+	assert.Equal(t, 4, flaky.attempts)
+
+	// Attempts are exhausted
+	flaky = &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer2.com", 1), failures: 4, err: unavailable}
+	_, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{flaky}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Equal(t, 4, flaky.attempts)
+
+	// Retries stop at the request deadline
+	l, err = NewLedger("testChannel", WithRetry(retry.Opts{Attempts: 10, InitialBackoff: time.Minute, MaxBackoff: time.Minute, BackoffFactor: 1}))
+	assert.NoError(t, err)
+	shortCtx, shortCancel := reqContext.WithTimeout(reqCtx, 100*time.Millisecond)
+	defer shortCancel()
+	flaky = &flakyTarget{ProposalProcessor: newMockLedgerPeer("http://peer2.com", 1), failures: 10, err: unavailable}
+	start := time.Now()
+	_, err = l.QueryInfo(shortCtx, []fab.ProposalProcessor{flaky}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "expecting retries to stop at the deadline")
+	assert.Equal(t, 1, flaky.attempts)
+
+	_, err = NewLedger("testChannel", WithRetry(retry.Opts{Attempts: -1}))
+	assert.Error(t, err)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	slow := &slowTarget{ProposalProcessor: newMockLedgerPeer("http://slow.com", 1), delay: 10 * time.Second}
+	fast := newMockLedgerPeer("http://fast.com", 1)
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(30*time.Second))
+	defer cancel()
+
+	start := time.Now()
+	_, err = l.QueryInfo(WithQueryTimeout(reqCtx, 100*time.Millisecond), []fab.ProposalProcessor{slow}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "expecting the query timeout to fire")
+
+	// The request context isn't affected
+	assert.NoError(t, reqCtx.Err())
+	responses, err := l.QueryInfo(WithQueryTimeout(reqCtx, 5*time.Second), []fab.ProposalProcessor{fast}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+
+	_, ok := queryTimeout(reqCtx)
+	assert.False(t, ok)
+	_, ok = queryTimeout(WithQueryTimeout(reqCtx, 0))
+	assert.False(t, ok, "expecting zero timeout to be ignored")
+}
+
+func TestQueryHeaderReuse(t *testing.T) {
+	target := &txIDTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 2)}
+	targets := []fab.ProposalProcessor{target}
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// A new header is created for each query by default
+	_, err = l.QueryInfo(reqCtx, targets, nil)
+	assert.NoError(t, err)
+	_, err = l.QueryBlock(reqCtx, 1, targets, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, target.txIDs, 2) {
+		assert.NotEqual(t, target.txIDs[0], target.txIDs[1])
+	}
+
+	ctx, ok := context.RequestClientContext(reqCtx)
+	assert.True(t, ok)
+	txh, err := txn.NewHeader(ctx, "testChannel")
+	assert.NoError(t, err)
+
+	target.txIDs = nil
+	queryCtx := WithQueryHeader(reqCtx, txh)
+	_, err = l.QueryInfo(queryCtx, targets, nil)
+	assert.NoError(t, err)
+	_, err = l.QueryBlock(queryCtx, 1, targets, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(txh.TransactionID()), string(txh.TransactionID())}, target.txIDs)
+
+	// The header must be for the channel of the ledger
+	otherTxh, err := txn.NewHeader(ctx, "otherChannel")
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(WithQueryHeader(reqCtx, otherTxh), targets, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "query header is for channel [otherChannel]")
+}
+
+// txIDTarget records the transaction IDs of the proposals that are sent to the target
+type txIDTarget struct {
+	fab.ProposalProcessor
+	txIDs []string
+}
+
+func (t *txIDTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	proposal := &pb.Proposal{}
+	if err := proto.Unmarshal(request.SignedProposal.ProposalBytes, proposal); err != nil {
+		return nil, err
+	}
+	header, err := utils.GetHeader(proposal.Header)
+	if err != nil {
+		return nil, err
+	}
+	channelHeader, err := utils.UnmarshalChannelHeader(header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+	t.txIDs = append(t.txIDs, channelHeader.TxId)
+	return t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+}
+
+func TestOrderedTargets(t *testing.T) {
+	l, err := NewLedger("testChannel", WithOrderedTargets())
+	assert.NoError(t, err)
+
+	// The targets respond in the reverse order (the endorsers of gRPC peers are identified by address rather than URL)
+	peer1 := &delayedLedgerPeer{mockLedgerPeer: newMockLedgerPeer("grpcs://peer1.com:7051", 3), delay: 150 * time.Millisecond}
+	peer2 := &delayedLedgerPeer{mockLedgerPeer: newMockLedgerPeer("grpcs://peer2.com:7051", 1), delay: 100 * time.Millisecond}
+	peer3 := &delayedLedgerPeer{mockLedgerPeer: newMockLedgerPeer("grpcs://peer3.com:7051", 3), delay: 50 * time.Millisecond}
+	peer4 := newMockLedgerPeer("grpcs://peer4.com:7051", 1)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// Block 2 isn't found on peer2 and peer4
+	blocks, err := l.QueryBlockRaw(reqCtx, 2, []fab.ProposalProcessor{peer1, peer2, peer3, peer4}, nil)
+	assert.Error(t, err)
+	var endorsers []string
+	for _, block := range blocks {
+		endorsers = append(endorsers, block.Endorser)
+	}
+	assert.Equal(t, []string{"peer1.com:7051", "peer3.com:7051"}, endorsers)
+
+	endorsers = nil
+	for _, targetErr := range TargetErrors(err) {
+		endorsers = append(endorsers, targetErr.Endorser)
+	}
+	assert.Equal(t, []string{"peer2.com:7051", "peer4.com:7051"}, endorsers)
+}
+
+// delayedLedgerPeer is a mockLedgerPeer that responds after a delay
+type delayedLedgerPeer struct {
+	*mockLedgerPeer
+	delay time.Duration
+}
+
+func (p *delayedLedgerPeer) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	time.Sleep(p.delay)
+	return p.mockLedgerPeer.ProcessTransactionProposal(reqCtx, request)
+}
+
+func TestTargetDeduplication(t *testing.T) {
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// The same peer under two URLs
+	peer1 := newMockLedgerPeer("grpcs://Peer1.com:7051", 1)
+	peer1Alias := newMockLedgerPeer("peer1.com:7051", 1)
+	peer2 := newMockLedgerPeer("grpcs://peer2.com:7051", 1)
+
+	builder := &mocks.MockConfigBlockBuilder{
+		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
+			ModPolicy:      "Admins",
+			MSPNames:       []string{"Org1MSP"},
+			OrdererAddress: "localhost:9999",
+			RootCA:         validRootCA,
+		},
+	}
+	peer1.configBlock = builder.Build()
+	peer1Alias.configBlock = peer1.configBlock
+	peer2.configBlock = peer1.configBlock
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	_, err = l.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{peer1, peer1Alias, peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.NoError(t, err)
+
+	_, err = l.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{peer1, peer1Alias}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.Error(t, err, "expecting duplicate target to count once towards the minimum responses")
+
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer1Alias, peer2}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	// Targets without a URL are never collapsed
+	noURL1 := &slowTarget{ProposalProcessor: newMockLedgerPeer("http://peer3.com", 1)}
+	noURL2 := &slowTarget{ProposalProcessor: newMockLedgerPeer("http://peer3.com", 1)}
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{noURL1, noURL2}, &TransactionProposalResponseVerifier{MinResponses: 2})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+
+	// Custom key function
+	l, err = NewLedger("testChannel", WithTargetKey(func(target fab.ProposalProcessor) string { return "same" }))
+	assert.NoError(t, err)
+	responses, err = l.QueryInfo(reqCtx, []fab.ProposalProcessor{peer1, peer2}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+
+	_, err = NewLedger("testChannel", WithTargetKey(nil))
+	assert.Error(t, err)
+
+	assert.Equal(t, "@peer1.com:7051", DefaultTargetKey(peer1))
+	assert.Equal(t, "Org1MSP@peer1.com:7051", DefaultTargetKey(mocks.NewMockPeer("Peer1", "grpcs://peer1.com:7051")))
+}
+
+func TestEndorserTimeout(t *testing.T) {
+	fast := newMockLedgerPeer("http://fast.com", 1)
+	slow := &slowTarget{ProposalProcessor: newMockLedgerPeer("http://slow.com", 1), delay: 10 * time.Second}
+
+	l, err := NewLedger("testChannel", WithEndorserTimeout(100*time.Millisecond))
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(30*time.Second))
+	defer cancel()
+
+	start := time.Now()
+	responses, err := l.QueryInfo(reqCtx, []fab.ProposalProcessor{fast, slow}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Len(t, responses, 1)
+	assert.Equal(t, "http://fast.com", responses[0].Endorser)
+	assert.True(t, time.Since(start) < 5*time.Second, "expecting the slow endorser to be abandoned")
+
+	// The request deadline wins if it fires first
+	l, err = NewLedger("testChannel", WithEndorserTimeout(time.Minute))
+	assert.NoError(t, err)
+	shortCtx, shortCancel := reqContext.WithTimeout(reqCtx, 100*time.Millisecond)
+	defer shortCancel()
+	start = time.Now()
+	_, err = l.QueryInfo(shortCtx, []fab.ProposalProcessor{slow}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "expecting the request deadline to fire first")
+
+	_, err = NewLedger("testChannel", WithEndorserTimeout(0))
+	assert.Error(t, err)
+}
+
+// slowTarget delays the response of the target until the delay has elapsed or the context is done
+func TestConcurrencyLimit(t *testing.T) {
+	var mutex sync.Mutex
+	inflight := 0
+	maxInflight := 0
+
+	var targets []fab.ProposalProcessor
+	for i := 0; i < 5; i++ {
+		targets = append(targets, &countingTarget{
+			ProposalProcessor: newMockLedgerPeer(fmt.Sprintf("http://peer%d.com", i), 1),
+			onStart: func() {
+				mutex.Lock()
+				defer mutex.Unlock()
+				inflight++
+				if inflight > maxInflight {
+					maxInflight = inflight
+				}
+			},
+			onEnd: func() {
+				mutex.Lock()
+				defer mutex.Unlock()
+				inflight--
+			},
+		})
+	}
+
+	l, err := NewLedger("testChannel", WithConcurrencyLimit(2))
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(30*time.Second))
+	defer cancel()
+
+	responses, err := l.QueryInfo(reqCtx, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, responses, 5)
+	assert.Equal(t, 2, maxInflight)
+
+	// Waiting targets give up when the request context is done
+	shortCtx, shortCancel := reqContext.WithTimeout(reqCtx, 100*time.Millisecond)
+	defer shortCancel()
+	l, err = NewLedger("testChannel", WithConcurrencyLimit(1))
+	assert.NoError(t, err)
+	slow := &slowTarget{ProposalProcessor: newMockLedgerPeer("http://slow.com", 1), delay: 10 * time.Second}
+	start := time.Now()
+	_, err = l.QueryInfo(shortCtx, []fab.ProposalProcessor{slow, newMockLedgerPeer("http://fast.com", 1)}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "expecting the waiting target to give up")
+
+	_, err = NewLedger("testChannel", WithConcurrencyLimit(0))
+	assert.Error(t, err)
+}
+
+// countingTarget invokes the given callbacks before and after each request to the target
+type countingTarget struct {
+	fab.ProposalProcessor
+	onStart func()
+	onEnd   func()
+}
+
+func (t *countingTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	t.onStart()
+	defer t.onEnd()
+	time.Sleep(50 * time.Millisecond)
+	return t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+}
+
+type slowTarget struct {
+	fab.ProposalProcessor
+	delay time.Duration
+}
+
+func (t *slowTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	select {
+	case <-time.After(t.delay):
+		return t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+	case <-reqCtx.Done():
+		return nil, reqCtx.Err()
+	}
+}
+
+// chaincodeNameRecorder records the names of the chaincodes that are invoked by the proposals
+type chaincodeNameRecorder struct {
+	fab.ProposalProcessor
+	names []string
+}
+
+func (t *chaincodeNameRecorder) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	spec, err := proposalChaincodeSpec(request.SignedProposal)
+	if err != nil {
+		return nil, err
+	}
+	t.names = append(t.names, spec.ChaincodeId.Name)
+	return t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+}
+
+// blockingTarget blocks until the request context is done and then closes the cancelled channel
+type blockingTarget struct {
+	fab.ProposalProcessor
+	cancelled chan struct{}
+}
+
+func (t *blockingTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	<-reqCtx.Done()
+	close(t.cancelled)
+	return nil, reqCtx.Err()
+}
+
+// endorserVerifier rejects the responses from the given endorser
+type endorserVerifier struct {
+	rejected string
+}
+
+func (v *endorserVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	if response.Endorser == v.rejected {
+		return errors.Errorf("endorser [%s] is rejected", response.Endorser)
+	}
+	return nil
+}
+
+func (v *endorserVerifier) Match(responses []*fab.TransactionProposalResponse) error {
+	return nil
+}
+
+// flakyTarget fails the given number of requests with the given error before delegating to the target
+type flakyTarget struct {
+	fab.ProposalProcessor
+	failures int
+	err      error
+	attempts int
+}
+
+func (t *flakyTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	t.attempts++
+	if t.attempts <= t.failures {
+		return nil, t.err
+	}
+	return t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+}
+
+func TestQueryBlockPage(t *testing.T) {
+	channel, _ := setupTestLedger()
+	peer := newMockLedgerPeer("http://peer1.com", 5)
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	targets := []fab.ProposalProcessor{peer}
+
+	_, _, err := channel.QueryBlockPage(reqCtx, "", 0, targets, &TestVerifier{})
+	assert.Error(t, err, "expecting error for zero page size")
+
+	_, _, err = channel.QueryBlockPage(reqCtx, "invalid cursor", 2, targets, &TestVerifier{})
+	assert.Error(t, err, "expecting error for invalid cursor")
+
+	var blockNums []uint64
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		var blocks []*common.Block
+		blocks, cursor, err = channel.QueryBlockPage(reqCtx, cursor, 2, targets, &TestVerifier{})
+		assert.NoError(t, err)
+		assert.True(t, len(blocks) <= 2, "page size exceeded")
+		for _, b := range blocks {
+			blockNums = append(blockNums, b.Header.Number)
+		}
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4}, blockNums)
+
+	// End of ledger reached - the cursor doesn't advance
+	blocks, nextCursor, err := channel.QueryBlockPage(reqCtx, cursor, 2, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Empty(t, blocks)
+	assert.Equal(t, cursor, nextCursor)
+
+	// Resume from the persisted cursor once new blocks are added
+	peer.addBlocks(1)
+	blocks, _, err = channel.QueryBlockPage(reqCtx, cursor, 2, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, uint64(5), blocks[0].Header.Number)
+
+	_, _, err = channel.QueryBlockPage(reqCtx, "", 2, targets, &TestVerifier{matchErr: errors.New("mismatch")})
+	assert.Error(t, err, "expecting error when responses do not match")
+}
+
+func TestTimestampVerifier(t *testing.T) {
+	newResponse := func(timestamp time.Time) *fab.TransactionProposalResponse {
+		ts, err := ptypes.TimestampProto(timestamp)
+		assert.NoError(t, err)
+		return &fab.TransactionProposalResponse{
+			Endorser:         "http://peer1.com",
+			ProposalResponse: &pb.ProposalResponse{Timestamp: ts},
+		}
+	}
+	noTimestamp := &fab.TransactionProposalResponse{Endorser: "http://peer1.com", ProposalResponse: &pb.ProposalResponse{}}
+
+	verifier := NewTimestampVerifier(time.Minute, false)
+	assert.NoError(t, verifier.Verify(newResponse(time.Now())))
+	assert.NoError(t, verifier.Verify(newResponse(time.Now().Add(-30*time.Second))))
+	assert.NoError(t, verifier.Verify(noTimestamp), "expecting response without timestamp to be skipped")
+
+	err := verifier.Verify(newResponse(time.Now().Add(-time.Hour)))
+	assert.Error(t, err, "expecting error for stale response")
+	assert.Contains(t, err.Error(), "outside of the allowed skew")
+
+	err = verifier.Verify(newResponse(time.Now().Add(time.Hour)))
+	assert.Error(t, err, "expecting error for response from the future")
+
+	verifier = NewTimestampVerifier(time.Minute, true)
+	err = verifier.Verify(noTimestamp)
+	assert.Error(t, err, "expecting error for response without timestamp")
+	assert.Contains(t, err.Error(), "missing timestamp")
+}
+
+func TestEndorserAllowlistVerifier(t *testing.T) {
+	allowed := EndorserIdentity{MSPID: "Org1MSP", Certificate: []byte("cert1")}
+	verifier := NewEndorserAllowlistVerifier([]EndorserIdentity{allowed})
+
+	newResponse := func(mspID string, cert []byte) *fab.TransactionProposalResponse {
+		endorser, err := proto.Marshal(&mb.SerializedIdentity{Mspid: mspID, IdBytes: cert})
+		assert.NoError(t, err)
+		return &fab.TransactionProposalResponse{
+			Endorser:         "http://peer1.com",
+			ProposalResponse: &pb.ProposalResponse{Endorsement: &pb.Endorsement{Endorser: endorser}},
+		}
+	}
+
+	assert.NoError(t, verifier.Verify(newResponse("Org1MSP", []byte("cert1\n"))))
+
+	err := verifier.Verify(newResponse("Org1MSP", []byte("cert2")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "endorser [http://peer1.com] of MSP [Org1MSP] is not in the allowlist")
+
+	err = verifier.Verify(newResponse("Org2MSP", []byte("cert1")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MSP [Org2MSP]")
+
+	err = verifier.Verify(&fab.TransactionProposalResponse{Endorser: "http://peer1.com", ProposalResponse: &pb.ProposalResponse{}})
+	assert.Error(t, err, "expecting error for missing endorsement")
+
+	// Responses from disallowed endorsers are filtered out
+	f, errs := filterResponses([]*fab.TransactionProposalResponse{
+		withStatus(newResponse("Org1MSP", []byte("cert1"))),
+		withStatus(newResponse("Org2MSP", []byte("cert2"))),
+	}, nil, verifier, nil)
+	assert.Len(t, f, 1)
+	assert.Error(t, errs)
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	caCert, caKey := newTestCertificate(t, nil, nil)
+	signerCert, signerKey := newTestCertificate(t, caCert, caKey)
+	_, otherKey := newTestCertificate(t, caCert, caKey)
+
+	verifier := NewSignatureVerifier(&testMSPManager{trustedMSPs: map[string]bool{"Org1MSP": true}})
+
+	assert.NoError(t, verifier.Verify(newSignedResponse(t, "Org1MSP", signerCert, signerKey, []byte("payload"))))
+
+	// Payload modified after signing
+	response := newSignedResponse(t, "Org1MSP", signerCert, signerKey, []byte("payload"))
+	response.ProposalResponse.Payload = []byte("fabricated")
+	err := verifier.Verify(response)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid endorsement signature from endorser [http://peer1.com]")
+
+	// Signed with a key that doesn't belong to the endorser certificate
+	assert.Error(t, verifier.Verify(newSignedResponse(t, "Org1MSP", signerCert, otherKey, []byte("payload"))))
+
+	// Untrusted MSP
+	err = verifier.Verify(newSignedResponse(t, "Org2MSP", signerCert, signerKey, []byte("payload")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "identity of endorser [http://peer1.com] is not valid")
+
+	err = verifier.Verify(&fab.TransactionProposalResponse{Endorser: "http://peer1.com", ProposalResponse: &pb.ProposalResponse{}})
+	assert.Error(t, err, "expecting error for missing endorsement")
 
-	res, err := channel.QueryInstantiatedChaincodes(reqCtx, []fab.ProposalProcessor{&peer}, nil)
+	// Responses with invalid signatures are filtered out
+	f, errs := filterResponses([]*fab.TransactionProposalResponse{
+		withStatus(newSignedResponse(t, "Org1MSP", signerCert, signerKey, []byte("payload"))),
+		withStatus(newSignedResponse(t, "Org1MSP", signerCert, otherKey, []byte("payload"))),
+	}, nil, verifier, nil)
+	assert.Len(t, f, 1)
+	assert.Error(t, errs)
+}
 
-	if err != nil || res == nil {
-		t.Fatalf("Test QueryInstatiated chaincode failed: %v", err)
+// newSignedResponse returns a proposal response that's endorsed with the given certificate and key
+func newSignedResponse(t *testing.T, mspID string, cert *x509.Certificate, key *ecdsa.PrivateKey, payload []byte) *fab.TransactionProposalResponse {
+	endorser, err := proto.Marshal(&mb.SerializedIdentity{Mspid: mspID, IdBytes: pemEncodeCert(cert)})
+	assert.NoError(t, err)
+
+	digest := sha256.Sum256(concatBytes(payload, endorser))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	assert.NoError(t, err)
+
+	return &fab.TransactionProposalResponse{
+		Endorser: "http://peer1.com",
+		ProposalResponse: &pb.ProposalResponse{
+			Payload:     payload,
+			Endorsement: &pb.Endorsement{Endorser: endorser, Signature: signature},
+		},
 	}
+}
 
+// testMSPManager deserializes identities whose certificates are valid if their MSP is trusted
+type testMSPManager struct {
+	msp.MSPManager
+	trustedMSPs map[string]bool
 }
 
-func TestQueryTransaction(t *testing.T) {
-	channel, _ := setupTestLedger()
-	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200}
+func (m *testMSPManager) DeserializeIdentity(serializedID []byte) (msp.Identity, error) {
+	sID := &mb.SerializedIdentity{}
+	if err := proto.Unmarshal(serializedID, sID); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(sID.IdBytes)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &testIdentity{cert: cert, trusted: m.trustedMSPs[sID.Mspid]}, nil
+}
 
-	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
-	defer cancel()
+type testIdentity struct {
+	msp.Identity
+	cert    *x509.Certificate
+	trusted bool
+}
 
-	res, err := channel.QueryTransaction(reqCtx, "txid", []fab.ProposalProcessor{&peer}, nil)
+func (id *testIdentity) Validate() error {
+	if !id.trusted {
+		return fmt.Errorf("untrusted MSP")
+	}
+	return nil
+}
 
-	if err != nil || res == nil {
-		t.Fatal("Test QueryTransaction failed")
+func (id *testIdentity) Verify(msg []byte, sig []byte) error {
+	signature := &ecdsaSignature{}
+	if _, err := asn1.Unmarshal(sig, signature); err != nil {
+		return err
 	}
+	digest := sha256.Sum256(msg)
+	if !ecdsa.Verify(id.cert.PublicKey.(*ecdsa.PublicKey), digest[:], signature.R, signature.S) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
 }
 
-func TestQueryInfo(t *testing.T) {
-	channel, _ := setupTestLedger()
-	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Status: 200}
+func TestRejectedResponses(t *testing.T) {
+	tprs := []*fab.TransactionProposalResponse{
+		{Endorser: "http://peer1.com", Status: http.StatusOK, ProposalResponse: &pb.ProposalResponse{Response: &pb.Response{Status: http.StatusOK}}},
+		{Endorser: "http://peer2.com", Status: http.StatusOK, ProposalResponse: &pb.ProposalResponse{Response: &pb.Response{Status: http.StatusForbidden, Message: "access denied", Payload: []byte("details")}}},
+		{Endorser: "http://peer3.com", Status: http.StatusInternalServerError},
+	}
+	tprs[1].Status = http.StatusForbidden
+
+	// By default only a generic error is returned
+	_, err := filterResponses(append([]*fab.TransactionProposalResponse{}, tprs...), nil, nil, nil)
+	assert.Error(t, err)
+	assert.Empty(t, RejectedResponses(err))
 
+	f, err := filterResponses(append([]*fab.TransactionProposalResponse{}, tprs...), nil, nil, &responseHooks{keepRejected: true})
+	assert.Len(t, f, 1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "access denied")
+	assert.Equal(t, []*RejectedResponse{
+		{Endorser: "http://peer2.com", Status: http.StatusForbidden, Message: "access denied", Payload: []byte("details")},
+		{Endorser: "http://peer3.com", Status: http.StatusInternalServerError},
+	}, RejectedResponses(errors.WithMessage(err, "query failed")))
+
+	// Through the ledger
 	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
 	defer cancel()
 
-	res, err := channel.QueryInfo(reqCtx, []fab.ProposalProcessor{&peer}, nil)
-
-	if err != nil || res == nil {
-		t.Fatalf("Test QueryInfo failed: %v", err)
+	l, err := NewLedger("testChannel", WithRejectedResponses())
+	assert.NoError(t, err)
+	_, err = l.QueryBlock(reqCtx, 5, []fab.ProposalProcessor{newMockLedgerPeer("http://peer1.com", 1)}, nil)
+	assert.Error(t, err)
+	rejected := RejectedResponses(err)
+	if assert.Len(t, rejected, 1) {
+		assert.Equal(t, "http://peer1.com", rejected[0].Endorser)
+		assert.Equal(t, int32(http.StatusInternalServerError), rejected[0].Status)
 	}
 }
 
-func TestQueryConfig(t *testing.T) {
-	channel, _ := setupTestLedger()
+func withStatus(response *fab.TransactionProposalResponse) *fab.TransactionProposalResponse {
+	response.Status = http.StatusOK
+	return response
+}
+
+func TestQueryTransactionsInBlockRange(t *testing.T) {
+	peer := newMockLedgerPeer("http://peer1.com", 0)
+	for i, block := range []*common.Block{
+		servicemocks.NewBlock("testChannel",
+			servicemocks.NewTransaction("config", pb.TxValidationCode_VALID, common.HeaderType_CONFIG),
+		),
+		servicemocks.NewBlock("testChannel",
+			servicemocks.NewTransactionWithCCEvent("tx1", pb.TxValidationCode_VALID, "cc1", "event", nil),
+			servicemocks.NewTransactionWithCCEvent("tx2", pb.TxValidationCode_MVCC_READ_CONFLICT, "cc2", "event", nil),
+		),
+		servicemocks.NewBlock("testChannel",
+			servicemocks.NewTransactionWithCCEvent("tx3", pb.TxValidationCode_VALID, "cc1", "event", nil),
+		),
+	} {
+		block.Header.Number = uint64(i)
+		peer.blocks = append(peer.blocks, block)
+	}
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
 
 	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
 	defer cancel()
 
-	// empty targets
-	_, err := channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{}, nil)
-	if err == nil {
-		t.Fatalf("Should have failed due to empty targets")
-	}
+	records, err := l.QueryTransactionsInBlockRange(reqCtx, 1, 2, []fab.ProposalProcessor{peer}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Equal(t, []TransactionRecord{
+		{TxID: "tx1", Type: common.HeaderType_ENDORSER_TRANSACTION, ChaincodeID: "cc1", ValidationCode: pb.TxValidationCode_VALID, BlockNumber: 1, TxIndex: 0},
+		{TxID: "tx2", Type: common.HeaderType_ENDORSER_TRANSACTION, ChaincodeID: "cc2", ValidationCode: pb.TxValidationCode_MVCC_READ_CONFLICT, BlockNumber: 1, TxIndex: 1},
+		{TxID: "tx3", Type: common.HeaderType_ENDORSER_TRANSACTION, ChaincodeID: "cc1", ValidationCode: pb.TxValidationCode_VALID, BlockNumber: 2, TxIndex: 0},
+	}, records)
 
-	// min endorsers <= 0
-	_, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{mocks.NewMockPeer("Peer1", "http://peer1.com")}, &TransactionProposalResponseVerifier{})
-	if err == nil {
-		t.Fatalf("Should have failed due to empty targets")
-	}
+	records, err = l.QueryTransactionsInBlockRange(reqCtx, 0, 0, []fab.ProposalProcessor{peer}, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, common.HeaderType_CONFIG, records[0].Type)
+	assert.Empty(t, records[0].ChaincodeID)
 
-	// peer without payload
-	_, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{mocks.NewMockPeer("Peer1", "http://peer1.com")}, &TransactionProposalResponseVerifier{MinResponses: 1})
-	if err == nil {
-		t.Fatalf("Should have failed due to nil block metadata")
+	// The records retrieved before the end of the ledger are returned along with the error
+	records, err = l.QueryTransactionsInBlockRange(reqCtx, 2, 3, []fab.ProposalProcessor{peer}, &TestVerifier{})
+	assert.Error(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = l.QueryTransactionsInBlockRange(reqCtx, 2, 1, []fab.ProposalProcessor{peer}, &TestVerifier{})
+	assert.Error(t, err)
+}
+
+func TestTransactionReadWriteSets(t *testing.T) {
+	tx := &pb.ProcessedTransaction{
+		ValidationCode: int32(pb.TxValidationCode_MVCC_READ_CONFLICT),
+		TransactionEnvelope: newTestEndorserTransaction(t, "tx1",
+			newTestChaincodeAction(t, "cc1", &rwsetutil.TxRwSet{
+				NsRwSets: []*rwsetutil.NsRwSet{
+					{
+						NameSpace: "cc1",
+						KvRwSet: &kvrwset.KVRWSet{
+							Reads: []*kvrwset.KVRead{
+								{Key: "key1", Version: &kvrwset.Version{BlockNum: 5, TxNum: 2}},
+								{Key: "key2"},
+							},
+							Writes: []*kvrwset.KVWrite{
+								{Key: "key1", Value: []byte("value1")},
+								{Key: "key3", IsDelete: true},
+							},
+						},
+					},
+					{NameSpace: "lscc", KvRwSet: &kvrwset.KVRWSet{}},
+				},
+			}),
+			newTestChaincodeAction(t, "cc2", &rwsetutil.TxRwSet{
+				NsRwSets: []*rwsetutil.NsRwSet{
+					{NameSpace: "cc2", KvRwSet: &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "key4", Value: []byte("value4")}}}},
+				},
+			}),
+		),
 	}
 
-	// create config block builder in order to create valid payload
-	builder := &mocks.MockConfigBlockBuilder{
-		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
-			ModPolicy: "Admins",
-			MSPNames: []string{
-				"Org1MSP",
-				"Org2MSP",
+	rwSets, err := TransactionReadWriteSets(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, &TxReadWriteSets{
+		TxID:           "tx1",
+		ValidationCode: pb.TxValidationCode_MVCC_READ_CONFLICT,
+		Actions: []ActionReadWriteSets{
+			{
+				ChaincodeID: "cc1",
+				Namespaces: []NsReadWriteSet{
+					{
+						Namespace: "cc1",
+						Reads:     []KVRead{{Key: "key1", Version: &KeyVersion{BlockNum: 5, TxNum: 2}}, {Key: "key2"}},
+						Writes:    []KVWrite{{Key: "key1", Value: []byte("value1")}, {Key: "key3", IsDelete: true}},
+					},
+					{Namespace: "lscc"},
+				},
+			},
+			{
+				ChaincodeID: "cc2",
+				Namespaces:  []NsReadWriteSet{{Namespace: "cc2", Writes: []KVWrite{{Key: "key4", Value: []byte("value4")}}}},
 			},
-			OrdererAddress: "localhost:9999",
-			RootCA:         validRootCA,
 		},
-		Index:           0,
-		LastConfigIndex: 0,
-	}
+	}, rwSets)
 
-	payload, err := proto.Marshal(builder.Build())
-	if err != nil {
-		t.Fatalf("Failed to marshal mock block")
-	}
+	_, err = TransactionReadWriteSets(&pb.ProcessedTransaction{})
+	assert.Error(t, err)
 
-	// peer with valid config block payload
-	peer := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Payload: payload, Status: 200}
+	// Config transactions have no read-write sets
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), TxId: "config"})
+	assert.NoError(t, err)
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}})
+	assert.NoError(t, err)
+	_, err = TransactionReadWriteSets(&pb.ProcessedTransaction{TransactionEnvelope: &common.Envelope{Payload: payload}})
+	assert.Error(t, err)
+}
 
-	// fail with min endorsers
-	res, err := channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 2})
-	if err == nil {
-		t.Fatalf("Should have failed with since there's one endorser and at least two are required")
-	}
+func newTestEndorserTransaction(t *testing.T, txID string, actions ...*pb.TransactionAction) *common.Envelope {
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID})
+	assert.NoError(t, err)
+	txBytes, err := proto.Marshal(&pb.Transaction{Actions: actions})
+	assert.NoError(t, err)
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: txBytes})
+	assert.NoError(t, err)
+	return &common.Envelope{Payload: payload}
+}
 
-	// success with one endorser
-	res, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer}, &TransactionProposalResponseVerifier{MinResponses: 1})
-	if err != nil || res == nil {
-		t.Fatalf("Test QueryConfig failed: %v", err)
-	}
+func newTestChaincodeAction(t *testing.T, ccID string, txRWSet *rwsetutil.TxRwSet) *pb.TransactionAction {
+	results, err := txRWSet.ToProtoBytes()
+	assert.NoError(t, err)
+	ccAction, err := proto.Marshal(&pb.ChaincodeAction{ChaincodeId: &pb.ChaincodeID{Name: ccID}, Results: results})
+	assert.NoError(t, err)
+	prp, err := proto.Marshal(&pb.ProposalResponsePayload{Extension: ccAction})
+	assert.NoError(t, err)
+	ccActionPayload, err := proto.Marshal(&pb.ChaincodeActionPayload{Action: &pb.ChaincodeEndorsedAction{ProposalResponsePayload: prp}})
+	assert.NoError(t, err)
+	return &pb.TransactionAction{Payload: ccActionPayload}
+}
 
-	// create second endorser with same payload
-	peer2 := mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", MockRoles: []string{}, MockCert: nil, Payload: payload, Status: 200}
+func TestVerifyBlockOrdererSignatures(t *testing.T) {
+	caCert, caKey := newTestCertificate(t, nil, nil)
+	signerCert, signerKey := newTestCertificate(t, caCert, caKey)
+	otherCACert, otherCAKey := newTestCertificate(t, nil, nil)
+	otherSignerCert, otherSignerKey := newTestCertificate(t, otherCACert, otherCAKey)
 
-	// success with two endorsers
-	res, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer, &peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
-	if err != nil || res == nil {
-		t.Fatalf("Test QueryConfig failed: %v", err)
+	ordererMSPs := map[string]*mb.FabricMSPConfig{
+		"OrdererMSP": {Name: "OrdererMSP", RootCerts: [][]byte{pemEncodeCert(caCert)}},
 	}
 
-	// Create different config block payload
-	builder2 := &mocks.MockConfigBlockBuilder{
-		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
-			ModPolicy: "Admins",
-			MSPNames: []string{
-				"Org1MSP",
-			},
-			OrdererAddress: "builder2:9999",
-			RootCA:         validRootCA,
-		},
-		Index:           0,
-		LastConfigIndex: 0,
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 7, PreviousHash: []byte("previous"), DataHash: []byte("data")},
+		Data:   &common.BlockData{},
 	}
 
-	payload2, err := proto.Marshal(builder2.Build())
-	if err != nil {
-		t.Fatalf("Failed to marshal mock block 2")
+	assert.Error(t, VerifyBlockOrdererSignatures(block, ordererMSPs), "expecting error for missing signatures")
+
+	signBlock(t, block, "OrdererMSP", signerCert, signerKey)
+	assert.NoError(t, VerifyBlockOrdererSignatures(block, ordererMSPs))
+
+	// Tampering with the header invalidates the signature
+	block.Header.Number = 8
+	assert.Error(t, VerifyBlockOrdererSignatures(block, ordererMSPs))
+	block.Header.Number = 7
+
+	// Signer from an untrusted MSP
+	signBlock(t, block, "OtherMSP", otherSignerCert, otherSignerKey)
+	err := VerifyBlockOrdererSignatures(block, ordererMSPs)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a trusted orderer MSP")
+
+	// Signer claims the trusted MSP but its certificate wasn't issued by the MSP
+	signBlock(t, block, "OrdererMSP", otherSignerCert, otherSignerKey)
+	err = VerifyBlockOrdererSignatures(block, ordererMSPs)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not issued by MSP")
+
+	// Wired as a verifier
+	signBlock(t, block, "OrdererMSP", signerCert, signerKey)
+	payload, err := proto.Marshal(block)
+	assert.NoError(t, err)
+	verifier := NewBlockSignatureVerifier(ordererMSPs)
+	assert.NoError(t, verifier.Verify(withStatus(&fab.TransactionProposalResponse{
+		ProposalResponse: &pb.ProposalResponse{Response: &pb.Response{Payload: payload}},
+	})))
+
+	signBlock(t, block, "OrdererMSP", otherSignerCert, otherSignerKey)
+	payload, err = proto.Marshal(block)
+	assert.NoError(t, err)
+	assert.Error(t, verifier.Verify(withStatus(&fab.TransactionProposalResponse{
+		ProposalResponse: &pb.ProposalResponse{Response: &pb.Response{Payload: payload}},
+	})))
+}
+
+// signBlock replaces the signature metadata of the block with a signature by the given signer
+func signBlock(t *testing.T, block *common.Block, mspID string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	creator, err := proto.Marshal(&mb.SerializedIdentity{Mspid: mspID, IdBytes: pemEncodeCert(cert)})
+	assert.NoError(t, err)
+	sigHeader, err := proto.Marshal(&common.SignatureHeader{Creator: creator, Nonce: []byte("nonce")})
+	assert.NoError(t, err)
+	headerBytes, err := protoutil.BlockHeaderBytes(block.Header)
+	assert.NoError(t, err)
+
+	digest := sha256.Sum256(concatBytes([]byte("value"), sigHeader, headerBytes))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	assert.NoError(t, err)
+
+	metadata, err := proto.Marshal(&common.Metadata{
+		Value:      []byte("value"),
+		Signatures: []*common.MetadataSignature{{SignatureHeader: sigHeader, Signature: signature}},
+	})
+	assert.NoError(t, err)
+	block.Metadata = &common.BlockMetadata{Metadata: [][]byte{metadata}}
+}
+
+// newTestCertificate creates a certificate issued by the given parent (or a self-signed CA certificate if parent is nil)
+func newTestCertificate(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "orderer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
 	}
 
-	// peer 2 now had different payload; query config block should fail
-	peer2.Payload = payload2
-	res, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer, &peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
-	if err == nil {
-		t.Fatalf("Should have failed for different block payloads")
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+func pemEncodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func TestQueryWithProof(t *testing.T) {
+	caCert, caKey := newTestCertificate(t, nil, nil)
+	signerCert, signerKey := newTestCertificate(t, caCert, caKey)
+	otherCACert, otherCAKey := newTestCertificate(t, nil, nil)
+	otherSignerCert, otherSignerKey := newTestCertificate(t, otherCACert, otherCAKey)
+
+	msps := map[string]*mb.FabricMSPConfig{
+		"Org1MSP": {Name: "Org1MSP", RootCerts: [][]byte{pemEncodeCert(caCert)}},
 	}
 
+	peer1 := &signingTarget{ProposalProcessor: newMockLedgerPeer("http://peer1.com", 3), t: t, mspID: "Org1MSP", cert: signerCert, key: signerKey}
+	peer2 := &signingTarget{ProposalProcessor: newMockLedgerPeer("http://peer2.com", 3), t: t, mspID: "Org1MSP", cert: signerCert, key: signerKey}
+	targets := []fab.ProposalProcessor{peer1, peer2}
+
+	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+
+	blocks, bundle, err := l.QueryBlockWithProof(reqCtx, 2, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 2)
+	assert.Len(t, bundle.Responses, 2)
+
+	// The bundle is relayed in serialized form
+	bundleBytes, err := bundle.Marshal()
+	assert.NoError(t, err)
+	relayed, err := UnmarshalProofBundle(bundleBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, "testChannel", relayed.ChannelID)
+
+	result, err := VerifyProofBundle(relayed, msps)
+	assert.NoError(t, err)
+	block := &common.Block{}
+	assert.NoError(t, proto.Unmarshal(result, block))
+	assert.Equal(t, uint64(2), block.Header.Number)
+
+	// Altering the (unsigned) result doesn't change the verified result
+	forged := &pb.ProposalResponse{}
+	assert.NoError(t, proto.Unmarshal(relayed.Responses[0].ProposalResponse, forged))
+	forged.Response.Payload = []byte("forged")
+	relayed.Responses[0].ProposalResponse, err = proto.Marshal(forged)
+	assert.NoError(t, err)
+	result, err = VerifyProofBundle(relayed, msps)
+	assert.NoError(t, err)
+	assert.NoError(t, proto.Unmarshal(result, block))
+
+	// Altering the signed result invalidates the signature
+	forged.Payload = append(forged.Payload, 0)
+	relayed.Responses[0].ProposalResponse, err = proto.Marshal(forged)
+	assert.NoError(t, err)
+	_, err = VerifyProofBundle(relayed, msps)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid endorsement signature")
+
+	// Endorser from an untrusted MSP
+	peer2.mspID = "Org2MSP"
+	_, bundle, err = l.QueryBlockWithProof(reqCtx, 2, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	_, err = VerifyProofBundle(bundle, msps)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not trusted")
+
+	// Endorser certificate not issued by the MSP
+	peer2.mspID = "Org1MSP"
+	peer2.cert, peer2.key = otherSignerCert, otherSignerKey
+	_, bundle, err = l.QueryBlockWithProof(reqCtx, 2, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	_, err = VerifyProofBundle(bundle, msps)
+	assert.Error(t, err)
+
+	// Responses for different results don't match
+	peer2.ProposalProcessor = newMockLedgerPeer("http://peer2.com", 3)
+	peer2.cert, peer2.key = signerCert, signerKey
+	peer2.ProposalProcessor.(*mockLedgerPeer).blocks[2].Data.Data[0] = []byte("other")
+	_, bundle, err = l.QueryBlockWithProof(reqCtx, 2, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	_, err = VerifyProofBundle(bundle, msps)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "doesn't match")
+
+	_, err = VerifyProofBundle(&ProofBundle{Version: ProofBundleVersion}, msps)
+	assert.Error(t, err, "expecting error for empty bundle")
+
+	_, err = UnmarshalProofBundle([]byte(`{"version":2}`))
+	assert.Error(t, err, "expecting error for unsupported version")
 }
 
-func TestQueryConfigBlockDifferentMetadata(t *testing.T) {
-	channel, _ := setupTestLedger()
-	builder := &mocks.MockConfigBlockBuilder{
-		MockConfigGroupBuilder: mocks.MockConfigGroupBuilder{
-			ModPolicy: "Admins",
-			MSPNames: []string{
-				"Org1MSP",
-				"Org2MSP",
-			},
-			OrdererAddress: "localhost:9999",
-			RootCA:         validRootCA,
-		},
-		Index:           0,
-		LastConfigIndex: 0,
+// signingTarget replaces the proposal responses of the target with responses that are signed by the given identity
+type signingTarget struct {
+	fab.ProposalProcessor
+	t     *testing.T
+	mspID string
+	cert  *x509.Certificate
+	key   *ecdsa.PrivateKey
+}
+
+func (s *signingTarget) ProcessTransactionProposal(ctx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	response, err := s.ProposalProcessor.ProcessTransactionProposal(ctx, request)
+	if err != nil {
+		return nil, err
 	}
 
-	b := builder.Build()
-	b.Metadata = &common.BlockMetadata{Metadata: [][]byte{[]byte("test1")}}
+	action, err := proto.Marshal(&pb.ChaincodeAction{Response: response.ProposalResponse.Response})
+	assert.NoError(s.t, err)
+	payload, err := proto.Marshal(&pb.ProposalResponsePayload{ProposalHash: []byte("hash"), Extension: action})
+	assert.NoError(s.t, err)
+	endorser, err := proto.Marshal(&mb.SerializedIdentity{Mspid: s.mspID, IdBytes: pemEncodeCert(s.cert)})
+	assert.NoError(s.t, err)
 
-	payload1, err := proto.Marshal(b)
-	assert.Nil(t, err, "Failed to marshal mock block")
+	digest := sha256.Sum256(concatBytes(payload, endorser))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	assert.NoError(s.t, err)
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: sig})
+	assert.NoError(s.t, err)
 
-	b.Metadata = &common.BlockMetadata{Metadata: [][]byte{[]byte("test2")}}
-	payload2, err := proto.Marshal(b)
-	assert.Nil(t, err, "Failed to marshal mock block")
+	response.ProposalResponse.Payload = payload
+	response.ProposalResponse.Endorsement = &pb.Endorsement{Endorser: endorser, Signature: signature}
+	return response, nil
+}
 
-	peer1 := mocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", MockRoles: []string{}, MockCert: nil, Payload: payload1, Status: 200}
-	peer2 := mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", MockRoles: []string{}, MockCert: nil, Payload: payload2, Status: 200}
+func TestResponseCompression(t *testing.T) {
+	peer1 := newMockLedgerPeer("http://peer1.com", 1)
+	peer2 := newMockLedgerPeer("grpcs://localhost:7051", 1)
+	targets := []fab.ProposalProcessor{peer1, peer2}
 
 	reqCtx, cancel := context.NewRequest(setupContext(), context.WithTimeout(10*time.Second))
 	defer cancel()
 
-	_, err = channel.QueryConfigBlock(reqCtx, []fab.ProposalProcessor{&peer1, &peer2}, &TransactionProposalResponseVerifier{MinResponses: 2})
-	assert.Nil(t, err, "Expected success querying blocks with identical block data payloads")
+	// Compression is disabled by default
+	l, err := NewLedger("testChannel")
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Empty(t, peer1.lastCompressor())
+	assert.Empty(t, peer2.lastCompressor())
+
+	l, err = NewLedger("testChannel", WithResponseCompression("grpcs://localhost:7051"))
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", peer1.lastCompressor())
+	assert.Empty(t, peer2.lastCompressor(), "expecting no compression for excluded target")
+
+	// Excluded targets may also be given as addresses
+	l, err = NewLedger("testChannel", WithResponseCompression("localhost:7051"))
+	assert.NoError(t, err)
+	_, err = l.QueryInfo(reqCtx, targets, &TestVerifier{})
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", peer1.lastCompressor())
+	assert.Empty(t, peer2.lastCompressor(), "expecting no compression for excluded target")
 }
 
-func TestFilterResponses(t *testing.T) {
-	tprs := []*fab.TransactionProposalResponse{}
-	err := fmt.Errorf("test")
-	for i := 0; i <= 100; i++ {
-		var s int
-		if i%2 == 0 {
-			s = 200
-		} else {
-			s = 500
-		}
-		tprs = append(tprs, &fab.TransactionProposalResponse{Status: int32(s)})
+// BenchmarkResponseCompression measures the CPU cost of compressing and decompressing a
+// 1MB block. This cost is paid for every round trip when response compression is enabled.
+func BenchmarkResponseCompression(b *testing.B) {
+	compressor := encoding.GetCompressor(gzipCompressor)
+	if compressor == nil {
+		b.Fatalf("gzip compressor not registered")
 	}
-	f, errs := filterResponses(tprs, err, &TestVerifier{})
-	assert.Len(t, f, 51)
-	assert.Len(t, errs.(multi.Errors), 51)
-}
 
-func TestFilterResponsesWithVerifyError(t *testing.T) {
-	tprs := []*fab.TransactionProposalResponse{}
-	err := fmt.Errorf("test")
-	tprs = append(tprs, &fab.TransactionProposalResponse{Status: 200})
-	f, errs := filterResponses(tprs, err, &TestVerifier{verifyErr: errors.New("error")})
-	assert.Len(t, f, 0)
-	assert.Len(t, errs.(multi.Errors), 2)
+	block := &common.Block{Header: &common.BlockHeader{Number: 1}, Data: &common.BlockData{}}
+	for i := 0; i < 1024; i++ {
+		block.Data.Data = append(block.Data.Data, []byte(strings.Repeat(fmt.Sprintf("tx%d-", i), 200)))
+	}
+	payload, err := proto.Marshal(block)
+	if err != nil {
+		b.Fatalf("marshal of block failed: %s", err)
+	}
+
+	var compressedSize int
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		w, err := compressor.Compress(&buf)
+		if err != nil {
+			b.Fatalf("compress failed: %s", err)
+		}
+		if _, err := w.Write(payload); err != nil {
+			b.Fatalf("compress failed: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatalf("compress failed: %s", err)
+		}
+		compressedSize = buf.Len()
+
+		r, err := compressor.Decompress(&buf)
+		if err != nil {
+			b.Fatalf("decompress failed: %s", err)
+		}
+		if _, err := ioutil.ReadAll(r); err != nil {
+			b.Fatalf("decompress failed: %s", err)
+		}
+	}
+	b.Logf("payload size: %d, compressed size: %d", len(payload), compressedSize)
 }
 
 func setupTestLedger() (*Ledger, error) {
@@ -313,3 +3391,147 @@ func (tv *TestVerifier) Verify(response *fab.TransactionProposalResponse) error
 func (tv *TestVerifier) Match(response []*fab.TransactionProposalResponse) error {
 	return tv.matchErr
 }
+
+// mockLedgerPeer is a proposal processor that serves qscc queries from an in-memory chain of blocks
+type mockLedgerPeer struct {
+	url          string
+	blocks       []*common.Block
+	configBlock  *common.Block
+	transactions map[string]*pb.ProcessedTransaction
+	definitions  *chaincodeDefinitionsResult
+	chaincodes   []*pb.ChaincodeInfo
+	ccData       map[string]*ccprovider.ChaincodeData
+	rawCCData    map[string][]byte
+	mutex        sync.Mutex
+	compressor   string
+}
+
+func newMockLedgerPeer(url string, numBlocks int) *mockLedgerPeer {
+	p := &mockLedgerPeer{url: url}
+	p.addBlocks(numBlocks)
+	return p
+}
+
+func (p *mockLedgerPeer) addBlocks(numBlocks int) {
+	for i := 0; i < numBlocks; i++ {
+		p.blocks = append(p.blocks, &common.Block{
+			Header: &common.BlockHeader{Number: uint64(len(p.blocks))},
+			Data:   &common.BlockData{Data: [][]byte{[]byte(fmt.Sprintf("data%d", len(p.blocks)))}},
+		})
+	}
+}
+
+// URL returns the URL of the peer
+func (p *mockLedgerPeer) URL() string {
+	return p.url
+}
+
+// ProcessTransactionProposal returns the chain info or the requested block
+func (p *mockLedgerPeer) ProcessTransactionProposal(ctx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	// Like a real peer endorser, the compressor is looked up by the address of the peer
+	compressor, _ := context.RequestCompressor(ctx, endpoint.ToAddress(p.url))
+	p.mutex.Lock()
+	p.compressor = compressor
+	p.mutex.Unlock()
+
+	args, err := proposalArgs(request.SignedProposal)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	switch string(args[0]) {
+	case qsccChannelInfo:
+		payload, err = proto.Marshal(&common.BlockchainInfo{Height: uint64(len(p.blocks))})
+	case qsccBlockByNumber:
+		var blockNum uint64
+		blockNum, err = strconv.ParseUint(string(args[2]), 10, 64)
+		if err == nil && blockNum >= uint64(len(p.blocks)) {
+			return p.newResponse(http.StatusInternalServerError, nil), nil
+		}
+		if err == nil {
+			payload, err = proto.Marshal(p.blocks[blockNum])
+		}
+	case csccConfigBlock:
+		if p.configBlock == nil {
+			return p.newResponse(http.StatusInternalServerError, nil), nil
+		}
+		payload, err = proto.Marshal(p.configBlock)
+	case qsccTransactionByID:
+		transaction, ok := p.transactions[string(args[2])]
+		if !ok {
+			return p.newResponse(http.StatusInternalServerError, nil), nil
+		}
+		payload, err = proto.Marshal(transaction)
+	case lsccChaincodes:
+		if p.chaincodes == nil {
+			return p.newResponse(http.StatusInternalServerError, nil), nil
+		}
+		payload, err = proto.Marshal(&pb.ChaincodeQueryResponse{Chaincodes: p.chaincodes})
+	case lsccChaincodeData:
+		if raw, ok := p.rawCCData[string(args[2])]; ok {
+			return p.newResponse(http.StatusOK, raw), nil
+		}
+		data, ok := p.ccData[string(args[2])]
+		if !ok {
+			// lscc denies access to the chaincode data if the caller isn't a channel reader
+			return p.newResponse(http.StatusInternalServerError, nil), nil
+		}
+		payload, err = proto.Marshal(data)
+	case newLifecycleChaincodeDefinitions:
+		if p.definitions == nil {
+			return p.newResponse(http.StatusInternalServerError, nil), nil
+		}
+		payload, err = proto.Marshal(p.definitions)
+	default:
+		err = fmt.Errorf("unsupported function: %s", args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p.newResponse(http.StatusOK, payload), nil
+}
+
+// lastCompressor returns the compressor of the last request
+func (p *mockLedgerPeer) lastCompressor() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.compressor
+}
+
+func (p *mockLedgerPeer) newResponse(status int32, payload []byte) *fab.TransactionProposalResponse {
+	// Like a real peer, the endorser is identified by its address (without the gRPC scheme)
+	return &fab.TransactionProposalResponse{
+		Endorser: endpoint.ToAddress(p.url),
+		Status:   status,
+		ProposalResponse: &pb.ProposalResponse{
+			Response:    &pb.Response{Status: status, Payload: payload},
+			Endorsement: &pb.Endorsement{Endorser: []byte(p.url), Signature: []byte("signature")},
+		},
+	}
+}
+
+func proposalArgs(signedProposal *pb.SignedProposal) ([][]byte, error) {
+	spec, err := proposalChaincodeSpec(signedProposal)
+	if err != nil {
+		return nil, err
+	}
+	return spec.Input.Args, nil
+}
+
+func proposalChaincodeSpec(signedProposal *pb.SignedProposal) (*pb.ChaincodeSpec, error) {
+	proposal := &pb.Proposal{}
+	if err := proto.Unmarshal(signedProposal.ProposalBytes, proposal); err != nil {
+		return nil, err
+	}
+	cpp, err := utils.GetChaincodeProposalPayload(proposal.Payload)
+	if err != nil {
+		return nil, err
+	}
+	cis := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(cpp.Input, cis); err != nil {
+		return nil, err
+	}
+	return cis.ChaincodeSpec, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// ChaincodeLifecycle is the chaincode lifecycle that's used by the channel
+type ChaincodeLifecycle int
+
+const (
+	// LegacyLifecycle is the v1.x chaincode lifecycle, in which the chaincodes are instantiated with lscc.
+	// This is the default.
+	LegacyLifecycle ChaincodeLifecycle = iota
+	// NewLifecycle is the v2.x chaincode lifecycle, in which the chaincode definitions are committed with _lifecycle
+	NewLifecycle
+)
+
+const (
+	newLifecycle                     = "_lifecycle"
+	newLifecycleChaincodeDefinitions = "QueryChaincodeDefinitions"
+)
+
+// String returns the name of the chaincode lifecycle
+func (l ChaincodeLifecycle) String() string {
+	switch l {
+	case LegacyLifecycle:
+		return lscc
+	case NewLifecycle:
+		return newLifecycle
+	default:
+		return "unknown"
+	}
+}
+
+// chaincodeDefinitionsResult is the QueryChaincodeDefinitionsResult message of _lifecycle.
+// Only the fields that are used by the SDK are declared.
+type chaincodeDefinitionsResult struct {
+	ChaincodeDefinitions []*chaincodeDefinition `protobuf:"bytes,1,rep,name=chaincode_definitions,json=chaincodeDefinitions" json:"chaincode_definitions,omitempty"`
+}
+
+func (m *chaincodeDefinitionsResult) Reset()         { *m = chaincodeDefinitionsResult{} }
+func (m *chaincodeDefinitionsResult) String() string { return proto.CompactTextString(m) }
+func (*chaincodeDefinitionsResult) ProtoMessage()    {}
+
+// chaincodeDefinition is the QueryChaincodeDefinitionsResult.ChaincodeDefinition message of _lifecycle
+type chaincodeDefinition struct {
+	Name              string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Sequence          int64  `protobuf:"varint,2,opt,name=sequence" json:"sequence,omitempty"`
+	Version           string `protobuf:"bytes,3,opt,name=version" json:"version,omitempty"`
+	EndorsementPlugin string `protobuf:"bytes,4,opt,name=endorsement_plugin,json=endorsementPlugin" json:"endorsement_plugin,omitempty"`
+	ValidationPlugin  string `protobuf:"bytes,5,opt,name=validation_plugin,json=validationPlugin" json:"validation_plugin,omitempty"`
+}
+
+func (m *chaincodeDefinition) Reset()         { *m = chaincodeDefinition{} }
+func (m *chaincodeDefinition) String() string { return proto.CompactTextString(m) }
+func (*chaincodeDefinition) ProtoMessage()    {}
+
+// createChaincodesInvokeRequest returns the request for the chaincodes of the channel with the given lifecycle
+// (lsccName is the name of the lscc system chaincode that's used by the legacy lifecycle)
+func createChaincodesInvokeRequest(lifecycle ChaincodeLifecycle, lsccName string) fab.ChaincodeInvokeRequest {
+	if lifecycle == NewLifecycle {
+		// The argument is the (empty) QueryChaincodeDefinitionsArgs message
+		return fab.ChaincodeInvokeRequest{
+			ChaincodeID: newLifecycle,
+			Fcn:         newLifecycleChaincodeDefinitions,
+			Args:        [][]byte{{}},
+		}
+	}
+	return createChaincodeInvokeRequest(lsccName)
+}
+
+// createChaincodesQueryResponse parses the response of the chaincodes query of the given lifecycle.
+// The chaincode definitions that are returned by _lifecycle are converted to ChaincodeInfo.
+func createChaincodesQueryResponse(lifecycle ChaincodeLifecycle, tpr *fab.TransactionProposalResponse) (*pb.ChaincodeQueryResponse, error) {
+	if lifecycle != NewLifecycle {
+		return createChaincodeQueryResponse(tpr)
+	}
+
+	result := chaincodeDefinitionsResult{}
+	if err := proto.Unmarshal(tpr.ProposalResponse.GetResponse().Payload, &result); err != nil {
+		return nil, errors.Wrap(err, "unmarshal of chaincode definitions response failed")
+	}
+
+	response := &pb.ChaincodeQueryResponse{}
+	for _, definition := range result.ChaincodeDefinitions {
+		response.Chaincodes = append(response.Chaincodes, &pb.ChaincodeInfo{
+			Name:    definition.Name,
+			Version: definition.Version,
+			Escc:    definition.EndorsementPlugin,
+			Vscc:    definition.ValidationPlugin,
+		})
+	}
+	return response, nil
+}
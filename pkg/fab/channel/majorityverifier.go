@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// payloadSelector is implemented by verifiers that select the payload that the responses agree on
+type payloadSelector interface {
+	MajorityPayload(responses []*fab.TransactionProposalResponse) ([]byte, error)
+}
+
+// MajorityVerifier is a ResponseVerifier that accepts the responses if more than half of them
+// have identical payloads. The verifier is stateless and safe for concurrent use.
+type MajorityVerifier struct {
+}
+
+// NewMajorityVerifier returns a new MajorityVerifier
+func NewMajorityVerifier() *MajorityVerifier {
+	return &MajorityVerifier{}
+}
+
+// Verify rejects responses that don't have a successful status
+func (v *MajorityVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	if response.ProposalResponse == nil || response.ProposalResponse.Response == nil {
+		return errors.Errorf("missing response from endorser [%s]", response.Endorser)
+	}
+	if response.Status != http.StatusOK || response.ProposalResponse.Response.Status != http.StatusOK {
+		return errors.Errorf("endorser [%s] returned status %d: %s", response.Endorser, response.ProposalResponse.Response.Status, response.ProposalResponse.Response.Message)
+	}
+	return nil
+}
+
+// Match succeeds if more than half of the responses have identical payloads
+func (v *MajorityVerifier) Match(responses []*fab.TransactionProposalResponse) error {
+	_, err := v.MajorityPayload(responses)
+	return err
+}
+
+// MajorityPayload returns the payload that more than half of the responses agree on. An error is
+// returned if there are no responses or if no payload is shared by a majority of the responses.
+func (v *MajorityVerifier) MajorityPayload(responses []*fab.TransactionProposalResponse) ([]byte, error) {
+	if len(responses) == 0 {
+		return nil, errors.New("no responses to match")
+	}
+
+	var payloads [][]byte
+	var counts []int
+	for _, response := range responses {
+		payload := response.ProposalResponse.GetResponse().GetPayload()
+		found := false
+		for i, p := range payloads {
+			if bytes.Equal(p, payload) {
+				counts[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			payloads = append(payloads, payload)
+			counts = append(counts, 1)
+		}
+	}
+
+	for i, count := range counts {
+		if count > len(responses)/2 {
+			return payloads[i], nil
+		}
+	}
+
+	return nil, errors.WithStack(status.New(status.EndorserClientStatus, status.EndorsementMismatch.ToInt32(), "no majority of matching payloads", nil))
+}
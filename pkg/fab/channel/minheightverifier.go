@@ -0,0 +1,73 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// MinHeightSource returns the minimum ledger height that a response must imply in order to be accepted,
+// for example, the height that was agreed on by a prior QueryInfoConsensus. It's invoked for each
+// response, so it should return a cached value rather than query the peers.
+type MinHeightSource func() (uint64, error)
+
+// StaleResponseError is returned by the MinHeightVerifier when the height that's implied by
+// the response of an endorser is lower than the minimum height
+type StaleResponseError struct {
+	Endorser  string
+	Height    uint64
+	MinHeight uint64
+}
+
+func (e *StaleResponseError) Error() string {
+	return fmt.Sprintf("response of endorser [%s] implies ledger height %d which is lower than the minimum height %d", e.Endorser, e.Height, e.MinHeight)
+}
+
+// MinHeightVerifier is a ResponseVerifier for block queries (such as QueryBlock and QueryConfigBlock) that
+// rejects blocks that are older than the minimum height returned by its MinHeightSource, which allows a stale
+// but validly signed block from a lagging peer to be detected. A block with number N implies a ledger height
+// of at least N+1. Note that the current config block is usually below the ledger height, so for config block
+// queries the minimum height should be derived from the expected config block (for example, the LAST_CONFIG
+// index of the block at the agreed height, plus one) rather than from the ledger height itself.
+type MinHeightVerifier struct {
+	minHeight MinHeightSource
+}
+
+// NewMinHeightVerifier returns a ResponseVerifier that rejects block responses whose block
+// number implies a height that's lower than the height returned by minHeight
+func NewMinHeightVerifier(minHeight MinHeightSource) *MinHeightVerifier {
+	return &MinHeightVerifier{minHeight: minHeight}
+}
+
+// Verify rejects the response with a StaleResponseError if the height implied by its block is below the minimum height
+func (v *MinHeightVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	block, err := createCommonBlock(response)
+	if err != nil {
+		return errors.WithMessage(err, "minimum height verification requires a block response")
+	}
+	if block.Header == nil {
+		return errors.Errorf("block header is missing in the response of endorser [%s]", response.Endorser)
+	}
+
+	minHeight, err := v.minHeight()
+	if err != nil {
+		return errors.WithMessage(err, "unable to determine the minimum height")
+	}
+
+	if height := block.Header.Number + 1; height < minHeight {
+		return &StaleResponseError{Endorser: response.Endorser, Height: height, MinHeight: minHeight}
+	}
+	return nil
+}
+
+// Match is not used by this verifier and always succeeds
+func (v *MinHeightVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	"github.com/pkg/errors"
+)
+
+// verifierWrapper is implemented by verifiers that decorate another verifier
+type verifierWrapper interface {
+	unwrap() ResponseVerifier
+}
+
+// MinMSPsVerifier is a ResponseVerifier that decorates another verifier and additionally requires
+// the matched responses to come from endorsers of at least a minimum number of distinct MSPs, so
+// that a query can't be answered by the peers of a single organization
+type MinMSPsVerifier struct {
+	verifier ResponseVerifier
+	minMSPs  int
+}
+
+// NewMinMSPsVerifier returns a ResponseVerifier that verifies and matches the responses with the given
+// verifier (if not nil) and then requires the responses to come from at least minMSPs distinct MSPs.
+// The MSP of a response is resolved from the identity of its endorsement; responses whose MSP can't be
+// resolved don't count towards the minimum. A minimum of less than one is treated as one.
+func NewMinMSPsVerifier(verifier ResponseVerifier, minMSPs int) *MinMSPsVerifier {
+	if minMSPs < 1 {
+		minMSPs = 1
+	}
+	return &MinMSPsVerifier{verifier: verifier, minMSPs: minMSPs}
+}
+
+// Verify verifies the response with the decorated verifier
+func (v *MinMSPsVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	if v.verifier == nil {
+		return nil
+	}
+	return v.verifier.Verify(response)
+}
+
+// Match matches the responses with the decorated verifier and checks that the responses
+// come from at least the minimum number of distinct MSPs
+func (v *MinMSPsVerifier) Match(responses []*fab.TransactionProposalResponse) error {
+	if v.verifier != nil {
+		if err := v.verifier.Match(responses); err != nil {
+			return err
+		}
+	}
+
+	msps := make(map[string]bool)
+	var unresolved []string
+	for _, response := range responses {
+		mspID, err := endorserMSPID(response)
+		if err != nil {
+			logger.Debugf("Unable to resolve MSP of endorser [%s]: %s", response.Endorser, err)
+			unresolved = append(unresolved, response.Endorser)
+			continue
+		}
+		msps[mspID] = true
+	}
+
+	if len(msps) >= v.minMSPs {
+		return nil
+	}
+
+	if len(unresolved) > 0 {
+		return errors.Errorf("responses from %d distinct MSP(s) but at least %d are required (unable to resolve the MSP of endorsers [%s])", len(msps), v.minMSPs, strings.Join(unresolved, ", "))
+	}
+	return errors.Errorf("responses from %d distinct MSP(s) but at least %d are required", len(msps), v.minMSPs)
+}
+
+func (v *MinMSPsVerifier) unwrap() ResponseVerifier {
+	return v.verifier
+}
+
+// payloadSelectorOf returns the payload selector of the verifier or of the verifier that it decorates (if any).
+// The verifiers of a composite verifier are searched in order.
+func payloadSelectorOf(verifier ResponseVerifier) (payloadSelector, bool) {
+	for verifier != nil {
+		if selector, ok := verifier.(payloadSelector); ok {
+			return selector, true
+		}
+		if composite, ok := verifier.(verifierComposite); ok {
+			for _, component := range composite.components() {
+				if selector, ok := payloadSelectorOf(component); ok {
+					return selector, true
+				}
+			}
+			return nil, false
+		}
+		wrapper, ok := verifier.(verifierWrapper)
+		if !ok {
+			return nil, false
+		}
+		verifier = wrapper.unwrap()
+	}
+	return nil, false
+}
+
+// endorserMSPID returns the MSP ID of the identity that endorsed the response
+func endorserMSPID(response *fab.TransactionProposalResponse) (string, error) {
+	endorsement := response.ProposalResponse.GetEndorsement()
+	if endorsement == nil {
+		return "", errors.New("missing endorsement")
+	}
+
+	sID := &mb.SerializedIdentity{}
+	if err := proto.Unmarshal(endorsement.Endorser, sID); err != nil {
+		return "", errors.Wrap(err, "unmarshal of endorser identity failed")
+	}
+	if sID.Mspid == "" {
+		return "", errors.New("endorser identity has no MSP ID")
+	}
+	return sID.Mspid, nil
+}
+
+// resolveMSPID returns the MSP ID of the endorser of the response, which is resolved from the endorsement
+// identity or otherwise from the target (peer) with the URL of the endorser. An empty string is returned
+// if the MSP ID can't be resolved.
+func resolveMSPID(response *fab.TransactionProposalResponse, targets []fab.ProposalProcessor) string {
+	mspID, err := endorserMSPID(response)
+	if err == nil {
+		return mspID
+	}
+
+	for _, target := range targets {
+		if peer, ok := target.(fab.Peer); ok && peer.URL() == response.Endorser {
+			return peer.MSPID()
+		}
+	}
+
+	logger.Debugf("Unable to resolve MSP of endorser [%s]: %s", response.Endorser, err)
+	return ""
+}
@@ -0,0 +1,60 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/pkg/errors"
+)
+
+// QueryMultiChannelHeights concurrently queries the height of each of the given channels (keyed by channel ID)
+// from the channel's targets and returns the maximum height reported for each channel. The given options are
+// applied to the Ledger of each channel. If the height of a channel can't be retrieved then the channel is omitted
+// from the result and the error is returned (aggregated with the errors of other channels) along with the heights
+// of the remaining channels.
+func QueryMultiChannelHeights(reqCtx reqContext.Context, channelTargets map[string][]fab.ProposalProcessor, verifier ResponseVerifier, opts ...Option) (map[string]uint64, error) {
+	heights := make(map[string]uint64)
+	var errs error
+	var mutex sync.Mutex
+
+	var wg sync.WaitGroup
+	wg.Add(len(channelTargets))
+
+	for channelID, targets := range channelTargets {
+		go func(channelID string, targets []fab.ProposalProcessor) {
+			defer wg.Done()
+
+			height, err := queryChannelHeight(reqCtx, channelID, targets, verifier, opts)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				errs = multi.Append(errs, errors.WithMessage(err, fmt.Sprintf("query for height of channel [%s] failed", channelID)))
+				return
+			}
+			heights[channelID] = height
+		}(channelID, targets)
+	}
+
+	wg.Wait()
+
+	return heights, errs
+}
+
+func queryChannelHeight(reqCtx reqContext.Context, channelID string, targets []fab.ProposalProcessor, verifier ResponseVerifier, opts []Option) (uint64, error) {
+	ledger, err := NewLedger(channelID, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return ledger.queryMaxHeight(reqCtx, targets, verifier)
+}
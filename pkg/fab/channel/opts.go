@@ -0,0 +1,355 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+const (
+	// gzipCompressor is the name of the gzip compressor registered with gRPC
+	gzipCompressor = "gzip"
+
+	// defaultMaxBlockRange is the default maximum number of blocks queried by QueryBlockByNumberRange
+	defaultMaxBlockRange = 100
+
+	// defaultMaxResponseSize is the default maximum size (in bytes) of the payload of a response (see WithMaxResponseSize)
+	defaultMaxResponseSize = 100 * 1024 * 1024
+)
+
+// ledgerOpts contains the options for the Ledger client
+type ledgerOpts struct {
+	compressor          string
+	uncompressedTargets []string
+	postVerify          PostVerifyHook
+	observer            Observer
+	latencyStats        *LatencyStats
+	retryClassifier     RetryClassifier
+	retryOpts           *retry.Opts
+	discovery           fab.DiscoveryService
+	maxLag              uint64
+	maxLagEnabled       bool
+	endorserTimeout     time.Duration
+	staleFallback       bool
+	targetKey           TargetKeyFunc
+	maxBlockRange       uint64
+	keepRejected        bool
+	concurrencyLimit    int
+	lifecycle           ChaincodeLifecycle
+	maxResponseSize     int
+	lsccName            string
+	qsccName            string
+	infoCacheEvents     fab.EventService
+	orderedTargets      bool
+}
+
+// VerificationRejectedEvent describes a response that was rejected by the ResponseVerifier
+type VerificationRejectedEvent struct {
+	ChannelID string
+	Endorser  string
+	Reason    string
+}
+
+// Observer is notified of notable events that occur while querying the ledger.
+// Implementations must be safe for concurrent use and should not block.
+type Observer interface {
+	// VerificationRejected is invoked when a response is rejected by the ResponseVerifier.
+	// Responses with a bad status (transport or endorsement failures) are not reported.
+	VerificationRejected(event *VerificationRejectedEvent)
+}
+
+// PostVerifyHook is invoked for each response that was successfully verified, before the
+// responses are aggregated. The hook may annotate the response; if it returns an error then
+// the response is rejected.
+type PostVerifyHook func(response *fab.TransactionProposalResponse) error
+
+// Option configures the Ledger client
+type Option func(opts *ledgerOpts) error
+
+// WithResponseCompression enables gzip compression of the gRPC proposal round trips made by
+// the Ledger, which reduces bandwidth for queries that return large payloads (such as blocks) at
+// the cost of CPU on both the client and the peer. Compression is disabled by default since, for
+// peers on a fast network, the CPU cost outweighs the bandwidth saving (see BenchmarkResponseCompression).
+// Calls to the given targets, such as local peers, are not compressed. A target may be given as a URL
+// (e.g. grpcs://localhost:7051) or as an address (localhost:7051).
+// The peers must support gzip compression.
+func WithResponseCompression(uncompressedTargets ...string) Option {
+	return func(opts *ledgerOpts) error {
+		opts.compressor = gzipCompressor
+		opts.uncompressedTargets = uncompressedTargets
+		return nil
+	}
+}
+
+// WithPostVerifyHook sets a hook that is invoked for each accepted response after the
+// ResponseVerifier has verified it. This is a lighter alternative to a custom ResponseVerifier
+// for callers that only need to observe or annotate accepted responses.
+func WithPostVerifyHook(hook PostVerifyHook) Option {
+	return func(opts *ledgerOpts) error {
+		opts.postVerify = hook
+		return nil
+	}
+}
+
+// WithObserver sets an observer that is notified of responses that are rejected by the
+// ResponseVerifier, for example, so that a pattern of verification failures may be alerted on.
+func WithObserver(observer Observer) Option {
+	return func(opts *ledgerOpts) error {
+		opts.observer = observer
+		return nil
+	}
+}
+
+// WithDeadlineAwareTargets enables deadline-aware target selection. The latency of each target is
+// recorded in the given stats (which may be shared by multiple Ledger clients) and, if the request
+// context has a deadline, only the targets whose p95 latency doesn't exceed the remaining time are
+// queried. If none of the targets qualify then the fastest target is queried. The selection is logged
+// and reported to the Observer if it implements TargetSelectionObserver.
+func WithDeadlineAwareTargets(stats *LatencyStats) Option {
+	return func(opts *ledgerOpts) error {
+		if stats == nil {
+			return errors.New("latency stats are required for deadline-aware target selection")
+		}
+		opts.latencyStats = stats
+		return nil
+	}
+}
+
+// WithRetryClassifier enables retrying of query requests to targets that fail with an error that the
+// given classifier considers to be transient. Requests are retried according to retry.DefaultOpts, unless
+// other options are set with WithRetry (only the attempts and backoff are used), and never beyond the
+// deadline of the request context. Since the errors that are transient vary across Fabric versions and
+// peer implementations, the classifier may be tuned per deployment. DefaultRetryClassifier is used if the
+// classifier is nil.
+func WithRetryClassifier(classifier RetryClassifier) Option {
+	return func(opts *ledgerOpts) error {
+		if classifier == nil {
+			classifier = DefaultRetryClassifier
+		}
+		opts.retryClassifier = classifier
+		return nil
+	}
+}
+
+// WithRetry enables retrying of query requests to targets that fail with a transient error, according to
+// the attempts and backoff of the given options. Only the failed targets are retried; responses that were
+// already received are not requested again. Requests are never retried beyond the deadline of the request
+// context. Errors are classified with DefaultRetryClassifier unless a classifier is set with WithRetryClassifier.
+func WithRetry(retryOpts retry.Opts) Option {
+	return func(opts *ledgerOpts) error {
+		if retryOpts.Attempts < 0 {
+			return errors.New("retry attempts must not be negative")
+		}
+		opts.retryOpts = &retryOpts
+		if opts.retryClassifier == nil {
+			opts.retryClassifier = DefaultRetryClassifier
+		}
+		return nil
+	}
+}
+
+// WithDiscovery enables the resolution of targets from the given discovery service. When a query
+// is made without targets, the peers currently provided by the discovery service are queried so that
+// changes to the channel's membership are picked up without maintaining a static list of peers.
+// Targets that are passed explicitly to a query override discovery. A query fails if discovery
+// returns no peers.
+func WithDiscovery(discovery fab.DiscoveryService) Option {
+	return func(opts *ledgerOpts) error {
+		if discovery == nil {
+			return errors.New("discovery service is required")
+		}
+		opts.discovery = discovery
+		return nil
+	}
+}
+
+// WithMaxLag enables bounded-staleness reads. Responses from targets whose ledger height lags behind
+// the maximum height observed across the targets by more than the given number of blocks are rejected.
+// For QueryInfo the maximum height is taken from the responses; for other queries the targets are first
+// probed for their height and the lagging targets are excluded from the query. A maximum lag of zero
+// only accepts responses from the targets with the maximum height. The rejected targets are included in
+// the returned errors and reported to the Observer if it implements LagObserver.
+func WithMaxLag(blocks uint64) Option {
+	return func(opts *ledgerOpts) error {
+		opts.maxLag = blocks
+		opts.maxLagEnabled = true
+		return nil
+	}
+}
+
+// WithEndorserTimeout sets an absolute cap on the time that is spent waiting for the response
+// of each endorser, so that a slow endorser is abandoned quickly even when the deadline of the
+// request context is generous. The timeout applies to each endorser independently (and, if
+// retries are enabled, to each attempt). The request context still bounds the overall query;
+// whichever of the endorser timeout and the request deadline fires first wins.
+func WithEndorserTimeout(timeout time.Duration) Option {
+	return func(opts *ledgerOpts) error {
+		if timeout <= 0 {
+			return errors.New("endorser timeout must be greater than zero")
+		}
+		opts.endorserTimeout = timeout
+		return nil
+	}
+}
+
+// WithStaleFallback enables graceful degradation when all targets fail. The last successful result of
+// each query is cached and, if a subsequent query fails for all targets, the cached result is returned
+// along with a StaleResultError (see IsStaleResult) so that the caller may decide whether stale data is
+// acceptable. A fresh result is never returned with a StaleResultError. Note that the cached results of
+// queries that are made with different targets or verifiers are shared.
+func WithStaleFallback() Option {
+	return func(opts *ledgerOpts) error {
+		opts.staleFallback = true
+		return nil
+	}
+}
+
+// WithInfoCache enables caching of the QueryInfo response of each peer (keyed by URL) until the next block
+// event, so that frequent QueryInfo calls between blocks don't query the peers, whereas a call after a block
+// event always queries the peers. The Ledger registers for filtered block events with the given event service
+// (which should be connected to the ledger's channel) when it's created, and the cache is invalidated whenever
+// a block event is received; if the subscription ends then nothing is cached. Close must be called to unregister
+// the subscription once the Ledger is no longer needed.
+// The cache holds one BlockchainInfoResponse per tracked peer: the peer's URL and MSP ID along with the height
+// and the two 32 byte block hashes of the channel, i.e. a few hundred bytes per peer. Note that the cached responses
+// were verified by the verifier of the query that retrieved them, which may differ from the verifier of a later query.
+func WithInfoCache(eventService fab.EventService) Option {
+	return func(opts *ledgerOpts) error {
+		if eventService == nil {
+			return errors.New("event service is required")
+		}
+		opts.infoCacheEvents = eventService
+		return nil
+	}
+}
+
+// WithOrderedTargets preserves the caller's ordering of the targets end-to-end, which makes the results of
+// queries reproducible (for example, in integration tests) and allows the first target to be a preferred peer.
+// The Ledger never reorders the targets: duplicate targets and, if enabled, lagging or slow targets are removed
+// without changing the order of the remaining targets, and targets that are resolved with discovery keep the
+// order in which they were discovered. Since the targets are queried concurrently, their responses arrive in
+// any order; with this option the responses (and the errors attributed to a target) are returned in the order
+// of the targets rather than in the order in which they arrived. Note that the proposals are still sent
+// concurrently, so a target isn't guaranteed to receive its proposal before the targets that follow it. The
+// random selection of targets by chconfig (see chconfig.WithMaxTargets) isn't affected and remains opt-in.
+func WithOrderedTargets() Option {
+	return func(opts *ledgerOpts) error {
+		opts.orderedTargets = true
+		return nil
+	}
+}
+
+// WithTargetKey sets the function that derives the logical identity of a target. Before a query is
+// dispatched, targets with the same identity are collapsed into one so that a peer that is included
+// more than once (for example, under two URLs that resolve to the same endpoint) is only counted once
+// towards the minimum number of responses required by the verifier. DefaultTargetKey is used by default.
+func WithTargetKey(keyFunc TargetKeyFunc) Option {
+	return func(opts *ledgerOpts) error {
+		if keyFunc == nil {
+			return errors.New("target key function is required")
+		}
+		opts.targetKey = keyFunc
+		return nil
+	}
+}
+
+// WithMaxBlockRange sets the maximum number of blocks that may be queried with QueryBlockByNumberRange
+// in one call, which guards against accidentally pulling a huge number of blocks. The default is 100.
+func WithMaxBlockRange(blocks uint64) Option {
+	return func(opts *ledgerOpts) error {
+		if blocks == 0 {
+			return errors.New("maximum block range must be greater than zero")
+		}
+		opts.maxBlockRange = blocks
+		return nil
+	}
+}
+
+// WithRejectedResponses retains the details of the responses that are returned with a bad status, for
+// example, in order to log why each peer rejected a proposal. Instead of a generic "bad status" error, a
+// RejectedResponseError containing the endorser, the status and the message of the response is included
+// in the returned error for each rejected response. The rejected responses may be extracted from the
+// error with RejectedResponses.
+func WithRejectedResponses() Option {
+	return func(opts *ledgerOpts) error {
+		opts.keepRejected = true
+		return nil
+	}
+}
+
+// WithConcurrencyLimit caps the number of proposals of a query that are in flight at a time, so that
+// querying many targets doesn't overwhelm slow peers. When the limit is reached, the requests to the
+// remaining targets wait for a request to complete (or for the request context to be done). The time spent
+// waiting doesn't count towards the endorser timeout and no slot is held between the attempts of a retried
+// request. By default the number of proposals in flight isn't limited.
+func WithConcurrencyLimit(limit int) Option {
+	return func(opts *ledgerOpts) error {
+		if limit <= 0 {
+			return errors.New("concurrency limit must be greater than zero")
+		}
+		opts.concurrencyLimit = limit
+		return nil
+	}
+}
+
+// WithChaincodeLifecycle declares the chaincode lifecycle that's used by the channel, which determines how
+// the chaincodes of the channel are queried (see QueryInstantiatedChaincodes). With the new (v2.x) lifecycle,
+// the chaincode definitions that are committed to the channel are queried from _lifecycle. The legacy (lscc)
+// lifecycle is used by default.
+func WithChaincodeLifecycle(lifecycle ChaincodeLifecycle) Option {
+	return func(opts *ledgerOpts) error {
+		if lifecycle != LegacyLifecycle && lifecycle != NewLifecycle {
+			return errors.Errorf("unsupported chaincode lifecycle: %d", lifecycle)
+		}
+		opts.lifecycle = lifecycle
+		return nil
+	}
+}
+
+// WithMaxResponseSize sets the maximum size (in bytes) of the payload of a response. A response whose payload
+// exceeds the maximum is rejected before the payload is unmarshalled, which protects against a malicious or
+// misconfigured peer that returns an enormous payload. The rejected response is reported, with the endorser and
+// the size of the payload, in the returned errors and to the Observer. The default maximum is 100 MB.
+func WithMaxResponseSize(bytes int) Option {
+	return func(opts *ledgerOpts) error {
+		if bytes <= 0 {
+			return errors.New("maximum response size must be greater than zero")
+		}
+		opts.maxResponseSize = bytes
+		return nil
+	}
+}
+
+// WithLSCCName overrides the name of the lscc system chaincode, which is queried for the chaincodes that are
+// instantiated on the channel with the legacy lifecycle (see QueryInstantiatedChaincodes). This is only
+// required on networks that run a fork of Fabric with renamed system chaincodes. The default is "lscc".
+func WithLSCCName(name string) Option {
+	return func(opts *ledgerOpts) error {
+		if name == "" {
+			return errors.New("lscc name must not be empty")
+		}
+		opts.lsccName = name
+		return nil
+	}
+}
+
+// WithQSCCName overrides the name of the qscc system chaincode, which is queried for the chain info, the blocks
+// and the transactions of the channel. This is only required on networks that run a fork of Fabric with renamed
+// system chaincodes. The default is "qscc".
+func WithQSCCName(name string) Option {
+	return func(opts *ledgerOpts) error {
+		if name == "" {
+			return errors.New("qscc name must not be empty")
+		}
+		opts.qsccName = name
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"sort"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+)
+
+// orderByTargets orders the responses, and the errors that are attributed to a target, by the position
+// of their target in the given targets, so that the result doesn't depend on the order in which the
+// targets responded. Responses and errors that can't be attributed to one of the targets keep their
+// relative order and follow those that can. Responses are matched to targets by address (the URL without
+// the gRPC scheme) since that's how endorsers identify themselves.
+func orderByTargets(targets []fab.ProposalProcessor, tprs []*fab.TransactionProposalResponse, errs error) ([]*fab.TransactionProposalResponse, error) {
+	positions := make(map[string]int)
+	for i, target := range targets {
+		if p, ok := target.(urlProvider); ok {
+			address := endpoint.ToAddress(p.URL())
+			if _, ok := positions[address]; !ok {
+				positions[address] = i
+			}
+		}
+	}
+
+	position := func(endorser string) int {
+		if i, ok := positions[endpoint.ToAddress(endorser)]; ok {
+			return i
+		}
+		return len(targets)
+	}
+
+	sort.SliceStable(tprs, func(i, j int) bool {
+		return position(tprs[i].Endorser) < position(tprs[j].Endorser)
+	})
+
+	if errList, ok := errs.(multi.Errors); ok {
+		errPosition := func(err error) int {
+			if targetErrs := TargetErrors(err); len(targetErrs) == 1 {
+				return position(targetErrs[0].Endorser)
+			}
+			return len(targets)
+		}
+		sort.SliceStable(errList, func(i, j int) bool {
+			return errPosition(errList[i]) < errPosition(errList[j])
+		})
+	}
+
+	return tprs, errs
+}
@@ -0,0 +1,200 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"bytes"
+	reqContext "context"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/utils"
+	"github.com/pkg/errors"
+)
+
+// ProofBundleVersion is the version of the proof bundle format produced by this package
+const ProofBundleVersion = 1
+
+// ProofBundle bundles the signed proposal responses of a query so that the result may be relayed to
+// a party that doesn't trust the relaying client. The recipient verifies the bundle with VerifyProofBundle,
+// which checks the endorsement signatures and extracts the result from the signed part of the responses,
+// so the relaying client can't forge or alter the result. The bundle is serialized as JSON (see Marshal
+// and UnmarshalProofBundle) with the proposal responses encoded as base64 protobuf bytes.
+type ProofBundle struct {
+	// Version is the version of the bundle format
+	Version int `json:"version"`
+	// ChannelID is the channel that was queried
+	ChannelID string `json:"channelId"`
+	// Responses are the proposal responses of the endorsers
+	Responses []*SignedResponse `json:"responses"`
+}
+
+// SignedResponse is the proposal response of an endorser
+type SignedResponse struct {
+	// Endorser is the target that returned the response. It's informational only since it's not signed;
+	// the signing identity is contained in the endorsement of the proposal response.
+	Endorser string `json:"endorser"`
+	// ProposalResponse is the marshalled peer.ProposalResponse
+	ProposalResponse []byte `json:"proposalResponse"`
+}
+
+// Marshal serializes the bundle
+func (b *ProofBundle) Marshal() ([]byte, error) {
+	bundleBytes, err := json.Marshal(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal of proof bundle failed")
+	}
+	return bundleBytes, nil
+}
+
+// UnmarshalProofBundle deserializes a bundle that was serialized with ProofBundle.Marshal
+func UnmarshalProofBundle(bundleBytes []byte) (*ProofBundle, error) {
+	bundle := &ProofBundle{}
+	if err := json.Unmarshal(bundleBytes, bundle); err != nil {
+		return nil, errors.Wrap(err, "unmarshal of proof bundle failed")
+	}
+	if bundle.Version != ProofBundleVersion {
+		return nil, errors.Errorf("unsupported proof bundle version %d", bundle.Version)
+	}
+	return bundle, nil
+}
+
+// VerifyProofBundle verifies each response in the bundle and returns the result payload on which the
+// responses agree. For each response, the endorser's identity must have been issued by one of the given
+// MSPs (keyed by MSP ID) and the endorsement signature over the response payload and endorser identity
+// must be valid. The result is taken from the signed chaincode action rather than from the (unsigned)
+// response, and the results of all of the responses must match. Only ECDSA signatures are supported.
+// Note that the proposal isn't included in the bundle, so the recipient should check that the decoded
+// result is the one that was asked for (for example, the number of a block or the ID of a transaction).
+func VerifyProofBundle(bundle *ProofBundle, msps map[string]*mb.FabricMSPConfig) ([]byte, error) {
+	if bundle == nil || len(bundle.Responses) == 0 {
+		return nil, errors.New("proof bundle contains no responses")
+	}
+
+	var result []byte
+	for i, response := range bundle.Responses {
+		payload, err := verifySignedResponse(response, msps)
+		if err != nil {
+			return nil, errors.WithMessage(err, "verification of response from ["+response.Endorser+"] failed")
+		}
+		if i > 0 && !bytes.Equal(payload, result) {
+			return nil, errors.Errorf("result of response from [%s] doesn't match", response.Endorser)
+		}
+		result = payload
+	}
+	return result, nil
+}
+
+// verifySignedResponse verifies the endorsement of the response and returns the signed result payload
+func verifySignedResponse(response *SignedResponse, msps map[string]*mb.FabricMSPConfig) ([]byte, error) {
+	proposalResponse := &pb.ProposalResponse{}
+	if err := proto.Unmarshal(response.ProposalResponse, proposalResponse); err != nil {
+		return nil, errors.Wrap(err, "unmarshal of proposal response failed")
+	}
+	if proposalResponse.Endorsement == nil {
+		return nil, errors.New("proposal response has no endorsement")
+	}
+
+	sID := &mb.SerializedIdentity{}
+	if err := proto.Unmarshal(proposalResponse.Endorsement.Endorser, sID); err != nil {
+		return nil, errors.Wrap(err, "unmarshal of endorser identity failed")
+	}
+	mspConfig, ok := msps[sID.Mspid]
+	if !ok {
+		return nil, errors.Errorf("endorser MSP [%s] is not trusted", sID.Mspid)
+	}
+
+	data := concatBytes(proposalResponse.Payload, proposalResponse.Endorsement.Endorser)
+	if err := verifyIdentitySignature(sID, mspConfig, proposalResponse.Endorsement.Signature, data); err != nil {
+		return nil, errors.WithMessage(err, "invalid endorsement signature")
+	}
+
+	prp, err := utils.GetProposalResponsePayload(proposalResponse.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal of proposal response payload failed")
+	}
+	action, err := utils.GetChaincodeAction(prp.Extension)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal of chaincode action failed")
+	}
+	if action.Response == nil {
+		return nil, errors.New("chaincode action has no response")
+	}
+	if action.Response.Status != int32(common.Status_SUCCESS) {
+		return nil, errors.Errorf("endorsed response has status %d: %s", action.Response.Status, action.Response.Message)
+	}
+	return action.Response.Payload, nil
+}
+
+// QueryBlockWithProof queries the ledger for the block with the given number (like QueryBlock) and
+// also returns a proof bundle containing the signed responses from which the blocks were extracted,
+// so that the block may be relayed to, and verified by, a party that doesn't trust this client.
+func (c *Ledger) QueryBlockWithProof(reqCtx reqContext.Context, blockNumber uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*common.Block, *ProofBundle, error) {
+	cir := createBlockByNumberInvokeRequest(c.opts.qsccName, c.chName, blockNumber)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
+
+	var blocks []*common.Block
+	var proven []*fab.TransactionProposalResponse
+	for _, tpr := range tprs {
+		block, err := createCommonBlock(tpr)
+		if err != nil {
+			errs = multi.Append(errs, newTargetError(tpr.Endorser, err, "From target: "+tpr.Endorser))
+			continue
+		}
+		blocks = append(blocks, block)
+		proven = append(proven, tpr)
+	}
+
+	bundle, err := c.newProofBundle(proven)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blocks, bundle, errs
+}
+
+// QueryTransactionWithProof queries the ledger for the transaction with the given ID (like QueryTransaction)
+// and also returns a proof bundle containing the signed responses from which the transactions were extracted,
+// so that the transaction may be relayed to, and verified by, a party that doesn't trust this client.
+func (c *Ledger) QueryTransactionWithProof(reqCtx reqContext.Context, transactionID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*pb.ProcessedTransaction, *ProofBundle, error) {
+	cir := createTransactionByIDInvokeRequest(c.opts.qsccName, c.chName, transactionID)
+	tprs, errs := c.queryChaincode(reqCtx, cir, targets, verifier)
+
+	var transactions []*pb.ProcessedTransaction
+	var proven []*fab.TransactionProposalResponse
+	for _, tpr := range tprs {
+		transaction, err := createProcessedTransaction(tpr)
+		if err != nil {
+			errs = multi.Append(errs, newTargetError(tpr.Endorser, err, "From target: "+tpr.Endorser))
+			continue
+		}
+		transactions = append(transactions, transaction)
+		proven = append(proven, tpr)
+	}
+
+	bundle, err := c.newProofBundle(proven)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transactions, bundle, errs
+}
+
+func (c *Ledger) newProofBundle(tprs []*fab.TransactionProposalResponse) (*ProofBundle, error) {
+	bundle := &ProofBundle{Version: ProofBundleVersion, ChannelID: c.chName}
+	for _, tpr := range tprs {
+		responseBytes, err := proto.Marshal(tpr.ProposalResponse)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal of proposal response failed")
+		}
+		bundle.Responses = append(bundle.Responses, &SignedResponse{Endorser: tpr.Endorser, ProposalResponse: responseBytes})
+	}
+	return bundle, nil
+}
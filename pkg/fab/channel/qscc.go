@@ -21,66 +21,66 @@ const (
 	qsccBlockByTxID     = "GetBlockByTxID"
 )
 
-func createTransactionByIDInvokeRequest(channelID string, transactionID fab.TransactionID) fab.ChaincodeInvokeRequest {
+func createTransactionByIDInvokeRequest(qsccName, channelID string, transactionID fab.TransactionID) fab.ChaincodeInvokeRequest {
 	var args [][]byte
 	args = append(args, []byte(channelID))
 	args = append(args, []byte(transactionID))
 
 	cir := fab.ChaincodeInvokeRequest{
-		ChaincodeID: qscc,
+		ChaincodeID: qsccName,
 		Fcn:         qsccTransactionByID,
 		Args:        args,
 	}
 	return cir
 }
 
-func createChannelInfoInvokeRequest(channelID string) fab.ChaincodeInvokeRequest {
+func createChannelInfoInvokeRequest(qsccName, channelID string) fab.ChaincodeInvokeRequest {
 	var args [][]byte
 	args = append(args, []byte(channelID))
 
 	cir := fab.ChaincodeInvokeRequest{
-		ChaincodeID: qscc,
+		ChaincodeID: qsccName,
 		Fcn:         qsccChannelInfo,
 		Args:        args,
 	}
 	return cir
 }
 
-func createBlockByHashInvokeRequest(channelID string, blockHash []byte) fab.ChaincodeInvokeRequest {
+func createBlockByHashInvokeRequest(qsccName, channelID string, blockHash []byte) fab.ChaincodeInvokeRequest {
 
 	var args [][]byte
 	args = append(args, []byte(channelID))
 	args = append(args, blockHash)
 
 	cir := fab.ChaincodeInvokeRequest{
-		ChaincodeID: qscc,
+		ChaincodeID: qsccName,
 		Fcn:         qsccBlockByHash,
 		Args:        args,
 	}
 	return cir
 }
 
-func createBlockByNumberInvokeRequest(channelID string, blockNumber uint64) fab.ChaincodeInvokeRequest {
+func createBlockByNumberInvokeRequest(qsccName, channelID string, blockNumber uint64) fab.ChaincodeInvokeRequest {
 
 	var args [][]byte
 	args = append(args, []byte(channelID))
 	args = append(args, []byte(strconv.FormatUint(blockNumber, 10)))
 
 	cir := fab.ChaincodeInvokeRequest{
-		ChaincodeID: qscc,
+		ChaincodeID: qsccName,
 		Fcn:         qsccBlockByNumber,
 		Args:        args,
 	}
 	return cir
 }
 
-func createBlockByTxIDInvokeRequest(channelID string, transactionID fab.TransactionID) fab.ChaincodeInvokeRequest {
+func createBlockByTxIDInvokeRequest(qsccName, channelID string, transactionID fab.TransactionID) fab.ChaincodeInvokeRequest {
 	var args [][]byte
 	args = append(args, []byte(channelID))
 	args = append(args, []byte(transactionID))
 
 	cir := fab.ChaincodeInvokeRequest{
-		ChaincodeID: qscc,
+		ChaincodeID: qsccName,
 		Fcn:         qsccBlockByTxID,
 		Args:        args,
 	}
@@ -0,0 +1,48 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/txn"
+	"github.com/pkg/errors"
+)
+
+// queryHeaderKey is the context key of the reusable query header
+type queryHeaderKey struct{}
+
+// WithQueryHeader returns a copy of the request context with which the queries made by the Ledger reuse the
+// given transaction header (and therefore its transaction ID and nonce) instead of creating a new header for
+// each query, which saves the overhead of creating headers for a batch of queries. The header must be for the
+// channel of the Ledger. Since queries are never ordered it's safe for them to share a transaction ID; a header
+// must never be reused for a transaction that will be sent to the orderer.
+func WithQueryHeader(reqCtx reqContext.Context, txh fab.TransactionHeader) reqContext.Context {
+	return reqContext.WithValue(reqCtx, queryHeaderKey{}, txh)
+}
+
+// queryHeader returns the reusable query header that was set on the request context or otherwise a new header
+func queryHeader(reqCtx reqContext.Context, channelID string) (fab.TransactionHeader, error) {
+	if txh, ok := reqCtx.Value(queryHeaderKey{}).(fab.TransactionHeader); ok && txh != nil {
+		if txh.ChannelID() != channelID {
+			return nil, errors.Errorf("query header is for channel [%s] but the query is for channel [%s]", txh.ChannelID(), channelID)
+		}
+		return txh, nil
+	}
+
+	ctx, ok := contextImpl.RequestClientContext(reqCtx)
+	if !ok {
+		return nil, errors.New("failed get client context from reqContext for signProposal")
+	}
+	txh, err := txn.NewHeader(ctx, channelID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "creation of transaction ID failed")
+	}
+	return txh, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// RawPayload is the undecoded payload of the response of a single endorser, for example,
+// the marshalled common.Block of a block query
+type RawPayload struct {
+	// Endorser is the URL of the endorser
+	Endorser string
+	// MSPID is the MSP ID of the endorser (empty if it can't be resolved)
+	MSPID string
+	// Identity is the serialized identity that endorsed the response (nil if the response has no endorsement)
+	Identity []byte
+	// Payload is the payload of the response
+	Payload []byte
+}
+
+// QueryBlockRaw queries the ledger for the block with the given number, as QueryBlock does, but returns the
+// undecoded payload of each response rather than unmarshalling it into a block. The responses are verified
+// by the verifier as usual. This allows the payloads to be parsed by custom parsers or passed to external
+// verification tools.
+func (c *Ledger) QueryBlockRaw(reqCtx reqContext.Context, blockNumber uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*RawPayload, error) {
+	cir := createBlockByNumberInvokeRequest(c.opts.qsccName, c.chName, blockNumber)
+	return c.queryRaw(reqCtx, cir, targets, verifier)
+}
+
+// QueryBlockByHashRaw queries the ledger for the block with the given hash and returns the undecoded
+// payload of each response (see QueryBlockRaw)
+func (c *Ledger) QueryBlockByHashRaw(reqCtx reqContext.Context, blockHash []byte, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*RawPayload, error) {
+	if blockHash == nil {
+		return nil, errors.New("blockHash is required")
+	}
+
+	cir := createBlockByHashInvokeRequest(c.opts.qsccName, c.chName, blockHash)
+	return c.queryRaw(reqCtx, cir, targets, verifier)
+}
+
+// QueryBlockByTxIDRaw queries the ledger for the block that contains the given transaction and returns
+// the undecoded payload of each response (see QueryBlockRaw)
+func (c *Ledger) QueryBlockByTxIDRaw(reqCtx reqContext.Context, txID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*RawPayload, error) {
+	if txID == "" {
+		return nil, errors.New("txID is required")
+	}
+
+	cir := createBlockByTxIDInvokeRequest(c.opts.qsccName, c.chName, txID)
+	return c.queryRaw(reqCtx, cir, targets, verifier)
+}
+
+// QueryTransactionRaw queries the ledger for the given transaction and returns the undecoded payload of
+// each response, i.e. the marshalled ProcessedTransaction (see QueryBlockRaw)
+func (c *Ledger) QueryTransactionRaw(reqCtx reqContext.Context, transactionID fab.TransactionID, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*RawPayload, error) {
+	cir := createTransactionByIDInvokeRequest(c.opts.qsccName, c.chName, transactionID)
+	return c.queryRaw(reqCtx, cir, targets, verifier)
+}
+
+// queryRaw queries the targets and returns the payloads of the verified responses along with their endorsers
+func (c *Ledger) queryRaw(reqCtx reqContext.Context, request fab.ChaincodeInvokeRequest, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]*RawPayload, error) {
+	tprs, errs := c.queryChaincode(reqCtx, request, targets, verifier)
+
+	payloads := collectProposalResponses(tprs)
+	responses := make([]*RawPayload, len(tprs))
+	for i, tpr := range tprs {
+		responses[i] = &RawPayload{
+			Endorser: tpr.Endorser,
+			MSPID:    resolveMSPID(tpr, targets),
+			Identity: tpr.ProposalResponse.GetEndorsement().GetEndorser(),
+			Payload:  payloads[i],
+		}
+	}
+	return responses, errs
+}
@@ -0,0 +1,64 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/pkg/errors"
+)
+
+// RejectedResponse describes a response that was returned with a bad status
+type RejectedResponse struct {
+	// Endorser is the URL of the endorser
+	Endorser string
+	// Status is the status of the response
+	Status int32
+	// Message is the message of the response that explains the status
+	Message string
+	// Payload is the payload of the response (if any)
+	Payload []byte
+}
+
+// RejectedResponseError is returned for each response with a bad status when rejected
+// responses are retained (see WithRejectedResponses)
+type RejectedResponseError struct {
+	Response *RejectedResponse
+}
+
+func (e *RejectedResponseError) Error() string {
+	return fmt.Sprintf("bad status from %s (%d): %s", e.Response.Endorser, e.Response.Status, e.Response.Message)
+}
+
+// RejectedResponses returns the rejected responses that are contained in the given error
+// returned by a query (see WithRejectedResponses)
+func RejectedResponses(err error) []*RejectedResponse {
+	var rejected []*RejectedResponse
+	switch e := errors.Cause(err).(type) {
+	case multi.Errors:
+		for _, err := range e {
+			rejected = append(rejected, RejectedResponses(err)...)
+		}
+	case *RejectedResponseError:
+		rejected = append(rejected, e.Response)
+	}
+	return rejected
+}
+
+func newRejectedResponseError(response *fab.TransactionProposalResponse) error {
+	rejected := &RejectedResponse{Endorser: response.Endorser, Status: response.Status}
+	if r := response.ProposalResponse.GetResponse(); r != nil {
+		if r.Status != 0 {
+			rejected.Status = r.Status
+		}
+		rejected.Message = r.Message
+		rejected.Payload = r.Payload
+	}
+	return &RejectedResponseError{Response: rejected}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// RetryClassifier determines whether the given error, returned by a target, is
+// transient such that the request to the target should be retried
+type RetryClassifier func(err error) bool
+
+// DefaultRetryClassifier is the RetryClassifier used when none is provided. An error is
+// considered to be retryable if its status is in retry.DefaultRetryableCodes.
+func DefaultRetryClassifier(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, code := range retry.DefaultRetryableCodes[s.Group] {
+		if status.Code(s.Code) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTarget retries requests to the target that fail with a retryable error
+type retryTarget struct {
+	fab.ProposalProcessor
+	opts       retry.Opts
+	classifier RetryClassifier
+}
+
+// ProcessTransactionProposal delegates to the target and retries (with backoff) while the
+// error is classified as retryable, the attempts are not exhausted and the context is not done
+func (t *retryTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	backoff := t.opts.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+		if err == nil || attempt >= t.opts.Attempts || !t.classifier(err) {
+			return resp, err
+		}
+
+		logger.Debugf("Retrying request after retryable error (attempt %d of %d): %s", attempt+1, t.opts.Attempts, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-reqCtx.Done():
+			return resp, err
+		}
+
+		backoff = time.Duration(float64(backoff) * t.opts.BackoffFactor)
+		if backoff > t.opts.MaxBackoff {
+			backoff = t.opts.MaxBackoff
+		}
+	}
+}
+
+// withRetry wraps the targets so that requests that fail with a retryable error are retried
+func withRetry(targets []fab.ProposalProcessor, opts retry.Opts, classifier RetryClassifier) []fab.ProposalProcessor {
+	retryTargets := make([]fab.ProposalProcessor, len(targets))
+	for i, target := range targets {
+		retryTargets[i] = &retryTarget{ProposalProcessor: target, opts: opts, classifier: classifier}
+	}
+	return retryTargets
+}
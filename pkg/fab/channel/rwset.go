@@ -0,0 +1,148 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/utils"
+	"github.com/pkg/errors"
+)
+
+// TxReadWriteSets contains the decoded read-write sets of an endorser transaction
+type TxReadWriteSets struct {
+	TxID           string
+	ValidationCode pb.TxValidationCode
+	// Actions contains the read-write sets of each action of the transaction, in transaction order
+	Actions []ActionReadWriteSets
+}
+
+// ActionReadWriteSets contains the read-write sets of a single action of a transaction
+type ActionReadWriteSets struct {
+	// ChaincodeID is the name of the chaincode that was invoked by the action
+	ChaincodeID string
+	// Namespaces contains the read-write set of each namespace (chaincode) that was accessed by the action
+	Namespaces []NsReadWriteSet
+}
+
+// NsReadWriteSet contains the public keys that were read and written in a namespace
+type NsReadWriteSet struct {
+	Namespace string
+	Reads     []KVRead
+	Writes    []KVWrite
+}
+
+// KVRead is a key that was read along with the version of the key at the time of the read
+type KVRead struct {
+	Key string
+	// Version is the version of the key that was read (nil if the key didn't exist)
+	Version *KeyVersion
+}
+
+// KeyVersion identifies the transaction that last committed a key
+type KeyVersion struct {
+	BlockNum uint64
+	TxNum    uint64
+}
+
+// KVWrite is a key that was written (or deleted) along with the value that was written
+type KVWrite struct {
+	Key      string
+	IsDelete bool
+	Value    []byte
+}
+
+// TransactionReadWriteSets decodes the read-write sets of the given processed transaction (for example,
+// as returned by QueryTransaction), which is useful for diagnosing MVCC read conflicts. The read-write
+// sets of all of the actions of the transaction are returned. Only the public data is decoded: the
+// hashed read-write sets of private data collections are ignored.
+func TransactionReadWriteSets(tx *pb.ProcessedTransaction) (*TxReadWriteSets, error) {
+	if tx == nil || tx.TransactionEnvelope == nil {
+		return nil, errors.New("processed transaction does not contain a transaction envelope")
+	}
+
+	envelopeBytes, err := proto.Marshal(tx.TransactionEnvelope)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal of transaction envelope failed")
+	}
+
+	payload, channelHeader, err := txChannelHeader(envelopeBytes)
+	if err != nil {
+		return nil, err
+	}
+	if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, errors.Errorf("transaction [%s] of type %s has no read-write sets", channelHeader.TxId, common.HeaderType(channelHeader.Type))
+	}
+
+	transaction, err := utils.GetTransaction(payload.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling transaction payload")
+	}
+
+	rwSets := &TxReadWriteSets{
+		TxID:           channelHeader.TxId,
+		ValidationCode: pb.TxValidationCode(tx.ValidationCode),
+	}
+	for i, action := range transaction.Actions {
+		actionRWSets, err := actionReadWriteSets(action)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("action %d of transaction [%s]", i, channelHeader.TxId))
+		}
+		rwSets.Actions = append(rwSets.Actions, *actionRWSets)
+	}
+
+	return rwSets, nil
+}
+
+func actionReadWriteSets(action *pb.TransactionAction) (*ActionReadWriteSets, error) {
+	chaincodeActionPayload, err := utils.GetChaincodeActionPayload(action.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling chaincode action payload")
+	}
+	if chaincodeActionPayload.Action == nil {
+		return nil, errors.New("missing chaincode endorsed action")
+	}
+
+	propRespPayload, err := utils.GetProposalResponsePayload(chaincodeActionPayload.Action.ProposalResponsePayload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling response payload")
+	}
+
+	ccAction, err := utils.GetChaincodeAction(propRespPayload.Extension)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling chaincode action")
+	}
+
+	txRWSet := &rwsetutil.TxRwSet{}
+	if err := txRWSet.FromProtoBytes(ccAction.Results); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling read-write set")
+	}
+
+	actionRWSets := &ActionReadWriteSets{ChaincodeID: ccAction.GetChaincodeId().GetName()}
+	for _, nsRWSet := range txRWSet.NsRwSets {
+		ns := NsReadWriteSet{Namespace: nsRWSet.NameSpace}
+		if nsRWSet.KvRwSet != nil {
+			for _, read := range nsRWSet.KvRwSet.Reads {
+				kvRead := KVRead{Key: read.Key}
+				if read.Version != nil {
+					kvRead.Version = &KeyVersion{BlockNum: read.Version.BlockNum, TxNum: read.Version.TxNum}
+				}
+				ns.Reads = append(ns.Reads, kvRead)
+			}
+			for _, write := range nsRWSet.KvRwSet.Writes {
+				ns.Writes = append(ns.Writes, KVWrite{Key: write.Key, IsDelete: write.IsDelete, Value: write.Value})
+			}
+		}
+		actionRWSets.Namespaces = append(actionRWSets.Namespaces, ns)
+	}
+
+	return actionRWSets, nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"github.com/hyperledger/fabric-sdk-go/internal/github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// SignatureVerifier is a ResponseVerifier that rejects responses whose endorsement wasn't signed
+// by a valid identity of one of the MSPs known to the MSP manager
+type SignatureVerifier struct {
+	mspManager msp.MSPManager
+}
+
+// NewSignatureVerifier returns a ResponseVerifier that verifies the endorsement signature over the
+// proposal response payload. The endorser identity is resolved and validated with the given MSP manager.
+func NewSignatureVerifier(mspManager msp.MSPManager) *SignatureVerifier {
+	return &SignatureVerifier{mspManager: mspManager}
+}
+
+// Verify checks that the endorsement of the response was signed by a valid endorser identity
+func (v *SignatureVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	if response.ProposalResponse == nil || response.ProposalResponse.Endorsement == nil {
+		return errors.Errorf("missing endorsement in proposal response from endorser [%s]", response.Endorser)
+	}
+
+	endorsement := response.ProposalResponse.Endorsement
+
+	identity, err := v.mspManager.DeserializeIdentity(endorsement.Endorser)
+	if err != nil {
+		return errors.Wrapf(err, "failed to deserialize identity of endorser [%s]", response.Endorser)
+	}
+
+	if err := identity.Validate(); err != nil {
+		return errors.Wrapf(err, "identity of endorser [%s] is not valid", response.Endorser)
+	}
+
+	// The endorsement signature is over the proposal response payload followed by the endorser identity
+	digest := concatBytes(response.ProposalResponse.Payload, endorsement.Endorser)
+	if err := identity.Verify(digest, endorsement.Signature); err != nil {
+		return errors.Wrapf(err, "invalid endorsement signature from endorser [%s]", response.Endorser)
+	}
+
+	return nil
+}
+
+// Match is not used by this verifier and always succeeds
+func (v *SignatureVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	"github.com/pkg/errors"
+)
+
+// maxStaleCacheEntries is the maximum number of query results that are cached for the stale fallback
+const maxStaleCacheEntries = 100
+
+// StaleResultError is returned along with a cached result when stale fallback is enabled (see
+// WithStaleFallback) and the query failed for all targets. The result that is returned with
+// this error is the last successful result of the same query and may be out of date.
+type StaleResultError struct {
+	// Err is the error of the failed query
+	Err error
+	// CachedAt is the time at which the returned result was retrieved
+	CachedAt time.Time
+}
+
+func (e *StaleResultError) Error() string {
+	return fmt.Sprintf("returning stale result retrieved at %s since the query failed: %s", e.CachedAt, e.Err)
+}
+
+// IsStaleResult returns true if the given error (or one of the errors in a multi error) is a
+// StaleResultError, in which case the returned result is a stale (cached) result
+func IsStaleResult(err error) bool {
+	if errs, ok := err.(multi.Errors); ok {
+		for _, e := range errs {
+			if IsStaleResult(e) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := errors.Cause(err).(*StaleResultError)
+	return ok
+}
+
+type staleCacheEntry struct {
+	responses []*fab.TransactionProposalResponse
+	cachedAt  time.Time
+}
+
+// staleCache holds the last successful responses of each query (keyed by request)
+type staleCache struct {
+	mutex   sync.RWMutex
+	entries map[string]*staleCacheEntry
+}
+
+func newStaleCache() *staleCache {
+	return &staleCache{entries: make(map[string]*staleCacheEntry)}
+}
+
+func (c *staleCache) put(request fab.ChaincodeInvokeRequest, responses []*fab.TransactionProposalResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := staleCacheKey(request)
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxStaleCacheEntries {
+		c.evictOldest()
+	}
+
+	cached := make([]*fab.TransactionProposalResponse, len(responses))
+	copy(cached, responses)
+	c.entries[key] = &staleCacheEntry{responses: cached, cachedAt: time.Now()}
+}
+
+func (c *staleCache) get(request fab.ChaincodeInvokeRequest) (*staleCacheEntry, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	entry, ok := c.entries[staleCacheKey(request)]
+	return entry, ok
+}
+
+func (c *staleCache) evictOldest() {
+	var oldestKey string
+	var oldest *staleCacheEntry
+	for key, entry := range c.entries {
+		if oldest == nil || entry.cachedAt.Before(oldest.cachedAt) {
+			oldestKey, oldest = key, entry
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+// staleCacheKey returns the key of the request. Each part of the key is prefixed with its length so that
+// the key is unambiguous, since the arguments may contain any bytes (including the separator).
+func staleCacheKey(request fab.ChaincodeInvokeRequest) string {
+	var key bytes.Buffer
+	writeKeyPart(&key, []byte(request.ChaincodeID))
+	writeKeyPart(&key, []byte(request.Fcn))
+	for _, arg := range request.Args {
+		writeKeyPart(&key, arg)
+	}
+	return key.String()
+}
+
+func writeKeyPart(key *bytes.Buffer, part []byte) {
+	fmt.Fprintf(key, "%d:", len(part))
+	key.Write(part)
+}
+
+// withStaleFallback caches the responses of successful queries and, if the query failed for all
+// targets, returns the cached responses of the same query (if any) along with a StaleResultError
+func (c *Ledger) withStaleFallback(request fab.ChaincodeInvokeRequest, tprs []*fab.TransactionProposalResponse, err error) ([]*fab.TransactionProposalResponse, error) {
+	if len(tprs) > 0 {
+		c.staleCache.put(request, tprs)
+		return tprs, err
+	}
+
+	if err == nil {
+		return tprs, err
+	}
+
+	entry, ok := c.staleCache.get(request)
+	if !ok {
+		return tprs, err
+	}
+
+	logger.Debugf("Query [%s] failed for all targets; returning stale result retrieved at %s: %s", request.Fcn, entry.cachedAt, err)
+
+	responses := make([]*fab.TransactionProposalResponse, len(entry.responses))
+	copy(responses, entry.responses)
+	return responses, &StaleResultError{Err: err, CachedAt: entry.cachedAt}
+}
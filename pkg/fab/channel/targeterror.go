@@ -0,0 +1,103 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+)
+
+// TargetError is an error that's attributed to a single target (endorser), for example, a failure to
+// send the proposal, a response with a bad status or a response that was rejected by the verifier
+type TargetError struct {
+	// Endorser is the URL of the target
+	Endorser string
+	// Err is the underlying error
+	Err error
+	// message describes the error (if empty, only the underlying error is described)
+	message string
+}
+
+func newTargetError(endorser string, err error, message string) *TargetError {
+	return &TargetError{Endorser: endorser, Err: err, message: message}
+}
+
+func (e *TargetError) Error() string {
+	if e.message == "" {
+		return e.Err.Error()
+	}
+	return e.message + ": " + e.Err.Error()
+}
+
+// Cause returns the underlying error
+func (e *TargetError) Cause() error {
+	return e.Err
+}
+
+// TargetErrors returns the errors that are attributed to a target in the given error returned by a query,
+// which allows the failing targets to be determined (for example, in order to exclude them from subsequent
+// queries). Errors that aren't attributed to a target aren't returned.
+func TargetErrors(err error) []*TargetError {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		switch e := err.(type) {
+		case *TargetError:
+			return []*TargetError{e}
+		case multi.Errors:
+			var targetErrs []*TargetError
+			for _, err := range e {
+				targetErrs = append(targetErrs, TargetErrors(err)...)
+			}
+			return targetErrs
+		}
+
+		c, ok := err.(causer)
+		if !ok {
+			return nil
+		}
+		err = c.Cause()
+	}
+	return nil
+}
+
+// targetErrorTarget attributes the errors of the target to the target's URL
+type targetErrorTarget struct {
+	fab.ProposalProcessor
+	url string
+}
+
+// URL returns the URL of the target
+func (t *targetErrorTarget) URL() string {
+	return t.url
+}
+
+// ProcessTransactionProposal delegates to the target and wraps the error (if any) in a TargetError
+func (t *targetErrorTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	resp, err := t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+	if err != nil {
+		return resp, newTargetError(t.url, err, "From target: "+t.url)
+	}
+	return resp, nil
+}
+
+// withTargetErrors wraps the targets (that have a URL) so that their errors are attributed to them
+func withTargetErrors(targets []fab.ProposalProcessor) []fab.ProposalProcessor {
+	wrapped := make([]fab.ProposalProcessor, len(targets))
+	for i, target := range targets {
+		if p, ok := target.(urlProvider); ok {
+			wrapped[i] = &targetErrorTarget{ProposalProcessor: target, url: p.URL()}
+		} else {
+			wrapped[i] = target
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,55 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// timeoutTarget bounds each request to the target by a timeout
+type timeoutTarget struct {
+	fab.ProposalProcessor
+	timeout time.Duration
+}
+
+// ProcessTransactionProposal delegates to the target with a context that is derived from the
+// request context and that times out after the endorser timeout
+func (t *timeoutTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	ctx, cancel := reqContext.WithTimeout(reqCtx, t.timeout)
+	defer cancel()
+	return t.ProposalProcessor.ProcessTransactionProposal(ctx, request)
+}
+
+// withEndorserTimeout wraps the targets so that each request is bounded by the given timeout
+func withEndorserTimeout(targets []fab.ProposalProcessor, timeout time.Duration) []fab.ProposalProcessor {
+	timeoutTargets := make([]fab.ProposalProcessor, len(targets))
+	for i, target := range targets {
+		timeoutTargets[i] = &timeoutTarget{ProposalProcessor: target, timeout: timeout}
+	}
+	return timeoutTargets
+}
+
+// queryTimeoutKey is the context key of the query timeout
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout returns a copy of the request context that bounds each query made by the Ledger
+// with the returned context by the given timeout, independently of the deadline of the request
+// context (whichever fires first wins). This allows a timeout to be set for an individual query
+// without deriving a new request context for it. Queries that consist of multiple round trips
+// (such as block range queries) apply the timeout to each round trip.
+func WithQueryTimeout(reqCtx reqContext.Context, timeout time.Duration) reqContext.Context {
+	return reqContext.WithValue(reqCtx, queryTimeoutKey{}, timeout)
+}
+
+// queryTimeout returns the query timeout that was set on the request context (if any)
+func queryTimeout(reqCtx reqContext.Context) (time.Duration, bool) {
+	timeout, ok := reqCtx.Value(queryTimeoutKey{}).(time.Duration)
+	return timeout, ok && timeout > 0
+}
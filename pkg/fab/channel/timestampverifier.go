@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// TimestampVerifier is a ResponseVerifier that rejects proposal responses whose timestamp is outside of
+// an acceptable window relative to the current time, in order to detect stale or replayed responses.
+// Note that the timestamp is an optional field of the proposal response which is not set by Fabric peers
+// (the timestamp of the signed proposal is set by the client), so the verifier is mainly useful with
+// endorsers (or proxies) that do set it. Responses without a timestamp are either skipped or rejected
+// according to the rejectMissing flag.
+type TimestampVerifier struct {
+	maxSkew       time.Duration
+	rejectMissing bool
+}
+
+// NewTimestampVerifier returns a ResponseVerifier that rejects responses whose timestamp differs from
+// the current time by more than maxSkew (in either direction). If rejectMissing is true then responses
+// without a timestamp are rejected, otherwise they are accepted.
+func NewTimestampVerifier(maxSkew time.Duration, rejectMissing bool) *TimestampVerifier {
+	return &TimestampVerifier{maxSkew: maxSkew, rejectMissing: rejectMissing}
+}
+
+// Verify checks that the timestamp of the response (if present) is within the allowed skew
+func (v *TimestampVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	if response.ProposalResponse == nil || response.ProposalResponse.Timestamp == nil {
+		if v.rejectMissing {
+			return errors.Errorf("missing timestamp in proposal response from endorser [%s]", response.Endorser)
+		}
+		return nil
+	}
+
+	timestamp, err := ptypes.Timestamp(response.ProposalResponse.Timestamp)
+	if err != nil {
+		return errors.Wrapf(err, "invalid timestamp in proposal response from endorser [%s]", response.Endorser)
+	}
+
+	skew := time.Since(timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > v.maxSkew {
+		return errors.Errorf("timestamp %s of proposal response from endorser [%s] is outside of the allowed skew of %s", timestamp, response.Endorser, v.maxSkew)
+	}
+
+	return nil
+}
+
+// Match is not used by this verifier and always succeeds
+func (v *TimestampVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
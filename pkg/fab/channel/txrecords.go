@@ -0,0 +1,176 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	reqContext "context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
+	ledgerutil "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/utils"
+	"github.com/pkg/errors"
+)
+
+// TransactionRecord contains the details of a transaction in a block
+type TransactionRecord struct {
+	TxID string
+	// Type is the header type of the transaction (for example, ENDORSER_TRANSACTION or CONFIG)
+	Type common.HeaderType
+	// ChaincodeID is the name of the invoked chaincode (endorser transactions only)
+	ChaincodeID    string
+	ValidationCode pb.TxValidationCode
+	BlockNumber    uint64
+	// TxIndex is the position of the transaction within the block
+	TxIndex int
+}
+
+// QueryTransactionsInBlockRange queries the ledger for the blocks in the given (inclusive) range
+// and returns a flat list of records of the transactions in the blocks, in ledger order.
+// The targets must agree (according to the verifier) on the contents of each block.
+// If a block can't be retrieved then the records extracted so far are returned along with the error.
+// Transactions that can't be parsed are skipped and reported in the returned error.
+func (c *Ledger) QueryTransactionsInBlockRange(reqCtx reqContext.Context, start, end uint64, targets []fab.ProposalProcessor, verifier ResponseVerifier) ([]TransactionRecord, error) {
+	if start > end {
+		return nil, errors.Errorf("invalid block range [%d, %d]", start, end)
+	}
+
+	targets, err := c.resolveTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []TransactionRecord
+	var errs error
+	for blockNum := start; blockNum <= end; blockNum++ {
+		block, err := c.queryMatchingBlock(reqCtx, blockNum, targets, verifier)
+		if err != nil {
+			return records, multi.Append(errs, errors.WithMessage(err, "query transactions in block range failed"))
+		}
+
+		blockRecords, err := transactionRecords(block)
+		records = append(records, blockRecords...)
+		if err != nil {
+			errs = multi.Append(errs, err)
+		}
+
+		if blockNum == end {
+			// Avoid overflow if end is the maximum block number
+			break
+		}
+	}
+
+	return records, errs
+}
+
+// transactionRecords extracts the records of the transactions in the block
+func transactionRecords(block *common.Block) ([]TransactionRecord, error) {
+	if block.Header == nil || block.Data == nil {
+		return nil, errors.New("block header and data are required")
+	}
+
+	var txFilter ledgerutil.TxValidationFlags
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = ledgerutil.TxValidationFlags(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	}
+
+	var records []TransactionRecord
+	var errs error
+	for i, data := range block.Data.Data {
+		record, err := transactionRecord(data)
+		if err != nil {
+			errs = multi.Append(errs, errors.WithMessage(err, fmt.Sprintf("transaction %d of block %d", i, block.Header.Number)))
+			continue
+		}
+
+		record.BlockNumber = block.Header.Number
+		record.TxIndex = i
+		if i < len(txFilter) {
+			record.ValidationCode = txFilter.Flag(i)
+		}
+		records = append(records, *record)
+	}
+
+	return records, errs
+}
+
+func transactionRecord(data []byte) (*TransactionRecord, error) {
+	payload, channelHeader, err := txChannelHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &TransactionRecord{
+		TxID: channelHeader.TxId,
+		Type: common.HeaderType(channelHeader.Type),
+	}
+
+	if record.Type == common.HeaderType_ENDORSER_TRANSACTION {
+		record.ChaincodeID, err = chaincodeIDFromTransaction(payload.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+// txChannelHeader extracts the payload and channel header of the transaction envelope in the block data
+func txChannelHeader(data []byte) (*common.Payload, *common.ChannelHeader, error) {
+	env, err := utils.GetEnvelopeFromBlock(data)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error extracting Envelope from block")
+	}
+
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error extracting Payload from envelope")
+	}
+	if payload.Header == nil {
+		return nil, nil, errors.New("missing payload header")
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return nil, nil, errors.Wrap(err, "error extracting ChannelHeader from payload")
+	}
+	return payload, channelHeader, nil
+}
+
+func chaincodeIDFromTransaction(data []byte) (string, error) {
+	tx, err := utils.GetTransaction(data)
+	if err != nil {
+		return "", errors.Wrap(err, "error unmarshalling transaction payload")
+	}
+	if len(tx.Actions) == 0 {
+		return "", errors.New("transaction has no actions")
+	}
+
+	chaincodeActionPayload, err := utils.GetChaincodeActionPayload(tx.Actions[0].Payload)
+	if err != nil {
+		return "", errors.Wrap(err, "error unmarshalling chaincode action payload")
+	}
+	if chaincodeActionPayload.Action == nil {
+		return "", errors.New("missing chaincode endorsed action")
+	}
+
+	propRespPayload, err := utils.GetProposalResponsePayload(chaincodeActionPayload.Action.ProposalResponsePayload)
+	if err != nil {
+		return "", errors.Wrap(err, "error unmarshalling response payload")
+	}
+
+	ccAction, err := utils.GetChaincodeAction(propRespPayload.Extension)
+	if err != nil {
+		return "", errors.Wrap(err, "error unmarshalling chaincode action")
+	}
+
+	return ccAction.GetChaincodeId().GetName(), nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chconfig
+
+import (
+	reqContext "context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/channel"
+	"github.com/pkg/errors"
+)
+
+// anchorPeerProbeTimeout bounds the QueryInfo probe of each anchor peer
+const anchorPeerProbeTimeout = 5 * time.Second
+
+// PeerStatus contains the result of probing an anchor peer
+type PeerStatus struct {
+	// Org is the organization that advertised the anchor peer
+	Org string
+	// Reachable is true if the peer responded to the probe
+	Reachable bool
+	// Height is the ledger height reported by the peer (if reachable)
+	Height uint64
+	// Err is the reason the peer is not reachable
+	Err error
+}
+
+// CheckAnchorPeers probes each of the anchor peers in the given channel config with a QueryInfo
+// request and returns the status of each peer, keyed by "host:port". The TLS settings and MSP ID of
+// each peer are taken from the SDK configuration if the peer is configured. Each probe is bounded
+// by a short timeout (and by the deadline of the request context). An error is only returned if
+// the anchor peers can't be probed; an unreachable peer is reported in its status.
+func CheckAnchorPeers(reqCtx reqContext.Context, cfg fab.ChannelCfg) (map[string]PeerStatus, error) {
+	if cfg == nil {
+		return nil, errors.New("channel config is required")
+	}
+
+	ctx, ok := contextImpl.RequestClientContext(reqCtx)
+	if !ok {
+		return nil, errors.New("failed get client context from reqContext for anchor peer check")
+	}
+
+	l, err := channel.NewLedger(cfg.ID())
+	if err != nil {
+		return nil, errors.WithMessage(err, "ledger client creation failed")
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	statuses := make(map[string]PeerStatus)
+	for _, anchorPeer := range cfg.AnchorPeers() {
+		url := fmt.Sprintf("%s:%d", anchorPeer.Host, anchorPeer.Port)
+
+		wg.Add(1)
+		go func(org, url string) {
+			defer wg.Done()
+
+			status := probeAnchorPeer(reqCtx, ctx, l, url)
+			status.Org = org
+
+			mutex.Lock()
+			statuses[url] = status
+			mutex.Unlock()
+		}(anchorPeer.Org, url)
+	}
+	wg.Wait()
+
+	return statuses, nil
+}
+
+func probeAnchorPeer(reqCtx reqContext.Context, ctx context.Client, l *channel.Ledger, url string) PeerStatus {
+	peerCfg, err := config.NetworkPeerConfigFromURL(ctx.Config(), url)
+	if err != nil {
+		logger.Debugf("Anchor peer [%s] not found in config - using default settings: %s", url, err)
+		peerCfg = &core.NetworkPeer{PeerConfig: core.PeerConfig{URL: url}}
+	}
+
+	peer, err := ctx.InfraProvider().CreatePeerFromConfig(peerCfg)
+	if err != nil {
+		return PeerStatus{Err: errors.WithMessage(err, "creating peer from config failed")}
+	}
+
+	probeCtx, cancel := reqContext.WithTimeout(reqCtx, anchorPeerProbeTimeout)
+	defer cancel()
+
+	responses, err := l.QueryInfo(probeCtx, []fab.ProposalProcessor{peer}, nil)
+	if len(responses) == 0 {
+		if err == nil {
+			err = errors.New("no response from peer")
+		}
+		return PeerStatus{Err: errors.WithMessage(err, "QueryInfo failed")}
+	}
+
+	return PeerStatus{Reachable: true, Height: responses[0].BCI.Height}
+}
+
+// anchorPeerTargets returns the peers that are anchor peers of the channel (see WithAnchorPeersOnly).
+// An error is returned if no anchor peers are known or if none of the peers is an anchor peer.
+func (c *ChannelConfig) anchorPeerTargets(peers []fab.Peer) ([]fab.Peer, error) {
+	cfg := c.opts.KnownConfig
+	if cfg == nil {
+		cfg = latestConfig(c.channelID, c.opts)
+	}
+	if cfg == nil {
+		// The config retrieved with the same options from all of the targets (rather than only the anchor peers)
+		opts := c.opts
+		opts.AnchorPeersOnly = false
+		cfg = latestConfig(c.channelID, opts)
+	}
+	if cfg == nil || len(cfg.AnchorPeers()) == 0 {
+		return nil, errors.Errorf("no anchor peers are known for channel [%s]", c.channelID)
+	}
+
+	addresses := make(map[string]bool)
+	for _, anchorPeer := range cfg.AnchorPeers() {
+		addresses[fmt.Sprintf("%s:%d", anchorPeer.Host, anchorPeer.Port)] = true
+	}
+
+	var anchorPeers []fab.Peer
+	for _, peer := range peers {
+		if addresses[endpoint.ToAddress(peer.URL())] {
+			anchorPeers = append(anchorPeers, peer)
+		}
+	}
+	if len(anchorPeers) == 0 {
+		return nil, errors.Errorf("none of the %d target(s) is an anchor peer of channel [%s]", len(peers), c.channelID)
+	}
+
+	logger.Debugf("Querying %d anchor peer(s) of %d target(s) for the config of channel [%s]", len(anchorPeers), len(peers), c.channelID)
+	return anchorPeers, nil
+}
+
+// latestConfig returns the cached config of the channel that was retrieved with the given options (if any)
+func latestConfig(channelID string, opts Opts) fab.ChannelCfg {
+	key, ok := newConfigKey(channelID, opts)
+	if !ok {
+		return nil
+	}
+	return configCache.latest(key)
+}
@@ -8,7 +8,12 @@ package chconfig
 
 import (
 	reqContext "context"
+	"fmt"
+	"math"
 	"math/rand"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
@@ -17,6 +22,7 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/channel"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/errors/multi"
 	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
 	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
 	ab "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/orderer"
@@ -35,6 +41,10 @@ var logger = logging.NewLogger("fabsdk/fab")
 const (
 	defaultMinResponses = 1
 	defaultMaxTargets   = 1
+
+	// maxSubsetAttempts is the maximum number of random subsets of the channel's
+	// peers that are queried for the config block
+	maxSubsetAttempts = 3
 )
 
 // Opts contains options for retrieving channel configuration
@@ -43,6 +53,36 @@ type Opts struct {
 	Targets      []fab.Peer  // if configured, channel config will be retrieved from peers (targets)
 	MinResponses int         // used with targets option; min number of success responses (from targets/peers)
 	MaxTargets   int         //if configured, channel config will be retrieved for these number of random targets
+	// MinAgreementRatio is used with targets; if configured, the minimum number of matching responses is
+	// calculated as ceil(MinAgreementRatio * number of targets queried) and MinResponses is ignored
+	MinAgreementRatio float64
+	// ConsensusStrategy is used with targets and determines how the config is selected from the responses
+	ConsensusStrategy ConsensusStrategy
+	// MatchingResponses is used with targets; if configured, at least this number of responses must contain
+	// an identical config
+	MatchingResponses int
+	// PreferredResponses is used with targets; if configured, a warning is reported in the ConsensusResult
+	// if fewer responses than this number agree on the selected config
+	PreferredResponses int
+	// TargetFilter is used with targets; if configured, only the peers accepted by the filter are queried
+	TargetFilter fab.TargetFilter
+	// FallbackOrderer is used with targets; if configured, channel config is retrieved from this orderer
+	// if it couldn't be retrieved from the peers
+	FallbackOrderer fab.Orderer
+	// CacheTTL is the time for which a retrieved config is cached; if zero, the config isn't cached
+	CacheTTL time.Duration
+	// AnchorPeersOnly is used with targets; if true, only the channel's anchor peers are queried
+	AnchorPeersOnly bool
+	// KnownConfig is used with AnchorPeersOnly; if configured, the anchor peers are read from this config
+	KnownConfig fab.ChannelCfg
+	// HasConfigBlockNumber indicates that the config is retrieved from the config block with ConfigBlockNumber
+	// rather than from the current config block
+	HasConfigBlockNumber bool
+	// ConfigBlockNumber is the number of the config block (only used if HasConfigBlockNumber is true)
+	ConfigBlockNumber uint64
+	// TargetRandomizer is used with MaxTargets; if configured, it's used instead of rand.Intn to select the
+	// random subset of targets
+	TargetRandomizer func(n int) int
 }
 
 // Option func for each Opts argument
@@ -67,6 +107,9 @@ type ChannelCfg struct {
 	anchorPeers []*fab.OrgAnchorPeer
 	orderers    []string
 	versions    *fab.Versions
+	sequence    uint64
+	group       *common.ConfigGroup
+	consensus   *ConsensusResult
 }
 
 // NewChannelCfg creates channel cfg
@@ -100,6 +143,22 @@ func (cfg *ChannelCfg) Versions() *fab.Versions {
 	return cfg.versions
 }
 
+// Sequence returns the sequence number of the config (Config.Sequence), which is incremented by each config update
+func (cfg *ChannelCfg) Sequence() uint64 {
+	return cfg.sequence
+}
+
+// ChannelGroup returns the channel's root config group
+func (cfg *ChannelCfg) ChannelGroup() *common.ConfigGroup {
+	return cfg.group
+}
+
+// ConsensusResult returns the outcome of selecting the config from the peer responses
+// (nil if the config was not retrieved from peers)
+func (cfg *ChannelCfg) ConsensusResult() *ConsensusResult {
+	return cfg.consensus
+}
+
 // New channel config implementation
 func New(channelID string, options ...Option) (*ChannelConfig, error) {
 	opts, err := prepareOpts(options...)
@@ -112,12 +171,40 @@ func New(channelID string, options ...Option) (*ChannelConfig, error) {
 
 // Query returns channel configuration
 func (c *ChannelConfig) Query(reqCtx reqContext.Context) (fab.ChannelCfg, error) {
+	// The cache only holds the current config of the channel
+	if c.opts.CacheTTL > 0 && !c.opts.HasConfigBlockNumber {
+		if key, ok := newConfigKey(c.channelID, c.opts); ok {
+			return configCache.get(reqCtx, key, c.opts.CacheTTL, c.query)
+		}
+		logger.Debugf("Not caching the config of channel [%s] since the options can't be compared by value", c.channelID)
+	}
+	return c.query(reqCtx)
+}
 
+// InvalidateCache removes the cached config of the channel (see WithCacheTTL) so that the next
+// Query retrieves the config from the network, for example, after a config update was committed.
+func (c *ChannelConfig) InvalidateCache() {
+	configCache.invalidate(c.channelID)
+}
+
+func (c *ChannelConfig) query(reqCtx reqContext.Context) (fab.ChannelCfg, error) {
 	if c.opts.Orderer != nil {
-		return c.queryOrderer(reqCtx)
+		return c.queryOrderer(reqCtx, c.opts.Orderer)
 	}
 
-	return c.queryPeers(reqCtx)
+	cfg, err := c.queryPeers(reqCtx)
+	if err == nil || c.opts.FallbackOrderer == nil {
+		return cfg, err
+	}
+
+	logger.Warnf("Failed to retrieve config for channel [%s] from peers, falling back to orderer [%s]: %s", c.channelID, c.opts.FallbackOrderer.URL(), err)
+
+	cfg, ordererErr := c.queryOrderer(reqCtx, c.opts.FallbackOrderer)
+	if ordererErr != nil {
+		errs := multi.Append(errors.WithMessage(err, "query from peers failed"), errors.WithMessage(ordererErr, "query from fallback orderer failed"))
+		return nil, errors.WithMessage(errs, "failed to retrieve channel config from peers and orderer")
+	}
+	return cfg, nil
 }
 
 func (c *ChannelConfig) queryPeers(reqCtx reqContext.Context) (*ChannelCfg, error) {
@@ -132,41 +219,151 @@ func (c *ChannelConfig) queryPeers(reqCtx reqContext.Context) (*ChannelCfg, erro
 		return nil, errors.WithMessage(err, "ledger client creation failed")
 	}
 
-	targets := []fab.ProposalProcessor{}
-	if c.opts.Targets == nil {
-
-		// Calculate targets from config
-		chPeers, err := ctx.Config().ChannelPeers(c.channelID)
+	if c.opts.Targets != nil {
+		targets, err := c.filterTargets(c.opts.Targets)
+		if err != nil {
+			return nil, err
+		}
+		configEnvelope, result, err := c.queryConfigBlock(reqCtx, l, targets)
 		if err != nil {
-			return nil, errors.WithMessage(err, "read configuration for channel peers failed")
+			return nil, errors.WithMessage(err, "QueryBlockConfig failed")
 		}
+		return extractConfigWithResult(c.channelID, configEnvelope, result)
+	}
 
-		for _, p := range chPeers {
-			newPeer, err := ctx.InfraProvider().CreatePeerFromConfig((&p.NetworkPeer))
-			if err != nil || newPeer == nil {
-				return nil, errors.WithMessage(err, "NewPeer failed")
-			}
+	// Calculate targets from config
+	chPeers, err := ctx.Config().ChannelPeers(c.channelID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read configuration for channel peers failed")
+	}
 
-			targets = append(targets, newPeer)
+	peers := []fab.Peer{}
+	for _, p := range chPeers {
+		newPeer, err := ctx.InfraProvider().CreatePeerFromConfig((&p.NetworkPeer))
+		if err != nil || newPeer == nil {
+			return nil, errors.WithMessage(err, "NewPeer failed")
 		}
 
-		targets = randomMaxTargets(targets, c.opts.MaxTargets)
+		peers = append(peers, newPeer)
+	}
 
-	} else {
-		targets = peersToTxnProcessors(c.opts.Targets)
+	targets, err := c.filterTargets(peers)
+	if err != nil {
+		return nil, err
 	}
 
-	configEnvelope, err := l.QueryConfigBlock(reqCtx, targets, &channel.TransactionProposalResponseVerifier{MinResponses: c.opts.MinResponses})
+	configEnvelope, result, err := c.queryConfigBlockFromSubsets(reqCtx, l, targets)
 	if err != nil {
 		return nil, errors.WithMessage(err, "QueryBlockConfig failed")
 	}
 
-	return extractConfig(c.channelID, configEnvelope)
+	return extractConfigWithResult(c.channelID, configEnvelope, result)
 }
 
-func (c *ChannelConfig) queryOrderer(reqCtx reqContext.Context) (*ChannelCfg, error) {
+func extractConfigWithResult(channelID string, configEnvelope *common.ConfigEnvelope, result *ConsensusResult) (*ChannelCfg, error) {
+	cfg, err := extractConfig(channelID, configEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	cfg.consensus = result
+	return cfg, nil
+}
+
+// queryConfigBlockFromSubsets queries a random subset (of size MaxTargets) of the given targets for the config block.
+// If there are insufficient matching responses then additional random subsets of the targets that haven't been tried
+// yet are queried, along with the targets that responded previously, until the minimum number of responses is
+// achieved, the targets are exhausted, or the maximum number of attempts is reached.
+func (c *ChannelConfig) queryConfigBlockFromSubsets(reqCtx reqContext.Context, l *channel.Ledger, targets []fab.ProposalProcessor) (*common.ConfigEnvelope, *ConsensusResult, error) {
+	// At most MaxTargets new targets are queried per attempt
+	if maxQueried := c.opts.MaxTargets * maxSubsetAttempts; maxQueried < c.minTargets() {
+		return nil, nil, errors.Errorf("at most %d target(s) are queried (%d per attempt) but at least %d response(s) are required", maxQueried, c.opts.MaxTargets, c.minTargets())
+	}
+
+	remaining := make([]fab.ProposalProcessor, len(targets))
+	copy(remaining, targets)
+
+	var responsive []fab.ProposalProcessor
+	var errs error
+	for attempt := 1; attempt <= maxSubsetAttempts && len(remaining) > 0; attempt++ {
+		// randomMaxTargets shuffles the remaining targets and returns the first max targets
+		subset := randomMaxTargets(remaining, c.opts.MaxTargets, c.targetRandomizer())
+		remaining = remaining[len(subset):]
+
+		var attemptTargets []fab.ProposalProcessor
+		attemptTargets = append(attemptTargets, responsive...)
+		for _, target := range subset {
+			attemptTargets = append(attemptTargets, &trackingTarget{ProposalProcessor: target})
+		}
 
-	configEnvelope, err := resource.LastConfigFromOrderer(reqCtx, c.channelID, c.opts.Orderer)
+		configEnvelope, result, err := c.queryConfigBlock(reqCtx, l, attemptTargets)
+		if err == nil {
+			if errs != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("config was retrieved after %d failed attempt(s): %s", attempt-1, errs))
+			}
+			return configEnvelope, result, nil
+		}
+
+		logger.Debugf("Attempt %d to query config block from %d target(s) failed: %s", attempt, len(attemptTargets), err)
+		errs = multi.Append(errs, err)
+
+		responsive = responsive[:0]
+		for _, target := range attemptTargets {
+			if target.(*trackingTarget).responded {
+				responsive = append(responsive, target)
+			}
+		}
+	}
+
+	return nil, nil, errs
+}
+
+func (c *ChannelConfig) queryConfigBlock(reqCtx reqContext.Context, l *channel.Ledger, targets []fab.ProposalProcessor) (*common.ConfigEnvelope, *ConsensusResult, error) {
+	minResponses := c.opts.MinResponses
+	if c.opts.MinAgreementRatio > 0 {
+		minResponses = minResponsesForRatio(c.opts.MinAgreementRatio, len(targets))
+		logger.Debugf("minimum responses for agreement ratio %v and %d targets: %d", c.opts.MinAgreementRatio, len(targets), minResponses)
+	}
+
+	verifier := &consensusVerifier{strategy: c.opts.ConsensusStrategy, minResponses: minResponses, matchingResponses: c.opts.MatchingResponses, preferredResponses: c.opts.PreferredResponses}
+	if c.opts.HasConfigBlockNumber {
+		if _, _, err := l.QueryConfigBlockByNumber(reqCtx, c.opts.ConfigBlockNumber, targets, verifier); err != nil {
+			return nil, nil, err
+		}
+	} else if _, err := l.QueryConfigBlock(reqCtx, targets, verifier); err != nil {
+		return nil, nil, err
+	}
+
+	// The ledger returns the config of the first response so the config selected by the strategy is used instead
+	configEnvelope, err := verifier.configEnvelope()
+	if err != nil {
+		return nil, nil, err
+	}
+	return configEnvelope, verifier.result, nil
+}
+
+// trackingTarget records whether the target returned a successful response
+type trackingTarget struct {
+	fab.ProposalProcessor
+	responded bool
+}
+
+// ProcessTransactionProposal delegates to the target and records whether the response was successful
+func (t *trackingTarget) ProcessTransactionProposal(reqCtx reqContext.Context, request fab.ProcessProposalRequest) (*fab.TransactionProposalResponse, error) {
+	resp, err := t.ProposalProcessor.ProcessTransactionProposal(reqCtx, request)
+	t.responded = err == nil && resp != nil && resp.Status == http.StatusOK
+	return resp, err
+}
+
+func (c *ChannelConfig) queryOrderer(reqCtx reqContext.Context, orderer fab.Orderer) (*ChannelCfg, error) {
+	if c.opts.HasConfigBlockNumber {
+		configEnvelope, err := resource.ConfigFromOrderer(reqCtx, c.channelID, orderer, c.opts.ConfigBlockNumber)
+		if err != nil {
+			return nil, errors.WithMessage(err, "ConfigFromOrderer failed")
+		}
+		return extractConfig(c.channelID, configEnvelope)
+	}
+
+	configEnvelope, err := resource.LastConfigFromOrderer(reqCtx, c.channelID, orderer)
 	if err != nil {
 		return nil, errors.WithMessage(err, "LastConfigFromOrderer failed")
 	}
@@ -190,6 +387,64 @@ func WithMinResponses(min int) Option {
 	}
 }
 
+// WithMinAgreementRatio encapsulates the minimum agreement ratio to Option.
+// The ratio must be in the range (0, 1] and requires at least ceil(ratio * len(targets))
+// matching responses, where targets are the peers actually queried. Note that when the targets
+// are calculated from config, the ratio applies to the targets selected by MaxTargets and not to
+// all of the channel's peers. If set, this option takes precedence over WithMinResponses.
+func WithMinAgreementRatio(ratio float64) Option {
+	return func(opts *Opts) error {
+		if ratio <= 0 || ratio > 1 {
+			return errors.Errorf("invalid minimum agreement ratio [%v]: must be greater than 0 and less than or equal to 1", ratio)
+		}
+		opts.MinAgreementRatio = ratio
+		return nil
+	}
+}
+
+// WithConsensusStrategy sets the strategy that's used to select the config from the responses of the peers.
+// The minimum number of responses (see WithMinResponses and WithMinAgreementRatio) applies to the number
+// of responses that agree on the selected config. The default is StrictMatchStrategy.
+func WithConsensusStrategy(strategy ConsensusStrategy) Option {
+	return func(opts *Opts) error {
+		switch strategy {
+		case StrictMatchStrategy, MajorityStrategy, HighestSequenceStrategy:
+			opts.ConsensusStrategy = strategy
+			return nil
+		default:
+			return errors.Errorf("invalid consensus strategy %s", strategy)
+		}
+	}
+}
+
+// WithMatchingResponses encapsulates the number of matching responses to Option. At least this number of the
+// responses from the peers must contain an identical config (in addition to the requirements of the consensus
+// strategy), which guards against a single compromised or stale peer influencing the result. Responses that
+// contain a different config are listed in the error that's returned if the requirement isn't met.
+func WithMatchingResponses(n int) Option {
+	return func(opts *Opts) error {
+		if n <= 0 {
+			return errors.Errorf("matching responses must be greater than zero: %d", n)
+		}
+		opts.MatchingResponses = n
+		return nil
+	}
+}
+
+// WithPreferredResponses encapsulates the number of preferred responses to Option. If fewer responses than this
+// number agree on the selected config, but the minimum number of responses (see WithMinResponses) is met, then
+// the config is still returned and a warning is reported in its ConsensusResult. This allows degraded conditions
+// to be monitored without the query failing.
+func WithPreferredResponses(n int) Option {
+	return func(opts *Opts) error {
+		if n <= 0 {
+			return errors.Errorf("preferred responses must be greater than zero: %d", n)
+		}
+		opts.PreferredResponses = n
+		return nil
+	}
+}
+
 // WithOrderer encapsulates orderer to Option
 func WithOrderer(orderer fab.Orderer) Option {
 	return func(opts *Opts) error {
@@ -198,14 +453,115 @@ func WithOrderer(orderer fab.Orderer) Option {
 	}
 }
 
-// WithMaxTargets encapsulates minTargets to Option
+// WithFallbackOrderer encapsulates a fallback orderer to Option. If the config can't be retrieved from the
+// peers (for example, if fewer than the minimum number of responses are received) then the config is
+// retrieved from the given orderer. If that also fails then the returned error contains both failures.
+// This option is ignored if WithOrderer is set.
+func WithFallbackOrderer(orderer fab.Orderer) Option {
+	return func(opts *Opts) error {
+		opts.FallbackOrderer = orderer
+		return nil
+	}
+}
+
+// WithMaxTargets encapsulates maxTargets to Option. The maximum number of targets must be greater than zero.
 func WithMaxTargets(maxTargets int) Option {
 	return func(opts *Opts) error {
+		if maxTargets <= 0 {
+			return errors.Errorf("max targets must be greater than zero: %d", maxTargets)
+		}
 		opts.MaxTargets = maxTargets
 		return nil
 	}
 }
 
+// WithTargetRandomizer encapsulates a source of random numbers to Option. The randomizer returns a random
+// number in [0,n) and is used instead of rand.Intn to select the random subset of MaxTargets targets, for
+// example, where a deterministic selection of targets is required. Since a ChannelConfig may be queried
+// concurrently, the randomizer must be safe for concurrent use. Note that the Intn of a rand.Rand isn't,
+// so a rand.Rand must be guarded by a mutex (see NewSeededTargetRandomizer).
+func WithTargetRandomizer(randomizer func(n int) int) Option {
+	return func(opts *Opts) error {
+		opts.TargetRandomizer = randomizer
+		return nil
+	}
+}
+
+// NewSeededTargetRandomizer returns a target randomizer (see WithTargetRandomizer) that is seeded with the
+// given seed and is safe for concurrent use
+func NewSeededTargetRandomizer(seed int64) func(n int) int {
+	var mutex sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func(n int) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return r.Intn(n)
+	}
+}
+
+// WithTargetFilter encapsulates a target filter to Option. Only the peers that are accepted by the
+// filter (for example, peers of trusted organizations) are queried for the config; the filter is applied
+// before the random subset of MaxTargets targets is selected. An error is returned by Query if fewer
+// targets than the minimum number of responses are accepted by the filter.
+func WithTargetFilter(filter fab.TargetFilter) Option {
+	return func(opts *Opts) error {
+		opts.TargetFilter = filter
+		return nil
+	}
+}
+
+// WithCacheTTL encapsulates the cache TTL to Option. The config that's retrieved by Query is cached in memory
+// and subsequent queries within the TTL return the cached config without querying the network. The cache is
+// shared by all ChannelConfigs with caching enabled but is keyed by channel ID and by the options that affect
+// how the config is retrieved and verified (for example, the targets, the minimum responses and the consensus
+// strategy), so a config that was retrieved with weaker options isn't returned to a stricter ChannelConfig.
+// Concurrent queries with the same options and identity share a single query. The cached configs of a
+// channel may be invalidated with InvalidateCache. The config isn't cached if the TargetFilter or KnownConfig
+// option is a pointer, func or other reference (rather than a plain value), since such options can't be
+// compared with the options of other ChannelConfigs.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(opts *Opts) error {
+		if ttl <= 0 {
+			return errors.Errorf("cache TTL must be greater than zero: %s", ttl)
+		}
+		opts.CacheTTL = ttl
+		return nil
+	}
+}
+
+// WithAnchorPeersOnly encapsulates the anchor-peers-only flag to Option. If true, only the channel's anchor
+// peers are queried for the config, which minimizes cross-org traffic when bootstrapping on a channel. The
+// anchor peers are read from the config provided with WithKnownConfig or else from the last config of the
+// channel that was cached (see WithCacheTTL) with the same options, either with or without this option.
+// Query returns an error if no anchor peers are known or if none of the targets is an anchor peer.
+func WithAnchorPeersOnly(anchorPeersOnly bool) Option {
+	return func(opts *Opts) error {
+		opts.AnchorPeersOnly = anchorPeersOnly
+		return nil
+	}
+}
+
+// WithKnownConfig encapsulates an already known channel config to Option. It's used with WithAnchorPeersOnly
+// to determine the anchor peers of the channel.
+func WithKnownConfig(cfg fab.ChannelCfg) Option {
+	return func(opts *Opts) error {
+		opts.KnownConfig = cfg
+		return nil
+	}
+}
+
+// WithConfigBlockNumber encapsulates a config block number to Option. Query retrieves the config from the
+// config block with the given number rather than the current config, for example, in order to reconstruct the
+// policies of the channel at a point in time. Query returns an error if the block isn't a config block. The
+// config isn't cached (see WithCacheTTL) since the cache only holds the current config.
+func WithConfigBlockNumber(blockNumber uint64) Option {
+	return func(opts *Opts) error {
+		opts.HasConfigBlockNumber = true
+		opts.ConfigBlockNumber = blockNumber
+		return nil
+	}
+}
+
 // prepareQueryConfigOpts Reads channel config options from Option array
 func prepareOpts(options ...Option) (Opts, error) {
 	opts := Opts{}
@@ -227,6 +583,20 @@ func prepareOpts(options ...Option) (Opts, error) {
 	return opts, nil
 }
 
+// agreementRatioTolerance compensates for floating point error when computing the minimum responses
+// for a ratio (e.g. 0.7 * 10 = 7.000000000000001 which would otherwise be rounded up to 8)
+const agreementRatioTolerance = 1e-9
+
+// minResponsesForRatio returns the minimum number of responses required to satisfy the
+// given agreement ratio for the given number of targets. At least one response is always required.
+func minResponsesForRatio(ratio float64, numTargets int) int {
+	min := int(math.Ceil(ratio*float64(numTargets) - agreementRatioTolerance))
+	if min < 1 {
+		return 1
+	}
+	return min
+}
+
 func extractConfig(channelID string, configEnvelope *common.ConfigEnvelope) (*ChannelCfg, error) {
 
 	group := configEnvelope.Config.ChannelGroup
@@ -241,6 +611,8 @@ func extractConfig(channelID string, configEnvelope *common.ConfigEnvelope) (*Ch
 		anchorPeers: []*fab.OrgAnchorPeer{},
 		orderers:    []string{},
 		versions:    versions,
+		sequence:    configEnvelope.Config.Sequence,
+		group:       group,
 	}
 
 	err := loadConfig(config, config.versions.Channel, group, "base", "", true)
@@ -489,6 +861,47 @@ func loadConfigValue(configItems *ChannelCfg, key string, versionsValue *common.
 	return nil
 }
 
+// filterTargets returns the peers that are accepted by the target filter (if any) and, if AnchorPeersOnly is set,
+// are anchor peers. An error is returned if there aren't enough targets remaining to satisfy the minimum number
+// of responses.
+func (c *ChannelConfig) filterTargets(peers []fab.Peer) ([]fab.ProposalProcessor, error) {
+	if c.opts.AnchorPeersOnly {
+		anchorPeers, err := c.anchorPeerTargets(peers)
+		if err != nil {
+			return nil, err
+		}
+		peers = anchorPeers
+	}
+
+	targets := peersToTxnProcessors(peers)
+	if c.opts.TargetFilter != nil {
+		targets = nil
+		for _, peer := range peers {
+			if c.opts.TargetFilter.Accept(peer) {
+				targets = append(targets, peer)
+			}
+		}
+	}
+
+	minResponses := c.minTargets()
+	if len(targets) < minResponses {
+		if c.opts.TargetFilter != nil {
+			return nil, errors.Errorf("only %d of %d target(s) were accepted by the target filter but at least %d response(s) are required", len(targets), len(peers), minResponses)
+		}
+		return nil, errors.Errorf("only %d target(s) are available but at least %d response(s) are required", len(targets), minResponses)
+	}
+	return targets, nil
+}
+
+// minTargets returns the minimum number of targets that must be queried to satisfy the minimum number of responses.
+// With an agreement ratio the minimum is calculated from the targets that are queried.
+func (c *ChannelConfig) minTargets() int {
+	if c.opts.MinAgreementRatio > 0 {
+		return 1
+	}
+	return c.opts.MinResponses
+}
+
 // peersToTxnProcessors converts a slice of Peers to a slice of ProposalProcessors
 func peersToTxnProcessors(peers []fab.Peer) []fab.ProposalProcessor {
 	tpp := make([]fab.ProposalProcessor, len(peers))
@@ -499,13 +912,21 @@ func peersToTxnProcessors(peers []fab.Peer) []fab.ProposalProcessor {
 	return tpp
 }
 
-//randomMaxTargets returns random sub set of max length targets
-func randomMaxTargets(targets []fab.ProposalProcessor, max int) []fab.ProposalProcessor {
+// targetRandomizer returns the source of random numbers that's used to select the random subset of targets
+func (c *ChannelConfig) targetRandomizer() func(n int) int {
+	if c.opts.TargetRandomizer != nil {
+		return c.opts.TargetRandomizer
+	}
+	return rand.Intn
+}
+
+//randomMaxTargets returns random sub set of max length targets; intn returns a random number in [0,n)
+func randomMaxTargets(targets []fab.ProposalProcessor, max int, intn func(n int) int) []fab.ProposalProcessor {
 	if len(targets) <= max {
 		return targets
 	}
 	for i := range targets {
-		j := rand.Intn(i + 1)
+		j := intn(i + 1)
 		targets[i], targets[j] = targets[j], targets[i]
 	}
 	return targets[:max]
@@ -7,17 +7,24 @@ package chconfig
 
 import (
 	reqContext "context"
+	"math/rand"
+	"sync"
 	"testing"
 
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/channel"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/mocks"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/orderer"
 	mspmocks "github.com/hyperledger/fabric-sdk-go/pkg/msp/test/mockmsp"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	ab "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/orderer"
 	"github.com/pkg/errors"
 
 	"github.com/stretchr/testify/assert"
@@ -69,6 +76,618 @@ func TestChannelConfigWithPeerError(t *testing.T) {
 	}
 }
 
+func TestChannelConfigWithFallbackOrderer(t *testing.T) {
+	ctx := setupTestContext()
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	block := &common.Block{}
+	err := proto.Unmarshal(peer.Payload, block)
+	assert.NoError(t, err)
+
+	// The peers fail to satisfy the minimum responses so the config is retrieved from the orderer
+	o := &configBlockOrderer{block: block}
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer}), WithMinResponses(2), WithFallbackOrderer(o))
+	assert.NoError(t, err)
+	cfg, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:7054", cfg.Orderers()[0])
+	assert.True(t, o.calls > 0, "expecting fallback orderer to be queried")
+
+	// The orderer isn't queried if the peers succeed
+	o = &configBlockOrderer{block: block}
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer}), WithFallbackOrderer(o))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, o.calls, "expecting fallback orderer not to be queried")
+
+	// Both the peer and orderer failures are returned
+	o = &configBlockOrderer{err: errors.New("orderer unavailable")}
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer}), WithMinResponses(2), WithFallbackOrderer(o))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "query from peers failed")
+	assert.Contains(t, err.Error(), "orderer unavailable")
+}
+
+// configBlockOrderer delivers the given block (or error) for every deliver request
+type configBlockOrderer struct {
+	block *common.Block
+	err   error
+	calls int
+}
+
+func (o *configBlockOrderer) URL() string {
+	return "orderer.example.com:7050"
+}
+
+func (o *configBlockOrderer) SendBroadcast(ctx reqContext.Context, envelope *fab.SignedEnvelope) (*common.Status, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (o *configBlockOrderer) SendDeliver(ctx reqContext.Context, envelope *fab.SignedEnvelope) (chan *common.Block, chan error) {
+	o.calls++
+	blocks := make(chan *common.Block, 1)
+	errs := make(chan error, 1)
+	if o.err != nil {
+		errs <- o.err
+		return blocks, errs
+	}
+	blocks <- o.block
+	close(blocks)
+	return blocks, errs
+}
+
+func TestChannelConfigWithConfigBlockNumber(t *testing.T) {
+	ctx := setupTestContext()
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer}), WithConfigBlockNumber(0), WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	defer channelConfig.InvalidateCache()
+
+	cfg, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:7054", cfg.Orderers()[0])
+
+	// The config of a specific block isn't cached
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, peer.ProcessProposalCalls, "expecting the config block to be queried for each query")
+
+	// The block must be a config block
+	block := &common.Block{}
+	assert.NoError(t, proto.Unmarshal(peer.Payload, block))
+	txBlock := &common.Block{Header: block.Header, Data: &common.BlockData{Data: [][]byte{newEndorserTxEnvelope(t)}}}
+	txPayload, err := proto.Marshal(txBlock)
+	assert.NoError(t, err)
+	txPeer := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Payload: txPayload, Status: 200}
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{txPeer}), WithConfigBlockNumber(5))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CONFIG")
+
+	// The config block is retrieved from the orderer
+	o := &configBlockOrderer{block: block}
+	channelConfig, err = New(channelID, WithOrderer(o), WithConfigBlockNumber(0))
+	assert.NoError(t, err)
+	cfg, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:7054", cfg.Orderers()[0])
+	assert.Equal(t, 1, o.calls, "expecting the config block to be retrieved with a single request")
+
+	o = &configBlockOrderer{block: txBlock}
+	channelConfig, err = New(channelID, WithOrderer(o), WithConfigBlockNumber(5))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "block 5 is not a config block")
+}
+
+// newEndorserTxEnvelope returns a marshalled envelope of an endorser transaction
+func newEndorserTxEnvelope(t *testing.T) []byte {
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), ChannelId: channelID})
+	assert.NoError(t, err)
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}})
+	assert.NoError(t, err)
+	envelope, err := proto.Marshal(&common.Envelope{Payload: payload})
+	assert.NoError(t, err)
+	return envelope
+}
+
+func TestChannelConfigWithMinAgreementRatio(t *testing.T) {
+
+	ctx := setupTestContext()
+	peer1 := getPeerWithConfigBlockPayload(t)
+	peer2 := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	peer2.Error = errors.New("peer unavailable")
+
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// One out of two targets respond so a ratio of 0.5 is satisfied
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMinAgreementRatio(0.5))
+	if err != nil {
+		t.Fatalf("Failed to create new channel client: %s", err)
+	}
+	_, err = channelConfig.Query(reqCtx)
+	assert.Nil(t, err, "expecting ratio of 0.5 to be satisfied by one of two targets")
+
+	// Ratio takes precedence over min responses
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMinResponses(1), WithMinAgreementRatio(0.51))
+	if err != nil {
+		t.Fatalf("Failed to create new channel client: %s", err)
+	}
+	_, err = channelConfig.Query(reqCtx)
+	assert.NotNil(t, err, "expecting ratio of 0.51 to require two of two targets")
+
+	_, err = New(channelID, WithMinAgreementRatio(0))
+	assert.NotNil(t, err, "expecting error for zero ratio")
+	_, err = New(channelID, WithMinAgreementRatio(1.1))
+	assert.NotNil(t, err, "expecting error for ratio greater than one")
+}
+
+func TestChannelConfigWithTargetFilter(t *testing.T) {
+	ctx := setupTestContext()
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer1 := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	peer1.MockMSP = "Org1MSP"
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", MockMSP: "Org2MSP", Payload: peer1.Payload, Status: 200}
+
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithTargetFilter(&mspFilter{mspID: "Org1MSP"}))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, peer1.ProcessProposalCalls)
+	assert.Equal(t, 0, peer2.ProcessProposalCalls, "expecting filtered peer not to be queried")
+
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMinResponses(2), WithTargetFilter(&mspFilter{mspID: "Org1MSP"}))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when too few targets are accepted by the filter")
+	assert.Contains(t, err.Error(), "only 1 of 2 target(s)")
+
+	// The minimum number of responses is checked without a target filter as well
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMinResponses(3))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when there are too few targets")
+	assert.Contains(t, err.Error(), "only 2 target(s) are available")
+
+	_, err = New(channelID, WithMaxTargets(0))
+	assert.Error(t, err, "expecting error for zero max targets")
+	_, err = New(channelID, WithMaxTargets(-1))
+	assert.Error(t, err, "expecting error for negative max targets")
+}
+
+func TestChannelConfigWithAnchorPeersOnly(t *testing.T) {
+	ctx := setupTestContext()
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer1 := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	peer1.MockURL = "grpcs://peer1.org1.com:7051"
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "grpcs://peer1.org2.com:7051", Payload: peer1.Payload, Status: 200}
+
+	knownCfg := mocks.NewMockChannelCfg(channelID)
+	knownCfg.MockAnchorPeers = []*fab.OrgAnchorPeer{{Org: "Org1", Host: "peer1.org1.com", Port: 7051}}
+
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMaxTargets(2), WithAnchorPeersOnly(true), WithKnownConfig(knownCfg))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, peer1.ProcessProposalCalls)
+	assert.Equal(t, 0, peer2.ProcessProposalCalls, "expecting peer that isn't an anchor peer not to be queried")
+
+	// No anchor peers known
+	channelConfig, err = New("unknownchannel", WithPeers([]fab.Peer{peer1, peer2}), WithAnchorPeersOnly(true))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when no anchor peers are known")
+	assert.Contains(t, err.Error(), "no anchor peers are known")
+	assert.Equal(t, 1, peer1.ProcessProposalCalls)
+	assert.Equal(t, 0, peer2.ProcessProposalCalls)
+
+	// None of the targets is an anchor peer
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer2}), WithAnchorPeersOnly(true), WithKnownConfig(knownCfg))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when none of the targets is an anchor peer")
+	assert.Contains(t, err.Error(), "none of the 1 target(s) is an anchor peer")
+
+	// Too few anchor peers for the minimum number of responses
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMinResponses(2), WithAnchorPeersOnly(true), WithKnownConfig(knownCfg))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when there are too few anchor peers")
+	assert.Contains(t, err.Error(), "only 1 target(s) are available")
+	assert.Equal(t, 1, peer1.ProcessProposalCalls)
+
+	// The anchor peers are read from the cached config if no config is provided
+	const cachedChannelID = "anchorpeerschannel"
+	cached := NewChannelCfg(cachedChannelID)
+	cached.anchorPeers = knownCfg.MockAnchorPeers
+	cachingConfig, err := New(cachedChannelID, WithPeers([]fab.Peer{peer1, peer2}), WithMaxTargets(2))
+	assert.NoError(t, err)
+	cachingKey, ok := newConfigKey(cachedChannelID, cachingConfig.opts)
+	assert.True(t, ok)
+	_, err = configCache.get(reqCtx, cachingKey, time.Minute, func(reqContext.Context) (fab.ChannelCfg, error) { return cached, nil })
+	assert.NoError(t, err)
+	defer configCache.invalidate(cachedChannelID)
+
+	// The config that was cached with other options isn't used
+	channelConfig, err = New(cachedChannelID, WithPeers([]fab.Peer{peer1, peer2}), WithMaxTargets(2), WithMinResponses(2), WithAnchorPeersOnly(true))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when no anchor peers are known for the options")
+
+	channelConfig, err = New(cachedChannelID, WithPeers([]fab.Peer{peer1, peer2}), WithMaxTargets(2), WithAnchorPeersOnly(true))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, peer1.ProcessProposalCalls)
+	assert.Equal(t, 0, peer2.ProcessProposalCalls, "expecting peer that isn't an anchor peer not to be queried")
+}
+
+type mspFilter struct {
+	mspID string
+}
+
+func (f *mspFilter) Accept(peer fab.Peer) bool {
+	return peer.MSPID() == f.mspID
+}
+
+// orgFilter is a target filter that's a plain value (so that configs retrieved with it may be cached)
+type orgFilter struct {
+	mspID string
+}
+
+func (f orgFilter) Accept(peer fab.Peer) bool {
+	return peer.MSPID() == f.mspID
+}
+
+func TestChannelConfigWithCacheTTL(t *testing.T) {
+	ctx := setupTestContext()
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	peer := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	peer.RWLock = &sync.RWMutex{}
+
+	const cachedChannelID = "cachedchannel"
+	channelConfig, err := New(cachedChannelID, WithPeers([]fab.Peer{peer}), WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	defer channelConfig.InvalidateCache()
+
+	cfg1, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	cfg2, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.True(t, cfg1 == cfg2, "expecting cached config to be returned")
+	assert.Equal(t, 1, peer.ProcessProposalCalls, "expecting the peer to be queried once")
+
+	// The cache is shared by the ChannelConfigs of the channel with the same options
+	otherConfig, err := New(cachedChannelID, WithPeers([]fab.Peer{peer}), WithCacheTTL(time.Minute))
+	assert.NoError(t, err)
+	_, err = otherConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, peer.ProcessProposalCalls, "expecting the peer to be queried once")
+
+	// A config retrieved with other options isn't returned
+	strictConfig, err := New(cachedChannelID, WithPeers([]fab.Peer{peer}), WithCacheTTL(time.Minute), WithMatchingResponses(1), WithConsensusStrategy(MajorityStrategy))
+	assert.NoError(t, err)
+	_, err = strictConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, peer.ProcessProposalCalls, "expecting the peer to be queried for other options")
+	_, err = strictConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, peer.ProcessProposalCalls, "expecting cached config to be returned for the same options")
+
+	// Invalidation removes the configs of the channel for all options
+	channelConfig.InvalidateCache()
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, peer.ProcessProposalCalls, "expecting the peer to be queried after invalidation")
+	_, err = strictConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, peer.ProcessProposalCalls, "expecting the peer to be queried after invalidation")
+
+	_, err = New(cachedChannelID, WithCacheTTL(0))
+	assert.Error(t, err, "expecting error for zero cache TTL")
+}
+
+func TestQueryCache(t *testing.T) {
+	cache := newQueryCache()
+	cfg := NewChannelCfg("ch")
+	key, _ := newConfigKey("ch", Opts{})
+
+	var mutex sync.Mutex
+	calls := 0
+	query := func(reqCtx reqContext.Context) (fab.ChannelCfg, error) {
+		mutex.Lock()
+		calls++
+		mutex.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		return cfg, nil
+	}
+
+	// Concurrent queries share a single query
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cache.get(reqContext.Background(), key, time.Minute, query)
+			assert.NoError(t, err)
+			assert.True(t, result == cfg, "unexpected config")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls, "expecting a single query for concurrent callers")
+
+	// An expired entry is refreshed
+	time.Sleep(10 * time.Millisecond)
+	_, err := cache.get(reqContext.Background(), key, 5*time.Millisecond, query)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "expecting expired entry to be refreshed")
+
+	// Errors are not cached
+	failing := func(reqCtx reqContext.Context) (fab.ChannelCfg, error) {
+		return nil, errors.New("query failed")
+	}
+	cache.invalidate("ch")
+	_, err = cache.get(reqContext.Background(), key, time.Minute, failing)
+	assert.Error(t, err)
+	_, err = cache.get(reqContext.Background(), key, time.Minute, query)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls, "expecting query after failed query")
+
+	// Callers that wait for a failed in-flight query perform their own query
+	cache.invalidate("ch")
+	started := make(chan struct{})
+	leader := func(reqCtx reqContext.Context) (fab.ChannelCfg, error) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return nil, errors.New("query failed")
+	}
+	leaderErr := make(chan error)
+	go func() {
+		_, err := cache.get(reqContext.Background(), key, time.Minute, leader)
+		leaderErr <- err
+	}()
+	<-started
+	result, err := cache.get(reqContext.Background(), key, time.Minute, query)
+	assert.NoError(t, err, "expecting the waiting caller not to inherit the error of the in-flight query")
+	assert.True(t, result == cfg, "unexpected config")
+	assert.Error(t, <-leaderErr)
+	assert.Equal(t, 4, calls, "expecting the waiting caller to query after the in-flight query failed")
+}
+
+func TestConfigKey(t *testing.T) {
+	peer1 := mocks.NewMockPeer("Peer1", "grpcs://peer1.com:7051")
+	peer2 := mocks.NewMockPeer("Peer2", "grpcs://peer2.com:7051")
+	filter := orgFilter{mspID: "Org1MSP"}
+
+	newKey := func(channelID string, opts Opts) configKey {
+		key, ok := newConfigKey(channelID, opts)
+		assert.True(t, ok, "expecting options to be keyed by value")
+		return key
+	}
+
+	key := newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: filter})
+	assert.Equal(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer2, peer1}, MinResponses: 1, TargetFilter: filter, CacheTTL: time.Minute}))
+	assert.Equal(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: orgFilter{mspID: "Org1MSP"}}), "expecting equal filters to have the same key")
+	assert.NotEqual(t, key, newKey("other", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: filter}))
+	assert.NotEqual(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1}, MinResponses: 1, TargetFilter: filter}))
+	assert.NotEqual(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 2, TargetFilter: filter}))
+	assert.NotEqual(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: orgFilter{mspID: "Org2MSP"}}))
+	assert.NotEqual(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: filter, AnchorPeersOnly: true}))
+	assert.NotEqual(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: filter, ConsensusStrategy: MajorityStrategy}))
+	assert.NotEqual(t, key, newKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, MinResponses: 1, TargetFilter: filter, Orderer: mocks.NewMockOrderer("grpcs://orderer.com:7050", nil)}))
+
+	// Options that are references can't be keyed
+	_, ok := newConfigKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, TargetFilter: &mspFilter{mspID: "Org1MSP"}})
+	assert.False(t, ok, "expecting pointer filter not to be keyed")
+	_, ok = newConfigKey("ch", Opts{Targets: []fab.Peer{peer1, peer2}, KnownConfig: NewChannelCfg("ch")})
+	assert.False(t, ok, "expecting pointer config not to be keyed")
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	cache := newQueryCache()
+	key1, _ := newConfigKey("ch1", Opts{})
+	key2, _ := newConfigKey("ch2", Opts{})
+	query := func(reqCtx reqContext.Context) (fab.ChannelCfg, error) {
+		return NewChannelCfg("ch"), nil
+	}
+
+	_, err := cache.get(reqContext.Background(), key1, 5*time.Millisecond, query)
+	assert.NoError(t, err)
+	assert.NotNil(t, cache.latest(key1))
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, cache.latest(key1), "expecting expired config to be evicted")
+
+	_, err = cache.get(reqContext.Background(), key1, 5*time.Millisecond, query)
+	assert.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = cache.get(reqContext.Background(), key2, time.Minute, query)
+	assert.NoError(t, err)
+	cache.mutex.Lock()
+	assert.Len(t, cache.entries, 1, "expecting expired configs to be evicted when a config is cached")
+	cache.mutex.Unlock()
+}
+
+func TestChannelConfigWithConsensusStrategy(t *testing.T) {
+
+	ctx := setupTestContext()
+	peer1 := getPeerWithConfigSequence(t, 1)
+	peer2 := getPeerWithConfigSequence(t, 2).(*mocks.MockPeer)
+	peer2.MockName = "Peer2"
+	peer2.MockURL = "http://peer2.com"
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Payload: peer2.Payload, Status: 200}
+
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// Strict match fails since one of the peers lags
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithMinResponses(1))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting strict match to fail for different configs")
+
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithConsensusStrategy(MajorityStrategy))
+	assert.NoError(t, err)
+	cfg, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, &ConsensusResult{Strategy: MajorityStrategy, Sequence: 2, Agreeing: 2, Responses: 3, Warnings: []string{"peer [http://peer1.com] returned a divergent config (sequence 1)"}}, cfg.(*ChannelCfg).ConsensusResult())
+
+	// No majority
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithConsensusStrategy(MajorityStrategy))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error when there's no majority")
+
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithConsensusStrategy(HighestSequenceStrategy))
+	assert.NoError(t, err)
+	cfg, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, &ConsensusResult{Strategy: HighestSequenceStrategy, Sequence: 2, Agreeing: 1, Responses: 2, Warnings: []string{"peer [http://peer1.com] returned a divergent config (sequence 1)"}}, cfg.(*ChannelCfg).ConsensusResult())
+	assert.Equal(t, uint64(2), cfg.Sequence(), "expecting the sequence of the selected config")
+
+	// Min responses applies to the agreeing responses
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2}), WithMinResponses(2), WithConsensusStrategy(HighestSequenceStrategy))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error since only one response has the highest sequence")
+
+	// The strict match result is also reported
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer2, peer3}), WithMinResponses(2))
+	assert.NoError(t, err)
+	cfg, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, &ConsensusResult{Strategy: StrictMatchStrategy, Sequence: 2, Agreeing: 2, Responses: 2}, cfg.(*ChannelCfg).ConsensusResult())
+
+	_, err = New(channelID, WithConsensusStrategy(ConsensusStrategy(99)))
+	assert.Error(t, err, "expecting error for invalid strategy")
+}
+
+func TestChannelConfigWithMatchingResponses(t *testing.T) {
+	ctx := setupTestContext()
+	peer1 := getPeerWithConfigSequence(t, 1)
+	peer2 := getPeerWithConfigSequence(t, 2).(*mocks.MockPeer)
+	peer2.MockName = "Peer2"
+	peer2.MockURL = "http://peer2.com"
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Payload: peer2.Payload, Status: 200}
+
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// Two of the three responses match
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithConsensusStrategy(MajorityStrategy), WithMatchingResponses(2))
+	assert.NoError(t, err)
+	cfg, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), cfg.Sequence())
+
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithConsensusStrategy(HighestSequenceStrategy), WithMatchingResponses(3))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error since only two responses match")
+	assert.Contains(t, err.Error(), "required 3 responses with matching configs got 2")
+	assert.Contains(t, err.Error(), "(sequence 1)", "expecting the divergent response to be listed")
+
+	// The divergent responses are also listed for strict match
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithMatchingResponses(2))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting strict match to fail for different configs")
+	assert.Contains(t, err.Error(), "(sequence 1)", "expecting the divergent response to be listed")
+
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer2, peer3}), WithMatchingResponses(2))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+
+	_, err = New(channelID, WithMatchingResponses(0))
+	assert.Error(t, err, "expecting error for zero matching responses")
+}
+
+func TestChannelConfigWithPreferredResponses(t *testing.T) {
+	ctx := setupTestContext()
+	peer1 := getPeerWithConfigSequence(t, 1)
+	peer2 := getPeerWithConfigSequence(t, 2).(*mocks.MockPeer)
+	peer2.MockName = "Peer2"
+	peer2.MockURL = "http://peer2.com"
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Payload: peer2.Payload, Status: 200}
+
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	// The minimum is met but fewer responses than preferred agree
+	channelConfig, err := New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithConsensusStrategy(MajorityStrategy), WithMinResponses(2), WithPreferredResponses(3))
+	assert.NoError(t, err)
+	cfg, err := channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	result := cfg.(*ChannelCfg).ConsensusResult()
+	assert.Equal(t, uint64(2), result.Sequence)
+	assert.Equal(t, []string{
+		"peer [http://peer1.com] returned a divergent config (sequence 1)",
+		"2 agreeing responses fell below the preferred 3 responses but met the minimum of 2",
+	}, result.Warnings)
+
+	// No warnings if the preferred number of responses agree
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer2, peer3}), WithMinResponses(1), WithPreferredResponses(2))
+	assert.NoError(t, err)
+	cfg, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.(*ChannelCfg).ConsensusResult().Warnings)
+
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer3}), WithMinResponses(1), WithPreferredResponses(2))
+	assert.NoError(t, err)
+	cfg, err = channelConfig.Query(reqCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1 agreeing responses fell below the preferred 2 responses but met the minimum of 1"}, cfg.(*ChannelCfg).ConsensusResult().Warnings)
+
+	// The query still fails if the minimum isn't met
+	channelConfig, err = New(channelID, WithPeers([]fab.Peer{peer1, peer2, peer3}), WithConsensusStrategy(MajorityStrategy), WithMinResponses(3), WithPreferredResponses(3))
+	assert.NoError(t, err)
+	_, err = channelConfig.Query(reqCtx)
+	assert.Error(t, err, "expecting error since the minimum responses aren't met")
+
+	_, err = New(channelID, WithPreferredResponses(0))
+	assert.Error(t, err, "expecting error for zero preferred responses")
+}
+
+func TestMinResponsesForRatio(t *testing.T) {
+	tests := []struct {
+		ratio      float64
+		numTargets int
+		expected   int
+	}{
+		{ratio: 1, numTargets: 3, expected: 3},
+		{ratio: 0.5, numTargets: 4, expected: 2},
+		{ratio: 0.5, numTargets: 5, expected: 3},
+		{ratio: 0.7, numTargets: 10, expected: 7},
+		{ratio: 0.67, numTargets: 3, expected: 3},
+		{ratio: 2.0 / 3.0, numTargets: 3, expected: 2},
+		{ratio: 0.01, numTargets: 5, expected: 1},
+		{ratio: 0.5, numTargets: 1, expected: 1},
+		{ratio: 0.5, numTargets: 0, expected: 1},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, minResponsesForRatio(test.ratio, test.numTargets), "unexpected min responses for ratio %v and %d targets", test.ratio, test.numTargets)
+	}
+}
+
 func TestChannelConfigWithOrdererError(t *testing.T) {
 
 	ctx := setupTestContext()
@@ -90,6 +709,69 @@ func TestChannelConfigWithOrdererError(t *testing.T) {
 
 }
 
+func TestQueryConfigBlockFromSubsets(t *testing.T) {
+	ctx := setupTestContext()
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	l, err := channel.NewLedger(channelID)
+	assert.Nil(t, err)
+
+	downPeer := func() *mocks.MockPeer {
+		peer := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+		peer.Error = errors.New("peer unavailable")
+		return peer
+	}
+
+	// Two of the three peers are down; the subsets are tried until the peer that's up is hit
+	channelConfig, err := New(channelID, WithMaxTargets(1), WithMinResponses(1))
+	assert.Nil(t, err)
+	_, result, err := channelConfig.queryConfigBlockFromSubsets(reqCtx, l, []fab.ProposalProcessor{downPeer(), getPeerWithConfigBlockPayload(t), downPeer()})
+	assert.Nil(t, err, "expecting success after querying additional subsets")
+	if assert.NotNil(t, result) && len(result.Warnings) > 0 {
+		assert.Contains(t, result.Warnings[0], "failed attempt(s)", "expecting the failed attempts to be reported")
+	}
+
+	// Two responses required from subsets of one; the responsive targets are included in subsequent attempts
+	channelConfig, err = New(channelID, WithMaxTargets(1), WithMinResponses(2))
+	assert.Nil(t, err)
+	peer1 := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+	peer2 := &mocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Payload: peer1.Payload, Status: 200}
+	_, _, err = channelConfig.queryConfigBlockFromSubsets(reqCtx, l, []fab.ProposalProcessor{peer1, peer2})
+	assert.Nil(t, err, "expecting success after accumulating responses")
+
+	// Too few targets are queried with subsets of one to satisfy the minimum number of responses
+	channelConfig, err = New(channelID, WithMaxTargets(1), WithMinResponses(maxSubsetAttempts+1))
+	assert.Nil(t, err)
+	peer3 := &mocks.MockPeer{MockName: "Peer3", MockURL: "http://peer3.com", Payload: peer1.Payload, Status: 200}
+	peer4 := &mocks.MockPeer{MockName: "Peer4", MockURL: "http://peer4.com", Payload: peer1.Payload, Status: 200}
+	_, _, err = channelConfig.queryConfigBlockFromSubsets(reqCtx, l, []fab.ProposalProcessor{peer1, peer2, peer3, peer4})
+	assert.NotNil(t, err, "expecting error when the maximum number of queried targets is below the minimum responses")
+	assert.Equal(t, 0, peer3.ProcessProposalCalls+peer4.ProcessProposalCalls, "expecting no targets to be queried")
+
+	// All peers down
+	channelConfig, err = New(channelID, WithMaxTargets(1), WithMinResponses(1))
+	assert.Nil(t, err)
+	_, _, err = channelConfig.queryConfigBlockFromSubsets(reqCtx, l, []fab.ProposalProcessor{downPeer(), downPeer()})
+	assert.NotNil(t, err, "expecting error when all targets are down")
+
+	// The number of attempts is bounded
+	var targets []fab.ProposalProcessor
+	var peers []*mocks.MockPeer
+	for i := 0; i < maxSubsetAttempts+2; i++ {
+		peer := downPeer()
+		peers = append(peers, peer)
+		targets = append(targets, peer)
+	}
+	_, _, err = channelConfig.queryConfigBlockFromSubsets(reqCtx, l, targets)
+	assert.NotNil(t, err, "expecting error when all targets are down")
+	numCalls := 0
+	for _, peer := range peers {
+		numCalls += peer.ProcessProposalCalls
+	}
+	assert.Equal(t, maxSubsetAttempts, numCalls, "unexpected number of calls to targets")
+}
+
 func TestRandomMaxTargetsSelections(t *testing.T) {
 
 	testTargets := []fab.ProposalProcessor{
@@ -98,13 +780,15 @@ func TestRandomMaxTargetsSelections(t *testing.T) {
 		&mockProposalProcessor{"SEVEN"}, &mockProposalProcessor{"EIGHT"}, &mockProposalProcessor{"NINE"},
 	}
 
+	intn := rand.New(rand.NewSource(1)).Intn
+
 	max := 3
 	before := ""
 	for _, v := range testTargets[:max] {
 		before = before + v.(*mockProposalProcessor).name
 	}
 
-	responseTargets := randomMaxTargets(testTargets, max)
+	responseTargets := randomMaxTargets(testTargets, max, intn)
 	assert.True(t, responseTargets != nil && len(responseTargets) == max, "response target not as expected")
 
 	after := ""
@@ -115,15 +799,292 @@ func TestRandomMaxTargetsSelections(t *testing.T) {
 	assert.False(t, before == after, "response targets are not random")
 
 	max = 0 //when zero minimum supplied, result should be empty
-	responseTargets = randomMaxTargets(testTargets, max)
+	responseTargets = randomMaxTargets(testTargets, max, intn)
 	assert.True(t, responseTargets != nil && len(responseTargets) == max, "response target not as expected")
 
 	max = 12 //greater than targets length
-	responseTargets = randomMaxTargets(testTargets, max)
+	responseTargets = randomMaxTargets(testTargets, max, intn)
 	assert.True(t, responseTargets != nil && len(responseTargets) == len(testTargets), "response target not as expected")
 
 }
 
+func TestRandomMaxTargetsWithFixedSeed(t *testing.T) {
+	newTargets := func() []fab.ProposalProcessor {
+		return []fab.ProposalProcessor{
+			&mockProposalProcessor{"ONE"}, &mockProposalProcessor{"TWO"}, &mockProposalProcessor{"THREE"},
+			&mockProposalProcessor{"FOUR"}, &mockProposalProcessor{"FIVE"}, &mockProposalProcessor{"SIX"},
+		}
+	}
+	names := func(targets []fab.ProposalProcessor) []string {
+		var n []string
+		for _, v := range targets {
+			n = append(n, v.(*mockProposalProcessor).name)
+		}
+		return n
+	}
+
+	first := names(randomMaxTargets(newTargets(), 3, NewSeededTargetRandomizer(42)))
+	second := names(randomMaxTargets(newTargets(), 3, NewSeededTargetRandomizer(42)))
+
+	assert.Len(t, first, 3)
+	assert.Equal(t, first, second, "expecting the same selection for the same seed")
+
+	// The seeded randomizer may be used concurrently
+	randomizer := NewSeededTargetRandomizer(42)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Len(t, randomMaxTargets(newTargets(), 3, randomizer), 3)
+		}()
+	}
+	wg.Wait()
+
+	c, err := New("mychannel", WithMaxTargets(3), WithTargetRandomizer(NewSeededTargetRandomizer(42)))
+	assert.NoError(t, err)
+	assert.Equal(t, first, names(randomMaxTargets(newTargets(), 3, c.targetRandomizer())), "expecting the configured randomizer to be used")
+}
+
+func TestCheckAnchorPeers(t *testing.T) {
+	payload, err := proto.Marshal(&common.BlockchainInfo{Height: 5})
+	if err != nil {
+		t.Fatalf("error marshalling blockchain info: %s", err)
+	}
+
+	infraProvider := &anchorPeerInfraProvider{
+		MockInfraProvider: &mocks.MockInfraProvider{},
+		peers: map[string]fab.Peer{
+			"peer1.org1.com:7051": &mocks.MockPeer{MockName: "Peer1", MockURL: "peer1.org1.com:7051", Payload: payload, Status: 200},
+			"peer1.org2.com:7051": &mocks.MockPeer{MockName: "Peer2", MockURL: "peer1.org2.com:7051", Error: errors.New("connection refused")},
+		},
+	}
+	user := mspmocks.NewMockSigningIdentity("test", "test")
+	ctx := mocks.NewMockContext(user)
+	ctx.SetCustomInfraProvider(infraProvider)
+
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	_, err = CheckAnchorPeers(reqCtx, nil)
+	assert.Error(t, err)
+
+	cfg := mocks.NewMockChannelCfg(channelID)
+	cfg.MockAnchorPeers = []*fab.OrgAnchorPeer{
+		{Org: "Org1", Host: "peer1.org1.com", Port: 7051},
+		{Org: "Org2", Host: "peer1.org2.com", Port: 7051},
+	}
+
+	statuses, err := CheckAnchorPeers(reqCtx, cfg)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+
+	status := statuses["peer1.org1.com:7051"]
+	assert.Equal(t, "Org1", status.Org)
+	assert.True(t, status.Reachable)
+	assert.Equal(t, uint64(5), status.Height)
+	assert.NoError(t, status.Err)
+
+	status = statuses["peer1.org2.com:7051"]
+	assert.Equal(t, "Org2", status.Org)
+	assert.False(t, status.Reachable)
+	assert.Error(t, status.Err)
+}
+
+// anchorPeerInfraProvider creates the mock peers registered by URL
+type anchorPeerInfraProvider struct {
+	*mocks.MockInfraProvider
+	peers map[string]fab.Peer
+}
+
+func (p *anchorPeerInfraProvider) CreatePeerFromConfig(peerCfg *core.NetworkPeer) (fab.Peer, error) {
+	peer, ok := p.peers[peerCfg.URL]
+	if !ok {
+		return nil, errors.Errorf("peer [%s] not found", peerCfg.URL)
+	}
+	return peer, nil
+}
+
+func TestGetOrdererConfig(t *testing.T) {
+	marshal := func(msg proto.Message) *common.ConfigValue {
+		value, err := proto.Marshal(msg)
+		assert.NoError(t, err)
+		return &common.ConfigValue{Value: value}
+	}
+
+	raftMetadata, err := proto.Marshal(&raftConfigMetadata{
+		Consenters: []*raftConsenter{
+			{Host: "orderer1.example.com", Port: 7050, ClientTlsCert: []byte(validRootCA), ServerTlsCert: []byte(validRootCA)},
+			{Host: "orderer2.example.com", Port: 8050, ClientTlsCert: []byte("invalid"), ServerTlsCert: []byte(validRootCA)},
+		},
+		Options: &raftOptions{TickInterval: "500ms", ElectionTick: 10, HeartbeatTick: 1, MaxInflightBlocks: 5, SnapshotIntervalSize: 20971520},
+	})
+	assert.NoError(t, err)
+
+	ordererGroup := &common.ConfigGroup{
+		Values: map[string]*common.ConfigValue{
+			"ConsensusType":       marshal(&consensusType{Type: ConsensusTypeRaft, Metadata: raftMetadata}),
+			"BatchSize":           marshal(&ab.BatchSize{MaxMessageCount: 10, AbsoluteMaxBytes: 99 * 1024 * 1024, PreferredMaxBytes: 512 * 1024}),
+			"BatchTimeout":        marshal(&ab.BatchTimeout{Timeout: "2s"}),
+			"ChannelRestrictions": marshal(&ab.ChannelRestrictions{MaxCount: 100}),
+		},
+	}
+	root := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{"Orderer": ordererGroup}}
+
+	cfg, err := extractConfig(channelID, &common.ConfigEnvelope{Config: &common.Config{ChannelGroup: root}})
+	assert.NoError(t, err)
+
+	ordererConfig, err := GetOrdererConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, ConsensusTypeRaft, ordererConfig.ConsensusType)
+	assert.Equal(t, 2*time.Second, ordererConfig.BatchTimeout)
+	assert.Equal(t, uint32(10), ordererConfig.MaxMessageCount)
+	assert.Equal(t, uint32(99*1024*1024), ordererConfig.AbsoluteMaxBytes)
+	assert.Equal(t, uint32(512*1024), ordererConfig.PreferredMaxBytes)
+	assert.Equal(t, uint64(100), ordererConfig.MaxChannels)
+	assert.Empty(t, ordererConfig.KafkaBrokers)
+
+	raft := ordererConfig.Raft
+	if !assert.NotNil(t, raft) || !assert.Len(t, raft.Consenters, 2) {
+		return
+	}
+	assert.Equal(t, "orderer1.example.com", raft.Consenters[0].Host)
+	assert.Equal(t, uint32(7050), raft.Consenters[0].Port)
+	cert, err := raft.Consenters[0].ServerTLSCertificate()
+	assert.NoError(t, err)
+	assert.NotNil(t, cert)
+	_, err = raft.Consenters[0].ClientTLSCertificate()
+	assert.NoError(t, err)
+	_, err = raft.Consenters[1].ClientTLSCertificate()
+	assert.Error(t, err, "expecting error for invalid PEM")
+	assert.Equal(t, &RaftOptions{TickInterval: 500 * time.Millisecond, ElectionTick: 10, HeartbeatTick: 1, MaxInflightBlocks: 5, SnapshotIntervalSize: 20971520}, raft.Options)
+
+	// Kafka
+	ordererGroup.Values["ConsensusType"] = marshal(&ab.ConsensusType{Type: ConsensusTypeKafka})
+	ordererGroup.Values["KafkaBrokers"] = marshal(&ab.KafkaBrokers{Brokers: []string{"kafka0:9092", "kafka1:9092"}})
+	ordererConfig, err = GetOrdererConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, ConsensusTypeKafka, ordererConfig.ConsensusType)
+	assert.Equal(t, []string{"kafka0:9092", "kafka1:9092"}, ordererConfig.KafkaBrokers)
+	assert.Nil(t, ordererConfig.Raft)
+
+	ordererGroup.Values["BatchTimeout"] = marshal(&ab.BatchTimeout{Timeout: "invalid"})
+	_, err = GetOrdererConfig(cfg)
+	assert.Error(t, err)
+
+	delete(ordererGroup.Values, "BatchTimeout")
+	delete(ordererGroup.Values, "ConsensusType")
+	_, err = GetOrdererConfig(cfg)
+	assert.Error(t, err, "expecting error for missing consensus type")
+
+	_, err = GetOrdererConfig(NewChannelCfg(channelID))
+	assert.Error(t, err, "expecting error for config without config tree")
+}
+
+func TestRequiredSignersForConfigUpdate(t *testing.T) {
+	application := &common.ConfigGroup{
+		Groups:    make(map[string]*common.ConfigGroup),
+		Policies:  map[string]*common.ConfigPolicy{"Admins": newImplicitMetaPolicy(t, common.ImplicitMetaPolicy_MAJORITY)},
+		ModPolicy: "Admins",
+	}
+	for _, mspID := range []string{"Org1MSP", "Org2MSP", "Org3MSP"} {
+		application.Groups[mspID] = &common.ConfigGroup{
+			Values:    map[string]*common.ConfigValue{"AnchorPeers": {ModPolicy: "Admins"}},
+			Policies:  map[string]*common.ConfigPolicy{"Admins": newSignaturePolicy(t, mspID)},
+			ModPolicy: "Admins",
+		}
+	}
+	root := &common.ConfigGroup{
+		Groups:    map[string]*common.ConfigGroup{"Application": application},
+		Policies:  map[string]*common.ConfigPolicy{"Admins": newImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ALL)},
+		ModPolicy: "Admins",
+	}
+
+	cfg, err := extractConfig(channelID, &common.ConfigEnvelope{Config: &common.Config{ChannelGroup: root}})
+	assert.NoError(t, err)
+
+	signers, err := RequiredSignersForConfigUpdate(cfg, "/Channel/Application/Org1MSP")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org1MSP"}, signers)
+
+	signers, err = RequiredSignersForConfigUpdate(cfg, "Application/Org2MSP/AnchorPeers")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org2MSP"}, signers)
+
+	// MAJORITY of the application orgs
+	signers, err = RequiredSignersForConfigUpdate(cfg, "/Channel/Application")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org1MSP", "Org2MSP"}, signers)
+
+	// ALL of the sub-groups of the channel group, each of which requires a MAJORITY
+	signers, err = RequiredSignersForConfigUpdate(cfg, "/Channel")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org1MSP", "Org2MSP"}, signers)
+
+	application.Policies["Admins"] = newImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ALL)
+	signers, err = RequiredSignersForConfigUpdate(cfg, "/Channel/Application")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org1MSP", "Org2MSP", "Org3MSP"}, signers)
+
+	application.Policies["Admins"] = newImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ANY)
+	signers, err = RequiredSignersForConfigUpdate(cfg, "/Channel/Application")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org1MSP"}, signers)
+
+	// Absolute mod policy
+	application.Groups["Org1MSP"].ModPolicy = "/Channel/Application/Org3MSP/Admins"
+	signers, err = RequiredSignersForConfigUpdate(cfg, "/Channel/Application/Org1MSP")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Org3MSP"}, signers)
+
+	_, err = RequiredSignersForConfigUpdate(cfg, "/Channel/Application/Org4MSP/AnchorPeers")
+	assert.Error(t, err)
+
+	application.Groups["Org1MSP"].ModPolicy = "Writers"
+	_, err = RequiredSignersForConfigUpdate(cfg, "/Channel/Application/Org1MSP")
+	assert.Error(t, err)
+
+	_, err = RequiredSignersForConfigUpdate(mocks.NewMockChannelCfg(channelID), "/Channel/Application")
+	assert.Error(t, err)
+}
+
+func TestSignaturePolicySignersNOutOfRange(t *testing.T) {
+	rules := []*common.SignaturePolicy{{Type: &common.SignaturePolicy_SignedBy{SignedBy: 0}}}
+	principal, err := proto.Marshal(&mb.MSPRole{MspIdentifier: "Org1MSP", Role: mb.MSPRole_ADMIN})
+	assert.NoError(t, err)
+	identities := []*mb.MSPPrincipal{{PrincipalClassification: mb.MSPPrincipal_ROLE, Principal: principal}}
+
+	for _, n := range []int32{-1, 2} {
+		rule := &common.SignaturePolicy{
+			Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: n, Rules: rules}},
+		}
+		_, err := signaturePolicySigners(rule, identities)
+		assert.Error(t, err, "expecting error for %d out of %d rules", n, len(rules))
+	}
+}
+
+func newSignaturePolicy(t *testing.T, mspID string) *common.ConfigPolicy {
+	principal, err := proto.Marshal(&mb.MSPRole{MspIdentifier: mspID, Role: mb.MSPRole_ADMIN})
+	assert.NoError(t, err)
+	value, err := proto.Marshal(&common.SignaturePolicyEnvelope{
+		Rule: &common.SignaturePolicy{
+			Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{
+				N:     1,
+				Rules: []*common.SignaturePolicy{{Type: &common.SignaturePolicy_SignedBy{SignedBy: 0}}},
+			}},
+		},
+		Identities: []*mb.MSPPrincipal{{PrincipalClassification: mb.MSPPrincipal_ROLE, Principal: principal}},
+	})
+	assert.NoError(t, err)
+	return &common.ConfigPolicy{Policy: &common.Policy{Type: int32(common.Policy_SIGNATURE), Value: value}}
+}
+
+func newImplicitMetaPolicy(t *testing.T, rule common.ImplicitMetaPolicy_Rule) *common.ConfigPolicy {
+	value, err := proto.Marshal(&common.ImplicitMetaPolicy{SubPolicy: "Admins", Rule: rule})
+	assert.NoError(t, err)
+	return &common.ConfigPolicy{Policy: &common.Policy{Type: int32(common.Policy_IMPLICIT_META), Value: value}}
+}
+
 func setupTestContext() context.Client {
 	user := mspmocks.NewMockSigningIdentity("test", "test")
 	ctx := mocks.NewMockContext(user)
@@ -158,6 +1119,34 @@ func getPeerWithConfigBlockPayload(t *testing.T) fab.Peer {
 	return peer
 }
 
+// getPeerWithConfigSequence returns a peer that responds with a config block containing a config with the given sequence
+func getPeerWithConfigSequence(t *testing.T, sequence uint64) fab.Peer {
+	peer := getPeerWithConfigBlockPayload(t).(*mocks.MockPeer)
+
+	block := &common.Block{}
+	assert.NoError(t, proto.Unmarshal(peer.Payload, block))
+	envelope := &common.Envelope{}
+	assert.NoError(t, proto.Unmarshal(block.Data.Data[0], envelope))
+	payload := &common.Payload{}
+	assert.NoError(t, proto.Unmarshal(envelope.Payload, payload))
+	configEnvelope := &common.ConfigEnvelope{}
+	assert.NoError(t, proto.Unmarshal(payload.Data, configEnvelope))
+
+	configEnvelope.Config.Sequence = sequence
+
+	var err error
+	payload.Data, err = proto.Marshal(configEnvelope)
+	assert.NoError(t, err)
+	envelope.Payload, err = proto.Marshal(payload)
+	assert.NoError(t, err)
+	block.Data.Data[0], err = proto.Marshal(envelope)
+	assert.NoError(t, err)
+	peer.Payload, err = proto.Marshal(block)
+	assert.NoError(t, err)
+
+	return peer
+}
+
 //mockProposalProcessor to mock proposal processor for random max target test
 type mockProposalProcessor struct {
 	name string
@@ -0,0 +1,244 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chconfig
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// ConsensusStrategy determines how the authoritative config is selected from the config responses of the peers
+type ConsensusStrategy int
+
+const (
+	// StrictMatchStrategy requires all of the responses to contain the same config (this is the default)
+	StrictMatchStrategy ConsensusStrategy = iota
+	// MajorityStrategy selects the config that is returned by a majority of the responses
+	MajorityStrategy
+	// HighestSequenceStrategy selects the config with the highest sequence, which allows
+	// peers that lag behind during a config update to be ignored
+	HighestSequenceStrategy
+)
+
+// String returns the name of the strategy
+func (s ConsensusStrategy) String() string {
+	switch s {
+	case StrictMatchStrategy:
+		return "StrictMatch"
+	case MajorityStrategy:
+		return "Majority"
+	case HighestSequenceStrategy:
+		return "HighestSequence"
+	default:
+		return fmt.Sprintf("ConsensusStrategy(%d)", int(s))
+	}
+}
+
+// ConsensusResult describes the outcome of selecting the config from the peer responses
+type ConsensusResult struct {
+	Strategy ConsensusStrategy
+	// Sequence is the sequence of the selected config
+	Sequence uint64
+	// Agreeing is the number of responses that contained the selected config
+	Agreeing int
+	// Responses is the total number of responses that were considered
+	Responses int
+	// Warnings describes conditions that didn't prevent the config from being selected but may require
+	// the attention of an operator, for example, peers that returned a divergent config or fewer agreeing
+	// responses than preferred (see WithPreferredResponses)
+	Warnings []string
+}
+
+// consensusVerifier matches the config responses according to the consensus strategy
+// and records the selected response along with the outcome
+type consensusVerifier struct {
+	strategy     ConsensusStrategy
+	minResponses int
+	// matchingResponses is the minimum number of responses that must contain the selected config (if zero,
+	// only minResponses applies)
+	matchingResponses int
+	// preferredResponses is the number of agreeing responses below which a warning is reported (if zero,
+	// no warning is reported)
+	preferredResponses int
+	selected           *configResponse
+	result             *ConsensusResult
+}
+
+type configResponse struct {
+	endorser string
+	envelope *common.ConfigEnvelope
+	sequence uint64
+}
+
+// Verify performs no verification of individual responses
+func (v *consensusVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	return nil
+}
+
+// Match selects the config from the responses according to the strategy
+func (v *consensusVerifier) Match(tprs []*fab.TransactionProposalResponse) error {
+	if v.strategy == StrictMatchStrategy && v.matchingResponses == 0 {
+		if err := (&channel.TransactionProposalResponseVerifier{MinResponses: v.minResponses}).Match(tprs); err != nil {
+			return err
+		}
+		response, err := newConfigResponse(tprs[0])
+		if err != nil {
+			return err
+		}
+		v.selected = response
+		v.result = &ConsensusResult{Strategy: v.strategy, Sequence: response.sequence, Agreeing: len(tprs), Responses: len(tprs)}
+		v.result.Warnings = v.preferredResponsesWarnings(len(tprs))
+		return nil
+	}
+
+	if v.minResponses <= 0 {
+		return errors.New("minimum Responses has to be greater than zero")
+	}
+
+	var responses []*configResponse
+	var warnings []string
+	for _, tpr := range tprs {
+		response, err := newConfigResponse(tpr)
+		if err != nil {
+			logger.Debugf("Ignoring invalid config response from [%s]: %s", tpr.Endorser, err)
+			warnings = append(warnings, fmt.Sprintf("ignored invalid config response from peer [%s]: %s", tpr.Endorser, err))
+			continue
+		}
+		responses = append(responses, response)
+	}
+
+	if len(responses) < v.minResponses {
+		return errors.Errorf("required minimum %d endorsments got %d", v.minResponses, len(responses))
+	}
+
+	var selected *configResponse
+	var agreeing int
+	switch v.strategy {
+	case StrictMatchStrategy:
+		selected, agreeing = largestGroup(responses)
+		if agreeing != len(responses) {
+			return errors.Errorf("responses contain conflicting configs; divergent responses: %s", divergentResponses(selected, responses))
+		}
+	case MajorityStrategy:
+		selected, agreeing = largestGroup(responses)
+		if agreeing <= len(responses)/2 {
+			return errors.Errorf("no config was returned by a majority of the responses: %d of %d responses agree", agreeing, len(responses))
+		}
+	case HighestSequenceStrategy:
+		var highest []*configResponse
+		for _, response := range responses {
+			if len(highest) == 0 || response.sequence > highest[0].sequence {
+				highest = []*configResponse{response}
+			} else if response.sequence == highest[0].sequence {
+				highest = append(highest, response)
+			}
+		}
+		selected, agreeing = largestGroup(highest)
+		if agreeing != len(highest) {
+			return errors.Errorf("responses contain conflicting configs with sequence %d", selected.sequence)
+		}
+	default:
+		return errors.Errorf("unsupported consensus strategy %s", v.strategy)
+	}
+
+	if agreeing < v.minResponses {
+		return errors.Errorf("required minimum %d matching endorsments got %d", v.minResponses, agreeing)
+	}
+	if agreeing < v.matchingResponses {
+		return errors.Errorf("required %d responses with matching configs got %d; divergent responses: %s", v.matchingResponses, agreeing, divergentResponses(selected, responses))
+	}
+
+	logger.Debugf("Consensus strategy %s selected config sequence %d (%d of %d responses agree)", v.strategy, selected.sequence, agreeing, len(responses))
+
+	for _, response := range responses {
+		if !proto.Equal(response.envelope.Config, selected.envelope.Config) {
+			warnings = append(warnings, fmt.Sprintf("peer [%s] returned a divergent config (sequence %d)", response.endorser, response.sequence))
+		}
+	}
+	warnings = append(warnings, v.preferredResponsesWarnings(agreeing)...)
+
+	v.selected = selected
+	v.result = &ConsensusResult{Strategy: v.strategy, Sequence: selected.sequence, Agreeing: agreeing, Responses: len(responses), Warnings: warnings}
+	return nil
+}
+
+// preferredResponsesWarnings returns a warning if the number of agreeing responses met the minimum but fell below the preferred number
+func (v *consensusVerifier) preferredResponsesWarnings(agreeing int) []string {
+	if agreeing >= v.preferredResponses {
+		return nil
+	}
+	return []string{fmt.Sprintf("%d agreeing responses fell below the preferred %d responses but met the minimum of %d", agreeing, v.preferredResponses, v.minResponses)}
+}
+
+// configEnvelope returns the config envelope of the selected response
+func (v *consensusVerifier) configEnvelope() (*common.ConfigEnvelope, error) {
+	if v.selected == nil {
+		return nil, errors.New("no config response was selected")
+	}
+	return v.selected.envelope, nil
+}
+
+func newConfigResponse(tpr *fab.TransactionProposalResponse) (*configResponse, error) {
+	if tpr.ProposalResponse == nil || tpr.ProposalResponse.Response == nil {
+		return nil, errors.New("missing response")
+	}
+
+	block := &common.Block{}
+	if err := proto.Unmarshal(tpr.ProposalResponse.Response.Payload, block); err != nil {
+		return nil, errors.Wrap(err, "unmarshal block failed")
+	}
+	if block.Data == nil || len(block.Data.Data) != 1 {
+		return nil, errors.New("config block must contain one transaction")
+	}
+
+	configEnvelope, err := resource.CreateConfigEnvelope(block.Data.Data[0])
+	if err != nil {
+		return nil, err
+	}
+	if configEnvelope.Config == nil {
+		return nil, errors.New("config envelope does not contain a config")
+	}
+
+	return &configResponse{endorser: tpr.Endorser, envelope: configEnvelope, sequence: configEnvelope.Config.Sequence}, nil
+}
+
+// divergentResponses describes the responses whose config differs from the config of the selected response
+func divergentResponses(selected *configResponse, responses []*configResponse) string {
+	var divergent []string
+	for _, response := range responses {
+		if !proto.Equal(response.envelope.Config, selected.envelope.Config) {
+			divergent = append(divergent, fmt.Sprintf("%s (sequence %d)", response.endorser, response.sequence))
+		}
+	}
+	return fmt.Sprintf("%v", divergent)
+}
+
+// largestGroup groups the responses by config and returns a response of the largest group
+// (the first such group in the case of a tie) along with the size of the group
+func largestGroup(responses []*configResponse) (*configResponse, int) {
+	var selected *configResponse
+	var max int
+	for i, response := range responses {
+		count := 0
+		for _, other := range responses {
+			if proto.Equal(response.envelope.Config, other.envelope.Config) {
+				count++
+			}
+		}
+		if count > max {
+			max = count
+			selected = responses[i]
+		}
+	}
+	return selected, max
+}
@@ -0,0 +1,256 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chconfig
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	ab "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/orderer"
+	"github.com/pkg/errors"
+
+	channelConfig "github.com/hyperledger/fabric-sdk-go/internal/github.com/hyperledger/fabric/common/channelconfig"
+)
+
+// Consensus types of the ordering service
+const (
+	ConsensusTypeSolo  = "solo"
+	ConsensusTypeKafka = "kafka"
+	ConsensusTypeRaft  = "etcdraft"
+)
+
+// OrdererConfig contains the configuration of the ordering service of a channel
+type OrdererConfig struct {
+	// ConsensusType is the type of the ordering service (see ConsensusTypeSolo, ConsensusTypeKafka and ConsensusTypeRaft)
+	ConsensusType string
+	// BatchTimeout is the time to wait before cutting a block
+	BatchTimeout time.Duration
+	// MaxMessageCount is the maximum number of messages in a block
+	MaxMessageCount uint32
+	// AbsoluteMaxBytes is the absolute maximum number of bytes of the messages in a block
+	AbsoluteMaxBytes uint32
+	// PreferredMaxBytes is the preferred maximum number of bytes of the messages in a block
+	PreferredMaxBytes uint32
+	// MaxChannels is the maximum number of channels that the ordering service allows (zero if unlimited)
+	MaxChannels uint64
+	// KafkaBrokers are the Kafka brokers (only for the Kafka consensus type)
+	KafkaBrokers []string
+	// Raft is the Raft configuration (only for the Raft consensus type)
+	Raft *RaftConfig
+}
+
+// RaftConfig contains the configuration of a Raft ordering service
+type RaftConfig struct {
+	Consenters []*RaftConsenter
+	Options    *RaftOptions
+}
+
+// RaftConsenter is a member of the Raft cluster
+type RaftConsenter struct {
+	Host string
+	Port uint32
+	// ClientTLSCert is the PEM encoded client TLS certificate of the consenter
+	ClientTLSCert []byte
+	// ServerTLSCert is the PEM encoded server TLS certificate of the consenter
+	ServerTLSCert []byte
+}
+
+// ClientTLSCertificate returns the parsed client TLS certificate of the consenter
+func (c *RaftConsenter) ClientTLSCertificate() (*x509.Certificate, error) {
+	return parsePEMCertificate(c.ClientTLSCert)
+}
+
+// ServerTLSCertificate returns the parsed server TLS certificate of the consenter
+func (c *RaftConsenter) ServerTLSCertificate() (*x509.Certificate, error) {
+	return parsePEMCertificate(c.ServerTLSCert)
+}
+
+// RaftOptions contains the options of the Raft cluster
+type RaftOptions struct {
+	TickInterval         time.Duration
+	ElectionTick         uint32
+	HeartbeatTick        uint32
+	MaxInflightBlocks    uint32
+	SnapshotIntervalSize uint32
+}
+
+// GetOrdererConfig extracts the configuration of the ordering service (the consensus type and its
+// parameters) from the orderer group of the channel config. The config must have been retrieved with
+// this package so that it retains the config tree.
+func GetOrdererConfig(cfg fab.ChannelCfg) (*OrdererConfig, error) {
+	p, ok := cfg.(channelGroupProvider)
+	if !ok || p.ChannelGroup() == nil {
+		return nil, errors.New("channel config does not contain the config tree")
+	}
+
+	ordererGroup, ok := p.ChannelGroup().Groups[channelConfig.OrdererGroupKey]
+	if !ok {
+		return nil, errors.New("channel config does not contain the orderer group")
+	}
+
+	ordererConfig := &OrdererConfig{}
+	for key, value := range ordererGroup.Values {
+		if err := loadOrdererConfigValue(key, value, ordererConfig); err != nil {
+			return nil, errors.WithMessage(err, "failed to load orderer config value ["+key+"]")
+		}
+	}
+
+	if ordererConfig.ConsensusType == "" {
+		return nil, errors.New("orderer group does not contain the consensus type")
+	}
+
+	return ordererConfig, nil
+}
+
+func loadOrdererConfigValue(key string, configValue *common.ConfigValue, ordererConfig *OrdererConfig) error {
+	switch key {
+	case channelConfig.ConsensusTypeKey:
+		consensusType := &consensusType{}
+		if err := proto.Unmarshal(configValue.Value, consensusType); err != nil {
+			return errors.Wrap(err, "unmarshal ConsensusType from config failed")
+		}
+		ordererConfig.ConsensusType = consensusType.Type
+		if consensusType.Type == ConsensusTypeRaft {
+			raftConfig, err := loadRaftConfig(consensusType.Metadata)
+			if err != nil {
+				return err
+			}
+			ordererConfig.Raft = raftConfig
+		}
+
+	case channelConfig.BatchSizeKey:
+		batchSize := &ab.BatchSize{}
+		if err := proto.Unmarshal(configValue.Value, batchSize); err != nil {
+			return errors.Wrap(err, "unmarshal BatchSize from config failed")
+		}
+		ordererConfig.MaxMessageCount = batchSize.MaxMessageCount
+		ordererConfig.AbsoluteMaxBytes = batchSize.AbsoluteMaxBytes
+		ordererConfig.PreferredMaxBytes = batchSize.PreferredMaxBytes
+
+	case channelConfig.BatchTimeoutKey:
+		batchTimeout := &ab.BatchTimeout{}
+		if err := proto.Unmarshal(configValue.Value, batchTimeout); err != nil {
+			return errors.Wrap(err, "unmarshal BatchTimeout from config failed")
+		}
+		timeout, err := time.ParseDuration(batchTimeout.Timeout)
+		if err != nil {
+			return errors.Wrapf(err, "invalid batch timeout [%s]", batchTimeout.Timeout)
+		}
+		ordererConfig.BatchTimeout = timeout
+
+	case channelConfig.ChannelRestrictionsKey:
+		restrictions := &ab.ChannelRestrictions{}
+		if err := proto.Unmarshal(configValue.Value, restrictions); err != nil {
+			return errors.Wrap(err, "unmarshal ChannelRestrictions from config failed")
+		}
+		ordererConfig.MaxChannels = restrictions.MaxCount
+
+	case channelConfig.KafkaBrokersKey:
+		kafkaBrokers := &ab.KafkaBrokers{}
+		if err := proto.Unmarshal(configValue.Value, kafkaBrokers); err != nil {
+			return errors.Wrap(err, "unmarshal KafkaBrokers from config failed")
+		}
+		ordererConfig.KafkaBrokers = kafkaBrokers.Brokers
+	}
+	return nil
+}
+
+func loadRaftConfig(metadata []byte) (*RaftConfig, error) {
+	raftMetadata := &raftConfigMetadata{}
+	if err := proto.Unmarshal(metadata, raftMetadata); err != nil {
+		return nil, errors.Wrap(err, "unmarshal Raft config metadata failed")
+	}
+
+	raftConfig := &RaftConfig{}
+	for _, consenter := range raftMetadata.Consenters {
+		raftConfig.Consenters = append(raftConfig.Consenters, &RaftConsenter{
+			Host:          consenter.Host,
+			Port:          consenter.Port,
+			ClientTLSCert: consenter.ClientTlsCert,
+			ServerTLSCert: consenter.ServerTlsCert,
+		})
+	}
+
+	if options := raftMetadata.Options; options != nil {
+		raftConfig.Options = &RaftOptions{
+			ElectionTick:         options.ElectionTick,
+			HeartbeatTick:        options.HeartbeatTick,
+			MaxInflightBlocks:    options.MaxInflightBlocks,
+			SnapshotIntervalSize: options.SnapshotIntervalSize,
+		}
+		if options.TickInterval != "" {
+			tickInterval, err := time.ParseDuration(options.TickInterval)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid Raft tick interval [%s]", options.TickInterval)
+			}
+			raftConfig.Options.TickInterval = tickInterval
+		}
+	}
+
+	return raftConfig, nil
+}
+
+func parsePEMCertificate(certBytes []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certBytes)
+	if block == nil {
+		return nil, errors.New("PEM decoding of certificate failed")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing of certificate failed")
+	}
+	return cert, nil
+}
+
+// The following messages are wire compatible with orderer.ConsensusType and the etcdraft
+// config metadata of Fabric; the versions of the protos in third_party don't include the
+// consensus metadata.
+
+type consensusType struct {
+	Type     string `protobuf:"bytes,1,opt,name=type,proto3"`
+	Metadata []byte `protobuf:"bytes,2,opt,name=metadata,proto3"`
+}
+
+func (m *consensusType) Reset()         { *m = consensusType{} }
+func (m *consensusType) String() string { return proto.CompactTextString(m) }
+func (*consensusType) ProtoMessage()    {}
+
+type raftConfigMetadata struct {
+	Consenters []*raftConsenter `protobuf:"bytes,1,rep,name=consenters,proto3"`
+	Options    *raftOptions     `protobuf:"bytes,2,opt,name=options,proto3"`
+}
+
+func (m *raftConfigMetadata) Reset()         { *m = raftConfigMetadata{} }
+func (m *raftConfigMetadata) String() string { return proto.CompactTextString(m) }
+func (*raftConfigMetadata) ProtoMessage()    {}
+
+type raftConsenter struct {
+	Host          string `protobuf:"bytes,1,opt,name=host,proto3"`
+	Port          uint32 `protobuf:"varint,2,opt,name=port,proto3"`
+	ClientTlsCert []byte `protobuf:"bytes,3,opt,name=client_tls_cert,json=clientTlsCert,proto3"`
+	ServerTlsCert []byte `protobuf:"bytes,4,opt,name=server_tls_cert,json=serverTlsCert,proto3"`
+}
+
+func (m *raftConsenter) Reset()         { *m = raftConsenter{} }
+func (m *raftConsenter) String() string { return proto.CompactTextString(m) }
+func (*raftConsenter) ProtoMessage()    {}
+
+type raftOptions struct {
+	TickInterval         string `protobuf:"bytes,1,opt,name=tick_interval,json=tickInterval,proto3"`
+	ElectionTick         uint32 `protobuf:"varint,2,opt,name=election_tick,json=electionTick,proto3"`
+	HeartbeatTick        uint32 `protobuf:"varint,3,opt,name=heartbeat_tick,json=heartbeatTick,proto3"`
+	MaxInflightBlocks    uint32 `protobuf:"varint,4,opt,name=max_inflight_blocks,json=maxInflightBlocks,proto3"`
+	SnapshotIntervalSize uint32 `protobuf:"varint,5,opt,name=snapshot_interval_size,json=snapshotIntervalSize,proto3"`
+}
+
+func (m *raftOptions) Reset()         { *m = raftOptions{} }
+func (m *raftOptions) String() string { return proto.CompactTextString(m) }
+func (*raftOptions) ProtoMessage()    {}
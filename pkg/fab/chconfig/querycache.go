@@ -0,0 +1,248 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chconfig
+
+import (
+	reqContext "context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/pkg/errors"
+)
+
+// configCache caches the configs retrieved by the ChannelConfigs that are created with WithCacheTTL.
+// It's shared by all such ChannelConfigs so that the cache is effective even though a new ChannelConfig
+// is typically created for each query (see Provider). The configs are keyed by channel and by the options
+// that determine how much the config is trusted (see newConfigKey), so a ChannelConfig is only returned
+// configs that were retrieved with the same options. Expired configs are evicted when the cache is accessed.
+var configCache = newQueryCache()
+
+// queryFunc retrieves the channel config
+type queryFunc func(reqCtx reqContext.Context) (fab.ChannelCfg, error)
+
+// configKey identifies the configs of a channel that were retrieved with the same trust-relevant options
+type configKey struct {
+	channelID string
+	options   string
+}
+
+// inflightKey identifies the in-flight query of an identity. Queries are only shared by the same
+// identity since the query is performed with the request context (and identity) of the first caller.
+type inflightKey struct {
+	configKey
+	identity string
+}
+
+type cachedConfig struct {
+	cfg     fab.ChannelCfg
+	fetched time.Time
+	expires time.Time
+}
+
+// inflightQuery is a query that is in progress. Concurrent queries with the same key and identity wait for
+// the result of the in-flight query instead of querying the network themselves.
+type inflightQuery struct {
+	done chan struct{}
+	cfg  fab.ChannelCfg
+	err  error
+}
+
+// queryCache is a cache of channel configs keyed by channel ID and options
+type queryCache struct {
+	mutex       sync.Mutex
+	entries     map[configKey]*cachedConfig
+	inflight    map[inflightKey]*inflightQuery
+	generations map[string]uint64
+}
+
+func newQueryCache() *queryCache {
+	return &queryCache{
+		entries:     make(map[configKey]*cachedConfig),
+		inflight:    make(map[inflightKey]*inflightQuery),
+		generations: make(map[string]uint64),
+	}
+}
+
+// newConfigKey returns the cache key of the configs of the given channel that are retrieved with the given
+// options. Options that don't affect the trust in the config (such as the cache TTL) are not included. False
+// is returned if the options can't be keyed by value, in which case the config mustn't be cached: a TargetFilter
+// or KnownConfig that's a pointer, func or other reference can't be compared with the options of another query.
+func newConfigKey(channelID string, opts Opts) (configKey, bool) {
+	filter, ok := valueKey(opts.TargetFilter)
+	if !ok {
+		return configKey{}, false
+	}
+	known, ok := valueKey(opts.KnownConfig)
+	if !ok {
+		return configKey{}, false
+	}
+
+	var targets []string
+	for _, target := range opts.Targets {
+		targets = append(targets, target.URL())
+	}
+	sort.Strings(targets)
+
+	options := fmt.Sprintf("orderer=%s;fallback=%s;targets=%s;min=%d;max=%d;ratio=%v;strategy=%s;matching=%d;preferred=%d;filter=%s;anchors=%t;known=%s",
+		ordererURL(opts.Orderer), ordererURL(opts.FallbackOrderer), strings.Join(targets, ","), opts.MinResponses, opts.MaxTargets,
+		opts.MinAgreementRatio, opts.ConsensusStrategy, opts.MatchingResponses, opts.PreferredResponses,
+		filter, opts.AnchorPeersOnly, known)
+
+	return configKey{channelID: channelID, options: options}, true
+}
+
+func ordererURL(orderer fab.Orderer) string {
+	if orderer == nil {
+		return ""
+	}
+	return orderer.URL()
+}
+
+// valueKey returns a key that identifies the given value by its type and contents. False is returned if the value
+// contains a reference (such as a pointer or a func), since a reference doesn't identify the value it refers to.
+func valueKey(v interface{}) (string, bool) {
+	if v == nil {
+		return "", true
+	}
+	if !isPlainValue(reflect.TypeOf(v)) {
+		return "", false
+	}
+	return fmt.Sprintf("%T:%#v", v, v), true
+}
+
+// isPlainValue returns true if values of the given type don't contain references
+func isPlainValue(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isPlainValue(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isPlainValue(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// requestIdentity returns the identity of the client of the request context
+func requestIdentity(reqCtx reqContext.Context) string {
+	ctx, ok := contextImpl.RequestClientContext(reqCtx)
+	if !ok || ctx == nil {
+		return ""
+	}
+	identifier := ctx.Identifier()
+	if identifier == nil {
+		return ""
+	}
+	return identifier.MSPID + ":" + identifier.ID
+}
+
+// get returns the cached config with the given key if it was retrieved within the given TTL; otherwise
+// the config is retrieved with the given query function and cached. Only one query per key and identity
+// is in flight at a time. If the in-flight query fails then the callers that waited for it query the
+// network themselves (with their own request context) rather than returning the error. Errors are not cached.
+func (qc *queryCache) get(reqCtx reqContext.Context, key configKey, ttl time.Duration, query queryFunc) (fab.ChannelCfg, error) {
+	qc.mutex.Lock()
+	qc.evictExpired(time.Now())
+	if entry, ok := qc.entries[key]; ok && time.Since(entry.fetched) < ttl {
+		qc.mutex.Unlock()
+		logger.Debugf("Returning cached config for channel [%s]", key.channelID)
+		return entry.cfg, nil
+	}
+
+	ik := inflightKey{configKey: key, identity: requestIdentity(reqCtx)}
+	if call, ok := qc.inflight[ik]; ok {
+		qc.mutex.Unlock()
+		logger.Debugf("Waiting for in-flight config query for channel [%s]", key.channelID)
+		select {
+		case <-call.done:
+			if call.err == nil {
+				return call.cfg, nil
+			}
+			logger.Debugf("In-flight config query for channel [%s] failed; querying the config: %s", key.channelID, call.err)
+			return query(reqCtx)
+		case <-reqCtx.Done():
+			return nil, errors.Wrap(reqCtx.Err(), "waiting for channel config query failed")
+		}
+	}
+
+	call := &inflightQuery{done: make(chan struct{})}
+	qc.inflight[ik] = call
+	generation := qc.generations[key.channelID]
+	qc.mutex.Unlock()
+
+	call.cfg, call.err = query(reqCtx)
+
+	qc.mutex.Lock()
+	// The result isn't cached if the cache was invalidated while the query was in flight
+	// since the result may be older than the update that caused the invalidation.
+	now := time.Now()
+	qc.evictExpired(now)
+	if call.err == nil && generation == qc.generations[key.channelID] {
+		qc.entries[key] = &cachedConfig{cfg: call.cfg, fetched: now, expires: now.Add(ttl)}
+	}
+	if qc.inflight[ik] == call {
+		delete(qc.inflight, ik)
+	}
+	qc.mutex.Unlock()
+
+	close(call.done)
+	return call.cfg, call.err
+}
+
+// evictExpired removes the configs that have expired. The caller must hold the mutex.
+func (qc *queryCache) evictExpired(now time.Time) {
+	for key, entry := range qc.entries {
+		if !now.Before(entry.expires) {
+			delete(qc.entries, key)
+		}
+	}
+}
+
+// invalidate removes the cached configs of the given channel (for all options)
+func (qc *queryCache) invalidate(channelID string) {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+
+	for key := range qc.entries {
+		if key.channelID == channelID {
+			delete(qc.entries, key)
+		}
+	}
+	for key := range qc.inflight {
+		if key.channelID == channelID {
+			delete(qc.inflight, key)
+		}
+	}
+	qc.generations[channelID]++
+}
+
+// latest returns the cached config with the given key (that hasn't expired), or nil if no such config is cached
+func (qc *queryCache) latest(key configKey) fab.ChannelCfg {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+
+	qc.evictExpired(time.Now())
+	if entry, ok := qc.entries[key]; ok {
+		return entry.cfg
+	}
+	return nil
+}
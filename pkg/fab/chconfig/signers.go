@@ -0,0 +1,258 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chconfig
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	"github.com/pkg/errors"
+)
+
+// rootGroupName is the name of the root config group in config paths
+const rootGroupName = "Channel"
+
+// channelGroupProvider is implemented by channel configs that retain the config tree
+type channelGroupProvider interface {
+	ChannelGroup() *common.ConfigGroup
+}
+
+// RequiredSignersForConfigUpdate resolves the mod policy of the config element at the given path and
+// returns the MSP IDs of a set of organizations whose (admin) signatures are sufficient to satisfy the
+// policy. The path is a slash-separated list of group names, optionally followed by the name of a value
+// or policy in the last group, for example "/Channel/Application/Org1MSP" or "/Channel/Application/Org1MSP/AnchorPeers"
+// (the leading "/Channel" may be omitted). Where a policy may be satisfied by different sets of
+// organizations (n-out-of signature policies and ANY/MAJORITY implicit meta policies), the first
+// sufficient sub-policies are chosen in order (ordered by group name for implicit meta policies).
+// The config must have been retrieved with this package so that it retains the config tree.
+func RequiredSignersForConfigUpdate(cfg fab.ChannelCfg, path string) ([]string, error) {
+	p, ok := cfg.(channelGroupProvider)
+	if !ok || p.ChannelGroup() == nil {
+		return nil, errors.New("channel config does not contain the config tree")
+	}
+	root := p.ChannelGroup()
+
+	elements := splitConfigPath(path)
+	if len(elements) > 0 && elements[0] == rootGroupName {
+		elements = elements[1:]
+	}
+
+	// Walk the groups along the path. The last element may be a group, a value or a policy.
+	group := root
+	var groupPath []string
+	modPolicy := root.ModPolicy
+	for i, element := range elements {
+		if child, ok := group.Groups[element]; ok {
+			group = child
+			groupPath = append(groupPath, element)
+			modPolicy = child.ModPolicy
+			continue
+		}
+		if i != len(elements)-1 {
+			return nil, errors.Errorf("config group [%s] not found in path [%s]", element, path)
+		}
+		if value, ok := group.Values[element]; ok {
+			modPolicy = value.ModPolicy
+		} else if policy, ok := group.Policies[element]; ok {
+			modPolicy = policy.ModPolicy
+		} else {
+			return nil, errors.Errorf("config element [%s] not found in path [%s]", element, path)
+		}
+	}
+
+	if modPolicy == "" {
+		return nil, errors.Errorf("no mod policy for config element at path [%s]", path)
+	}
+
+	signers, err := policySigners(root, groupPath, modPolicy)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to resolve mod policy ["+modPolicy+"]")
+	}
+
+	return sortedKeys(signers), nil
+}
+
+// policySigners resolves the policy with the given name (absolute, or relative to the group
+// at groupPath) and returns the MSP IDs of the signers that satisfy the policy
+func policySigners(root *common.ConfigGroup, groupPath []string, name string) (map[string]struct{}, error) {
+	var policyPath []string
+	if strings.HasPrefix(name, "/") {
+		policyPath = splitConfigPath(name)
+		if len(policyPath) == 0 || policyPath[0] != rootGroupName {
+			return nil, errors.Errorf("invalid absolute policy path [%s]", name)
+		}
+		policyPath = policyPath[1:]
+	} else {
+		policyPath = append(append([]string{}, groupPath...), splitConfigPath(name)...)
+	}
+	if len(policyPath) == 0 {
+		return nil, errors.Errorf("invalid policy name [%s]", name)
+	}
+
+	policyGroupPath := policyPath[:len(policyPath)-1]
+	policyName := policyPath[len(policyPath)-1]
+
+	group := root
+	for _, element := range policyGroupPath {
+		child, ok := group.Groups[element]
+		if !ok {
+			return nil, errors.Errorf("config group [%s] of policy [%s] not found", element, name)
+		}
+		group = child
+	}
+
+	configPolicy, ok := group.Policies[policyName]
+	if !ok || configPolicy.Policy == nil {
+		return nil, errors.Errorf("policy [%s] not found", name)
+	}
+
+	switch common.Policy_PolicyType(configPolicy.Policy.Type) {
+	case common.Policy_SIGNATURE:
+		sigPolicyEnv := &common.SignaturePolicyEnvelope{}
+		if err := proto.Unmarshal(configPolicy.Policy.Value, sigPolicyEnv); err != nil {
+			return nil, errors.Wrap(err, "unmarshal signature policy envelope from config failed")
+		}
+		return signaturePolicySigners(sigPolicyEnv.Rule, sigPolicyEnv.Identities)
+
+	case common.Policy_IMPLICIT_META:
+		implicitMetaPolicy := &common.ImplicitMetaPolicy{}
+		if err := proto.Unmarshal(configPolicy.Policy.Value, implicitMetaPolicy); err != nil {
+			return nil, errors.Wrap(err, "unmarshal implicit meta policy from config failed")
+		}
+		return implicitMetaPolicySigners(root, policyGroupPath, group, implicitMetaPolicy)
+
+	default:
+		return nil, errors.Errorf("unsupported policy type %v", common.Policy_PolicyType(configPolicy.Policy.Type))
+	}
+}
+
+// implicitMetaPolicySigners returns the signers of the sub-policy of the first N child groups (ordered
+// by name), where N is 1 for ANY, a majority of the child groups for MAJORITY, and all child groups for ALL
+func implicitMetaPolicySigners(root *common.ConfigGroup, groupPath []string, group *common.ConfigGroup, policy *common.ImplicitMetaPolicy) (map[string]struct{}, error) {
+	var children []string
+	for name := range group.Groups {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+
+	var threshold int
+	switch policy.Rule {
+	case common.ImplicitMetaPolicy_ANY:
+		threshold = 1
+	case common.ImplicitMetaPolicy_ALL:
+		threshold = len(children)
+	case common.ImplicitMetaPolicy_MAJORITY:
+		threshold = len(children)/2 + 1
+	default:
+		return nil, errors.Errorf("unsupported implicit meta policy rule %v", policy.Rule)
+	}
+
+	if threshold > len(children) {
+		return nil, errors.Errorf("implicit meta policy %s of [%s] can't be satisfied by %d sub-group(s)", policy.Rule, policy.SubPolicy, len(children))
+	}
+
+	signers := make(map[string]struct{})
+	for _, child := range children[:threshold] {
+		childSigners, err := policySigners(root, append(append([]string{}, groupPath...), child), policy.SubPolicy)
+		if err != nil {
+			return nil, err
+		}
+		addAll(signers, childSigners)
+	}
+	return signers, nil
+}
+
+// signaturePolicySigners returns the MSP IDs of the identities that satisfy the signature policy
+// (choosing the first N rules of n-out-of policies)
+func signaturePolicySigners(rule *common.SignaturePolicy, identities []*mb.MSPPrincipal) (map[string]struct{}, error) {
+	if rule == nil {
+		return nil, errors.New("missing signature policy rule")
+	}
+
+	switch t := rule.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if t.SignedBy < 0 || int(t.SignedBy) >= len(identities) {
+			return nil, errors.Errorf("identity index %d out of range", t.SignedBy)
+		}
+		mspID, err := principalMSPID(identities[t.SignedBy])
+		if err != nil {
+			return nil, err
+		}
+		return map[string]struct{}{mspID: {}}, nil
+
+	case *common.SignaturePolicy_NOutOf_:
+		if t.NOutOf.N < 0 || int(t.NOutOf.N) > len(t.NOutOf.Rules) {
+			return nil, errors.Errorf("signature policy requires %d of %d rules", t.NOutOf.N, len(t.NOutOf.Rules))
+		}
+		signers := make(map[string]struct{})
+		for _, r := range t.NOutOf.Rules[:t.NOutOf.N] {
+			ruleSigners, err := signaturePolicySigners(r, identities)
+			if err != nil {
+				return nil, err
+			}
+			addAll(signers, ruleSigners)
+		}
+		return signers, nil
+
+	default:
+		return nil, errors.Errorf("unsupported signature policy type %T", rule.Type)
+	}
+}
+
+func principalMSPID(principal *mb.MSPPrincipal) (string, error) {
+	switch principal.PrincipalClassification {
+	case mb.MSPPrincipal_ROLE:
+		role := &mb.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			return "", errors.Wrap(err, "unmarshal of MSP role failed")
+		}
+		return role.MspIdentifier, nil
+	case mb.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &mb.OrganizationUnit{}
+		if err := proto.Unmarshal(principal.Principal, ou); err != nil {
+			return "", errors.Wrap(err, "unmarshal of organization unit failed")
+		}
+		return ou.MspIdentifier, nil
+	case mb.MSPPrincipal_IDENTITY:
+		sID := &mb.SerializedIdentity{}
+		if err := proto.Unmarshal(principal.Principal, sID); err != nil {
+			return "", errors.Wrap(err, "unmarshal of serialized identity failed")
+		}
+		return sID.Mspid, nil
+	default:
+		return "", errors.Errorf("unsupported principal classification %v", principal.PrincipalClassification)
+	}
+}
+
+func splitConfigPath(path string) []string {
+	var elements []string
+	for _, element := range strings.Split(path, "/") {
+		if element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+func addAll(target, source map[string]struct{}) {
+	for key := range source {
+		target[key] = struct{}{}
+	}
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -101,7 +101,7 @@ func (c *Client) Connect() error {
 	if c.maxConnAttempts == 1 {
 		return c.connect()
 	}
-	return c.connectWithRetry(c.maxConnAttempts, c.timeBetweenConnAttempts)
+	return c.connectWithRetry(c.maxConnAttempts, newBackoff(c.timeBetweenConnAttempts, 1, 0), nil)
 }
 
 // CloseIfIdle closes the connection to the event server only if there are no outstanding
@@ -234,13 +234,13 @@ func (c *Client) connect() error {
 	return err
 }
 
-func (c *Client) connectWithRetry(maxAttempts uint, timeBetweenAttempts time.Duration) error {
+// connectWithRetry attempts to connect until it succeeds or until maxAttempts is reached (if not zero),
+// waiting for the time given by the backoff between attempts. onRetry (if not nil) is invoked with the
+// number of the next attempt and the error of the failed attempt before each retry.
+func (c *Client) connectWithRetry(maxAttempts uint, backoff *backoff, onRetry func(attempt uint, err error)) error {
 	if c.Stopped() {
 		return errors.New("event client is closed")
 	}
-	if timeBetweenAttempts < time.Second {
-		timeBetweenAttempts = time.Second
-	}
 
 	var attempts uint
 	for {
@@ -252,7 +252,10 @@ func (c *Client) connectWithRetry(maxAttempts uint, timeBetweenAttempts time.Dur
 				logger.Warnf("maximum connect attempts exceeded")
 				return errors.New("maximum connect attempts exceeded")
 			}
-			time.Sleep(timeBetweenAttempts)
+			time.Sleep(backoff.next())
+			if onRetry != nil {
+				onRetry(attempts+1, err)
+			}
 		} else {
 			logger.Debugf("... connect succeeded.")
 			return nil
@@ -269,6 +272,35 @@ func (c *Client) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration
 	return c.Service.RegisterBlockEvent(filter...)
 }
 
+// RegisterBlockEventWithConnectionStatus registers for block events and for notifications of the status of
+// the connection to the event server (see Service.RegisterBlockEventWithConnectionStatus). A status is sent
+// when the client connects, before each reconnection attempt and when the client gives up reconnecting.
+// If the client is not authorized to receive block events then an error is returned.
+func (c *Client) RegisterBlockEventWithConnectionStatus(connStatusCh chan<- *esdispatcher.ConnectionStatusEvent, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	if !c.permitBlockEvents {
+		return nil, nil, errors.New("block events are not permitted")
+	}
+	return c.Service.RegisterBlockEventWithConnectionStatus(connStatusCh, filter...)
+}
+
+// RegisterChannelBlockEvent registers for the block events of the given channel (see Service.RegisterChannelBlockEvent).
+// If the client is not authorized to receive block events then an error is returned.
+func (c *Client) RegisterChannelBlockEvent(channelID string, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	if !c.permitBlockEvents {
+		return nil, nil, errors.New("block events are not permitted")
+	}
+	return c.Service.RegisterChannelBlockEvent(channelID, filter...)
+}
+
+// RegisterBlockEventFromBlock registers for block events starting at the given block (see Service.RegisterBlockEventFromBlock).
+// If the client is not authorized to receive block events then an error is returned.
+func (c *Client) RegisterBlockEventFromBlock(fromBlock uint64, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	if !c.permitBlockEvents {
+		return nil, nil, errors.New("block events are not permitted")
+	}
+	return c.Service.RegisterBlockEventFromBlock(fromBlock, filter...)
+}
+
 // registerConnectionEvent registers a connection event. The returned
 // ConnectionEvent channel will be called whenever the client clients or disconnects
 // from the event server
@@ -333,16 +365,18 @@ func (c *Client) monitorConnection() {
 
 		if event.Connected {
 			logger.Debugf("Event client has connected")
+			c.notifyConnectionStatus(esdispatcher.ConnectionStatusConnected, 0, nil)
 		} else if c.reconn {
 			logger.Warnf("Event client has disconnected. Details: %s", event.Err)
 			if c.setConnectionState(Connected, Disconnected) {
 				logger.Warnf("Attempting to reconnect...")
-				go c.reconnect()
+				go c.reconnect(event.Err)
 			} else if c.setConnectionState(Connecting, Disconnected) {
 				logger.Warnf("Reconnect already in progress. Setting state to disconnected")
 			}
 		} else {
 			logger.Debugf("Event client has disconnected. Terminating: %s", event.Err)
+			c.notifyConnectionStatus(esdispatcher.ConnectionStatusFailed, 0, event.Err)
 			go c.Close()
 			break
 		}
@@ -350,7 +384,9 @@ func (c *Client) monitorConnection() {
 	logger.Debugf("Exiting connection monitor")
 }
 
-func (c *Client) reconnect() {
+func (c *Client) reconnect(disconnectErr error) {
+	c.notifyConnectionStatus(esdispatcher.ConnectionStatusReconnecting, 1, disconnectErr)
+
 	logger.Debugf("Waiting %s before attempting to reconnect event client...", c.reconnInitialDelay)
 	time.Sleep(c.reconnInitialDelay)
 
@@ -364,12 +400,57 @@ func (c *Client) reconnect() {
 		}
 	}
 
-	if err := c.connectWithRetry(c.maxReconnAttempts, c.timeBetweenConnAttempts); err != nil {
+	backoff := newBackoff(c.timeBetweenConnAttempts, c.reconnBackoffFactor, c.maxTimeBetweenConnAttempts)
+	onRetry := func(attempt uint, err error) {
+		c.notifyConnectionStatus(esdispatcher.ConnectionStatusReconnecting, attempt, err)
+	}
+	if err := c.connectWithRetry(c.maxReconnAttempts, backoff, onRetry); err != nil {
 		logger.Warnf("Could not reconnect event client: %s. Closing.", err)
+		c.notifyConnectionStatus(esdispatcher.ConnectionStatusFailed, 0, err)
 		c.Close()
 	}
 }
 
+// notifyConnectionStatus sends the connection status to the dispatcher, which forwards it
+// to the registrations that requested connection status notifications
+func (c *Client) notifyConnectionStatus(status esdispatcher.ConnectionStatus, attempt uint, err error) {
+	if submitErr := c.Submit(esdispatcher.NewConnectionStatusEvent(status, attempt, err)); submitErr != nil {
+		logger.Debugf("Unable to submit connection status [%s]: %s", status, submitErr)
+	}
+}
+
+// backoff provides the time between connection attempts, which starts at the initial delay
+// (at least one second) and is multiplied by the factor after each attempt, up to the
+// maximum delay (if not zero)
+type backoff struct {
+	delay    time.Duration
+	factor   float64
+	maxDelay time.Duration
+}
+
+func newBackoff(initialDelay time.Duration, factor float64, maxDelay time.Duration) *backoff {
+	if initialDelay < time.Second {
+		initialDelay = time.Second
+	}
+	if factor < 1 {
+		factor = 1
+	}
+	if maxDelay > 0 && initialDelay > maxDelay {
+		initialDelay = maxDelay
+	}
+	return &backoff{delay: initialDelay, factor: factor, maxDelay: maxDelay}
+}
+
+// next returns the time to wait before the next attempt
+func (b *backoff) next() time.Duration {
+	delay := b.delay
+	b.delay = time.Duration(float64(b.delay) * b.factor)
+	if b.maxDelay > 0 && b.delay > b.maxDelay {
+		b.delay = b.maxDelay
+	}
+	return delay
+}
+
 func (c *Client) closeConnectEventChan() {
 	c.Lock()
 	defer c.Unlock()
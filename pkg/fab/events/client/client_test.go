@@ -18,6 +18,7 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/options"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/api"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/client/dispatcher"
@@ -29,6 +30,8 @@ import (
 	mspmocks "github.com/hyperledger/fabric-sdk-go/pkg/msp/test/mockmsp"
 	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
 	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 )
 
@@ -283,6 +286,178 @@ func TestBlockEvents(t *testing.T) {
 	}
 }
 
+func TestHealthSnapshot(t *testing.T) {
+	channelID := "mychannel"
+	ctx := fabmocks.NewMockContextWithCustomDiscovery(
+		mspmocks.NewMockSigningIdentity("user1", "Org1MSP"),
+		clientmocks.NewDiscoveryProvider(peer1, peer2),
+	)
+	eventClient, _, err := newClientWithMockConn(
+		ctx,
+		fabmocks.NewMockChannelCfg(channelID),
+		clientProvider,
+		mockconn.WithLedger(servicemocks.NewMockLedger(servicemocks.BlockEventFactory)),
+	)
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	if err := eventClient.Connect(); err != nil {
+		t.Fatalf("error connecting channel event client: %s", err)
+	}
+	defer eventClient.Close()
+
+	registration, _, err := eventClient.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	defer eventClient.Unregister(registration)
+
+	payload, err := proto.Marshal(&cb.BlockchainInfo{Height: 10})
+	if err != nil {
+		t.Fatalf("error marshalling blockchain info: %s", err)
+	}
+	target1 := &fabmocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Payload: payload, Status: 200}
+	payload, err = proto.Marshal(&cb.BlockchainInfo{Height: 12})
+	if err != nil {
+		t.Fatalf("error marshalling blockchain info: %s", err)
+	}
+	target2 := &fabmocks.MockPeer{MockName: "Peer2", MockURL: "http://peer2.com", Payload: payload, Status: 200}
+
+	reqCtx, cancel := contextImpl.NewRequest(ctx, contextImpl.WithTimeout(10*time.Second))
+	defer cancel()
+
+	health, err := eventClient.HealthSnapshot(reqCtx, []fab.ProposalProcessor{target1, target2}, &healthVerifier{})
+	if err != nil {
+		t.Fatalf("error getting health snapshot: %s", err)
+	}
+	if health.ConnectionState != Connected {
+		t.Fatalf("expecting connection state %s but got %s", Connected, health.ConnectionState)
+	}
+	if health.Registrations.NumBlockRegistrations != 1 {
+		t.Fatalf("expecting 1 block registration but got %d", health.Registrations.NumBlockRegistrations)
+	}
+	if health.Height != 12 {
+		t.Fatalf("expecting height 12 but got %d", health.Height)
+	}
+	if health.Endorser != target2.URL() {
+		t.Fatalf("expecting endorser %s but got %s", target2.URL(), health.Endorser)
+	}
+
+	target1.Error = errors.New("peer unavailable")
+	target2.Error = errors.New("peer unavailable")
+	health, err = eventClient.HealthSnapshot(reqCtx, []fab.ProposalProcessor{target1, target2}, &healthVerifier{})
+	if err == nil {
+		t.Fatalf("expecting error when ledger probe fails")
+	}
+	if health == nil || health.ConnectionState != Connected {
+		t.Fatalf("expecting partial health snapshot when ledger probe fails")
+	}
+}
+
+type healthVerifier struct{}
+
+func (v *healthVerifier) Verify(response *fab.TransactionProposalResponse) error {
+	return nil
+}
+
+func (v *healthVerifier) Match(response []*fab.TransactionProposalResponse) error {
+	return nil
+}
+
+func TestConfirmedTxStatusEvent(t *testing.T) {
+	channelID := "mychannel"
+	ctx := fabmocks.NewMockContextWithCustomDiscovery(
+		mspmocks.NewMockSigningIdentity("user1", "Org1MSP"),
+		clientmocks.NewDiscoveryProvider(peer1, peer2),
+	)
+	eventClient, conn, err := newClientWithMockConn(
+		ctx,
+		fabmocks.NewMockChannelCfg(channelID),
+		clientProvider,
+		mockconn.WithLedger(servicemocks.NewMockLedger(servicemocks.BlockEventFactory)),
+	)
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	if err := eventClient.Connect(); err != nil {
+		t.Fatalf("error connecting channel event client: %s", err)
+	}
+	defer eventClient.Close()
+
+	payload, err := proto.Marshal(&pb.ProcessedTransaction{ValidationCode: int32(pb.TxValidationCode_VALID)})
+	if err != nil {
+		t.Fatalf("error marshalling processed transaction: %s", err)
+	}
+	target := &fabmocks.MockPeer{MockName: "Peer1", MockURL: "http://peer1.com", Payload: payload, Status: 200}
+
+	confirmation := &TxConfirmation{
+		Context:  ctx,
+		Targets:  []fab.ProposalProcessor{target},
+		Verifier: &healthVerifier{},
+		Timeout:  5 * time.Second,
+	}
+
+	if _, _, err := eventClient.RegisterConfirmedTxStatusEvent("txid", &TxConfirmation{Context: ctx}); err == nil {
+		t.Fatalf("expecting error registering without targets")
+	}
+
+	checkConfirmed := func(txID string, txCode pb.TxValidationCode, expectConfirmed bool) {
+		reg, eventch, err := eventClient.RegisterConfirmedTxStatusEvent(txID, confirmation)
+		if err != nil {
+			t.Fatalf("error registering for confirmed TxStatus events: %s", err)
+		}
+		defer eventClient.Unregister(reg)
+
+		conn.Ledger().NewBlock(channelID,
+			servicemocks.NewTransaction(txID, txCode, cb.HeaderType_ENDORSER_TRANSACTION),
+		)
+
+		select {
+		case event, ok := <-eventch:
+			if !ok {
+				t.Fatalf("unexpected closed channel")
+			}
+			if event.Err != nil {
+				t.Fatalf("unexpected confirmation error: %s", event.Err)
+			}
+			if event.TxID != txID || event.TxValidationCode != txCode {
+				t.Fatalf("unexpected event: %#v", event.TxStatusEvent)
+			}
+			if event.Confirmed != expectConfirmed {
+				t.Fatalf("expecting confirmed to be %t for TxID [%s]", expectConfirmed, txID)
+			}
+			if len(event.LedgerValidationCodes) != 1 || event.LedgerValidationCodes[0] != pb.TxValidationCode_VALID {
+				t.Fatalf("unexpected ledger validation codes: %v", event.LedgerValidationCodes)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for confirmed TxStatus event")
+		}
+	}
+
+	checkConfirmed("txid1", pb.TxValidationCode_VALID, true)
+	checkConfirmed("txid2", pb.TxValidationCode_MVCC_READ_CONFLICT, false)
+
+	target.Error = errors.New("peer unavailable")
+	reg, eventch, err := eventClient.RegisterConfirmedTxStatusEvent("txid3", confirmation)
+	if err != nil {
+		t.Fatalf("error registering for confirmed TxStatus events: %s", err)
+	}
+	defer eventClient.Unregister(reg)
+
+	conn.Ledger().NewBlock(channelID,
+		servicemocks.NewTransaction("txid3", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION),
+	)
+
+	select {
+	case event := <-eventch:
+		if event.Err == nil || event.Confirmed {
+			t.Fatalf("expecting confirmation error when the ledger query fails")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for confirmed TxStatus event")
+	}
+}
+
 func TestFilteredBlockEvents(t *testing.T) {
 	channelID := "mychannel"
 	eventClient, conn, err := newClientWithMockConn(
@@ -680,6 +855,64 @@ func TestReconnect(t *testing.T) {
 	})
 }
 
+// TestReconnectConnectionStatus tests that the connection status is sent to block registrations
+// that requested it when the connection is lost and re-established (or not)
+func TestReconnectConnectionStatus(t *testing.T) {
+	// (1) Connect
+	//     -> should succeed to connect on the first attempt
+	// (2) Disconnect
+	//     -> should fail to reconnect on the first attempt but succeed on the second attempt
+	t.Run("Reconnected", func(t *testing.T) {
+		t.Parallel()
+		testReconnectConnectionStatus(t, 2,
+			mockconn.NewConnectResults(
+				mockconn.NewConnectResult(mockconn.FirstAttempt, mockconn.SucceedResult),
+				mockconn.NewConnectResult(mockconn.ThirdAttempt, mockconn.SucceedResult),
+			),
+			esdispatcher.ConnectionStatusReconnecting, esdispatcher.ConnectionStatusReconnecting, esdispatcher.ConnectionStatusConnected,
+		)
+	})
+
+	// (1) Connect
+	//     -> should succeed to connect on the first attempt
+	// (2) Disconnect
+	//     -> should fail to reconnect after one attempt and then close
+	t.Run("Failed", func(t *testing.T) {
+		t.Parallel()
+		testReconnectConnectionStatus(t, 1,
+			mockconn.NewConnectResults(
+				mockconn.NewConnectResult(mockconn.FirstAttempt, mockconn.SucceedResult),
+			),
+			esdispatcher.ConnectionStatusReconnecting, esdispatcher.ConnectionStatusFailed,
+		)
+	})
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 2, 5*time.Second)
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := b.next(); delay != expected {
+			t.Fatalf("Expecting delay %s but got %s", expected, delay)
+		}
+	}
+
+	// The delay is at least one second and is constant by default
+	b = newBackoff(time.Millisecond, 1, 0)
+	for i := 0; i < 3; i++ {
+		if delay := b.next(); delay != time.Second {
+			t.Fatalf("Expecting delay %s but got %s", time.Second, delay)
+		}
+	}
+
+	// The initial delay is capped by the max delay as well
+	b = newBackoff(10*time.Second, 2, 5*time.Second)
+	for i := 0; i < 3; i++ {
+		if delay := b.next(); delay != 5*time.Second {
+			t.Fatalf("Expecting delay %s but got %s", 5*time.Second, delay)
+		}
+	}
+}
+
 // TestReconnectRegistration tests the ability of the Channel Event Client to
 // re-establish the existing registrations after reconnecting.
 func TestReconnectRegistration(t *testing.T) {
@@ -1048,6 +1281,68 @@ func testReconnect(t *testing.T, reconnect bool, maxReconnectAttempts uint, expe
 	}
 }
 
+func testReconnectConnectionStatus(t *testing.T, maxReconnectAttempts uint, connAttemptResult mockconn.ConnectAttemptResults, expectedStatuses ...esdispatcher.ConnectionStatus) {
+	cp := mockconn.NewProviderFactory()
+
+	ledger := servicemocks.NewMockLedger(servicemocks.BlockEventFactory)
+
+	eventClient, _, err := newClientWithMockConnAndOpts(
+		fabmocks.NewMockContextWithCustomDiscovery(
+			mspmocks.NewMockSigningIdentity("user1", "Org1MSP"),
+			clientmocks.NewDiscoveryProvider(peer1, peer2),
+		),
+		fabmocks.NewMockChannelCfg("mychannel"),
+		cp.FlakeyProvider(connAttemptResult, mockconn.WithLedger(ledger)),
+		clientProvider,
+		[]options.Opt{
+			esdispatcher.WithEventConsumerTimeout(3 * time.Second),
+			WithMaxConnectAttempts(1),
+			WithReconnectInitialDelay(0),
+			WithMaxReconnectAttempts(maxReconnectAttempts),
+			WithTimeBetweenConnectAttempts(time.Millisecond),
+			WithReconnectBackoff(2, 2*time.Second),
+			WithResponseTimeout(2 * time.Second),
+		},
+	)
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	if err := eventClient.Connect(); err != nil {
+		t.Fatalf("error connecting channel event client: %s", err)
+	}
+	defer eventClient.Close()
+
+	statusch := make(chan *esdispatcher.ConnectionStatusEvent, 10)
+	if _, _, err := eventClient.RegisterBlockEventWithConnectionStatus(statusch); err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+
+	// Discard the status of the initial connection (if any)
+	time.Sleep(500 * time.Millisecond)
+	for len(statusch) > 0 {
+		<-statusch
+	}
+
+	cp.Connection().ProduceEvent(dispatcher.NewDisconnectedEvent(errors.New("testing reconnect handling")))
+
+	for i, expected := range expectedStatuses {
+		select {
+		case event := <-statusch:
+			if event.Status != expected {
+				t.Fatalf("Expecting connection status [%s] but got [%s]", expected, event.Status)
+			}
+			if expected == esdispatcher.ConnectionStatusReconnecting && event.Attempt != uint(i+1) {
+				t.Fatalf("Expecting reconnection attempt %d but got %d", i+1, event.Attempt)
+			}
+			if expected != esdispatcher.ConnectionStatusConnected && event.Err == nil {
+				t.Fatalf("Expecting error for connection status [%s]", event.Status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for connection status [%s]", expected)
+		}
+	}
+}
+
 // testReconnectRegistration tests the scenario when an events client is registered to receive events and the connection to the
 // event service is lost. After the connection is re-established, events should once again be received without the caller having to
 // re-register for those events.
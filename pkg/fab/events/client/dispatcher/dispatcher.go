@@ -44,6 +44,11 @@ func New(context context.Client, chConfig fab.ChannelCfg, connectionProvider api
 	params := defaultParams()
 	options.Apply(params, opts)
 
+	if chConfig != nil {
+		// The channel ID option is prepended so that it may be overridden
+		opts = append([]options.Opt{esdispatcher.WithChannelID(chConfig.ID())}, opts...)
+	}
+
 	return &Dispatcher{
 		Dispatcher:         *esdispatcher.New(opts...),
 		params:             *params,
@@ -140,6 +140,13 @@ func TestConnectNoPeers(t *testing.T) {
 		t.Fatalf("Expecting error connecting with no peers but got none")
 	}
 
+	// The registrations are reported for the dispatcher's channel
+	regInfoCh := make(chan *esdispatcher.RegistrationInfo, 1)
+	dispatcherEventch <- esdispatcher.NewRegistrationInfoEvent(regInfoCh)
+	if regInfo := <-regInfoCh; regInfo.Channels[channelID] == nil {
+		t.Fatalf("expecting registration info for channel [%s]", channelID)
+	}
+
 	// Stop the dispatcher
 	stopResp := make(chan error)
 	dispatcherEventch <- esdispatcher.NewStopEvent(stopResp)
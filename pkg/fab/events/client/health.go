@@ -0,0 +1,99 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	reqContext "context"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/channel"
+	esdispatcher "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/dispatcher"
+	"github.com/pkg/errors"
+)
+
+// Health contains a snapshot of the event client's state along with
+// the current height of the channel's ledger
+type Health struct {
+	// ConnectionState is the state of the connection to the event server
+	ConnectionState ConnectionState
+	// LastBlockNum is the number of the last block for which an event was received
+	// (math.MaxUint64 if no block has been received yet)
+	LastBlockNum uint64
+	// Registrations contains the registration counts at the time of the snapshot
+	Registrations *esdispatcher.RegistrationInfo
+	// Height is the maximum ledger height reported by the probed targets
+	Height uint64
+	// Endorser is the target that reported Height
+	Endorser string
+}
+
+// channelConfigProvider is implemented by dispatchers that are bound to a channel
+type channelConfigProvider interface {
+	ChannelConfig() fab.ChannelCfg
+}
+
+// HealthSnapshot returns the connection state, last block number and registration counts
+// of the event client along with the channel height obtained from a QueryInfo probe of the
+// given targets. The probe is bounded by the health probe timeout (see WithHealthProbeTimeout).
+// If the probe fails then the snapshot is still returned along with the error.
+func (c *Client) HealthSnapshot(reqCtx reqContext.Context, targets []fab.ProposalProcessor, verifier channel.ResponseVerifier) (*Health, error) {
+	regInfo, err := c.registrationInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	health := &Health{
+		ConnectionState: c.ConnectionState(),
+		LastBlockNum:    c.Dispatcher().LastBlockNum(),
+		Registrations:   regInfo,
+	}
+
+	cp, ok := c.Dispatcher().(channelConfigProvider)
+	if !ok {
+		return health, errors.New("unable to determine channel from event dispatcher")
+	}
+
+	ledger, err := channel.NewLedger(cp.ChannelConfig().ID())
+	if err != nil {
+		return health, errors.WithMessage(err, "ledger client creation failed")
+	}
+
+	probeCtx, cancel := reqContext.WithTimeout(reqCtx, c.healthProbeTimeout)
+	defer cancel()
+
+	responses, err := ledger.QueryInfo(probeCtx, targets, verifier)
+	if len(responses) == 0 {
+		if err == nil {
+			err = errors.New("no responses from targets")
+		}
+		return health, errors.WithMessage(err, "ledger probe failed")
+	}
+
+	for _, r := range responses {
+		if r.BCI.Height > health.Height {
+			health.Height = r.BCI.Height
+			health.Endorser = r.Endorser
+		}
+	}
+
+	return health, nil
+}
+
+func (c *Client) registrationInfo() (*esdispatcher.RegistrationInfo, error) {
+	regInfoCh := make(chan *esdispatcher.RegistrationInfo, 1)
+	if err := c.Submit(esdispatcher.NewRegistrationInfoEvent(regInfoCh)); err != nil {
+		return nil, errors.WithMessage(err, "error requesting registration info")
+	}
+
+	select {
+	case regInfo := <-regInfoCh:
+		return regInfo, nil
+	case <-time.After(c.respTimeout):
+		return nil, errors.New("timeout waiting for registration info")
+	}
+}
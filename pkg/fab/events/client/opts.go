@@ -20,8 +20,13 @@ type params struct {
 	maxReconnAttempts       uint
 	reconnInitialDelay      time.Duration
 	timeBetweenConnAttempts time.Duration
-	connEventCh             chan *dispatcher.ConnectionEvent
-	respTimeout             time.Duration
+	// reconnBackoffFactor multiplies the time between reconnection attempts after each failed attempt
+	reconnBackoffFactor float64
+	// maxTimeBetweenConnAttempts caps the time between reconnection attempts (no cap if zero)
+	maxTimeBetweenConnAttempts time.Duration
+	connEventCh                chan *dispatcher.ConnectionEvent
+	respTimeout                time.Duration
+	healthProbeTimeout         time.Duration
 }
 
 func defaultParams() *params {
@@ -32,7 +37,9 @@ func defaultParams() *params {
 		maxReconnAttempts:       0, // Try forever
 		reconnInitialDelay:      0,
 		timeBetweenConnAttempts: 5 * time.Second,
+		reconnBackoffFactor:     1,
 		respTimeout:             5 * time.Second,
+		healthProbeTimeout:      2 * time.Second,
 	}
 }
 
@@ -95,6 +102,18 @@ func WithTimeBetweenConnectAttempts(value time.Duration) options.Opt {
 	}
 }
 
+// WithReconnectBackoff sets an exponential backoff for reconnection attempts: the time between reconnection
+// attempts starts at the time between connection attempts (see WithTimeBetweenConnectAttempts) and is multiplied
+// by factor after each failed attempt, up to maxTimeBetweenAttempts (if not zero). A factor of 1 (the default)
+// results in a constant time between attempts.
+func WithReconnectBackoff(factor float64, maxTimeBetweenAttempts time.Duration) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(reconnectBackoffSetter); ok {
+			setter.SetReconnectBackoff(factor, maxTimeBetweenAttempts)
+		}
+	}
+}
+
 // WithResponseTimeout sets the timeout when waiting for a response from the event server
 func WithResponseTimeout(value time.Duration) options.Opt {
 	return func(p options.Params) {
@@ -104,6 +123,16 @@ func WithResponseTimeout(value time.Duration) options.Opt {
 	}
 }
 
+// WithHealthProbeTimeout sets the timeout for the ledger probe issued by HealthSnapshot.
+// The probe is bounded by this timeout even if the request context allows more time.
+func WithHealthProbeTimeout(value time.Duration) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(healthProbeTimeoutSetter); ok {
+			setter.SetHealthProbeTimeout(value)
+		}
+	}
+}
+
 func (p *params) SetEventConsumerBufferSize(value uint) {
 	p.eventConsumerBufferSize = value
 }
@@ -133,6 +162,12 @@ func (p *params) SetTimeBetweenConnectAttempts(value time.Duration) {
 	p.timeBetweenConnAttempts = value
 }
 
+func (p *params) SetReconnectBackoff(factor float64, maxTimeBetweenAttempts time.Duration) {
+	logger.Debugf("ReconnectBackoff - factor: %f, max time between attempts: %s", factor, maxTimeBetweenAttempts)
+	p.reconnBackoffFactor = factor
+	p.maxTimeBetweenConnAttempts = maxTimeBetweenAttempts
+}
+
 func (p *params) SetConnectEventCh(value chan *dispatcher.ConnectionEvent) {
 	logger.Debugf("ConnectEventCh: %#v", value)
 	p.connEventCh = value
@@ -143,6 +178,11 @@ func (p *params) SetResponseTimeout(value time.Duration) {
 	p.respTimeout = value
 }
 
+func (p *params) SetHealthProbeTimeout(value time.Duration) {
+	logger.Debugf("HealthProbeTimeout: %s", value)
+	p.healthProbeTimeout = value
+}
+
 type reconnectSetter interface {
 	SetReconnect(value bool)
 }
@@ -167,6 +207,14 @@ type timeBetweenConnectAttemptsSetter interface {
 	SetTimeBetweenConnectAttempts(value time.Duration)
 }
 
+type reconnectBackoffSetter interface {
+	SetReconnectBackoff(factor float64, maxTimeBetweenAttempts time.Duration)
+}
+
 type responseTimeoutSetter interface {
 	SetResponseTimeout(value time.Duration)
 }
+
+type healthProbeTimeoutSetter interface {
+	SetHealthProbeTimeout(value time.Duration)
+}
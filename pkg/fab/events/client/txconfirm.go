@@ -0,0 +1,124 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	contextImpl "github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/channel"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+const defaultTxConfirmationTimeout = 5 * time.Second
+
+// TxConfirmation contains the settings for confirming transaction status events against the ledger
+type TxConfirmation struct {
+	// Context is the client context used to query the ledger
+	Context context.Client
+	// Targets are the peers that are queried for the transaction
+	Targets []fab.ProposalProcessor
+	// Verifier verifies the query responses (optional)
+	Verifier channel.ResponseVerifier
+	// Timeout bounds the ledger query (defaults to 5s)
+	Timeout time.Duration
+}
+
+// ConfirmedTxStatusEvent contains a transaction status event along with the result
+// of confirming the validation code against the ledger
+type ConfirmedTxStatusEvent struct {
+	*fab.TxStatusEvent
+	// Confirmed is true if all of the targets that returned the transaction agree with the validation code of the event
+	Confirmed bool
+	// LedgerValidationCodes contains the validation codes returned by the targets that returned the transaction
+	LedgerValidationCodes []pb.TxValidationCode
+	// Err is set if the transaction could not be retrieved from any of the targets
+	Err error
+}
+
+// RegisterConfirmedTxStatusEvent registers for transaction status events and, upon receiving an event,
+// queries the ledger for the transaction in order to confirm that its validation code matches that of the
+// event. The event is delivered along with the result of the confirmation; a discrepancy between the event
+// and the ledger is flagged by Confirmed being false. If confirmation is nil then events are delivered
+// without being confirmed.
+func (c *Client) RegisterConfirmedTxStatusEvent(txID string, confirmation *TxConfirmation) (fab.Registration, <-chan *ConfirmedTxStatusEvent, error) {
+	var ledger *channel.Ledger
+	if confirmation != nil {
+		if confirmation.Context == nil {
+			return nil, nil, errors.New("context is required for transaction confirmation")
+		}
+		if len(confirmation.Targets) == 0 {
+			return nil, nil, errors.New("targets are required for transaction confirmation")
+		}
+
+		cp, ok := c.Dispatcher().(channelConfigProvider)
+		if !ok {
+			return nil, nil, errors.New("unable to determine channel from event dispatcher")
+		}
+
+		var err error
+		ledger, err = channel.NewLedger(cp.ChannelConfig().ID())
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "ledger client creation failed")
+		}
+	}
+
+	reg, eventch, err := c.RegisterTxStatusEvent(txID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	confirmedch := make(chan *ConfirmedTxStatusEvent, c.eventConsumerBufferSize)
+	go func() {
+		defer close(confirmedch)
+		for event := range eventch {
+			if confirmation == nil {
+				confirmedch <- &ConfirmedTxStatusEvent{TxStatusEvent: event}
+				continue
+			}
+			confirmedch <- confirmTxStatus(ledger, confirmation, event)
+		}
+	}()
+
+	return reg, confirmedch, nil
+}
+
+func confirmTxStatus(ledger *channel.Ledger, confirmation *TxConfirmation, event *fab.TxStatusEvent) *ConfirmedTxStatusEvent {
+	timeout := confirmation.Timeout
+	if timeout <= 0 {
+		timeout = defaultTxConfirmationTimeout
+	}
+
+	reqCtx, cancel := contextImpl.NewRequest(confirmation.Context, contextImpl.WithTimeout(timeout))
+	defer cancel()
+
+	confirmed := &ConfirmedTxStatusEvent{TxStatusEvent: event}
+
+	responses, err := ledger.QueryTransaction(reqCtx, fab.TransactionID(event.TxID), confirmation.Targets, confirmation.Verifier)
+	if len(responses) == 0 {
+		if err == nil {
+			err = errors.New("no responses from targets")
+		}
+		confirmed.Err = errors.WithMessage(err, "query for transaction failed")
+		return confirmed
+	}
+
+	confirmed.Confirmed = true
+	for _, r := range responses {
+		code := pb.TxValidationCode(r.ValidationCode)
+		confirmed.LedgerValidationCodes = append(confirmed.LedgerValidationCodes, code)
+		if code != event.TxValidationCode {
+			logger.Warnf("Ledger validation code [%s] of TxID [%s] doesn't match the code of the event [%s]", code, event.TxID, event.TxValidationCode)
+			confirmed.Confirmed = false
+		}
+	}
+
+	return confirmed
+}
@@ -110,4 +110,6 @@ func (ed *Dispatcher) handleDeliverResponseStatus(evt *pb.DeliverResponse_Status
 func (ed *Dispatcher) registerHandlers() {
 	ed.RegisterHandler(&SeekEvent{}, ed.handleSeekEvent)
 	ed.RegisterHandler(&pb.DeliverResponse{}, ed.handleDeliverResponse)
+
+	ed.RegisterDrainableEvent(&pb.DeliverResponse{})
 }
@@ -192,4 +192,6 @@ func (ed *Dispatcher) registerHandlers() {
 	ed.RegisterHandler(&RegisterInterestsEvent{}, ed.handleRegInterestsEvent)
 	ed.RegisterHandler(&UnregisterInterestsEvent{}, ed.handleUnregInterestsEvent)
 	ed.RegisterHandler(&pb.Event{}, ed.handleEvent)
+
+	ed.RegisterDrainableEvent(&pb.Event{})
 }
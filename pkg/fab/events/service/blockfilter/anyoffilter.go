@@ -0,0 +1,39 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package blockfilter
+
+import (
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+)
+
+// AnyOf returns a block filter that accepts a block if any of the given filters accepts it.
+// Nil filters are ignored. If no filters are given then the returned filter accepts any block.
+func AnyOf(filters ...fab.BlockFilter) fab.BlockFilter {
+	var nonNilFilters []fab.BlockFilter
+	for _, filter := range filters {
+		if filter != nil {
+			nonNilFilters = append(nonNilFilters, filter)
+		}
+	}
+
+	switch len(nonNilFilters) {
+	case 0:
+		return AcceptAny
+	case 1:
+		return nonNilFilters[0]
+	}
+
+	return func(block *cb.Block) bool {
+		for _, filter := range nonNilFilters {
+			if filter(block) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,26 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/protoutil"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+)
+
+// computeBlockHash returns the hash of the block header if the block hash option is enabled (see WithBlockHash)
+// or nil otherwise. The block is still delivered if its hash can't be computed, without a hash.
+func (ed *Dispatcher) computeBlockHash(block *cb.Block) []byte {
+	if !ed.blockHash {
+		return nil
+	}
+	hash, err := protoutil.BlockHeaderHash(block.Header)
+	if err != nil {
+		logger.Warnf("Unable to compute the hash of block #%d: %s", block.Header.GetNumber(), err)
+		return nil
+	}
+	return hash
+}
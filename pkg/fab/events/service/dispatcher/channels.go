@@ -0,0 +1,75 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// A dispatcher may dispatch the events of multiple channels, in which case the registrations are scoped
+// to a channel by setting the ChannelID of the registration (for example, BlockReg.ChannelID) before it's
+// registered. Registrations without a channel ID are registered for the default channel of the dispatcher
+// (see WithChannelID). Channel-scoped registrations require the default channel to be set; if it isn't
+// set then the dispatcher dispatches the events of a single channel to all registrations.
+//
+// The last block number is tracked per channel: LastBlockNum returns the number of the last block of
+// the default channel.
+
+// resolveChannel returns the channel of a registration or event with the given channel ID (the default
+// channel if the channel ID is empty)
+func (ed *Dispatcher) resolveChannel(channelID string) string {
+	if channelID == "" {
+		return ed.channelID
+	}
+	return channelID
+}
+
+// isDefaultChannel returns true if the given channel is the default channel of the dispatcher
+// (or if no default channel is set, in which case all events belong to a single channel)
+func (ed *Dispatcher) isDefaultChannel(channelID string) bool {
+	return ed.channelID == "" || ed.resolveChannel(channelID) == ed.channelID
+}
+
+// inChannel returns true if an event of the given channel is dispatched to a registration for regChannelID
+func (ed *Dispatcher) inChannel(regChannelID, channelID string) bool {
+	if ed.channelID == "" {
+		return true
+	}
+	return ed.resolveChannel(regChannelID) == ed.resolveChannel(channelID)
+}
+
+// checkChannel returns an error if a registration can't be scoped to the given channel
+func (ed *Dispatcher) checkChannel(regChannelID string) error {
+	if regChannelID != "" && ed.channelID == "" {
+		return errors.Errorf("unable to register for events of channel [%s] since the default channel of the dispatcher isn't set", regChannelID)
+	}
+	return nil
+}
+
+// lastBlockNumOf returns the number of the last block that was dispatched for the given channel
+// (math.MaxUint64 if no block has been dispatched)
+func (ed *Dispatcher) lastBlockNumOf(channelID string) uint64 {
+	if ed.isDefaultChannel(channelID) {
+		return ed.LastBlockNum()
+	}
+	if blockNum, ok := ed.channelBlockNums[channelID]; ok {
+		return blockNum
+	}
+	return math.MaxUint64
+}
+
+// setLastBlockNum sets the number of the last block that was dispatched for the given channel
+func (ed *Dispatcher) setLastBlockNum(channelID string, blockNum uint64) {
+	if ed.isDefaultChannel(channelID) {
+		atomic.StoreUint64(&ed.lastBlockNum, blockNum)
+		return
+	}
+	ed.channelBlockNums[channelID] = blockNum
+}
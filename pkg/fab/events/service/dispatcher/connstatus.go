@@ -0,0 +1,77 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+// ConnectionStatus is the status of the connection to the event producer
+type ConnectionStatus int
+
+const (
+	// ConnectionStatusConnected indicates that the connection was established (or re-established)
+	ConnectionStatusConnected ConnectionStatus = iota
+	// ConnectionStatusReconnecting indicates that the connection was lost and that an attempt to reconnect is in progress
+	ConnectionStatusReconnecting
+	// ConnectionStatusFailed indicates that the connection was lost and won't be re-established, so no more
+	// events will be received
+	ConnectionStatusFailed
+)
+
+func (s ConnectionStatus) String() string {
+	switch s {
+	case ConnectionStatusConnected:
+		return "Connected"
+	case ConnectionStatusReconnecting:
+		return "Reconnecting"
+	case ConnectionStatusFailed:
+		return "Failed"
+	default:
+		return "undefined"
+	}
+}
+
+// ConnectionStatusEvent is sent to the dispatcher by the event client when the status of the connection to the
+// event producer changes. The dispatcher forwards the event to the block and filtered block registrations that
+// requested connection status notifications (see RegisterEvent.ConnStatusCh), which allows consumers to
+// distinguish between the absence of new blocks and the loss of the event stream.
+type ConnectionStatusEvent struct {
+	Status ConnectionStatus
+	// Attempt is the number of the reconnection attempt (ConnectionStatusReconnecting only)
+	Attempt uint
+	// Err is the error that caused the connection to be lost or the error of the last reconnection attempt
+	Err error
+}
+
+// NewConnectionStatusEvent creates a new ConnectionStatusEvent
+func NewConnectionStatusEvent(status ConnectionStatus, attempt uint, err error) *ConnectionStatusEvent {
+	return &ConnectionStatusEvent{Status: status, Attempt: attempt, Err: err}
+}
+
+// handleConnectionStatusEvent forwards the connection status to the registrations that requested it. The
+// status is dropped for a registration whose channel is full since the dispatcher mustn't be blocked while
+// the connection is being re-established.
+func (ed *Dispatcher) handleConnectionStatusEvent(e Event) {
+	event := e.(*ConnectionStatusEvent)
+
+	logger.Debugf("Connection status: %s, attempt: %d, error: %v", event.Status, event.Attempt, event.Err)
+
+	for _, reg := range ed.blockRegistrations {
+		sendConnectionStatus(reg.ConnStatusch, event)
+	}
+	for _, reg := range ed.filteredBlockRegistrations {
+		sendConnectionStatus(reg.ConnStatusch, event)
+	}
+}
+
+func sendConnectionStatus(statusch chan<- *ConnectionStatusEvent, event *ConnectionStatusEvent) {
+	if statusch == nil {
+		return
+	}
+	select {
+	case statusch <- event:
+	default:
+		logger.Warnf("Connection status channel is full. Dropping connection status: %s", event.Status)
+	}
+}
@@ -7,9 +7,12 @@ SPDX-License-Identifier: Apache-2.0
 package dispatcher
 
 import (
+	"fmt"
 	"math"
 	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -32,6 +35,9 @@ const (
 	dispatcherStateStopped
 )
 
+// defaultDrainTimeout is the maximum time spent delivering queued events when stopping in drain mode
+const defaultDrainTimeout = 5 * time.Second
+
 // Handler is the handler for a given event type.
 type Handler func(Event)
 
@@ -45,13 +51,21 @@ type HandlerRegistry map[reflect.Type]Handler
 type Dispatcher struct {
 	params
 	handlers                   map[reflect.Type]Handler
+	drainableTypes             map[reflect.Type]bool
 	eventch                    chan interface{}
 	blockRegistrations         []*BlockReg
 	filteredBlockRegistrations []*FilteredBlockReg
 	txRegistrations            map[string]*TxStatusReg
 	ccRegistrations            map[string]*ChaincodeReg
+	heartbeatRegistrations     []*HeartbeatReg
+	recentBlocks               []*recentBlock
 	state                      int32
 	lastBlockNum               uint64
+	channelBlockNums           map[string]uint64 // last block numbers of the channels other than the default channel
+	lastEventTime              time.Time
+	sequenceNum                uint64
+	deliveries                 deliveryCounters
+	drainDeadline              time.Time // set while draining; bounds each delivery (see drain)
 }
 
 // New creates a new Dispatcher.
@@ -62,13 +76,15 @@ func New(opts ...options.Opt) *Dispatcher {
 	options.Apply(params, opts)
 
 	return &Dispatcher{
-		params:          *params,
-		handlers:        make(map[reflect.Type]Handler),
-		eventch:         make(chan interface{}, params.eventConsumerBufferSize),
-		txRegistrations: make(map[string]*TxStatusReg),
-		ccRegistrations: make(map[string]*ChaincodeReg),
-		state:           dispatcherStateInitial,
-		lastBlockNum:    math.MaxUint64,
+		params:           *params,
+		handlers:         make(map[reflect.Type]Handler),
+		drainableTypes:   make(map[reflect.Type]bool),
+		eventch:          make(chan interface{}, params.eventConsumerBufferSize),
+		txRegistrations:  make(map[string]*TxStatusReg),
+		ccRegistrations:  make(map[string]*ChaincodeReg),
+		state:            dispatcherStateInitial,
+		lastBlockNum:     math.MaxUint64,
+		channelBlockNums: make(map[string]uint64),
 	}
 }
 
@@ -79,10 +95,24 @@ func (ed *Dispatcher) RegisterHandlers() {
 	ed.RegisterHandler(&RegisterBlockEvent{}, ed.handleRegisterBlockEvent)
 	ed.RegisterHandler(&RegisterFilteredBlockEvent{}, ed.handleRegisterFilteredBlockEvent)
 	ed.RegisterHandler(&UnregisterEvent{}, ed.handleUnregisterEvent)
+	ed.RegisterHandler(&BulkUnregisterEvent{}, ed.handleBulkUnregisterEvent)
 	ed.RegisterHandler(&StopEvent{}, ed.HandleStopEvent)
 	ed.RegisterHandler(&cb.Block{}, ed.handleBlockEvent)
 	ed.RegisterHandler(&pb.FilteredBlock{}, ed.handleFilteredBlockEvent)
+	ed.RegisterHandler(&fullBlockFetchedEvent{}, ed.handleFullBlockFetchedEvent)
+	ed.RegisterHandler(&replayBlocksFetchedEvent{}, ed.handleReplayBlocksFetchedEvent)
 	ed.RegisterHandler(&RegistrationInfoEvent{}, ed.handleRegistrationInfoEvent)
+	ed.RegisterHandler(&ChaincodeRegInfoEvent{}, ed.handleChaincodeRegInfoEvent)
+	ed.RegisterHandler(&ExportRegistrationsEvent{}, ed.handleExportRegistrationsEvent)
+	ed.RegisterHandler(&RestoreLastBlockNumEvent{}, ed.handleRestoreLastBlockNumEvent)
+	ed.RegisterHandler(&RegisterHeartbeatEvent{}, ed.handleRegisterHeartbeatEvent)
+	ed.RegisterHandler(&heartbeatTickEvent{}, ed.handleHeartbeatTickEvent)
+	ed.RegisterHandler(&txStatusExpiredEvent{}, ed.handleTxStatusExpiredEvent)
+	ed.RegisterHandler(&ConnectionStatusEvent{}, ed.handleConnectionStatusEvent)
+
+	// Register the events that are delivered when stopping in drain mode
+	ed.RegisterDrainableEvent(&cb.Block{})
+	ed.RegisterDrainableEvent(&pb.FilteredBlock{})
 }
 
 // EventCh returns the channel to which events may be posted
@@ -129,19 +159,19 @@ func (ed *Dispatcher) Start() error {
 	return nil
 }
 
-// LastBlockNum returns the block number of the last block for which an event was received.
+// LastBlockNum returns the block number of the last block (of the default channel) for which an event was received.
 func (ed *Dispatcher) LastBlockNum() uint64 {
 	return atomic.LoadUint64(&ed.lastBlockNum)
 }
 
-// updateLastBlockNum updates the value of lastBlockNum and
-// returns the updated value.
-func (ed *Dispatcher) updateLastBlockNum(blockNum uint64) error {
+// updateLastBlockNum updates the value of lastBlockNum (or the last block number of
+// the given channel if it isn't the default channel) and returns the updated value.
+func (ed *Dispatcher) updateLastBlockNum(channelID string, blockNum uint64) error {
 	// The Deliver Service shouldn't be sending blocks out of order.
 	// Log an error if we detect this happening.
-	lastBlockNum := atomic.LoadUint64(&ed.lastBlockNum)
+	lastBlockNum := ed.lastBlockNumOf(channelID)
 	if lastBlockNum == math.MaxUint64 || blockNum > lastBlockNum {
-		atomic.StoreUint64(&ed.lastBlockNum, blockNum)
+		ed.setLastBlockNum(channelID, blockNum)
 		return nil
 	}
 	return errors.Errorf("Expecting a block number greater than %d but received block number %d", lastBlockNum, lastBlockNum)
@@ -151,6 +181,7 @@ func (ed *Dispatcher) updateLastBlockNum(blockNum uint64) error {
 // The listener will receive a 'closed' event to indicate that the channel has been closed.
 func (ed *Dispatcher) clearBlockRegistrations() {
 	for _, reg := range ed.blockRegistrations {
+		ed.stopReplay(reg)
 		close(reg.Eventch)
 	}
 	ed.blockRegistrations = nil
@@ -161,6 +192,7 @@ func (ed *Dispatcher) clearBlockRegistrations() {
 func (ed *Dispatcher) clearFilteredBlockRegistrations() {
 	for _, reg := range ed.filteredBlockRegistrations {
 		close(reg.Eventch)
+		ed.stopFullBlocks(reg)
 	}
 	ed.filteredBlockRegistrations = nil
 }
@@ -168,13 +200,39 @@ func (ed *Dispatcher) clearFilteredBlockRegistrations() {
 // clearTxRegistrations removes all transaction registrations and closes the corresponding event channels.
 // The listener will receive a 'closed' event to indicate that the channel has been closed.
 func (ed *Dispatcher) clearTxRegistrations() {
-	for _, reg := range ed.txRegistrations {
-		logger.Debugf("Closing TX registration event channel for TxID [%s].", reg.TxID)
+	for _, reg := range ed.txStatusRegistrations() {
+		logger.Debugf("Closing TX registration event channel for TxID %v.", reg.txIDs())
+		ed.stopTxStatusTimer(reg)
 		close(reg.Eventch)
 	}
 	ed.txRegistrations = make(map[string]*TxStatusReg)
 }
 
+// txStatusRegistrations returns the transaction status registrations. (A registration for
+// multiple transactions is indexed by each of its pending transaction IDs in txRegistrations.)
+func (ed *Dispatcher) txStatusRegistrations() []*TxStatusReg {
+	var regs []*TxStatusReg
+	seen := make(map[*TxStatusReg]bool)
+	for _, reg := range ed.txRegistrations {
+		if !seen[reg] {
+			seen[reg] = true
+			regs = append(regs, reg)
+		}
+	}
+	return regs
+}
+
+// removeTxStatusRegistration removes the transaction status registration and closes its event channel
+func (ed *Dispatcher) removeTxStatusRegistration(reg *TxStatusReg) {
+	for _, txID := range reg.txIDs() {
+		if ed.txRegistrations[txID] == reg {
+			delete(ed.txRegistrations, txID)
+		}
+	}
+	ed.stopTxStatusTimer(reg)
+	close(reg.Eventch)
+}
+
 // clearChaincodeRegistrations removes all chaincode registrations and closes the corresponding event channels.
 // The listener will receive a 'closed' event to indicate that the channel has been closed.
 func (ed *Dispatcher) clearChaincodeRegistrations() {
@@ -196,56 +254,209 @@ func (ed *Dispatcher) HandleStopEvent(e Event) {
 		return
 	}
 
+	if event.Drain {
+		ed.drain(event.DrainTimeout)
+	}
+
+	if event.StatsCh != nil {
+		event.StatsCh <- ed.stopStats()
+	}
+
+	if event.RegInfoCh != nil {
+		regInfo := ed.registrationInfo()
+		if regInfo.TotalRegistrations > 0 {
+			logger.Warnf("Stopping dispatcher with %d active registration(s)", regInfo.TotalRegistrations)
+		}
+		event.RegInfoCh <- regInfo
+	}
+
 	// Remove all registrations and close the associated event channels
 	// so that the client is notified that the registration has been removed
 	ed.clearBlockRegistrations()
 	ed.clearFilteredBlockRegistrations()
 	ed.clearTxRegistrations()
 	ed.clearChaincodeRegistrations()
+	ed.clearHeartbeatRegistrations()
 
 	event.ErrCh <- nil
 }
 
+// drain handles the drainable events that are queued for the dispatcher so that they're delivered to the registrations.
+// Other events (such as registration requests) are dropped. Draining stops once the given timeout has elapsed, and
+// each delivery is bounded by the remaining time so that a blocked consumer can't prevent the dispatcher from stopping.
+func (ed *Dispatcher) drain(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	deadline := ed.clock.Now().Add(timeout)
+	ed.drainDeadline = deadline
+	defer func() { ed.drainDeadline = time.Time{} }()
+
+	pending := len(ed.eventch)
+	logger.Debugf("Draining %d pending event(s)...", pending)
+
+	for i := 0; i < pending; i++ {
+		if ed.clock.Now().After(deadline) {
+			logger.Warnf("Timed out after %s draining events - %d pending event(s) dropped", timeout, pending-i)
+			return
+		}
+
+		var e interface{}
+		select {
+		case e = <-ed.eventch:
+		default:
+			return
+		}
+
+		t := reflect.TypeOf(e)
+		if !ed.drainableTypes[t] {
+			logger.Debugf("Dropping event while draining: %v", t)
+			continue
+		}
+
+		if handler, ok := ed.handlers[t]; ok {
+			logger.Debugf("Dispatching event while draining: %v", t)
+			handler(e)
+		}
+	}
+}
+
+// stopStats returns the number of pending and queued events and active registrations
+func (ed *Dispatcher) stopStats() *StopStats {
+	stats := &StopStats{
+		PendingEvents: len(ed.eventch),
+		QueuedEvents:  make(map[RegistrationType]int),
+		ActiveRegistrations: map[RegistrationType]int{
+			BlockRegistration:         len(ed.blockRegistrations),
+			FilteredBlockRegistration: len(ed.filteredBlockRegistrations),
+			ChaincodeRegistration:     len(ed.ccRegistrations),
+			TxStatusRegistration:      len(ed.txStatusRegistrations()),
+		},
+	}
+
+	for _, reg := range ed.blockRegistrations {
+		stats.QueuedEvents[BlockRegistration] += len(reg.Eventch)
+	}
+	for _, reg := range ed.filteredBlockRegistrations {
+		stats.QueuedEvents[FilteredBlockRegistration] += len(reg.Eventch)
+	}
+	for _, reg := range ed.ccRegistrations {
+		stats.QueuedEvents[ChaincodeRegistration] += len(reg.Eventch)
+	}
+	for _, reg := range ed.txStatusRegistrations() {
+		stats.QueuedEvents[TxStatusRegistration] += len(reg.Eventch)
+	}
+
+	logger.Debugf("Dispatcher stop stats - pending events: %d, queued events: %v, active registrations: %v", stats.PendingEvents, stats.QueuedEvents, stats.ActiveRegistrations)
+
+	return stats
+}
+
 func (ed *Dispatcher) handleRegisterBlockEvent(e Event) {
 	event := e.(*RegisterBlockEvent)
+	if err := ed.checkChannel(event.Reg.ChannelID); err != nil {
+		event.ErrCh <- err
+		return
+	}
 
+	event.Reg.ConnStatusch = event.ConnStatusCh
 	ed.blockRegistrations = append(ed.blockRegistrations, event.Reg)
 	event.RegCh <- event.Reg
+
+	if event.Reg.HasFromBlock {
+		ed.startReplay(event.Reg)
+	}
 }
 
 func (ed *Dispatcher) handleRegisterFilteredBlockEvent(e Event) {
 	event := e.(*RegisterFilteredBlockEvent)
+	if err := ed.checkChannel(event.Reg.ChannelID); err != nil {
+		event.ErrCh <- err
+		return
+	}
+	if err := ed.startFullBlocks(event.Reg); err != nil {
+		event.ErrCh <- err
+		return
+	}
+	event.Reg.ConnStatusch = event.ConnStatusCh
 	ed.filteredBlockRegistrations = append(ed.filteredBlockRegistrations, event.Reg)
 	event.RegCh <- event.Reg
 }
 
 func (ed *Dispatcher) handleRegisterCCEvent(e Event) {
 	event := e.(*RegisterChaincodeEvent)
+	if err := ed.checkChannel(event.Reg.ChannelID); err != nil {
+		event.ErrCh <- err
+		return
+	}
 
-	key := getCCKey(event.Reg.ChaincodeID, event.Reg.EventFilter)
+	key := getCCKey(ed.resolveChannel(event.Reg.ChannelID), event.Reg.ChaincodeID, eventFilterPattern(event.Reg.EventFilter, event.Reg.ExactMatch))
 	if _, exists := ed.ccRegistrations[key]; exists {
 		event.ErrCh <- errors.Errorf("registration already exists for chaincode [%s] and event [%s]", event.Reg.ChaincodeID, event.Reg.EventFilter)
-	} else {
-		regExp, err := regexp.Compile(event.Reg.EventFilter)
+		return
+	}
+
+	if event.filterErr != nil {
+		event.ErrCh <- errors.Wrapf(event.filterErr, "error compiling regular expression for event filter [%s]", event.Reg.EventFilter)
+		return
+	}
+
+	if event.Reg.EventRegExp == nil {
+		// The registration wasn't created with NewRegisterChaincodeEvent
+		regExp, err := regexp.Compile(eventFilterPattern(event.Reg.EventFilter, event.Reg.ExactMatch))
 		if err != nil {
 			event.ErrCh <- errors.Wrapf(err, "error compiling regular expression for event filter [%s]", event.Reg.EventFilter)
-		} else {
-			event.Reg.EventRegExp = regExp
-			ed.ccRegistrations[key] = event.Reg
-			event.RegCh <- event.Reg
+			return
 		}
+		event.Reg.EventRegExp = regExp
 	}
+
+	ed.ccRegistrations[key] = event.Reg
+	event.RegCh <- event.Reg
 }
 
 func (ed *Dispatcher) handleRegisterTxStatusEvent(e Event) {
 	event := e.(*RegisterTxStatusEvent)
 
-	if _, exists := ed.txRegistrations[event.Reg.TxID]; exists {
-		event.ErrCh <- errors.Errorf("registration already exists for TX ID [%s]", event.Reg.TxID)
-	} else {
-		ed.txRegistrations[event.Reg.TxID] = event.Reg
-		event.RegCh <- event.Reg
+	txIDs := event.Reg.txIDs()
+	if len(txIDs) == 0 {
+		event.ErrCh <- errors.New("at least one TX ID must be provided")
+		return
+	}
+
+	if err := ed.checkChannel(event.Reg.ChannelID); err != nil {
+		event.ErrCh <- err
+		return
+	}
+
+	for _, txID := range txIDs {
+		if _, exists := ed.txRegistrations[txID]; exists {
+			event.ErrCh <- errors.Errorf("registration already exists for TX ID [%s]", txID)
+			return
+		}
 	}
+
+	if event.Reg.TTL < 0 {
+		event.ErrCh <- errors.Errorf("invalid TTL for TX ID %v: %s", txIDs, event.Reg.TTL)
+		return
+	}
+
+	if err := ed.checkTxStatusMaxBlock(event.Reg); err != nil {
+		event.ErrCh <- err
+		return
+	}
+
+	if event.Reg.isMulti() {
+		event.Reg.pending = make(map[string]struct{})
+	}
+	for _, txID := range txIDs {
+		ed.txRegistrations[txID] = event.Reg
+		if event.Reg.isMulti() {
+			event.Reg.pending[txID] = struct{}{}
+		}
+	}
+	ed.startTxStatusTimer(event.Reg)
+	event.RegCh <- event.Reg
 }
 
 func (ed *Dispatcher) handleUnregisterEvent(e Event) {
@@ -261,6 +472,8 @@ func (ed *Dispatcher) handleUnregisterEvent(e Event) {
 		err = ed.unregisterCCEvents(registration)
 	case *TxStatusReg:
 		err = ed.unregisterTXEvents(registration)
+	case *HeartbeatReg:
+		err = ed.unregisterHeartbeatEvents(registration)
 	default:
 		err = errors.Errorf("Unsupported registration type: %v", reflect.TypeOf(registration))
 	}
@@ -269,6 +482,37 @@ func (ed *Dispatcher) handleUnregisterEvent(e Event) {
 	}
 }
 
+// handleBulkUnregisterEvent removes all registrations of the given type and closes the corresponding
+// event channels. Since the event is processed by the dispatcher's Go routine, no events are sent
+// to the registrations once they're removed.
+func (ed *Dispatcher) handleBulkUnregisterEvent(e Event) {
+	event := e.(*BulkUnregisterEvent)
+
+	var count int
+	switch event.RegType {
+	case BlockRegistration:
+		count = len(ed.blockRegistrations)
+		ed.clearBlockRegistrations()
+	case FilteredBlockRegistration:
+		count = len(ed.filteredBlockRegistrations)
+		ed.clearFilteredBlockRegistrations()
+	case ChaincodeRegistration:
+		count = len(ed.ccRegistrations)
+		ed.clearChaincodeRegistrations()
+	case TxStatusRegistration:
+		count = len(ed.txStatusRegistrations())
+		ed.clearTxRegistrations()
+	default:
+		logger.Warnf("Unsupported registration type for bulk unregister: %s", event.RegType)
+	}
+
+	logger.Debugf("Unregistered %d registration(s) of type [%s]", count, event.RegType)
+
+	if event.CountCh != nil {
+		event.CountCh <- count
+	}
+}
+
 func (ed *Dispatcher) handleBlockEvent(e Event) {
 	ed.HandleBlock(e.(*cb.Block))
 }
@@ -279,41 +523,164 @@ func (ed *Dispatcher) handleFilteredBlockEvent(e Event) {
 
 func (ed *Dispatcher) handleRegistrationInfoEvent(e Event) {
 	evt := e.(*RegistrationInfoEvent)
+	evt.RegInfoCh <- ed.registrationInfo()
+}
 
+// registrationInfo returns a snapshot of the current registrations
+func (ed *Dispatcher) registrationInfo() *RegistrationInfo {
 	regInfo := &RegistrationInfo{
 		NumBlockRegistrations:         len(ed.blockRegistrations),
 		NumFilteredBlockRegistrations: len(ed.filteredBlockRegistrations),
 		NumCCRegistrations:            len(ed.ccRegistrations),
-		NumTxStatusRegistrations:      len(ed.txRegistrations),
+		NumTxStatusRegistrations:      len(ed.txStatusRegistrations()),
 	}
 
 	regInfo.TotalRegistrations =
 		regInfo.NumBlockRegistrations + regInfo.NumFilteredBlockRegistrations + regInfo.NumCCRegistrations + regInfo.NumTxStatusRegistrations
 
-	evt.RegInfoCh <- regInfo
+	regInfo.BlockedDeliveries = ed.deliveries.blocked
+	regInfo.DroppedDeliveries = ed.deliveries.dropped
+	regInfo.DeliveryStats = ed.deliveryStats()
+
+	regInfo.Channels = map[string]*ChannelRegistrationInfo{ed.channelID: {}}
+	channelInfo := func(channelID string) *ChannelRegistrationInfo {
+		channelID = ed.resolveChannel(channelID)
+		info, ok := regInfo.Channels[channelID]
+		if !ok {
+			info = &ChannelRegistrationInfo{}
+			regInfo.Channels[channelID] = info
+		}
+		return info
+	}
+	for _, reg := range ed.blockRegistrations {
+		channelInfo(reg.ChannelID).NumBlockRegistrations++
+	}
+	for _, reg := range ed.filteredBlockRegistrations {
+		channelInfo(reg.ChannelID).NumFilteredBlockRegistrations++
+	}
+	for _, reg := range ed.ccRegistrations {
+		channelInfo(reg.ChannelID).NumCCRegistrations++
+	}
+	for _, reg := range ed.txStatusRegistrations() {
+		channelInfo(reg.ChannelID).NumTxStatusRegistrations++
+	}
+
+	return regInfo
+}
+
+// handleChaincodeRegInfoEvent returns the descriptors of the chaincode event registrations, sorted by
+// chaincode ID and event filter. The event channels of the registrations are not exposed.
+func (ed *Dispatcher) handleChaincodeRegInfoEvent(e Event) {
+	evt := e.(*ChaincodeRegInfoEvent)
+
+	regInfos := make([]*ChaincodeRegInfo, 0, len(ed.ccRegistrations))
+	for _, reg := range ed.ccRegistrations {
+		regInfos = append(regInfos, &ChaincodeRegInfo{ChannelID: reg.ChannelID, ChaincodeID: reg.ChaincodeID, EventFilter: reg.EventFilter, ExactMatch: reg.ExactMatch})
+	}
+	sort.Slice(regInfos, func(i, j int) bool {
+		if regInfos[i].ChannelID != regInfos[j].ChannelID {
+			return regInfos[i].ChannelID < regInfos[j].ChannelID
+		}
+		if regInfos[i].ChaincodeID != regInfos[j].ChaincodeID {
+			return regInfos[i].ChaincodeID < regInfos[j].ChaincodeID
+		}
+		return regInfos[i].EventFilter < regInfos[j].EventFilter
+	})
+
+	evt.RegInfoCh <- regInfos
+}
+
+// deliveryStats returns the delivery statistics of the registrations that had blocked or dropped deliveries
+func (ed *Dispatcher) deliveryStats() []*DeliveryStats {
+	var stats []*DeliveryStats
+	add := func(reg fab.Registration, regType RegistrationType, description string, counters deliveryCounters) {
+		if counters.blocked > 0 || counters.dropped > 0 {
+			stats = append(stats, &DeliveryStats{Registration: reg, Type: regType, Description: description, Blocked: counters.blocked, Dropped: counters.dropped})
+		}
+	}
+
+	for _, reg := range ed.blockRegistrations {
+		add(reg, BlockRegistration, "", reg.deliveries)
+	}
+	for _, reg := range ed.filteredBlockRegistrations {
+		add(reg, FilteredBlockRegistration, "", reg.deliveries)
+	}
+	for _, reg := range ed.ccRegistrations {
+		add(reg, ChaincodeRegistration, fmt.Sprintf("%s:%s", reg.ChaincodeID, reg.EventFilter), reg.deliveries)
+	}
+	for _, reg := range ed.txStatusRegistrations() {
+		add(reg, TxStatusRegistration, strings.Join(reg.txIDs(), ","), reg.deliveries)
+	}
+	return stats
+}
+
+func (ed *Dispatcher) handleExportRegistrationsEvent(e Event) {
+	evt := e.(*ExportRegistrationsEvent)
+
+	var states []RegistrationState
+	for _, reg := range ed.blockRegistrations {
+		states = append(states, RegistrationState{Type: BlockRegistration, ChannelID: reg.ChannelID, LastBlockNum: ed.lastBlockNumOf(reg.ChannelID)})
+	}
+	for _, reg := range ed.filteredBlockRegistrations {
+		states = append(states, RegistrationState{Type: FilteredBlockRegistration, ChannelID: reg.ChannelID, LastBlockNum: ed.lastBlockNumOf(reg.ChannelID)})
+	}
+	for _, reg := range ed.ccRegistrations {
+		states = append(states, RegistrationState{Type: ChaincodeRegistration, ChannelID: reg.ChannelID, ChaincodeID: reg.ChaincodeID, EventFilter: reg.EventFilter, ExactMatch: reg.ExactMatch, LastBlockNum: ed.lastBlockNumOf(reg.ChannelID)})
+	}
+	for _, reg := range ed.txStatusRegistrations() {
+		state := RegistrationState{Type: TxStatusRegistration, ChannelID: reg.ChannelID, TxID: reg.TxID, LastBlockNum: ed.lastBlockNumOf(reg.ChannelID)}
+		if reg.isMulti() {
+			state.TxIDs = reg.pendingTxIDs()
+		}
+		states = append(states, state)
+	}
+
+	evt.RegStateCh <- states
+}
+
+func (ed *Dispatcher) handleRestoreLastBlockNumEvent(e Event) {
+	evt := e.(*RestoreLastBlockNumEvent)
+
+	if err := ed.checkChannel(evt.ChannelID); err != nil {
+		evt.ErrCh <- err
+		return
+	}
+
+	lastBlockNum := ed.lastBlockNumOf(evt.ChannelID)
+	if lastBlockNum != math.MaxUint64 && lastBlockNum != evt.BlockNum {
+		evt.ErrCh <- errors.Errorf("unable to restore last block number to %d since block %d has already been dispatched", evt.BlockNum, lastBlockNum)
+		return
+	}
+
+	logger.Debugf("Restoring last block number of channel [%s] to %d", ed.resolveChannel(evt.ChannelID), evt.BlockNum)
+	ed.setLastBlockNum(evt.ChannelID, evt.BlockNum)
+	evt.ErrCh <- nil
 }
 
 // HandleBlock handles a block event
 func (ed *Dispatcher) HandleBlock(block *cb.Block) {
 	logger.Debugf("Handling block event - Block #%d", block.Header.Number)
 
-	if err := ed.updateLastBlockNum(block.Header.Number); err != nil {
+	fblock := toFilteredBlock(block)
+	if err := ed.updateLastBlockNum(fblock.ChannelId, block.Header.Number); err != nil {
 		logger.Error(err.Error())
 		return
 	}
+	ed.lastEventTime = ed.clock.Now()
 
-	ed.publishBlockEvents(block)
-	ed.publishFilteredBlockEvents(toFilteredBlock(block))
+	ed.publishBlockEvents(fblock.ChannelId, block)
+	ed.publishFilteredBlockEvents(fblock)
 }
 
 // HandleFilteredBlock handles a filtered block event
 func (ed *Dispatcher) HandleFilteredBlock(fblock *pb.FilteredBlock) {
 	logger.Debugf("Handling filtered block event - Block #%d", fblock.Number)
 
-	if err := ed.updateLastBlockNum(fblock.Number); err != nil {
+	if err := ed.updateLastBlockNum(fblock.ChannelId, fblock.Number); err != nil {
 		logger.Error(err.Error())
 		return
 	}
+	ed.lastEventTime = ed.clock.Now()
 
 	logger.Debugf("Publishing filtered block event...")
 	ed.publishFilteredBlockEvents(fblock)
@@ -325,6 +692,7 @@ func (ed *Dispatcher) unregisterBlockEvents(registration *BlockReg) error {
 			// Move the 0'th item to i and then delete the 0'th item
 			ed.blockRegistrations[i] = ed.blockRegistrations[0]
 			ed.blockRegistrations = ed.blockRegistrations[1:]
+			ed.stopReplay(reg)
 			close(reg.Eventch)
 			return nil
 		}
@@ -339,6 +707,7 @@ func (ed *Dispatcher) unregisterFilteredBlockEvents(registration *FilteredBlockR
 			ed.filteredBlockRegistrations[i] = ed.filteredBlockRegistrations[0]
 			ed.filteredBlockRegistrations = ed.filteredBlockRegistrations[1:]
 			close(reg.Eventch)
+			ed.stopFullBlocks(reg)
 			return nil
 		}
 	}
@@ -346,7 +715,7 @@ func (ed *Dispatcher) unregisterFilteredBlockEvents(registration *FilteredBlockR
 }
 
 func (ed *Dispatcher) unregisterCCEvents(registration *ChaincodeReg) error {
-	key := getCCKey(registration.ChaincodeID, registration.EventFilter)
+	key := getCCKey(ed.resolveChannel(registration.ChannelID), registration.ChaincodeID, eventFilterPattern(registration.EventFilter, registration.ExactMatch))
 	reg, ok := ed.ccRegistrations[key]
 	if !ok {
 		return errors.New("the provided registration is invalid")
@@ -359,40 +728,116 @@ func (ed *Dispatcher) unregisterCCEvents(registration *ChaincodeReg) error {
 }
 
 func (ed *Dispatcher) unregisterTXEvents(registration *TxStatusReg) error {
-	reg, ok := ed.txRegistrations[registration.TxID]
-	if !ok {
+	var reg *TxStatusReg
+	for _, txID := range registration.txIDs() {
+		if r, ok := ed.txRegistrations[txID]; ok {
+			reg = r
+			break
+		}
+	}
+	if reg == nil {
 		return errors.New("the provided registration is invalid")
 	}
 
-	logger.Debugf("Unregistering Tx Status event for TxID [%s]...", registration.TxID)
-	close(reg.Eventch)
-	delete(ed.txRegistrations, registration.TxID)
+	logger.Debugf("Unregistering Tx Status event for TxID %v...", reg.txIDs())
+	ed.removeTxStatusRegistration(reg)
 	return nil
 }
 
-func (ed *Dispatcher) publishBlockEvents(block *cb.Block) {
+func (ed *Dispatcher) publishBlockEvents(channelID string, block *cb.Block) {
+	seqNum := ed.nextSequenceNum()
+	hash := ed.computeBlockHash(block)
+	ed.bufferBlock(channelID, &fab.BlockEvent{Block: block, SequenceNum: seqNum, BlockHash: hash})
+
 	for _, reg := range ed.blockRegistrations {
+		if !ed.inChannel(reg.ChannelID, channelID) {
+			continue
+		}
+		if reg.HasFromBlock && block.Header.Number < reg.FromBlock {
+			logger.Debugf("Not sending block event for block #%d since the registration starts at block #%d.", block.Header.Number, reg.FromBlock)
+			continue
+		}
+		if reg.replay != nil {
+			// The block is delivered once the previous blocks have been fetched and delivered
+			reg.replay.pending = append(reg.replay.pending, &fab.BlockEvent{Block: block, SequenceNum: seqNum, BlockHash: hash})
+			continue
+		}
 		if !reg.Filter(block) {
 			logger.Debugf("Not sending block event for block #%d since it was filtered out.", block.Header.Number)
 			continue
 		}
 
-		if ed.eventConsumerTimeout < 0 {
+		ed.sendBlockEvent(reg, &fab.BlockEvent{Block: block, SequenceNum: seqNum, BlockHash: hash})
+	}
+}
+
+func (ed *Dispatcher) sendBlockEvent(reg *BlockReg, event *fab.BlockEvent) {
+	ed.deliver(&reg.deliveries, "block", func(wait bool, timeout <-chan time.Time) bool {
+		if !wait {
 			select {
-			case reg.Eventch <- &fab.BlockEvent{Block: block}:
+			case reg.Eventch <- event:
+				return true
 			default:
-				logger.Warnf("Unable to send to block event channel.")
-			}
-		} else if ed.eventConsumerTimeout == 0 {
-			reg.Eventch <- &fab.BlockEvent{Block: block}
-		} else {
-			select {
-			case reg.Eventch <- &fab.BlockEvent{Block: block}:
-			case <-time.After(ed.eventConsumerTimeout):
-				logger.Warnf("Timed out sending block event.")
+				return false
 			}
 		}
+		select {
+		case reg.Eventch <- event:
+			return true
+		case <-timeout:
+			return false
+		}
+	})
+}
+
+// sendFunc sends an event to the event channel of a registration and returns true if the event was sent. If wait
+// is false then the event is only sent if the channel isn't full; otherwise the event is sent once the consumer
+// is ready or until the timeout fires (a nil timeout never fires).
+type sendFunc func(wait bool, timeout <-chan time.Time) bool
+
+// deliver sends an event according to the event consumer timeout and counts the deliveries for which the event
+// channel of the registration was full. If the timeout is negative, the event is dropped if the channel is full;
+// if it's zero, the dispatcher blocks until the event is sent; otherwise the dispatcher blocks until the timeout.
+func (ed *Dispatcher) deliver(counters *deliveryCounters, eventType string, send sendFunc) {
+	if send(false, nil) {
+		return
+	}
+
+	if ed.eventConsumerTimeout < 0 {
+		ed.countDropped(counters)
+		logger.Warnf("Unable to send to %s event channel.", eventType)
+		return
 	}
+
+	counters.blocked++
+	ed.deliveries.blocked++
+
+	wait := ed.eventConsumerTimeout
+	if !ed.drainDeadline.IsZero() {
+		remaining := ed.drainDeadline.Sub(ed.clock.Now())
+		if remaining <= 0 {
+			ed.countDropped(counters)
+			logger.Warnf("Drain timeout elapsed - dropping %s event.", eventType)
+			return
+		}
+		if wait == 0 || wait > remaining {
+			wait = remaining
+		}
+	}
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timeout = time.After(wait)
+	}
+	if !send(true, timeout) {
+		ed.countDropped(counters)
+		logger.Warnf("Timed out sending %s event.", eventType)
+	}
+}
+
+func (ed *Dispatcher) countDropped(counters *deliveryCounters) {
+	counters.dropped++
+	ed.deliveries.dropped++
 }
 
 func (ed *Dispatcher) publishFilteredBlockEvents(fblock *pb.FilteredBlock) {
@@ -403,26 +848,17 @@ func (ed *Dispatcher) publishFilteredBlockEvents(fblock *pb.FilteredBlock) {
 
 	logger.Debugf("Publishing filtered block event: %#v", fblock)
 
+	seqNum := ed.nextSequenceNum()
 	for _, reg := range ed.filteredBlockRegistrations {
-		if ed.eventConsumerTimeout < 0 {
-			select {
-			case reg.Eventch <- &fab.FilteredBlockEvent{FilteredBlock: fblock}:
-			default:
-				logger.Warnf("Unable to send to filtered block event channel.")
-			}
-		} else if ed.eventConsumerTimeout == 0 {
-			reg.Eventch <- &fab.FilteredBlockEvent{FilteredBlock: fblock}
-		} else {
-			select {
-			case reg.Eventch <- &fab.FilteredBlockEvent{FilteredBlock: fblock}:
-			case <-time.After(ed.eventConsumerTimeout):
-				logger.Warnf("Timed out sending filtered block event.")
-			}
+		if !ed.inChannel(reg.ChannelID, fblock.ChannelId) {
+			continue
 		}
+		ed.sendFilteredBlockEvent(reg, &fab.FilteredBlockEvent{FilteredBlock: fblock, SequenceNum: seqNum})
+		ed.fetchFullBlock(reg, fblock)
 	}
 
 	for _, tx := range fblock.FilteredTransactions {
-		ed.publishTxStatusEvents(tx)
+		ed.publishTxStatusEvents(fblock.ChannelId, tx)
 
 		// Only send a chaincode event if the transaction has committed
 		if tx.TxValidationCode == pb.TxValidationCode_VALID {
@@ -432,61 +868,140 @@ func (ed *Dispatcher) publishFilteredBlockEvents(fblock *pb.FilteredBlock) {
 			}
 			for _, action := range txActions.ChaincodeActions {
 				if action.ChaincodeEvent != nil {
-					ed.publishCCEvents(action.ChaincodeEvent)
+					ed.publishCCEvents(fblock.ChannelId, action.ChaincodeEvent)
 				}
 			}
 		}
 	}
+
+	ed.removeTxStatusRegistrationsUntilBlock(fblock.ChannelId, fblock.Number)
 }
 
-func (ed *Dispatcher) publishTxStatusEvents(tx *pb.FilteredTransaction) {
+func (ed *Dispatcher) publishTxStatusEvents(channelID string, tx *pb.FilteredTransaction) {
 	logger.Debugf("Publishing Tx Status event for TxID [%s]...", tx.Txid)
-	if reg, ok := ed.txRegistrations[tx.Txid]; ok {
+	seqNum := ed.nextSequenceNum()
+	if reg, ok := ed.txRegistrations[tx.Txid]; ok && ed.inChannel(reg.ChannelID, channelID) {
 		logger.Debugf("Sending Tx Status event for TxID [%s] to registrant...", tx.Txid)
 
-		if ed.eventConsumerTimeout < 0 {
-			select {
-			case reg.Eventch <- NewTxStatusEvent(tx.Txid, tx.TxValidationCode):
-			default:
-				logger.Warnf("Unable to send to Tx Status event channel.")
-			}
-		} else if ed.eventConsumerTimeout == 0 {
-			reg.Eventch <- NewTxStatusEvent(tx.Txid, tx.TxValidationCode)
-		} else {
-			select {
-			case reg.Eventch <- NewTxStatusEvent(tx.Txid, tx.TxValidationCode):
-			case <-time.After(ed.eventConsumerTimeout):
-				logger.Warnf("Timed out sending Tx Status event.")
-			}
+		completed := true
+		if reg.isMulti() {
+			delete(ed.txRegistrations, tx.Txid)
+			delete(reg.pending, tx.Txid)
+			completed = len(reg.pending) == 0
+		}
+
+		if completed {
+			// The status was received so the registration no longer expires
+			ed.stopTxStatusTimer(reg)
+			reg.received = true
+		}
+
+		ed.sendTxStatusEvent(reg, newTxStatusEvent(tx.Txid, tx.TxValidationCode, seqNum))
+
+		if reg.isMulti() && completed {
+			logger.Debugf("Received the status of all transactions of registration for TxID %v", reg.TxIDs)
+			close(reg.Eventch)
 		}
 	}
 }
 
-func (ed *Dispatcher) publishCCEvents(ccEvent *pb.ChaincodeEvent) {
+func (ed *Dispatcher) publishCCEvents(channelID string, ccEvent *pb.ChaincodeEvent) {
+	seqNum := ed.nextSequenceNum()
 	for _, reg := range ed.ccRegistrations {
+		if !ed.inChannel(reg.ChannelID, channelID) {
+			continue
+		}
 		logger.Debugf("Matching CCEvent[%s,%s] against Reg[%s,%s] ...", ccEvent.ChaincodeId, ccEvent.EventName, reg.ChaincodeID, reg.EventFilter)
 		if reg.ChaincodeID == ccEvent.ChaincodeId && reg.EventRegExp.MatchString(ccEvent.EventName) {
 			logger.Debugf("... matched CCEvent[%s,%s] against Reg[%s,%s]", ccEvent.ChaincodeId, ccEvent.EventName, reg.ChaincodeID, reg.EventFilter)
 
-			if ed.eventConsumerTimeout < 0 {
-				select {
-				case reg.Eventch <- NewChaincodeEvent(ccEvent.ChaincodeId, ccEvent.EventName, ccEvent.TxId, ccEvent.Payload):
-				default:
-					logger.Warnf("Unable to send to CC event channel.")
-				}
-			} else if ed.eventConsumerTimeout == 0 {
-				reg.Eventch <- NewChaincodeEvent(ccEvent.ChaincodeId, ccEvent.EventName, ccEvent.TxId, ccEvent.Payload)
-			} else {
-				select {
-				case reg.Eventch <- NewChaincodeEvent(ccEvent.ChaincodeId, ccEvent.EventName, ccEvent.TxId, ccEvent.Payload):
-				case <-time.After(ed.eventConsumerTimeout):
-					logger.Warnf("Timed out sending CC event.")
-				}
-			}
+			ed.sendCCEvent(reg, newChaincodeEvent(ccEvent, seqNum))
 		}
 	}
 }
 
+func (ed *Dispatcher) sendFilteredBlockEvent(reg *FilteredBlockReg, event *fab.FilteredBlockEvent) {
+	ed.deliver(&reg.deliveries, "filtered block", func(wait bool, timeout <-chan time.Time) bool {
+		if !wait {
+			select {
+			case reg.Eventch <- event:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case reg.Eventch <- event:
+			return true
+		case <-timeout:
+			return false
+		}
+	})
+}
+
+func (ed *Dispatcher) sendTxStatusEvent(reg *TxStatusReg, event *fab.TxStatusEvent) {
+	ed.deliver(&reg.deliveries, "Tx Status", func(wait bool, timeout <-chan time.Time) bool {
+		if !wait {
+			select {
+			case reg.Eventch <- event:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case reg.Eventch <- event:
+			return true
+		case <-timeout:
+			return false
+		}
+	})
+}
+
+func (ed *Dispatcher) sendCCEvent(reg *ChaincodeReg, event *fab.CCEvent) {
+	ed.deliver(&reg.deliveries, "CC", func(wait bool, timeout <-chan time.Time) bool {
+		if !wait {
+			select {
+			case reg.Eventch <- event:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case reg.Eventch <- event:
+			return true
+		case <-timeout:
+			return false
+		}
+	})
+}
+
+// nextSequenceNum returns the next event sequence number. A sequence number is consumed by each
+// event that's processed, even if there are no registrations for the event.
+func (ed *Dispatcher) nextSequenceNum() uint64 {
+	ed.sequenceNum++
+	return ed.sequenceNum
+}
+
+func newTxStatusEvent(txID string, txValidationCode pb.TxValidationCode, seqNum uint64) *fab.TxStatusEvent {
+	event := NewTxStatusEvent(txID, txValidationCode)
+	event.SequenceNum = seqNum
+	return event
+}
+
+func newChaincodeEvent(ccEvent *pb.ChaincodeEvent, seqNum uint64) *fab.CCEvent {
+	event := NewChaincodeEvent(ccEvent.ChaincodeId, ccEvent.EventName, ccEvent.TxId, ccEvent.Payload)
+	event.SequenceNum = seqNum
+	return event
+}
+
+// RegisterDrainableEvent marks events of the given type as events that originate from the event producer.
+// Such events are delivered (rather than dropped) if they're queued when the dispatcher is stopped in drain mode.
+func (ed *Dispatcher) RegisterDrainableEvent(t interface{}) {
+	ed.drainableTypes[reflect.TypeOf(t)] = true
+}
+
 // RegisterHandler registers an event handler
 func (ed *Dispatcher) RegisterHandler(t interface{}, h Handler) {
 	htype := reflect.TypeOf(t)
@@ -498,8 +1013,10 @@ func (ed *Dispatcher) RegisterHandler(t interface{}, h Handler) {
 	}
 }
 
-func getCCKey(ccID, eventFilter string) string {
-	return ccID + "/" + eventFilter
+// getCCKey returns the key of a chaincode registration of the given channel. The key contains the event filter
+// pattern so that an exact match filter and the equivalent anchored regular expression share a key.
+func getCCKey(channelID, ccID, eventFilterPattern string) string {
+	return channelID + "/" + ccID + "/" + eventFilterPattern
 }
 
 func toFilteredBlock(block *cb.Block) *pb.FilteredBlock {
@@ -8,6 +8,9 @@ package dispatcher
 
 import (
 	"bytes"
+	reqContext "context"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,8 +18,10 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/blockfilter"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/blockfilter/headertypefilter"
 	servicemocks "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/mocks"
+	"github.com/hyperledger/fabric-sdk-go/pkg/util/protoutil"
 	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
 	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
 )
 
 func TestInvalidUnregister(t *testing.T) {
@@ -82,6 +87,258 @@ func TestBlockEvents(t *testing.T) {
 	}
 }
 
+func TestBlockEventsFromBlock(t *testing.T) {
+	channelID := "testchannel"
+	dispatcher := New(
+		WithEventConsumerTimeout(2*time.Second),
+		WithBlockReplayBufferSize(3),
+	)
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	// Dispatch blocks 0 to 4 (blocks 2 to 4 are retained for replay)
+	producer := servicemocks.NewBlockProducer()
+	for i := 0; i < 5; i++ {
+		dispatcherEventch <- producer.NewBlock(channelID)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	register := func(fromBlock uint64) chan *fab.BlockEvent {
+		eventch := make(chan *fab.BlockEvent, 10)
+		dispatcherEventch <- NewRegisterBlockEventFromBlock(blockfilter.AcceptAny, fromBlock, eventch, regch, errch)
+		select {
+		case <-regch:
+		case err := <-errch:
+			t.Fatalf("Error registering for block events: %s", err)
+		}
+		return eventch
+	}
+
+	fromPast := register(3)
+	// Block 0 is no longer in the replay buffer and no block fetcher is configured,
+	// so delivery starts at the oldest buffered block
+	fromEvicted := register(0)
+	fromFuture := register(6)
+
+	for i := 5; i < 7; i++ {
+		dispatcherEventch <- producer.NewBlock(channelID)
+	}
+
+	checkBlockNums(t, fromPast, 3, 4, 5, 6)
+	checkBlockNums(t, fromEvicted, 2, 3, 4, 5, 6)
+	checkBlockNums(t, fromFuture, 6)
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestBlockEventsFromBlockWithFetcher(t *testing.T) {
+	channelID := "testchannel"
+
+	// Blocks 0 to 4 are dispatched and blocks 3 and 4 are retained for replay
+	producer := servicemocks.NewBlockProducer()
+	var blocks []*cb.Block
+	for i := 0; i < 5; i++ {
+		blocks = append(blocks, producer.NewBlock(channelID))
+	}
+
+	fetchStarted := make(chan struct{}, 10)
+	releaseFetch := make(chan struct{})
+	fetcher := func(ctx reqContext.Context, blockNum uint64) (*cb.Block, error) {
+		fetchStarted <- struct{}{}
+		select {
+		case <-releaseFetch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if blockNum == 0 {
+			return nil, errors.New("block 0 isn't available")
+		}
+		return blocks[blockNum], nil
+	}
+
+	dispatcher := New(
+		WithEventConsumerTimeout(2*time.Second),
+		WithBlockReplayBufferSize(2),
+		WithBlockFetcher(fetcher),
+	)
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	for _, block := range blocks {
+		dispatcherEventch <- block
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	register := func(fromBlock uint64) chan *fab.BlockEvent {
+		eventch := make(chan *fab.BlockEvent, 10)
+		dispatcherEventch <- NewRegisterBlockEventFromBlock(blockfilter.AcceptAny, fromBlock, eventch, regch, errch)
+		select {
+		case <-regch:
+		case err := <-errch:
+			t.Fatalf("Error registering for block events: %s", err)
+		}
+		return eventch
+	}
+
+	// Blocks 1 and 2 are fetched. The live block that's dispatched while fetching is delivered after the
+	// fetched and buffered blocks.
+	fromFetched := register(1)
+	<-fetchStarted
+	dispatcherEventch <- producer.NewBlock(channelID)
+	close(releaseFetch)
+	checkBlockNums(t, fromFetched, 1, 2, 3, 4, 5)
+
+	// Block 0 can't be fetched so delivery starts at the oldest buffered block
+	fromUnavailable := register(0)
+	checkBlockNums(t, fromUnavailable, 4, 5)
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestBlockEventsWithBlockHash(t *testing.T) {
+	channelID := "testchannel"
+	dispatcher := New(
+		WithEventConsumerTimeout(2*time.Second),
+		WithBlockReplayBufferSize(3),
+		WithBlockHash(true),
+	)
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	producer := servicemocks.NewBlockProducer()
+	dispatcherEventch <- producer.NewBlock(channelID)
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	register := func(fromBlock uint64) chan *fab.BlockEvent {
+		eventch := make(chan *fab.BlockEvent, 10)
+		dispatcherEventch <- NewRegisterBlockEventFromBlock(blockfilter.AcceptAny, fromBlock, eventch, regch, errch)
+		select {
+		case <-regch:
+		case err := <-errch:
+			t.Fatalf("Error registering for block events: %s", err)
+		}
+		return eventch
+	}
+
+	// The first block is replayed to eventch1
+	eventch1 := register(0)
+	eventch2 := register(1)
+	dispatcherEventch <- producer.NewBlock(channelID)
+
+	checkBlockHash := func(eventch chan *fab.BlockEvent, expectedBlockNum uint64) []byte {
+		select {
+		case event := <-eventch:
+			if event.Block.Header.Number != expectedBlockNum {
+				t.Fatalf("expecting block #%d but received block #%d", expectedBlockNum, event.Block.Header.Number)
+			}
+			expected, err := protoutil.BlockHeaderHash(event.Block.Header)
+			if err != nil {
+				t.Fatalf("Error computing block hash: %s", err)
+			}
+			if !bytes.Equal(expected, event.BlockHash) {
+				t.Fatalf("expecting hash %x for block #%d but got %x", expected, expectedBlockNum, event.BlockHash)
+			}
+			return event.BlockHash
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block #%d", expectedBlockNum)
+			return nil
+		}
+	}
+
+	hash0 := checkBlockHash(eventch1, 0)
+	hash1 := checkBlockHash(eventch1, 1)
+	if len(hash0) != 32 {
+		t.Fatalf("expecting a SHA-256 hash but got %x", hash0)
+	}
+	if bytes.Equal(hash0, hash1) {
+		t.Fatalf("expecting different hashes for different blocks")
+	}
+	if hash2 := checkBlockHash(eventch2, 1); !bytes.Equal(hash1, hash2) {
+		t.Fatalf("expecting the same hash for all registrations")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+
+	// The hash isn't computed by default
+	dispatcher = New(WithEventConsumerTimeout(2 * time.Second))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+	dispatcherEventch, err = dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+	eventch := register(0)
+	dispatcherEventch <- producer.NewBlock(channelID)
+	select {
+	case event := <-eventch:
+		if event.BlockHash != nil {
+			t.Fatalf("expecting no block hash by default")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for block event")
+	}
+
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func checkBlockNums(t *testing.T, eventch chan *fab.BlockEvent, expectedBlockNums ...uint64) {
+	for _, expected := range expectedBlockNums {
+		select {
+		case event, ok := <-eventch:
+			if !ok {
+				t.Fatalf("unexpected closed channel")
+			}
+			if event.Block.Header.Number != expected {
+				t.Fatalf("expecting block #%d but received block #%d", expected, event.Block.Header.Number)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block #%d", expected)
+		}
+	}
+	select {
+	case event := <-eventch:
+		t.Fatalf("unexpected block #%d", event.Block.Header.Number)
+	default:
+	}
+}
+
 func TestBlockEventsWithFilter(t *testing.T) {
 	channelID := "testchannel"
 	dispatcher := New()
@@ -648,7 +905,82 @@ func TestCCEventsFiltered(t *testing.T) {
 	}
 }
 
-func TestRegistrationInfo(t *testing.T) {
+func TestCCEventsExactMatch(t *testing.T) {
+	channelID := "mychannel"
+	ccID := "mycc"
+
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	// An invalid regular expression is rejected
+	dispatcherEventch <- NewRegisterChaincodeEvent(ccID, "event(", make(chan *fab.CCEvent), regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering with invalid event filter")
+	case err := <-errch:
+		if !strings.Contains(err.Error(), "error compiling regular expression") {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// The event name isn't interpreted as a regular expression
+	eventch := make(chan *fab.CCEvent, 10)
+	dispatcherEventch <- NewRegisterChaincodeEventExactMatch(ccID, "event.1", eventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for chaincode events: %s", err)
+	}
+
+	// The equivalent regular expression is a duplicate registration
+	dispatcherEventch <- NewRegisterChaincodeEvent(ccID, `^event\.1$`, make(chan *fab.CCEvent), regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering multiple times for chaincode events")
+	case <-errch:
+	}
+
+	dispatcherEventch <- servicemocks.NewBlockProducer().NewBlock(
+		channelID,
+		servicemocks.NewTransactionWithCCEvent("txid1", pb.TxValidationCode_VALID, ccID, "eventx1", []byte("payload1")),
+		servicemocks.NewTransactionWithCCEvent("txid2", pb.TxValidationCode_VALID, ccID, "event.1", []byte("payload2")),
+		servicemocks.NewTransactionWithCCEvent("txid3", pb.TxValidationCode_VALID, ccID, "event.10", []byte("payload3")),
+	)
+
+	select {
+	case event, ok := <-eventch:
+		if !ok {
+			t.Fatalf("unexpected closed channel")
+		}
+		checkCCEvent(t, event, ccID, []byte("payload2"), "event.1")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for CC event")
+	}
+
+	select {
+	case event := <-eventch:
+		t.Fatalf("unexpected CC event [%s]", event.EventName)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestChaincodeRegInfo(t *testing.T) {
 	dispatcher := New()
 	if err := dispatcher.Start(); err != nil {
 		t.Fatalf("Error starting dispatcher: %s", err)
@@ -659,6 +991,65 @@ func TestRegistrationInfo(t *testing.T) {
 		t.Fatalf("Error getting event channel from dispatcher: %s", err)
 	}
 
+	regInfoch := make(chan []*ChaincodeRegInfo, 1)
+	dispatcherEventch <- NewChaincodeRegInfoEvent(regInfoch)
+	if regInfos := <-regInfoch; len(regInfos) != 0 {
+		t.Fatalf("Expecting no chaincode registrations but got %d", len(regInfos))
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	var regs []fab.Registration
+	for _, event := range []*RegisterChaincodeEvent{
+		NewRegisterChaincodeEvent("cc2", "event.*", make(chan *fab.CCEvent), regch, errch),
+		NewRegisterChaincodeEventExactMatch("cc1", "event1", make(chan *fab.CCEvent), regch, errch),
+		NewRegisterChaincodeEvent("cc1", "event0", make(chan *fab.CCEvent), regch, errch),
+	} {
+		dispatcherEventch <- event
+		select {
+		case reg := <-regch:
+			regs = append(regs, reg)
+		case err := <-errch:
+			t.Fatalf("error registering for chaincode events: %s", err)
+		}
+	}
+
+	expected := []*ChaincodeRegInfo{
+		{ChaincodeID: "cc1", EventFilter: "event0"},
+		{ChaincodeID: "cc1", EventFilter: "event1", ExactMatch: true},
+		{ChaincodeID: "cc2", EventFilter: "event.*"},
+	}
+	dispatcherEventch <- NewChaincodeRegInfoEvent(regInfoch)
+	if regInfos := <-regInfoch; !reflect.DeepEqual(regInfos, expected) {
+		t.Fatalf("Expecting chaincode registrations %+v but got %+v", expected, regInfos)
+	}
+
+	dispatcherEventch <- NewUnregisterEvent(regs[0])
+	dispatcherEventch <- NewChaincodeRegInfoEvent(regInfoch)
+	if regInfos := <-regInfoch; !reflect.DeepEqual(regInfos, expected[:2]) {
+		t.Fatalf("Expecting chaincode registrations %+v but got %+v", expected[:2], regInfos)
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestRegistrationInfo(t *testing.T) {
+	channelID := "mychannel"
+	dispatcher := New(WithChannelID(channelID))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
 	errch := make(chan error)
 
 	regch := make(chan fab.Registration)
@@ -699,6 +1090,13 @@ func TestRegistrationInfo(t *testing.T) {
 		if regInfo.NumFilteredBlockRegistrations != 1 {
 			t.Fatalf("expecting number of filtered block registrations to be [%d] but received [%d]", 1, regInfo.NumFilteredBlockRegistrations)
 		}
+		chRegInfo, ok := regInfo.Channels[channelID]
+		if !ok {
+			t.Fatalf("expecting registration info for channel [%s]", channelID)
+		}
+		if chRegInfo.NumBlockRegistrations != 1 || chRegInfo.NumFilteredBlockRegistrations != 1 {
+			t.Fatalf("unexpected registration info for channel [%s]: %+v", channelID, chRegInfo)
+		}
 	case <-time.After(5 * time.Second):
 		t.Fatalf("timed out waiting for registration info")
 	}
@@ -749,30 +1147,1318 @@ func TestRegistrationInfo(t *testing.T) {
 	}
 }
 
-func checkTxStatusEvent(t *testing.T, event *fab.TxStatusEvent, expectedTxID string, expectedCode pb.TxValidationCode) {
-	if event.TxID != expectedTxID {
-		t.Fatalf("expecting event for TxID [%s] but received event for TxID [%s]", expectedTxID, event.TxID)
+func TestDeliveryStats(t *testing.T) {
+	// Non-blocking mode: the events that don't fit into the consumer's channel are dropped
+	regInfo, reg := testDeliveryStats(t, -1)
+	if regInfo.BlockedDeliveries != 0 {
+		t.Fatalf("expecting [%d] blocked deliveries but received [%d]", 0, regInfo.BlockedDeliveries)
 	}
-	if event.TxValidationCode != expectedCode {
-		t.Fatalf("expecting TxValidationCode [%s] but received [%s]", expectedCode, event.TxValidationCode)
+	if regInfo.DroppedDeliveries == 0 {
+		t.Fatalf("expecting dropped deliveries")
 	}
+	checkDeliveryStats(t, regInfo, reg)
+
+	// Blocking mode with timeout: the dispatcher blocks on the full channel and drops the event when the timeout fires
+	regInfo, reg = testDeliveryStats(t, 10*time.Millisecond)
+	if regInfo.BlockedDeliveries == 0 {
+		t.Fatalf("expecting blocked deliveries")
+	}
+	if regInfo.DroppedDeliveries != regInfo.BlockedDeliveries {
+		t.Fatalf("expecting all [%d] blocked deliveries to time out but [%d] were dropped", regInfo.BlockedDeliveries, regInfo.DroppedDeliveries)
+	}
+	checkDeliveryStats(t, regInfo, reg)
 }
 
-func checkCCEvent(t *testing.T, event *fab.CCEvent, expectedCCID string, expectedPayload []byte, expectedEventNames ...string) {
-	if event.ChaincodeID != expectedCCID {
-		t.Fatalf("expecting event for CC [%s] but received event for CC [%s]", expectedCCID, event.ChaincodeID)
+func checkDeliveryStats(t *testing.T, regInfo *RegistrationInfo, reg fab.Registration) {
+	if len(regInfo.DeliveryStats) != 1 {
+		t.Fatalf("expecting delivery stats for [%d] registration but received [%d]", 1, len(regInfo.DeliveryStats))
 	}
-	if bytes.Compare(event.Payload, expectedPayload) != 0 {
-		t.Fatalf("expecting payload [%s] but received payload [%s]", expectedPayload, event.Payload)
+	stats := regInfo.DeliveryStats[0]
+	if stats.Registration != reg || stats.Type != BlockRegistration {
+		t.Fatalf("unexpected registration in delivery stats: %+v", stats)
 	}
-	found := false
-	for _, eventName := range expectedEventNames {
-		if event.EventName == eventName {
-			found = true
-			break
-		}
+	if stats.Blocked != regInfo.BlockedDeliveries || stats.Dropped != regInfo.DroppedDeliveries {
+		t.Fatalf("expecting delivery stats of registration to match the totals: %+v", stats)
 	}
-	if !found {
-		t.Fatalf("expecting one of [%v] but received [%s]", expectedEventNames, event.EventName)
+}
+
+func testDeliveryStats(t *testing.T, timeout time.Duration) (*RegistrationInfo, fab.Registration) {
+	channelID := "testchannel"
+	dispatcher := New(WithEventConsumerTimeout(timeout))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	// The consumer never reads from the channel
+	eventch := make(chan *fab.BlockEvent, 1)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	dispatcherEventch <- NewRegisterBlockEvent(blockfilter.AcceptAny, eventch, regch, errch)
+
+	var reg fab.Registration
+	select {
+	case reg = <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for block events: %s", err)
+	}
+
+	producer := servicemocks.NewBlockProducer()
+	for i := 0; i < 5; i++ {
+		dispatcherEventch <- producer.NewBlock(channelID)
+	}
+
+	regInfoch := make(chan *RegistrationInfo, 1)
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoch)
+
+	var regInfo *RegistrationInfo
+	select {
+	case regInfo = <-regInfoch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for registration info")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+
+	return regInfo, reg
+}
+
+func TestBulkUnregister(t *testing.T) {
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	errch := make(chan error)
+	regch := make(chan fab.Registration)
+
+	var cceventchs []chan *fab.CCEvent
+	for _, ccID := range []string{"cc1", "cc2", "cc3"} {
+		cceventch := make(chan *fab.CCEvent, 10)
+		cceventchs = append(cceventchs, cceventch)
+		dispatcherEventch <- NewRegisterChaincodeEvent(ccID, ".*", cceventch, regch, errch)
+		select {
+		case <-regch:
+		case err := <-errch:
+			t.Fatalf("Error registering for chaincode events: %s", err)
+		}
+	}
+
+	fbeventch := make(chan *fab.FilteredBlockEvent, 10)
+	dispatcherEventch <- NewRegisterFilteredBlockEvent(fbeventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for filtered block events: %s", err)
+	}
+
+	countch := make(chan int, 1)
+	dispatcherEventch <- NewBulkUnregisterEvent(ChaincodeRegistration, countch)
+
+	select {
+	case count := <-countch:
+		if count != 3 {
+			t.Fatalf("expecting [%d] registrations to be removed but received [%d]", 3, count)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for bulk unregister")
+	}
+
+	for _, cceventch := range cceventchs {
+		if _, ok := <-cceventch; ok {
+			t.Fatalf("expecting chaincode event channel to be closed")
+		}
+	}
+
+	eventch := make(chan *RegistrationInfo, 1)
+	dispatcherEventch <- NewRegistrationInfoEvent(eventch)
+
+	select {
+	case regInfo := <-eventch:
+		if regInfo.NumCCRegistrations != 0 {
+			t.Fatalf("expecting number of CC registrations to be [%d] but received [%d]", 0, regInfo.NumCCRegistrations)
+		}
+		if regInfo.NumFilteredBlockRegistrations != 1 {
+			t.Fatalf("expecting number of filtered block registrations to be [%d] but received [%d]", 1, regInfo.NumFilteredBlockRegistrations)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for registration info")
+	}
+
+	// The count channel is optional
+	dispatcherEventch <- NewBulkUnregisterEvent(FilteredBlockRegistration, nil)
+	if _, ok := <-fbeventch; ok {
+		t.Fatalf("expecting filtered block event channel to be closed")
+	}
+
+	dispatcherEventch <- NewBulkUnregisterEvent(TxStatusRegistration, countch)
+	if count := <-countch; count != 0 {
+		t.Fatalf("expecting [%d] registrations to be removed but received [%d]", 0, count)
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func checkTxStatusEvent(t *testing.T, event *fab.TxStatusEvent, expectedTxID string, expectedCode pb.TxValidationCode) {
+	if event.TxID != expectedTxID {
+		t.Fatalf("expecting event for TxID [%s] but received event for TxID [%s]", expectedTxID, event.TxID)
+	}
+	if event.TxValidationCode != expectedCode {
+		t.Fatalf("expecting TxValidationCode [%s] but received [%s]", expectedCode, event.TxValidationCode)
+	}
+}
+
+func checkCCEvent(t *testing.T, event *fab.CCEvent, expectedCCID string, expectedPayload []byte, expectedEventNames ...string) {
+	if event.ChaincodeID != expectedCCID {
+		t.Fatalf("expecting event for CC [%s] but received event for CC [%s]", expectedCCID, event.ChaincodeID)
+	}
+	if bytes.Compare(event.Payload, expectedPayload) != 0 {
+		t.Fatalf("expecting payload [%s] but received payload [%s]", expectedPayload, event.Payload)
+	}
+	found := false
+	for _, eventName := range expectedEventNames {
+		if event.EventName == eventName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("expecting one of [%v] but received [%s]", expectedEventNames, event.EventName)
+	}
+}
+
+func TestStopWithDrain(t *testing.T) {
+	t.Run("Drain", func(t *testing.T) {
+		if n := testStopWithQueuedBlocks(t, true); n != 3 {
+			t.Fatalf("Expecting 3 block events to be delivered in drain mode but got %d", n)
+		}
+	})
+	t.Run("Immediate", func(t *testing.T) {
+		if n := testStopWithQueuedBlocks(t, false); n != 1 {
+			t.Fatalf("Expecting only 1 block event to be delivered in immediate mode but got %d", n)
+		}
+	})
+}
+
+// testStopWithQueuedBlocks stops the dispatcher while blocks are queued and returns the number of block events delivered
+func testStopWithQueuedBlocks(t *testing.T, drain bool) int {
+	channelID := "mychannel"
+	dispatcher := New(WithEventConsumerTimeout(0))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	// The event channel is unbuffered so that the dispatcher is blocked delivering the first block
+	// until the consumer is ready, while the stop event and the remaining blocks are queued
+	eventch := make(chan *fab.BlockEvent)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	dispatcherEventch <- NewRegisterBlockEvent(blockfilter.AcceptAny, eventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for block events: %s", err)
+	}
+
+	// The first block of a producer is ignored
+	producer := servicemocks.NewBlockProducer()
+	producer.NewBlock(channelID)
+
+	stopResp := make(chan error, 1)
+	stopEvent := NewStopEvent(stopResp)
+	if drain {
+		stopEvent = NewStopEventWithDrain(stopResp, 0)
+	}
+
+	dispatcherEventch <- producer.NewBlock(channelID)
+	dispatcherEventch <- stopEvent
+	dispatcherEventch <- producer.NewBlock(channelID)
+	dispatcherEventch <- producer.NewBlock(channelID)
+
+	numEvents := 0
+	for {
+		select {
+		case _, ok := <-eventch:
+			if !ok {
+				if err := <-stopResp; err != nil {
+					t.Fatalf("Error stopping dispatcher: %s", err)
+				}
+				return numEvents
+			}
+			numEvents++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block event")
+		}
+	}
+}
+
+func TestStopWithDrainBlockedConsumer(t *testing.T) {
+	channelID := "mychannel"
+	dispatcher := New(WithEventConsumerTimeout(0))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	eventch := make(chan *fab.BlockEvent)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	dispatcherEventch <- NewRegisterBlockEvent(blockfilter.AcceptAny, eventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for block events: %s", err)
+	}
+
+	// The first block of a producer is ignored
+	producer := servicemocks.NewBlockProducer()
+	producer.NewBlock(channelID)
+
+	stopResp := make(chan error, 1)
+	statsch := make(chan *StopStats, 1)
+	stopEvent := &StopEvent{
+		ErrCh:        stopResp,
+		StatsCh:      statsch,
+		Drain:        true,
+		DrainTimeout: 100 * time.Millisecond,
+	}
+
+	// The dispatcher is blocked delivering the first block while the stop event and the second block are queued
+	dispatcherEventch <- producer.NewBlock(channelID)
+	dispatcherEventch <- stopEvent
+	dispatcherEventch <- producer.NewBlock(channelID)
+
+	select {
+	case <-eventch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for block event")
+	}
+
+	// The consumer doesn't read the second block so the delivery is bounded by the drain timeout
+	select {
+	case err := <-stopResp:
+		if err != nil {
+			t.Fatalf("Error stopping dispatcher: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for dispatcher to stop while draining")
+	}
+
+	stats := <-statsch
+	if stats.PendingEvents != 0 {
+		t.Fatalf("expecting no pending events after draining but got %d", stats.PendingEvents)
+	}
+}
+
+func TestScriptedProducer(t *testing.T) {
+	channelID := "testchannel"
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	txeventch := make(chan *fab.TxStatusEvent, 10)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	dispatcherEventch <- NewRegisterTxStatusEvent("txid2", txeventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for TxStatus events: %s", err)
+	}
+
+	cceventch := make(chan *fab.CCEvent, 10)
+	dispatcherEventch <- NewRegisterChaincodeEvent("mycc", "event1", cceventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for CC events: %s", err)
+	}
+
+	clock := servicemocks.NewManualClock(time.Now())
+	done := servicemocks.NewScriptedProducer(channelID, clock).
+		Block(0, servicemocks.NewTransaction("txid1", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION)).
+		TxStatus(time.Minute, "txid2", pb.TxValidationCode_MVCC_READ_CONFLICT).
+		ChaincodeEvent(time.Minute, "txid3", "mycc", "event1", []byte("payload")).
+		Play(dispatcherEventch)
+
+	// Only the first block is sent before the clock is advanced
+	select {
+	case <-txeventch:
+		t.Fatalf("unexpected TxStatus event before clock was advanced")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if dispatcher.LastBlockNum() != 0 {
+		t.Fatalf("Expecting last block number 0 but got %d", dispatcher.LastBlockNum())
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case event := <-txeventch:
+		if event.TxValidationCode != pb.TxValidationCode_MVCC_READ_CONFLICT {
+			t.Fatalf("Expecting validation code %s but got %s", pb.TxValidationCode_MVCC_READ_CONFLICT, event.TxValidationCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event")
+	}
+
+	select {
+	case <-cceventch:
+		t.Fatalf("unexpected CC event before clock was advanced")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case event := <-cceventch:
+		if event.TxID != "txid3" {
+			t.Fatalf("Expecting TxID txid3 but got %s", event.TxID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for CC event")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for script to complete")
+	}
+	if dispatcher.LastBlockNum() != 2 {
+		t.Fatalf("Expecting last block number 2 but got %d", dispatcher.LastBlockNum())
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestEventSequenceNumbers(t *testing.T) {
+	channelID := "testchannel"
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	register := func(event interface{}) {
+		dispatcherEventch <- event
+		select {
+		case <-regch:
+		case err := <-errch:
+			t.Fatalf("Error registering for events: %s", err)
+		}
+	}
+
+	blockch := make(chan *fab.BlockEvent, 10)
+	register(NewRegisterBlockEvent(blockfilter.AcceptAny, blockch, regch, errch))
+	fblockch := make(chan *fab.FilteredBlockEvent, 10)
+	register(NewRegisterFilteredBlockEvent(fblockch, regch, errch))
+	txch1 := make(chan *fab.TxStatusEvent, 10)
+	register(NewRegisterTxStatusEvent("txid1", txch1, regch, errch))
+	txch2 := make(chan *fab.TxStatusEvent, 10)
+	register(NewRegisterTxStatusEvent("txid2", txch2, regch, errch))
+	ccch := make(chan *fab.CCEvent, 10)
+	register(NewRegisterChaincodeEvent("mycc", ".*", ccch, regch, errch))
+
+	dispatcherEventch <- servicemocks.NewBlock(channelID,
+		servicemocks.NewTransactionWithCCEvent("txid1", pb.TxValidationCode_VALID, "mycc", "event1", nil),
+		servicemocks.NewTransaction("txid2", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION),
+	)
+
+	// The events are numbered in the order in which they were processed: block, filtered block,
+	// then the TxStatus event of each transaction followed by its chaincode events
+	select {
+	case event := <-blockch:
+		checkSequenceNum(t, 1, event.SequenceNum)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for block event")
+	}
+	select {
+	case event := <-fblockch:
+		checkSequenceNum(t, 2, event.SequenceNum)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for filtered block event")
+	}
+	select {
+	case event := <-txch1:
+		checkSequenceNum(t, 3, event.SequenceNum)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event")
+	}
+	select {
+	case event := <-ccch:
+		checkSequenceNum(t, 4, event.SequenceNum)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for CC event")
+	}
+	select {
+	case event := <-txch2:
+		checkSequenceNum(t, 5, event.SequenceNum)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestVerifyFilteredBlock(t *testing.T) {
+	channelID := "testchannel"
+	newFullBlock := func() *cb.Block {
+		block := servicemocks.NewBlock(channelID,
+			servicemocks.NewTransaction("txid1", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION),
+			servicemocks.NewTransaction("txid2", pb.TxValidationCode_MVCC_READ_CONFLICT, cb.HeaderType_ENDORSER_TRANSACTION),
+		)
+		block.Header.Number = 5
+		return block
+	}
+
+	full := newFullBlock()
+	if err := VerifyFilteredBlock(toFilteredBlock(full), full); err != nil {
+		t.Fatalf("Expecting filtered block to be consistent but got error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(filtered *pb.FilteredBlock)
+		expected string
+	}{
+		{"block number", func(f *pb.FilteredBlock) { f.Number = 6 }, "doesn't match full block number"},
+		{"channel", func(f *pb.FilteredBlock) { f.ChannelId = "otherchannel" }, "filtered block is for channel [otherchannel]"},
+		{"txID", func(f *pb.FilteredBlock) { f.FilteredTransactions[1].Txid = "txid3" }, "transaction 1 of block 5: filtered block has TxID [txid3] but full block has TxID [txid2]"},
+		{"order", func(f *pb.FilteredBlock) {
+			f.FilteredTransactions[0], f.FilteredTransactions[1] = f.FilteredTransactions[1], f.FilteredTransactions[0]
+		}, "transaction 0 of block 5: filtered block has TxID [txid2] but full block has TxID [txid1]"},
+		{"validation code", func(f *pb.FilteredBlock) {
+			f.FilteredTransactions[0].TxValidationCode = pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE
+		}, "filtered block has validation code ENDORSEMENT_POLICY_FAILURE but full block has validation code VALID"},
+		{"missing", func(f *pb.FilteredBlock) { f.FilteredTransactions = f.FilteredTransactions[:1] }, "transaction 1 [txid2] of block 5 is missing from the filtered block"},
+		{"extra", func(f *pb.FilteredBlock) {
+			f.FilteredTransactions = append(f.FilteredTransactions, servicemocks.NewFilteredTx("txid3", pb.TxValidationCode_VALID))
+		}, "filtered block 5 contains 3 transactions but full block contains 2 transactions"},
+	}
+
+	for _, test := range tests {
+		full := newFullBlock()
+		filtered := toFilteredBlock(full)
+		test.mutate(filtered)
+		err := VerifyFilteredBlock(filtered, full)
+		if err == nil {
+			t.Fatalf("%s: expecting error", test.name)
+		}
+		if !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expecting error containing [%s] but got [%s]", test.name, test.expected, err)
+		}
+	}
+}
+
+func checkSequenceNum(t *testing.T, expected, actual uint64) {
+	if actual != expected {
+		t.Fatalf("Expecting sequence number %d but got %d", expected, actual)
+	}
+}
+
+func TestHeartbeatEvents(t *testing.T) {
+	channelID := "testchannel"
+	start := time.Now()
+	clock := servicemocks.NewManualClock(start)
+	dispatcher := New(WithClock(clock))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	dispatcherEventch <- NewRegisterHeartbeatEvent(0, false, make(chan *HeartbeatEvent), regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering for heartbeat with invalid interval")
+	case <-errch:
+	}
+
+	eventch1 := make(chan *HeartbeatEvent, 10)
+	dispatcherEventch <- NewRegisterHeartbeatEvent(time.Minute, false, eventch1, regch, errch)
+	var reg1 fab.Registration
+	select {
+	case reg1 = <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for heartbeat events: %s", err)
+	}
+
+	eventch2 := make(chan *HeartbeatEvent, 10)
+	dispatcherEventch <- NewRegisterHeartbeatEvent(time.Minute, true, eventch2, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for heartbeat events: %s", err)
+	}
+
+	waitForClockWaiters(t, clock, 2)
+
+	// A block is dispatched half way through the interval
+	clock.Advance(30 * time.Second)
+	dispatcherEventch <- servicemocks.NewBlock(channelID)
+	waitForLastBlockNum(t, dispatcher, 0)
+
+	clock.Advance(30 * time.Second)
+	checkHeartbeatEvent(t, eventch1, 0, start.Add(time.Minute))
+
+	// The heartbeat for the second registration is skipped since a block was dispatched within the interval
+	select {
+	case event := <-eventch2:
+		t.Fatalf("unexpected heartbeat event at %s", event.Time)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	waitForClockWaiters(t, clock, 2)
+	clock.Advance(time.Minute)
+	checkHeartbeatEvent(t, eventch1, 0, start.Add(2*time.Minute))
+	checkHeartbeatEvent(t, eventch2, 0, start.Add(2*time.Minute))
+
+	dispatcherEventch <- NewUnregisterEvent(reg1)
+	select {
+	case _, ok := <-eventch1:
+		if ok {
+			t.Fatalf("unexpected heartbeat event after unregister")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for heartbeat event channel to close")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+
+	if _, ok := <-eventch2; ok {
+		t.Fatalf("expecting heartbeat event channel to be closed after stop")
+	}
+}
+
+func TestHeartbeatDeliveryStats(t *testing.T) {
+	start := time.Now()
+	clock := servicemocks.NewManualClock(start)
+	dispatcher := New(WithClock(clock), WithEventConsumerTimeout(-1))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	// The heartbeat is dropped since nobody reads from the unbuffered event channel
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	dispatcherEventch <- NewRegisterHeartbeatEvent(time.Minute, false, make(chan *HeartbeatEvent), regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for heartbeat events: %s", err)
+	}
+
+	waitForClockWaiters(t, clock, 1)
+	clock.Advance(time.Minute)
+	waitForClockWaiters(t, clock, 1)
+
+	reginfoch := make(chan *RegistrationInfo)
+	dispatcherEventch <- NewRegistrationInfoEvent(reginfoch)
+	select {
+	case regInfo := <-reginfoch:
+		if regInfo.DroppedDeliveries != 1 {
+			t.Fatalf("expecting [%d] dropped deliveries but received [%d]", 1, regInfo.DroppedDeliveries)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for registration info")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestMultiTxStatusEvents(t *testing.T) {
+	channelID := "testchannel"
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	producer := servicemocks.NewBlockProducer()
+
+	txID1 := "1234"
+	txID2 := "5678"
+	txID3 := "9012"
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	dispatcherEventch <- NewRegisterMultiTxStatusEvent(nil, make(chan *fab.TxStatusEvent), regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering for TxStatus events without TX IDs")
+	case <-errch:
+	}
+
+	eventch := make(chan *fab.TxStatusEvent, 10)
+	dispatcherEventch <- NewRegisterMultiTxStatusEvent([]string{txID1, txID2, txID2}, eventch, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	// A registration for one of the transactions already exists
+	dispatcherEventch <- NewRegisterMultiTxStatusEvent([]string{txID3, txID2}, make(chan *fab.TxStatusEvent), regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering multiple times for TxStatus events")
+	case <-errch:
+	}
+
+	regInfoch := make(chan *RegistrationInfo, 1)
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoch)
+	if regInfo := <-regInfoch; regInfo.NumTxStatusRegistrations != 1 {
+		t.Fatalf("Expecting 1 TxStatus registration but got %d", regInfo.NumTxStatusRegistrations)
+	}
+
+	dispatcherEventch <- producer.NewFilteredBlock(
+		channelID,
+		servicemocks.NewFilteredTx(txID2, pb.TxValidationCode_MVCC_READ_CONFLICT),
+	)
+	checkTxStatus(t, eventch, txID2, pb.TxValidationCode_MVCC_READ_CONFLICT)
+
+	regStatech := make(chan []RegistrationState, 1)
+	dispatcherEventch <- NewExportRegistrationsEvent(regStatech)
+	states := <-regStatech
+	if len(states) != 1 || len(states[0].TxIDs) != 1 || states[0].TxIDs[0] != txID1 {
+		t.Fatalf("Expecting registration state with pending TxID [%s] but got %+v", txID1, states)
+	}
+
+	dispatcherEventch <- producer.NewFilteredBlock(
+		channelID,
+		servicemocks.NewFilteredTx(txID1, pb.TxValidationCode_VALID),
+	)
+	checkTxStatus(t, eventch, txID1, pb.TxValidationCode_VALID)
+
+	// The registration is removed once the status of all transactions was received
+	select {
+	case _, ok := <-eventch:
+		if ok {
+			t.Fatalf("unexpected TxStatus event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event channel to close")
+	}
+
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoch)
+	if regInfo := <-regInfoch; regInfo.NumTxStatusRegistrations != 0 {
+		t.Fatalf("Expecting no TxStatus registrations but got %d", regInfo.NumTxStatusRegistrations)
+	}
+
+	// Unregister before the status of all transactions was received
+	eventch = make(chan *fab.TxStatusEvent, 10)
+	dispatcherEventch <- NewRegisterMultiTxStatusEvent([]string{txID1, txID3}, eventch, regch, errch)
+	var reg fab.Registration
+	select {
+	case reg = <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	dispatcherEventch <- producer.NewFilteredBlock(
+		channelID,
+		servicemocks.NewFilteredTx(txID1, pb.TxValidationCode_VALID),
+	)
+	checkTxStatus(t, eventch, txID1, pb.TxValidationCode_VALID)
+
+	dispatcherEventch <- NewUnregisterEvent(reg)
+	if _, ok := <-eventch; ok {
+		t.Fatalf("expecting TxStatus event channel to be closed after unregister")
+	}
+
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoch)
+	if regInfo := <-regInfoch; regInfo.NumTxStatusRegistrations != 0 {
+		t.Fatalf("Expecting no TxStatus registrations but got %d", regInfo.NumTxStatusRegistrations)
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func checkTxStatus(t *testing.T, eventch <-chan *fab.TxStatusEvent, expectedTxID string, expectedCode pb.TxValidationCode) {
+	select {
+	case event, ok := <-eventch:
+		if !ok {
+			t.Fatalf("unexpected closed channel")
+		}
+		if event.TxID != expectedTxID {
+			t.Fatalf("Expecting TxID [%s] but got [%s]", expectedTxID, event.TxID)
+		}
+		if event.TxValidationCode != expectedCode {
+			t.Fatalf("Expecting TxValidationCode [%s] but got [%s]", expectedCode, event.TxValidationCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event")
+	}
+}
+
+func TestFilteredBlockEventsWithFullBlocks(t *testing.T) {
+	channelID := "testchannel"
+	txID1 := "1234"
+	txID2 := "5678"
+
+	// Without a block fetcher, registering for full blocks fails
+	testFullBlocksWithoutFetcher(t)
+
+	fetcher := func(ctx reqContext.Context, blockNum uint64) (*cb.Block, error) {
+		if blockNum == 1 {
+			return nil, errors.New("block not found")
+		}
+		return &cb.Block{Header: &cb.BlockHeader{Number: blockNum}}, nil
+	}
+
+	dispatcher := New(WithBlockFetcher(fetcher))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	fbeventch := make(chan *fab.FilteredBlockEvent, 10)
+	fullBlockch := make(chan *FullBlockEvent, 10)
+	filter := func(tx *pb.FilteredTransaction) bool {
+		return tx.Txid == txID1
+	}
+	dispatcherEventch <- NewRegisterFilteredBlockEventWithFullBlocks(filter, fbeventch, fullBlockch, regch, errch)
+
+	var reg fab.Registration
+	select {
+	case reg = <-regch:
+	case err := <-errch:
+		t.Fatalf("Error registering for filtered block events: %s", err)
+	}
+
+	producer := servicemocks.NewBlockProducer()
+
+	// Block 0 contains a matching transaction, so the full block is fetched
+	dispatcherEventch <- producer.NewFilteredBlock(channelID, servicemocks.NewFilteredTx(txID1, pb.TxValidationCode_VALID), servicemocks.NewFilteredTx(txID2, pb.TxValidationCode_VALID))
+	checkFullBlockEvent(t, fullBlockch, 0, false, txID1)
+
+	// The full block of block 1 can't be fetched
+	dispatcherEventch <- producer.NewFilteredBlock(channelID, servicemocks.NewFilteredTx(txID1, pb.TxValidationCode_VALID))
+	checkFullBlockEvent(t, fullBlockch, 1, true, txID1)
+
+	// Block 2 doesn't contain a matching transaction, so the full block isn't fetched
+	dispatcherEventch <- producer.NewFilteredBlock(channelID, servicemocks.NewFilteredTx(txID2, pb.TxValidationCode_VALID))
+	waitForLastBlockNum(t, dispatcher, 2)
+	select {
+	case event := <-fullBlockch:
+		t.Fatalf("unexpected full block event for block %d", event.BlockNum)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// All of the filtered blocks are delivered regardless of the full block failure
+	for i := uint64(0); i < 3; i++ {
+		select {
+		case fbevent := <-fbeventch:
+			if fbevent.FilteredBlock.Number != i {
+				t.Fatalf("Expecting filtered block %d but got %d", i, fbevent.FilteredBlock.Number)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for filtered block event")
+		}
+	}
+
+	dispatcherEventch <- NewUnregisterEvent(reg)
+	if _, ok := <-fullBlockch; ok {
+		t.Fatalf("expecting full block channel to be closed after unregister")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func testFullBlocksWithoutFetcher(t *testing.T) {
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	dispatcherEventch <- NewRegisterFilteredBlockEventWithFullBlocks(nil, make(chan *fab.FilteredBlockEvent), make(chan *FullBlockEvent), regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering for full blocks without a block fetcher")
+	case <-errch:
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func checkFullBlockEvent(t *testing.T, eventch <-chan *FullBlockEvent, expectedBlockNum uint64, expectErr bool, expectedTxIDs ...string) {
+	select {
+	case event := <-eventch:
+		if event.BlockNum != expectedBlockNum {
+			t.Fatalf("Expecting full block %d but got %d", expectedBlockNum, event.BlockNum)
+		}
+		if !reflect.DeepEqual(event.TxIDs, expectedTxIDs) {
+			t.Fatalf("Expecting TxIDs %v but got %v", expectedTxIDs, event.TxIDs)
+		}
+		if expectErr {
+			if event.Err == nil || event.Block != nil {
+				t.Fatalf("Expecting error fetching full block %d", expectedBlockNum)
+			}
+			return
+		}
+		if event.Err != nil {
+			t.Fatalf("Error fetching full block %d: %s", expectedBlockNum, event.Err)
+		}
+		if event.Block.Header.Number != expectedBlockNum {
+			t.Fatalf("Expecting block %d but got %d", expectedBlockNum, event.Block.Header.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for full block event")
+	}
+}
+
+func TestTxStatusEventsWithTTL(t *testing.T) {
+	channelID := "testchannel"
+	clock := servicemocks.NewManualClock(time.Now())
+	dispatcher := New(WithClock(clock))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	txID1 := "1234"
+	txID2 := "5678"
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	dispatcherEventch <- NewRegisterTxStatusEventWithTTL(txID1, -time.Minute, make(chan *fab.TxStatusEvent), nil, regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering for TxStatus events with invalid TTL")
+	case <-errch:
+	}
+
+	eventch1 := make(chan *fab.TxStatusEvent, 10)
+	expiredch1 := make(chan error, 1)
+	dispatcherEventch <- NewRegisterTxStatusEventWithTTL(txID1, time.Minute, eventch1, expiredch1, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	eventch2 := make(chan *fab.TxStatusEvent, 10)
+	expiredch2 := make(chan error, 1)
+	dispatcherEventch <- NewRegisterTxStatusEventWithTTL(txID2, time.Minute, eventch2, expiredch2, regch, errch)
+	var reg2 fab.Registration
+	select {
+	case reg2 = <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	waitForClockWaiters(t, clock, 2)
+
+	// The status of the second transaction arrives before the TTL elapses
+	dispatcherEventch <- servicemocks.NewBlockProducer().NewFilteredBlock(
+		channelID,
+		servicemocks.NewFilteredTx(txID2, pb.TxValidationCode_VALID),
+	)
+	select {
+	case event := <-eventch2:
+		if event.TxID != txID2 {
+			t.Fatalf("Expecting TxID [%s] but got [%s]", txID2, event.TxID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event")
+	}
+
+	clock.Advance(time.Minute)
+
+	select {
+	case err := <-expiredch1:
+		if err == nil {
+			t.Fatalf("expecting expiry error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus registration to expire")
+	}
+	if _, ok := <-eventch1; ok {
+		t.Fatalf("expecting TxStatus event channel to be closed after expiry")
+	}
+
+	// The second registration doesn't expire since its status was received
+	select {
+	case err := <-expiredch2:
+		t.Fatalf("unexpected expiry of TxStatus registration: %s", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	regInfoch := make(chan *RegistrationInfo, 1)
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoch)
+	if regInfo := <-regInfoch; regInfo.NumTxStatusRegistrations != 1 {
+		t.Fatalf("Expecting 1 TxStatus registration but got %d", regInfo.NumTxStatusRegistrations)
+	}
+
+	dispatcherEventch <- NewUnregisterEvent(reg2)
+	if _, ok := <-eventch2; ok {
+		t.Fatalf("expecting TxStatus event channel to be closed after unregister")
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestTxStatusEventsUntilBlock(t *testing.T) {
+	channelID := "testchannel"
+	dispatcher := New()
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	txID1 := "1234"
+	txID2 := "5678"
+
+	producer := servicemocks.NewBlockProducer()
+	dispatcherEventch <- producer.NewFilteredBlock(channelID, servicemocks.NewFilteredTx("txid0", pb.TxValidationCode_VALID))
+	waitForLastBlockNum(t, dispatcher, 0)
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	// Block 0 has already been dispatched
+	dispatcherEventch <- NewRegisterTxStatusEventUntilBlock(txID1, 0, make(chan *fab.TxStatusEvent), nil, regch, errch)
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering for TxStatus events until a block that was already dispatched")
+	case <-errch:
+	}
+
+	eventch1 := make(chan *fab.TxStatusEvent, 10)
+	expiredch1 := make(chan error, 1)
+	dispatcherEventch <- NewRegisterTxStatusEventUntilBlock(txID1, 2, eventch1, expiredch1, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	eventch2 := make(chan *fab.TxStatusEvent, 10)
+	expiredch2 := make(chan error, 1)
+	dispatcherEventch <- NewRegisterTxStatusEventUntilBlock(txID2, 1, eventch2, expiredch2, regch, errch)
+	select {
+	case <-regch:
+	case err := <-errch:
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	// The status of the second transaction is received in block 1, after which the registration is removed
+	dispatcherEventch <- producer.NewFilteredBlock(channelID, servicemocks.NewFilteredTx(txID2, pb.TxValidationCode_VALID))
+	checkTxStatus(t, eventch2, txID2, pb.TxValidationCode_VALID)
+	if _, ok := <-eventch2; ok {
+		t.Fatalf("expecting TxStatus event channel to be closed once the block bound is reached")
+	}
+	select {
+	case err := <-expiredch2:
+		t.Fatalf("unexpected expiry of TxStatus registration whose status was received: %s", err)
+	default:
+	}
+
+	// The status of the first transaction isn't received by block 2
+	dispatcherEventch <- producer.NewFilteredBlock(channelID, servicemocks.NewFilteredTx("txid3", pb.TxValidationCode_VALID))
+	select {
+	case err := <-expiredch1:
+		if err == nil {
+			t.Fatalf("expecting expiry error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus registration to be removed")
+	}
+	if _, ok := <-eventch1; ok {
+		t.Fatalf("expecting TxStatus event channel to be closed once the block bound is reached")
+	}
+
+	regInfoch := make(chan *RegistrationInfo, 1)
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoch)
+	if regInfo := <-regInfoch; regInfo.NumTxStatusRegistrations != 0 {
+		t.Fatalf("Expecting no TxStatus registrations but got %d", regInfo.NumTxStatusRegistrations)
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func TestMultiChannelEvents(t *testing.T) {
+	channel1 := "channel1"
+	channel2 := "channel2"
+
+	dispatcher := New(
+		WithEventConsumerTimeout(2*time.Second),
+		WithChannelID(channel1),
+	)
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+
+	dispatcherEventch, err := dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+	register := func(event interface{}) {
+		dispatcherEventch <- event
+		select {
+		case <-regch:
+		case err := <-errch:
+			t.Fatalf("Error registering for events: %s", err)
+		}
+	}
+
+	// fbeventch1 is registered for the default channel
+	fbeventch1 := make(chan *fab.FilteredBlockEvent, 10)
+	register(NewRegisterFilteredBlockEvent(fbeventch1, regch, errch))
+
+	fbeventch2 := make(chan *fab.FilteredBlockEvent, 10)
+	fbRegEvent := NewRegisterFilteredBlockEvent(fbeventch2, regch, errch)
+	fbRegEvent.Reg.ChannelID = channel2
+	register(fbRegEvent)
+
+	// The same chaincode event may be registered for each channel
+	cceventch1 := make(chan *fab.CCEvent, 10)
+	register(NewRegisterChaincodeEvent("cc1", "event1", cceventch1, regch, errch))
+	cceventch2 := make(chan *fab.CCEvent, 10)
+	ccRegEvent := NewRegisterChaincodeEvent("cc1", "event1", cceventch2, regch, errch)
+	ccRegEvent.Reg.ChannelID = channel2
+	register(ccRegEvent)
+
+	txeventch := make(chan *fab.TxStatusEvent, 10)
+	txRegEvent := NewRegisterTxStatusEvent("tx2", txeventch, regch, errch)
+	txRegEvent.Reg.ChannelID = channel2
+	register(txRegEvent)
+
+	// The block numbers of each channel start at 0
+	dispatcherEventch <- servicemocks.NewBlockProducer().NewFilteredBlock(channel1, servicemocks.NewFilteredTxWithCCEvent("tx1", "cc1", "event1"))
+	dispatcherEventch <- servicemocks.NewBlockProducer().NewFilteredBlock(channel2, servicemocks.NewFilteredTxWithCCEvent("tx2", "cc1", "event1"))
+
+	checkFilteredBlock := func(eventch chan *fab.FilteredBlockEvent, expectedChannelID string) {
+		select {
+		case event := <-eventch:
+			if event.FilteredBlock.ChannelId != expectedChannelID {
+				t.Fatalf("expecting filtered block of channel [%s] but got channel [%s]", expectedChannelID, event.FilteredBlock.ChannelId)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for filtered block of channel [%s]", expectedChannelID)
+		}
+	}
+	checkCCEvent := func(eventch chan *fab.CCEvent, expectedTxID string) {
+		select {
+		case event := <-eventch:
+			if event.TxID != expectedTxID {
+				t.Fatalf("expecting chaincode event for TxID [%s] but got TxID [%s]", expectedTxID, event.TxID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for chaincode event for TxID [%s]", expectedTxID)
+		}
+	}
+
+	checkFilteredBlock(fbeventch1, channel1)
+	checkFilteredBlock(fbeventch2, channel2)
+	checkCCEvent(cceventch1, "tx1")
+	checkCCEvent(cceventch2, "tx2")
+	select {
+	case event := <-txeventch:
+		if event.TxID != "tx2" {
+			t.Fatalf("expecting TxStatus event for TxID [tx2] but got TxID [%s]", event.TxID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for TxStatus event")
+	}
+
+	// Each registration only receives the events of its channel
+	select {
+	case event := <-fbeventch1:
+		t.Fatalf("unexpected filtered block of channel [%s]", event.FilteredBlock.ChannelId)
+	case event := <-cceventch1:
+		t.Fatalf("unexpected chaincode event for TxID [%s]", event.TxID)
+	default:
+	}
+
+	if blockNum := dispatcher.LastBlockNum(); blockNum != 0 {
+		t.Fatalf("expecting last block number 0 of the default channel but got %d", blockNum)
+	}
+
+	regInfoCh := make(chan *RegistrationInfo)
+	dispatcherEventch <- NewRegistrationInfoEvent(regInfoCh)
+	regInfo := <-regInfoCh
+	if chRegInfo := regInfo.Channels[channel1]; chRegInfo == nil || chRegInfo.NumFilteredBlockRegistrations != 1 || chRegInfo.NumCCRegistrations != 1 || chRegInfo.NumTxStatusRegistrations != 0 {
+		t.Fatalf("unexpected registration info for channel [%s]: %+v", channel1, chRegInfo)
+	}
+	if chRegInfo := regInfo.Channels[channel2]; chRegInfo == nil || chRegInfo.NumFilteredBlockRegistrations != 1 || chRegInfo.NumCCRegistrations != 1 {
+		t.Fatalf("unexpected registration info for channel [%s]: %+v", channel2, chRegInfo)
+	}
+
+	stopResp := make(chan error)
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+
+	// Channel-scoped registrations require a default channel
+	dispatcher = New(WithEventConsumerTimeout(2 * time.Second))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Error starting dispatcher: %s", err)
+	}
+	dispatcherEventch, err = dispatcher.EventCh()
+	if err != nil {
+		t.Fatalf("Error getting event channel from dispatcher: %s", err)
+	}
+	blockRegEvent := NewRegisterBlockEvent(blockfilter.AcceptAny, make(chan *fab.BlockEvent), regch, errch)
+	blockRegEvent.Reg.ChannelID = channel2
+	dispatcherEventch <- blockRegEvent
+	select {
+	case <-regch:
+		t.Fatalf("expecting error registering for a channel without a default channel")
+	case <-errch:
+	}
+
+	dispatcherEventch <- NewStopEvent(stopResp)
+	if err := <-stopResp; err != nil {
+		t.Fatalf("Error stopping dispatcher: %s", err)
+	}
+}
+
+func checkHeartbeatEvent(t *testing.T, eventch <-chan *HeartbeatEvent, expectedBlockNum uint64, expectedTime time.Time) {
+	select {
+	case event := <-eventch:
+		if event.LastBlockNum != expectedBlockNum {
+			t.Fatalf("Expecting last block number %d but got %d", expectedBlockNum, event.LastBlockNum)
+		}
+		if !event.Time.Equal(expectedTime) {
+			t.Fatalf("Expecting heartbeat time %s but got %s", expectedTime, event.Time)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for heartbeat event")
+	}
+}
+
+func waitForClockWaiters(t *testing.T, clock *servicemocks.ManualClock, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.NumWaiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d clock waiters", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitForLastBlockNum(t *testing.T, dispatcher *Dispatcher, blockNum uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for dispatcher.LastBlockNum() != blockNum {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for block %d to be dispatched", blockNum)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 }
@@ -7,6 +7,9 @@ SPDX-License-Identifier: Apache-2.0
 package dispatcher
 
 import (
+	"regexp"
+	"time"
+
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
 )
@@ -19,11 +22,41 @@ type Event interface{}
 type RegisterEvent struct {
 	RegCh chan<- fab.Registration
 	ErrCh chan<- error
+	// ConnStatusCh (optional) receives the status of the connection to the event producer when it changes
+	// (see ConnectionStatusEvent). Only block and filtered block registrations receive connection status
+	// notifications. The channel should be buffered since notifications are dropped if it's full, and it
+	// isn't closed when the registration is removed.
+	ConnStatusCh chan<- *ConnectionStatusEvent
 }
 
 // StopEvent tells the dispatcher to stop processing
 type StopEvent struct {
 	ErrCh chan<- error
+	// StatsCh (optional) receives the stop statistics before the ErrCh signal. In drain mode, the statistics
+	// are taken after the queued events have been drained.
+	StatsCh chan<- *StopStats
+	// RegInfoCh (optional) receives a snapshot of the registrations that were still active when the
+	// dispatcher was stopped, before the registrations are removed and before the ErrCh signal.
+	// No events are delivered to the registrations after the snapshot is taken.
+	RegInfoCh chan<- *RegistrationInfo
+	// Drain indicates that the events that are queued for the dispatcher when it's stopped (for example, blocks
+	// that were received from the producer but not yet dispatched) are delivered to the registrations before the
+	// registrations are removed. If false, queued events are dropped.
+	Drain bool
+	// DrainTimeout bounds the time spent delivering queued events in drain mode, including the time spent waiting
+	// for consumers whose event channels are full. If zero, a default timeout is used.
+	DrainTimeout time.Duration
+}
+
+// StopStats contains the state of the dispatcher at the time it was stopped
+type StopStats struct {
+	// PendingEvents is the number of events that were queued for the dispatcher but not yet processed
+	PendingEvents int
+	// QueuedEvents contains, by registration type, the number of events that were delivered
+	// to registration channels but not yet consumed
+	QueuedEvents map[RegistrationType]int
+	// ActiveRegistrations contains the number of active registrations by registration type
+	ActiveRegistrations map[RegistrationType]int
 }
 
 // RegisterBlockEvent registers for block events
@@ -42,6 +75,8 @@ type RegisterFilteredBlockEvent struct {
 type RegisterChaincodeEvent struct {
 	RegisterEvent
 	Reg *ChaincodeReg
+	// filterErr is the error that occurred while compiling the event filter
+	filterErr error
 }
 
 // RegisterTxStatusEvent registers for transaction status events
@@ -55,6 +90,13 @@ type UnregisterEvent struct {
 	Reg fab.Registration
 }
 
+// BulkUnregisterEvent unregisters all registrations of the given type
+type BulkUnregisterEvent struct {
+	RegType RegistrationType
+	// CountCh (optional) receives the number of registrations that were removed
+	CountCh chan<- int
+}
+
 // RegistrationInfo contains a snapshot of the current event registrations
 type RegistrationInfo struct {
 	TotalRegistrations            int
@@ -62,6 +104,22 @@ type RegistrationInfo struct {
 	NumFilteredBlockRegistrations int
 	NumCCRegistrations            int
 	NumTxStatusRegistrations      int
+	// Channels contains the registration counts by channel ID
+	Channels map[string]*ChannelRegistrationInfo
+	// BlockedDeliveries is the total number of events for which the dispatcher was blocked waiting for a consumer
+	BlockedDeliveries uint64
+	// DroppedDeliveries is the total number of events that couldn't be delivered to a consumer
+	DroppedDeliveries uint64
+	// DeliveryStats contains the delivery statistics of the current registrations that had blocked or dropped deliveries
+	DeliveryStats []*DeliveryStats
+}
+
+// ChannelRegistrationInfo contains the registration counts of a channel
+type ChannelRegistrationInfo struct {
+	NumBlockRegistrations         int
+	NumFilteredBlockRegistrations int
+	NumCCRegistrations            int
+	NumTxStatusRegistrations      int
 }
 
 // RegistrationInfoEvent requests registration information
@@ -69,6 +127,25 @@ type RegistrationInfoEvent struct {
 	RegInfoCh chan<- *RegistrationInfo
 }
 
+// ChaincodeRegInfoEvent requests the descriptors of the current chaincode event registrations
+type ChaincodeRegInfoEvent struct {
+	RegInfoCh chan<- []*ChaincodeRegInfo
+}
+
+// ExportRegistrationsEvent requests the state of all registrations
+type ExportRegistrationsEvent struct {
+	RegStateCh chan<- []RegistrationState
+}
+
+// RestoreLastBlockNumEvent restores the number of the last block that was dispatched.
+// Blocks with a number less than or equal to the restored block number are not dispatched.
+type RestoreLastBlockNumEvent struct {
+	// ChannelID (optional) is the channel whose block number is restored (the default channel if empty)
+	ChannelID string
+	BlockNum  uint64
+	ErrCh     chan<- error
+}
+
 // NewRegisterBlockEvent creates a new RegisterBlockEvent
 func NewRegisterBlockEvent(filter fab.BlockFilter, eventch chan<- *fab.BlockEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterBlockEvent {
 	return &RegisterBlockEvent{
@@ -77,6 +154,20 @@ func NewRegisterBlockEvent(filter fab.BlockFilter, eventch chan<- *fab.BlockEven
 	}
 }
 
+// NewRegisterBlockEventFromBlock creates a new RegisterBlockEvent for which delivery starts at the given block.
+// If the block has already been dispatched then the blocks from the given block are replayed before live delivery
+// resumes. Recent blocks are replayed from the dispatcher's replay buffer (see WithBlockReplayBufferSize) and older
+// blocks are fetched from the event source with the dispatcher's BlockFetcher (see WithBlockFetcher); fetched blocks
+// have a SequenceNum of zero. If the older blocks can't be fetched (or no BlockFetcher is configured) then delivery
+// starts immediately at the oldest available block. If the block hasn't been dispatched yet then blocks are not
+// delivered until the given block is reached.
+func NewRegisterBlockEventFromBlock(filter fab.BlockFilter, fromBlock uint64, eventch chan<- *fab.BlockEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterBlockEvent {
+	event := NewRegisterBlockEvent(filter, eventch, respch, errCh)
+	event.Reg.HasFromBlock = true
+	event.Reg.FromBlock = fromBlock
+	return event
+}
+
 // NewRegisterFilteredBlockEvent creates a new RegisterFilterBlockEvent
 func NewRegisterFilteredBlockEvent(eventch chan<- *fab.FilteredBlockEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterFilteredBlockEvent {
 	return &RegisterFilteredBlockEvent{
@@ -92,15 +183,39 @@ func NewUnregisterEvent(reg fab.Registration) *UnregisterEvent {
 	}
 }
 
-// NewRegisterChaincodeEvent creates a new RegisterChaincodeEvent
+// NewBulkUnregisterEvent creates a new BulkUnregisterEvent. The number of registrations that were
+// removed is sent to countch (if not nil), which should be buffered.
+func NewBulkUnregisterEvent(regType RegistrationType, countch chan<- int) *BulkUnregisterEvent {
+	return &BulkUnregisterEvent{
+		RegType: regType,
+		CountCh: countch,
+	}
+}
+
+// NewRegisterChaincodeEvent creates a new RegisterChaincodeEvent. The event filter is a regular expression
+// that's compiled once, when the event is created; if it's invalid then the registration fails with an error.
 func NewRegisterChaincodeEvent(ccID, eventFilter string, eventch chan<- *fab.CCEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterChaincodeEvent {
+	return newRegisterChaincodeEvent(ccID, eventFilter, false, eventch, respch, errCh)
+}
+
+// NewRegisterChaincodeEventExactMatch creates a new RegisterChaincodeEvent for chaincode events whose
+// name is exactly the given event name (the name isn't interpreted as a regular expression)
+func NewRegisterChaincodeEventExactMatch(ccID, eventName string, eventch chan<- *fab.CCEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterChaincodeEvent {
+	return newRegisterChaincodeEvent(ccID, eventName, true, eventch, respch, errCh)
+}
+
+func newRegisterChaincodeEvent(ccID, eventFilter string, exactMatch bool, eventch chan<- *fab.CCEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterChaincodeEvent {
+	regExp, err := regexp.Compile(eventFilterPattern(eventFilter, exactMatch))
 	return &RegisterChaincodeEvent{
 		Reg: &ChaincodeReg{
 			ChaincodeID: ccID,
 			EventFilter: eventFilter,
+			ExactMatch:  exactMatch,
+			EventRegExp: regExp,
 			Eventch:     eventch,
 		},
 		RegisterEvent: NewRegisterEvent(respch, errCh),
+		filterErr:     err,
 	}
 }
 
@@ -112,6 +227,26 @@ func NewRegisterTxStatusEvent(txID string, eventch chan<- *fab.TxStatusEvent, re
 	}
 }
 
+// NewRegisterMultiTxStatusEvent creates a new RegisterTxStatusEvent for the status of multiple transactions.
+// The status of each transaction is sent to the same event channel (the TxID of the event identifies the
+// transaction). The registration is removed and the event channel is closed once the status of all of the
+// transactions has been received.
+func NewRegisterMultiTxStatusEvent(txIDs []string, eventch chan<- *fab.TxStatusEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterTxStatusEvent {
+	ids := make([]string, 0, len(txIDs))
+	seen := make(map[string]bool)
+	for _, txID := range txIDs {
+		if !seen[txID] {
+			seen[txID] = true
+			ids = append(ids, txID)
+		}
+	}
+
+	return &RegisterTxStatusEvent{
+		Reg:           &TxStatusReg{TxIDs: ids, Eventch: eventch},
+		RegisterEvent: NewRegisterEvent(respch, errCh),
+	}
+}
+
 // NewRegisterEvent creates a new RgisterEvent
 func NewRegisterEvent(respch chan<- fab.Registration, errCh chan<- error) RegisterEvent {
 	return RegisterEvent{
@@ -145,7 +280,50 @@ func NewStopEvent(errch chan<- error) *StopEvent {
 	}
 }
 
+// NewStopEventWithStats creates a new StopEvent that delivers the stop statistics to the given
+// channel (which should be buffered) before the ErrCh signal
+func NewStopEventWithStats(errch chan<- error, statsch chan<- *StopStats) *StopEvent {
+	return &StopEvent{
+		ErrCh:   errch,
+		StatsCh: statsch,
+	}
+}
+
+// NewStopEventWithRegistrationInfo creates a new StopEvent that delivers a snapshot of the registrations
+// that were still active to the given channel (which should be buffered) before the ErrCh signal
+func NewStopEventWithRegistrationInfo(errch chan<- error, regInfoCh chan<- *RegistrationInfo) *StopEvent {
+	return &StopEvent{
+		ErrCh:     errch,
+		RegInfoCh: regInfoCh,
+	}
+}
+
+// NewStopEventWithDrain creates a new StopEvent that delivers the events that are queued for the dispatcher
+// to the registrations (bounded by the given timeout or, if zero, a default timeout) before the ErrCh signal
+func NewStopEventWithDrain(errch chan<- error, drainTimeout time.Duration) *StopEvent {
+	return &StopEvent{
+		ErrCh:        errch,
+		Drain:        true,
+		DrainTimeout: drainTimeout,
+	}
+}
+
 // NewRegistrationInfoEvent returns a new RegistrationInfoEvent
 func NewRegistrationInfoEvent(regInfoCh chan<- *RegistrationInfo) *RegistrationInfoEvent {
 	return &RegistrationInfoEvent{RegInfoCh: regInfoCh}
 }
+
+// NewChaincodeRegInfoEvent returns a new ChaincodeRegInfoEvent
+func NewChaincodeRegInfoEvent(regInfoCh chan<- []*ChaincodeRegInfo) *ChaincodeRegInfoEvent {
+	return &ChaincodeRegInfoEvent{RegInfoCh: regInfoCh}
+}
+
+// NewExportRegistrationsEvent returns a new ExportRegistrationsEvent
+func NewExportRegistrationsEvent(regStateCh chan<- []RegistrationState) *ExportRegistrationsEvent {
+	return &ExportRegistrationsEvent{RegStateCh: regStateCh}
+}
+
+// NewRestoreLastBlockNumEvent returns a new RestoreLastBlockNumEvent
+func NewRestoreLastBlockNumEvent(blockNum uint64, errch chan<- error) *RestoreLastBlockNumEvent {
+	return &RestoreLastBlockNumEvent{BlockNum: blockNum, ErrCh: errch}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	reqContext "context"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// BlockFetcher fetches the full block with the given number, for example, by querying the ledger of a
+// peer (see channel.Ledger). The context is cancelled if the block is no longer required.
+type BlockFetcher func(ctx reqContext.Context, blockNum uint64) (*cb.Block, error)
+
+// TxFilter returns true if the full block of the filtered transaction is required
+type TxFilter func(tx *pb.FilteredTransaction) bool
+
+// FullBlockEvent contains the full block that was fetched for a filtered block that contains
+// transactions that were accepted by the TxFilter of the registration
+type FullBlockEvent struct {
+	// BlockNum is the number of the block
+	BlockNum uint64
+	// TxIDs contains the IDs of the transactions that were accepted by the TxFilter
+	TxIDs []string
+	// Block is the full block (nil if the block couldn't be fetched)
+	Block *cb.Block
+	// Err is the error if the block couldn't be fetched
+	Err error
+}
+
+// fullBlockFetchedEvent is sent to the dispatcher when the full block for a filtered block registration was fetched
+type fullBlockFetchedEvent struct {
+	reg   *FilteredBlockReg
+	event *FullBlockEvent
+}
+
+// NewRegisterFilteredBlockEventWithFullBlocks creates a new RegisterFilteredBlockEvent for which the full block is
+// also delivered to fullBlockch when a filtered block contains transactions that are accepted by the given filter
+// (if nil, all transactions are accepted). The full blocks are fetched with the dispatcher's BlockFetcher (see
+// WithBlockFetcher) without blocking the delivery of events, so a full block may be delivered after subsequent
+// filtered blocks and full blocks may be delivered out of order. If a full block can't be fetched then an event
+// that contains the error is delivered to fullBlockch and the delivery of filtered blocks continues. Both channels
+// are closed when the registration is removed, and outstanding fetches are cancelled.
+func NewRegisterFilteredBlockEventWithFullBlocks(filter TxFilter, eventch chan<- *fab.FilteredBlockEvent, fullBlockch chan<- *FullBlockEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterFilteredBlockEvent {
+	event := NewRegisterFilteredBlockEvent(eventch, respch, errCh)
+	event.Reg.TxFilter = filter
+	event.Reg.FullBlockch = fullBlockch
+	return event
+}
+
+// startFullBlocks prepares the registration for the delivery of full blocks (if requested)
+func (ed *Dispatcher) startFullBlocks(reg *FilteredBlockReg) error {
+	if reg.FullBlockch == nil {
+		return nil
+	}
+	if ed.blockFetcher == nil {
+		return errors.New("full blocks can't be delivered since no block fetcher is configured")
+	}
+	if !ed.isDefaultChannel(reg.ChannelID) {
+		return errors.Errorf("full blocks can only be delivered for the default channel and not for channel [%s]", reg.ChannelID)
+	}
+	reg.ctx, reg.cancel = reqContext.WithCancel(reqContext.Background())
+	return nil
+}
+
+// stopFullBlocks cancels the outstanding fetches of the registration and closes its full block channel
+func (ed *Dispatcher) stopFullBlocks(reg *FilteredBlockReg) {
+	if reg.cancel == nil {
+		return
+	}
+	reg.cancel()
+	reg.cancel = nil
+	close(reg.FullBlockch)
+}
+
+// fetchFullBlock fetches the full block of the filtered block in the background if the filtered block
+// contains transactions that are accepted by the registration's filter
+func (ed *Dispatcher) fetchFullBlock(reg *FilteredBlockReg, fblock *pb.FilteredBlock) {
+	if reg.cancel == nil {
+		return
+	}
+
+	var txIDs []string
+	for _, tx := range fblock.FilteredTransactions {
+		if reg.TxFilter == nil || reg.TxFilter(tx) {
+			txIDs = append(txIDs, tx.Txid)
+		}
+	}
+	if len(txIDs) == 0 {
+		return
+	}
+
+	logger.Debugf("Fetching full block %d for TxIDs %v", fblock.Number, txIDs)
+
+	go func(ctx reqContext.Context, blockNum uint64) {
+		block, err := ed.blockFetcher(ctx, blockNum)
+		if err != nil {
+			err = errors.WithMessage(err, "fetching full block failed")
+		}
+		event := &FullBlockEvent{BlockNum: blockNum, TxIDs: txIDs, Block: block, Err: err}
+
+		select {
+		case ed.eventch <- &fullBlockFetchedEvent{reg: reg, event: event}:
+		case <-ctx.Done():
+		}
+	}(reg.ctx, fblock.Number)
+}
+
+func (ed *Dispatcher) handleFullBlockFetchedEvent(e Event) {
+	event := e.(*fullBlockFetchedEvent)
+	reg := event.reg
+
+	if reg.cancel == nil {
+		logger.Debugf("Ignoring full block %d since the registration was removed", event.event.BlockNum)
+		return
+	}
+
+	if event.event.Err != nil {
+		logger.Warnf("Unable to fetch full block %d: %s", event.event.BlockNum, event.event.Err)
+	}
+
+	ed.deliver(&reg.deliveries, "full block", func(wait bool, timeout <-chan time.Time) bool {
+		if !wait {
+			select {
+			case reg.FullBlockch <- event.event:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case reg.FullBlockch <- event.event:
+			return true
+		case <-timeout:
+			return false
+		}
+	})
+}
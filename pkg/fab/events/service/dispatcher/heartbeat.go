@@ -0,0 +1,171 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// Clock provides the current time and timers so that heartbeats may be controlled in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (c *realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// HeartbeatEvent is sent to heartbeat registrations at the configured interval
+type HeartbeatEvent struct {
+	// LastBlockNum is the number of the last block that was dispatched
+	// (math.MaxUint64 if no block has been dispatched)
+	LastBlockNum uint64
+	// Time is the time of the heartbeat according to the dispatcher's clock
+	Time time.Time
+}
+
+// HeartbeatReg contains the data for a heartbeat registration
+type HeartbeatReg struct {
+	Interval time.Duration
+	// SkipWhenActive indicates that a heartbeat is not sent if a block was dispatched within the last interval
+	SkipWhenActive bool
+	Eventch        chan<- *HeartbeatEvent
+	done           chan struct{}
+	deliveries     deliveryCounters
+}
+
+// RegisterHeartbeatEvent registers for heartbeat events
+type RegisterHeartbeatEvent struct {
+	RegisterEvent
+	Reg *HeartbeatReg
+}
+
+// heartbeatTickEvent is sent to the dispatcher by the heartbeat timer of a registration
+type heartbeatTickEvent struct {
+	reg  *HeartbeatReg
+	time time.Time
+}
+
+// NewRegisterHeartbeatEvent creates a new RegisterHeartbeatEvent. A heartbeat carrying the number of the last
+// dispatched block is sent to the event channel at the given interval. If skipWhenActive is true then the
+// heartbeat is skipped if a block was dispatched within the last interval.
+func NewRegisterHeartbeatEvent(interval time.Duration, skipWhenActive bool, eventch chan<- *HeartbeatEvent, respch chan<- fab.Registration, errCh chan<- error) *RegisterHeartbeatEvent {
+	return &RegisterHeartbeatEvent{
+		Reg: &HeartbeatReg{
+			Interval:       interval,
+			SkipWhenActive: skipWhenActive,
+			Eventch:        eventch,
+			done:           make(chan struct{}),
+		},
+		RegisterEvent: NewRegisterEvent(respch, errCh),
+	}
+}
+
+func (ed *Dispatcher) handleRegisterHeartbeatEvent(e Event) {
+	event := e.(*RegisterHeartbeatEvent)
+
+	if event.Reg.Interval <= 0 {
+		event.ErrCh <- errors.Errorf("invalid heartbeat interval: %s", event.Reg.Interval)
+		return
+	}
+
+	ed.heartbeatRegistrations = append(ed.heartbeatRegistrations, event.Reg)
+	go ed.runHeartbeatTimer(event.Reg)
+	event.RegCh <- event.Reg
+}
+
+// runHeartbeatTimer submits a tick to the dispatcher at each interval until the registration is removed
+func (ed *Dispatcher) runHeartbeatTimer(reg *HeartbeatReg) {
+	for {
+		select {
+		case t := <-ed.clock.After(reg.Interval):
+			select {
+			case ed.eventch <- &heartbeatTickEvent{reg: reg, time: t}:
+			case <-reg.done:
+				return
+			}
+		case <-reg.done:
+			return
+		}
+	}
+}
+
+func (ed *Dispatcher) handleHeartbeatTickEvent(e Event) {
+	event := e.(*heartbeatTickEvent)
+
+	if !ed.isHeartbeatRegistered(event.reg) {
+		logger.Debugf("Ignoring heartbeat tick for removed registration")
+		return
+	}
+
+	if event.reg.SkipWhenActive && !ed.lastEventTime.IsZero() && event.time.Sub(ed.lastEventTime) < event.reg.Interval {
+		logger.Debugf("Skipping heartbeat since a block was dispatched at %s", ed.lastEventTime)
+		return
+	}
+
+	heartbeat := &HeartbeatEvent{LastBlockNum: ed.LastBlockNum(), Time: event.time}
+
+	ed.deliver(&event.reg.deliveries, "heartbeat", func(wait bool, timeout <-chan time.Time) bool {
+		if !wait {
+			select {
+			case event.reg.Eventch <- heartbeat:
+				return true
+			default:
+				return false
+			}
+		}
+		select {
+		case event.reg.Eventch <- heartbeat:
+			return true
+		case <-timeout:
+			return false
+		}
+	})
+}
+
+func (ed *Dispatcher) isHeartbeatRegistered(reg *HeartbeatReg) bool {
+	for _, r := range ed.heartbeatRegistrations {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
+
+func (ed *Dispatcher) unregisterHeartbeatEvents(registration *HeartbeatReg) error {
+	for i, reg := range ed.heartbeatRegistrations {
+		if reg == registration {
+			logger.Debugf("Unregistering heartbeat events...")
+			close(reg.done)
+			close(reg.Eventch)
+			ed.heartbeatRegistrations = append(ed.heartbeatRegistrations[:i], ed.heartbeatRegistrations[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("the provided registration is invalid")
+}
+
+func (ed *Dispatcher) clearHeartbeatRegistrations() {
+	for _, reg := range ed.heartbeatRegistrations {
+		close(reg.done)
+		close(reg.Eventch)
+	}
+	ed.heartbeatRegistrations = nil
+}
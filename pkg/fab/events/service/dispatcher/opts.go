@@ -15,12 +15,22 @@ import (
 type params struct {
 	eventConsumerBufferSize uint
 	eventConsumerTimeout    time.Duration
+	clock                   Clock
+	blockReplayBufferSize   uint
+	channelID               string
+	blockFetcher            BlockFetcher
+	blockHash               bool
 }
 
+// defaultBlockReplayBufferSize is the default number of recently dispatched blocks that are retained for replay
+const defaultBlockReplayBufferSize = 10
+
 func defaultParams() *params {
 	return &params{
 		eventConsumerBufferSize: 100,
 		eventConsumerTimeout:    500 * time.Millisecond,
+		clock:                   &realClock{},
+		blockReplayBufferSize:   defaultBlockReplayBufferSize,
 	}
 }
 
@@ -45,6 +55,58 @@ func WithEventConsumerTimeout(value time.Duration) options.Opt {
 	}
 }
 
+// WithClock sets the clock that's used to time heartbeats. This option is mainly used for testing.
+func WithClock(value Clock) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(clockSetter); ok {
+			setter.SetClock(value)
+		}
+	}
+}
+
+// WithBlockReplayBufferSize sets the number of recently dispatched blocks that are retained so that they
+// may be replayed to block registrations that start at a previous block (see NewRegisterBlockEventFromBlock).
+// Blocks that are older than the buffered blocks are fetched with the BlockFetcher (see WithBlockFetcher), if
+// configured. The default is 10; a size of 0 disables the buffer.
+func WithBlockReplayBufferSize(value uint) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(blockReplayBufferSizeSetter); ok {
+			setter.SetBlockReplayBufferSize(value)
+		}
+	}
+}
+
+// WithChannelID sets the ID of the channel for which the dispatcher dispatches events. The channel ID
+// is used to report the registrations by channel (see RegistrationInfo).
+func WithChannelID(value string) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(channelIDSetter); ok {
+			setter.SetChannelID(value)
+		}
+	}
+}
+
+// WithBlockFetcher sets the fetcher of the full blocks that are delivered to filtered block registrations
+// that request full blocks (see NewRegisterFilteredBlockEventWithFullBlocks).
+func WithBlockFetcher(value BlockFetcher) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(blockFetcherSetter); ok {
+			setter.SetBlockFetcher(value)
+		}
+	}
+}
+
+// WithBlockHash enables the computation of the block header hash, which is computed once for each block and set
+// on the BlockEvents that are delivered to all block registrations (see fab.BlockEvent.BlockHash). The hash isn't
+// computed by default.
+func WithBlockHash(value bool) options.Opt {
+	return func(p options.Params) {
+		if setter, ok := p.(blockHashSetter); ok {
+			setter.SetBlockHash(value)
+		}
+	}
+}
+
 type eventConsumerBufferSizeSetter interface {
 	SetEventConsumerBufferSize(value uint)
 }
@@ -53,6 +115,26 @@ type eventEventConsumerTimeoutSetter interface {
 	SetEventConsumerTimeout(value time.Duration)
 }
 
+type clockSetter interface {
+	SetClock(value Clock)
+}
+
+type channelIDSetter interface {
+	SetChannelID(value string)
+}
+
+type blockReplayBufferSizeSetter interface {
+	SetBlockReplayBufferSize(value uint)
+}
+
+type blockFetcherSetter interface {
+	SetBlockFetcher(value BlockFetcher)
+}
+
+type blockHashSetter interface {
+	SetBlockHash(value bool)
+}
+
 func (p *params) SetEventConsumerBufferSize(value uint) {
 	logger.Debugf("EventConsumerBufferSize: %d", value)
 	p.eventConsumerBufferSize = value
@@ -62,3 +144,28 @@ func (p *params) SetEventConsumerTimeout(value time.Duration) {
 	logger.Debugf("EventConsumerTimeout: %s", value)
 	p.eventConsumerTimeout = value
 }
+
+func (p *params) SetClock(value Clock) {
+	if value != nil {
+		p.clock = value
+	}
+}
+
+func (p *params) SetBlockReplayBufferSize(value uint) {
+	logger.Debugf("BlockReplayBufferSize: %d", value)
+	p.blockReplayBufferSize = value
+}
+
+func (p *params) SetChannelID(value string) {
+	logger.Debugf("ChannelID: %s", value)
+	p.channelID = value
+}
+
+func (p *params) SetBlockFetcher(value BlockFetcher) {
+	p.blockFetcher = value
+}
+
+func (p *params) SetBlockHash(value bool) {
+	logger.Debugf("BlockHash: %t", value)
+	p.blockHash = value
+}
@@ -7,32 +7,187 @@ SPDX-License-Identifier: Apache-2.0
 package dispatcher
 
 import (
+	reqContext "context"
 	"regexp"
+	"time"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 )
 
 // BlockReg contains the data for a block registration
 type BlockReg struct {
-	Filter  fab.BlockFilter
-	Eventch chan<- *fab.BlockEvent
+	// ChannelID (optional) scopes the registration to the events of the given channel (the default channel of
+	// the dispatcher if empty)
+	ChannelID string
+	Filter    fab.BlockFilter
+	Eventch   chan<- *fab.BlockEvent
+	// HasFromBlock indicates that delivery starts at FromBlock rather than at the next block
+	HasFromBlock bool
+	// FromBlock is the number of the first block to be delivered (only used if HasFromBlock is true)
+	FromBlock uint64
+	// ConnStatusch (optional) receives the status of the connection to the event producer
+	ConnStatusch chan<- *ConnectionStatusEvent
+	deliveries   deliveryCounters
+	// replay is set while the blocks before the buffered blocks are fetched (see startReplay)
+	replay *blockReplay
 }
 
 // FilteredBlockReg contains the data for a filtered block registration
 type FilteredBlockReg struct {
-	Eventch chan<- *fab.FilteredBlockEvent
+	// ChannelID (optional) scopes the registration to the events of the given channel (the default channel of
+	// the dispatcher if empty)
+	ChannelID string
+	Eventch   chan<- *fab.FilteredBlockEvent
+	// FullBlockch is the channel to which full blocks are delivered (see NewRegisterFilteredBlockEventWithFullBlocks)
+	FullBlockch chan<- *FullBlockEvent
+	// TxFilter selects the transactions for which the full block is delivered (all transactions if nil)
+	TxFilter TxFilter
+	// ConnStatusch (optional) receives the status of the connection to the event producer
+	ConnStatusch chan<- *ConnectionStatusEvent
+	deliveries   deliveryCounters
+	// ctx is cancelled (with cancel) when the registration is removed (only used if FullBlockch is set)
+	ctx    reqContext.Context
+	cancel reqContext.CancelFunc
 }
 
 // ChaincodeReg contains the data for a chaincode registration
 type ChaincodeReg struct {
+	// ChannelID (optional) scopes the registration to the events of the given channel (the default channel of
+	// the dispatcher if empty)
+	ChannelID   string
 	ChaincodeID string
 	EventFilter string
+	// ExactMatch indicates that the EventFilter is matched exactly rather than as a regular expression
+	ExactMatch  bool
 	EventRegExp *regexp.Regexp
 	Eventch     chan<- *fab.CCEvent
+	deliveries  deliveryCounters
+}
+
+// ChaincodeRegInfo is a read-only descriptor of a chaincode event registration
+type ChaincodeRegInfo struct {
+	// ChannelID is the channel of a channel-scoped registration (empty for the default channel)
+	ChannelID   string
+	ChaincodeID string
+	EventFilter string
+	// ExactMatch indicates that the EventFilter is matched exactly rather than as a regular expression
+	ExactMatch bool
+}
+
+// eventFilterPattern returns the regular expression for the event filter
+func eventFilterPattern(eventFilter string, exactMatch bool) string {
+	if exactMatch {
+		return "^" + regexp.QuoteMeta(eventFilter) + "$"
+	}
+	return eventFilter
 }
 
 // TxStatusReg contains the data for a transaction status registration
 type TxStatusReg struct {
-	TxID    string
+	// ChannelID (optional) scopes the registration to the events of the given channel (the default channel of
+	// the dispatcher if empty)
+	ChannelID string
+	TxID      string
+	// TxIDs contains the IDs of the transactions of a registration for multiple transactions (TxID is empty)
+	TxIDs   []string
 	Eventch chan<- *fab.TxStatusEvent
+	// TTL (optional) is the time after which the registration expires if no status was received
+	TTL time.Duration
+	// HasMaxBlock indicates that the registration is removed once block MaxBlock has been dispatched
+	HasMaxBlock bool
+	// MaxBlock is the number of the last block for which the status is delivered (only used if HasMaxBlock is true)
+	MaxBlock uint64
+	// Expiredch (optional) receives an error when the registration expires or when its MaxBlock is reached
+	// without receiving the status
+	Expiredch chan<- error
+	done      chan struct{}
+	// pending contains the IDs of the transactions whose status hasn't been received yet
+	// (registrations for multiple transactions only)
+	pending map[string]struct{}
+	// received is set once the status of all of the transactions has been received
+	received   bool
+	deliveries deliveryCounters
+}
+
+// isMulti returns true if the registration is for multiple transactions
+func (reg *TxStatusReg) isMulti() bool {
+	return reg.TxIDs != nil
+}
+
+// txIDs returns the IDs of the transactions of the registration
+func (reg *TxStatusReg) txIDs() []string {
+	if reg.isMulti() {
+		return reg.TxIDs
+	}
+	return []string{reg.TxID}
+}
+
+// pendingTxIDs returns the IDs of the transactions whose status hasn't been received yet
+func (reg *TxStatusReg) pendingTxIDs() []string {
+	if !reg.isMulti() {
+		return []string{reg.TxID}
+	}
+	var txIDs []string
+	for _, txID := range reg.TxIDs {
+		if _, ok := reg.pending[txID]; ok {
+			txIDs = append(txIDs, txID)
+		}
+	}
+	return txIDs
+}
+
+// deliveryCounters counts the events that couldn't be delivered to a registration immediately
+// since its event channel was full
+type deliveryCounters struct {
+	// blocked is the number of events for which the dispatcher had to wait for the consumer
+	blocked uint64
+	// dropped is the number of events that weren't delivered
+	dropped uint64
+}
+
+// DeliveryStats contains the delivery statistics of a registration whose event channel was full when
+// an event was delivered, which indicates that the consumer of the registration is slow
+type DeliveryStats struct {
+	// Registration is the registration, which may be used to unregister a misbehaving consumer
+	Registration fab.Registration
+	// Type is the type of the registration
+	Type RegistrationType
+	// Description identifies the registration (for example, the chaincode ID and event filter)
+	Description string
+	// Blocked is the number of events for which the dispatcher was blocked waiting for the consumer
+	Blocked uint64
+	// Dropped is the number of events that were dropped, either since the consumer didn't accept the
+	// event within the event consumer timeout or since the event channel was full in non-blocking mode
+	Dropped uint64
+}
+
+// RegistrationType is the type of an event registration
+type RegistrationType string
+
+const (
+	// BlockRegistration is a registration for block events
+	BlockRegistration RegistrationType = "block"
+	// FilteredBlockRegistration is a registration for filtered block events
+	FilteredBlockRegistration RegistrationType = "filteredblock"
+	// ChaincodeRegistration is a registration for chaincode events
+	ChaincodeRegistration RegistrationType = "chaincode"
+	// TxStatusRegistration is a registration for transaction status events
+	TxStatusRegistration RegistrationType = "txstatus"
+)
+
+// RegistrationState contains the serializable state of a registration so that
+// the registration may be restored (for example, after a process restart).
+// Note that block filters and event channels are not part of the state.
+type RegistrationState struct {
+	Type        RegistrationType `json:"type"`
+	ChannelID   string           `json:"channelId,omitempty"`
+	ChaincodeID string           `json:"chaincodeId,omitempty"`
+	EventFilter string           `json:"eventFilter,omitempty"`
+	ExactMatch  bool             `json:"exactMatch,omitempty"`
+	TxID        string           `json:"txId,omitempty"`
+	// TxIDs contains the IDs of the pending transactions of a registration for multiple transactions
+	TxIDs []string `json:"txIds,omitempty"`
+	// LastBlockNum is the number of the last block (of the registration's channel) that was dispatched
+	// at the time of the export (math.MaxUint64 if no block has been dispatched)
+	LastBlockNum uint64 `json:"lastBlockNum"`
 }
@@ -0,0 +1,162 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	reqContext "context"
+	"math"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// recentBlock is a dispatched block event that's retained for replay
+type recentBlock struct {
+	channelID string
+	event     *fab.BlockEvent
+}
+
+// blockReplay holds the state of a block registration while the blocks that precede the buffered
+// blocks are fetched from the event source
+type blockReplay struct {
+	cancel reqContext.CancelFunc
+	// pending contains the buffered blocks and the blocks that were dispatched during the replay,
+	// which are delivered after the fetched blocks
+	pending []*fab.BlockEvent
+}
+
+// replayBlocksFetchedEvent is sent to the dispatcher when the blocks for a replay were fetched
+type replayBlocksFetchedEvent struct {
+	reg    *BlockReg
+	replay *blockReplay
+	blocks []*cb.Block
+	// err is the error if not all of the blocks could be fetched
+	err error
+}
+
+// bufferBlock retains the dispatched block event for replay. The buffer is shared by all channels.
+func (ed *Dispatcher) bufferBlock(channelID string, event *fab.BlockEvent) {
+	if ed.blockReplayBufferSize == 0 {
+		return
+	}
+	ed.recentBlocks = append(ed.recentBlocks, &recentBlock{channelID: channelID, event: event})
+	if uint(len(ed.recentBlocks)) > ed.blockReplayBufferSize {
+		ed.recentBlocks = ed.recentBlocks[1:]
+	}
+}
+
+// startReplay delivers the blocks starting at the registration's FromBlock that have already been dispatched.
+// The buffered blocks are replayed immediately. If the registration starts before the oldest buffered block
+// then the missing blocks are fetched in the background with the dispatcher's BlockFetcher (see WithBlockFetcher)
+// and the buffered blocks, as well as the blocks that are dispatched in the meantime, are delivered once the
+// missing blocks have been delivered. If the missing blocks can't be fetched then delivery starts at the
+// oldest available block.
+func (ed *Dispatcher) startReplay(reg *BlockReg) {
+	lastBlockNum := ed.lastBlockNumOf(reg.ChannelID)
+	if lastBlockNum == math.MaxUint64 || reg.FromBlock > lastBlockNum {
+		logger.Debugf("Block %d hasn't been dispatched yet. Waiting for the block.", reg.FromBlock)
+		return
+	}
+
+	var buffered []*fab.BlockEvent
+	for _, recent := range ed.recentBlocks {
+		if ed.inChannel(reg.ChannelID, recent.channelID) && recent.event.Block.Header.Number >= reg.FromBlock {
+			buffered = append(buffered, recent.event)
+		}
+	}
+
+	firstAvailable := lastBlockNum + 1
+	if len(buffered) > 0 {
+		firstAvailable = buffered[0].Block.Header.Number
+	}
+
+	if reg.FromBlock < firstAvailable {
+		if ed.blockFetcher != nil && ed.isDefaultChannel(reg.ChannelID) {
+			ed.fetchReplayBlocks(reg, firstAvailable, buffered)
+			return
+		}
+		logger.Warnf("Blocks %d to %d are not available for replay. Starting delivery at block %d.", reg.FromBlock, firstAvailable-1, firstAvailable)
+	}
+
+	for _, event := range buffered {
+		ed.sendReplayedBlockEvent(reg, event)
+	}
+}
+
+// fetchReplayBlocks fetches the blocks from the registration's FromBlock up to (but excluding) the given block
+// in the background. Live blocks aren't delivered to the registration until the fetched blocks are delivered.
+func (ed *Dispatcher) fetchReplayBlocks(reg *BlockReg, toBlock uint64, buffered []*fab.BlockEvent) {
+	ctx, cancel := reqContext.WithCancel(reqContext.Background())
+	replay := &blockReplay{cancel: cancel, pending: buffered}
+	reg.replay = replay
+
+	logger.Debugf("Fetching blocks %d to %d for replay", reg.FromBlock, toBlock-1)
+
+	go func(fromBlock uint64) {
+		event := &replayBlocksFetchedEvent{reg: reg, replay: replay}
+		for blockNum := fromBlock; blockNum < toBlock; blockNum++ {
+			block, err := ed.blockFetcher(ctx, blockNum)
+			if err == nil && block.GetHeader().GetNumber() != blockNum {
+				err = errors.Errorf("expecting block %d but fetched block %d", blockNum, block.GetHeader().GetNumber())
+			}
+			if err != nil {
+				event.err = errors.WithMessage(err, "fetching block for replay failed")
+				break
+			}
+			event.blocks = append(event.blocks, block)
+		}
+
+		select {
+		case ed.eventch <- event:
+		case <-ctx.Done():
+		}
+	}(reg.FromBlock)
+}
+
+func (ed *Dispatcher) handleReplayBlocksFetchedEvent(e Event) {
+	event := e.(*replayBlocksFetchedEvent)
+	reg := event.reg
+
+	if reg.replay != event.replay {
+		logger.Debugf("Ignoring fetched blocks since the registration was removed")
+		return
+	}
+
+	if event.err != nil {
+		logger.Warnf("Unable to fetch all of the blocks for replay starting at block %d (%d fetched): %s", reg.FromBlock, len(event.blocks), event.err)
+	}
+
+	// Fetched blocks weren't processed by the dispatcher so they aren't assigned a sequence number
+	for _, block := range event.blocks {
+		ed.sendReplayedBlockEvent(reg, &fab.BlockEvent{Block: block, BlockHash: ed.computeBlockHash(block)})
+	}
+
+	pending := reg.replay.pending
+	ed.stopReplay(reg)
+
+	for _, blockEvent := range pending {
+		ed.sendReplayedBlockEvent(reg, blockEvent)
+	}
+}
+
+// stopReplay cancels the outstanding fetch of the registration's replay (if any)
+func (ed *Dispatcher) stopReplay(reg *BlockReg) {
+	if reg.replay == nil {
+		return
+	}
+	reg.replay.cancel()
+	reg.replay = nil
+}
+
+func (ed *Dispatcher) sendReplayedBlockEvent(reg *BlockReg, event *fab.BlockEvent) {
+	if !reg.Filter(event.Block) {
+		logger.Debugf("Not replaying block event for block #%d since it was filtered out.", event.Block.Header.Number)
+		return
+	}
+	ed.sendBlockEvent(reg, event)
+}
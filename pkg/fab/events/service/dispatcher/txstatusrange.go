@@ -0,0 +1,64 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"math"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// NewRegisterTxStatusEventUntilBlock creates a new RegisterTxStatusEvent that's bounded to the blocks up to
+// (and including) maxBlock, for example, in order to receive the status of a transaction in the blocks that
+// are being replayed without the registration lingering into live processing. Once block maxBlock has been
+// dispatched, the registration is removed and the event channel is closed; if the status wasn't received then
+// an error is also sent to expiredch (if not nil, which should be buffered). The registration fails with an
+// error if block maxBlock has already been dispatched at the time of registration, since the status of the
+// transaction could never be delivered.
+func NewRegisterTxStatusEventUntilBlock(txID string, maxBlock uint64, eventch chan<- *fab.TxStatusEvent, expiredch chan<- error, respch chan<- fab.Registration, errCh chan<- error) *RegisterTxStatusEvent {
+	event := NewRegisterTxStatusEvent(txID, eventch, respch, errCh)
+	event.Reg.HasMaxBlock = true
+	event.Reg.MaxBlock = maxBlock
+	event.Reg.Expiredch = expiredch
+	return event
+}
+
+// checkTxStatusMaxBlock returns an error if the registration is bounded to a block that has already been dispatched
+func (ed *Dispatcher) checkTxStatusMaxBlock(reg *TxStatusReg) error {
+	if !reg.HasMaxBlock {
+		return nil
+	}
+	lastBlockNum := ed.lastBlockNumOf(reg.ChannelID)
+	if lastBlockNum != math.MaxUint64 && lastBlockNum >= reg.MaxBlock {
+		return errors.Errorf("unable to register for the status of TxID %v until block %d since block %d has already been dispatched", reg.txIDs(), reg.MaxBlock, lastBlockNum)
+	}
+	return nil
+}
+
+// removeTxStatusRegistrationsUntilBlock removes the registrations of the given channel that are bounded to blocks
+// up to the given block, which has been dispatched
+func (ed *Dispatcher) removeTxStatusRegistrationsUntilBlock(channelID string, blockNum uint64) {
+	for _, reg := range ed.txStatusRegistrations() {
+		if !ed.inChannel(reg.ChannelID, channelID) || !reg.HasMaxBlock || reg.MaxBlock > blockNum {
+			continue
+		}
+
+		pending := reg.pendingTxIDs()
+		logger.Debugf("Removing TX status registration for TxID %v since block %d was dispatched", reg.txIDs(), blockNum)
+
+		if !reg.received && reg.Expiredch != nil {
+			select {
+			case reg.Expiredch <- errors.Errorf("block %d was dispatched without receiving the status of TxID %v", reg.MaxBlock, pending):
+			default:
+				logger.Warnf("Unable to send to TX status expired channel.")
+			}
+		}
+
+		ed.removeTxStatusRegistration(reg)
+	}
+}
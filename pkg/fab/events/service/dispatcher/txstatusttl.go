@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// txStatusExpiredEvent is sent to the dispatcher by the timer of a transaction status registration with a TTL
+type txStatusExpiredEvent struct {
+	reg *TxStatusReg
+}
+
+// NewRegisterTxStatusEventWithTTL creates a new RegisterTxStatusEvent that expires if the status of the
+// transaction isn't received within the given TTL. When the registration expires, an error is sent to
+// expiredch (if not nil, which should be buffered), the registration is removed and the event channel
+// is closed. The timer is stopped when the status is received or the registration is removed.
+func NewRegisterTxStatusEventWithTTL(txID string, ttl time.Duration, eventch chan<- *fab.TxStatusEvent, expiredch chan<- error, respch chan<- fab.Registration, errCh chan<- error) *RegisterTxStatusEvent {
+	event := NewRegisterTxStatusEvent(txID, eventch, respch, errCh)
+	event.Reg.TTL = ttl
+	event.Reg.Expiredch = expiredch
+	return event
+}
+
+// startTxStatusTimer starts the expiry timer of the registration if the registration has a TTL
+func (ed *Dispatcher) startTxStatusTimer(reg *TxStatusReg) {
+	if reg.TTL <= 0 {
+		return
+	}
+	reg.done = make(chan struct{})
+	go ed.runTxStatusTimer(reg, reg.done)
+}
+
+// stopTxStatusTimer stops the expiry timer of the registration (if it's running)
+func (ed *Dispatcher) stopTxStatusTimer(reg *TxStatusReg) {
+	if reg.done != nil {
+		close(reg.done)
+		reg.done = nil
+	}
+}
+
+// runTxStatusTimer submits an expired event to the dispatcher when the TTL of the registration elapses
+func (ed *Dispatcher) runTxStatusTimer(reg *TxStatusReg, done chan struct{}) {
+	select {
+	case <-ed.clock.After(reg.TTL):
+		select {
+		case ed.eventch <- &txStatusExpiredEvent{reg: reg}:
+		case <-done:
+		}
+	case <-done:
+	}
+}
+
+func (ed *Dispatcher) handleTxStatusExpiredEvent(e Event) {
+	event := e.(*txStatusExpiredEvent)
+	reg := event.reg
+
+	if reg.done == nil {
+		logger.Debugf("Ignoring expiry of TX status registration for TxID %v since it was removed or its status was received", reg.txIDs())
+		return
+	}
+
+	pending := reg.pendingTxIDs()
+	logger.Debugf("TX status registration for TxID %v expired after %s", pending, reg.TTL)
+
+	if reg.Expiredch != nil {
+		select {
+		case reg.Expiredch <- errors.Errorf("timed out after %s waiting for status of TxID %v", reg.TTL, pending):
+		default:
+			logger.Warnf("Unable to send to TX status expired channel.")
+		}
+	}
+
+	ed.removeTxStatusRegistration(reg)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+
+	ledgerutil "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/core/ledger/util"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// VerifyFilteredBlock verifies that the transactions of the filtered block are consistent with the
+// transactions of the full block with the same number, i.e. that the filtered block contains the same
+// transaction IDs (and types) in the same order with the same validation codes. This may be used to
+// detect a peer that serves a filtered block stream that's inconsistent with its blocks.
+// The first discrepancy that's found is returned.
+func VerifyFilteredBlock(filtered *pb.FilteredBlock, full *cb.Block) error {
+	if filtered == nil {
+		return errors.New("filtered block is nil")
+	}
+	if full == nil || full.Header == nil || full.Data == nil {
+		return errors.New("full block header and data are required")
+	}
+
+	if filtered.Number != full.Header.Number {
+		return errors.Errorf("filtered block number %d doesn't match full block number %d", filtered.Number, full.Header.Number)
+	}
+
+	var txFilter ledgerutil.TxValidationFlags
+	if full.Metadata != nil && len(full.Metadata.Metadata) > int(cb.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = ledgerutil.TxValidationFlags(full.Metadata.Metadata[cb.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	}
+	if len(txFilter) != len(full.Data.Data) {
+		return errors.Errorf("full block %d contains %d validation flags for %d transactions", full.Header.Number, len(txFilter), len(full.Data.Data))
+	}
+
+	filteredTxs := filtered.FilteredTransactions
+	for i, data := range full.Data.Data {
+		tx, channelID, err := getFilteredTx(data, txFilter.Flag(i))
+		if err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("invalid transaction %d in full block %d", i, full.Header.Number))
+		}
+
+		if i >= len(filteredTxs) {
+			return errors.Errorf("transaction %d [%s] of block %d is missing from the filtered block", i, tx.Txid, full.Header.Number)
+		}
+		filteredTx := filteredTxs[i]
+
+		if filtered.ChannelId != channelID {
+			return errors.Errorf("transaction %d of block %d: filtered block is for channel [%s] but transaction is for channel [%s]", i, full.Header.Number, filtered.ChannelId, channelID)
+		}
+		if filteredTx.Txid != tx.Txid {
+			return errors.Errorf("transaction %d of block %d: filtered block has TxID [%s] but full block has TxID [%s]", i, full.Header.Number, filteredTx.Txid, tx.Txid)
+		}
+		if filteredTx.Type != tx.Type {
+			return errors.Errorf("transaction %d [%s] of block %d: filtered block has type %s but full block has type %s", i, tx.Txid, full.Header.Number, filteredTx.Type, tx.Type)
+		}
+		if filteredTx.TxValidationCode != tx.TxValidationCode {
+			return errors.Errorf("transaction %d [%s] of block %d: filtered block has validation code %s but full block has validation code %s", i, tx.Txid, full.Header.Number, filteredTx.TxValidationCode, tx.TxValidationCode)
+		}
+	}
+
+	if len(filteredTxs) > len(full.Data.Data) {
+		return errors.Errorf("filtered block %d contains %d transactions but full block contains %d transactions", filtered.Number, len(filteredTxs), len(full.Data.Data))
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mocks
+
+import (
+	"time"
+
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+)
+
+// ScriptedProducer replays a predefined sequence of events into a dispatcher's event channel.
+// Each event is sent after the given delay (relative to the previous event) has elapsed on the clock,
+// so that tests using a ManualClock are deterministic. Block numbers are assigned sequentially.
+// The script is built by chaining calls to Block, FilteredBlock, ChaincodeEvent, TxStatus and Event,
+// and is replayed with Play.
+type ScriptedProducer struct {
+	ChannelID     string
+	Clock         Clock
+	steps         []*scriptStep
+	blockProducer *BlockProducer
+}
+
+type scriptStep struct {
+	delay time.Duration
+	event interface{}
+}
+
+// NewScriptedProducer returns a new ScriptedProducer for the given channel. If clock is nil then the system clock is used.
+func NewScriptedProducer(channelID string, clock Clock) *ScriptedProducer {
+	if clock == nil {
+		clock = &RealClock{}
+	}
+	return &ScriptedProducer{
+		ChannelID:     channelID,
+		Clock:         clock,
+		blockProducer: NewBlockProducer(),
+	}
+}
+
+// Block adds a block containing the given transactions to the script
+func (p *ScriptedProducer) Block(delay time.Duration, transactions ...*TxInfo) *ScriptedProducer {
+	return p.add(delay, p.blockProducer.NewBlock(p.ChannelID, transactions...))
+}
+
+// FilteredBlock adds a filtered block containing the given transactions to the script
+func (p *ScriptedProducer) FilteredBlock(delay time.Duration, filteredTx ...*pb.FilteredTransaction) *ScriptedProducer {
+	return p.add(delay, p.blockProducer.NewFilteredBlock(p.ChannelID, filteredTx...))
+}
+
+// ChaincodeEvent adds a block containing a single valid transaction which emits the given chaincode event
+func (p *ScriptedProducer) ChaincodeEvent(delay time.Duration, txID, ccID, eventName string, payload []byte) *ScriptedProducer {
+	return p.Block(delay, NewTransactionWithCCEvent(txID, pb.TxValidationCode_VALID, ccID, eventName, payload))
+}
+
+// TxStatus adds a block containing a single endorser transaction with the given validation code
+func (p *ScriptedProducer) TxStatus(delay time.Duration, txID string, code pb.TxValidationCode) *ScriptedProducer {
+	return p.Block(delay, NewTransaction(txID, code, cb.HeaderType_ENDORSER_TRANSACTION))
+}
+
+// Event adds an arbitrary event to the script
+func (p *ScriptedProducer) Event(delay time.Duration, event interface{}) *ScriptedProducer {
+	return p.add(delay, event)
+}
+
+// Play sends the scripted events to the given event channel in a separate Go routine. The schedule
+// is computed from the time on the clock when Play is called. The returned channel is closed once
+// all of the events have been sent.
+func (p *ScriptedProducer) Play(eventch chan<- interface{}) <-chan struct{} {
+	done := make(chan struct{})
+
+	deadline := p.Clock.Now()
+	var deadlines []time.Time
+	for _, step := range p.steps {
+		deadline = deadline.Add(step.delay)
+		deadlines = append(deadlines, deadline)
+	}
+
+	steps := p.steps
+	go func() {
+		defer close(done)
+		for i, step := range steps {
+			<-p.Clock.After(deadlines[i].Sub(p.Clock.Now()))
+			eventch <- step.event
+		}
+	}()
+
+	return done
+}
+
+func (p *ScriptedProducer) add(delay time.Duration, event interface{}) *ScriptedProducer {
+	p.steps = append(p.steps, &scriptStep{delay: delay, event: event})
+	return p
+}
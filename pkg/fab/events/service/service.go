@@ -7,7 +7,9 @@ SPDX-License-Identifier: Apache-2.0
 package service
 
 import (
+	"math"
 	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,6 +26,10 @@ const (
 	// It's hard-coded here since (at this point) it doesn't make sense to
 	// expose it as an option.
 	stopTimeout = 5 * time.Second
+
+	// queryTimeout is the time that we wait for the dispatcher to respond to a query
+	// (such as ChaincodeRegistrations), which it doesn't do if it was stopped.
+	queryTimeout = 5 * time.Second
 )
 
 var logger = logging.NewLogger("fabsdk/fab")
@@ -72,6 +78,41 @@ func (s *Service) Start() error {
 
 // Stop stops the event service
 func (s *Service) Stop() {
+	s.stop(nil, nil)
+}
+
+// StopWithStats stops the event service and returns the number of events that were still
+// queued and the registrations that were active at the time of the stop, which is useful for
+// detecting consumers that never drained their event channels. Nil is returned if the
+// stats are unavailable (for example, if the service was already stopped).
+func (s *Service) StopWithStats() *dispatcher.StopStats {
+	statsch := make(chan *dispatcher.StopStats, 1)
+	s.stop(statsch, nil)
+
+	select {
+	case stats := <-statsch:
+		return stats
+	default:
+		return nil
+	}
+}
+
+// StopWithRegistrationInfo stops the event service and returns a snapshot of the registrations that
+// were still active at the time of the stop. Non-zero counts indicate consumers that never unregistered.
+// Nil is returned if the snapshot is unavailable (for example, if the service was already stopped).
+func (s *Service) StopWithRegistrationInfo() *dispatcher.RegistrationInfo {
+	regInfoCh := make(chan *dispatcher.RegistrationInfo, 1)
+	s.stop(nil, regInfoCh)
+
+	select {
+	case regInfo := <-regInfoCh:
+		return regInfo
+	default:
+		return nil
+	}
+}
+
+func (s *Service) stop(statsch chan<- *dispatcher.StopStats, regInfoCh chan<- *dispatcher.RegistrationInfo) {
 	eventch, err := s.dispatcher.EventCh()
 	if err != nil {
 		logger.Warnf("Error stopping event service: %s", err)
@@ -79,7 +120,9 @@ func (s *Service) Stop() {
 	}
 
 	regch := make(chan error)
-	eventch <- dispatcher.NewStopEvent(regch)
+	stopEvent := dispatcher.NewStopEventWithStats(regch, statsch)
+	stopEvent.RegInfoCh = regInfoCh
+	eventch <- stopEvent
 
 	select {
 	case err := <-regch:
@@ -118,21 +161,56 @@ func (s *Service) Dispatcher() Dispatcher {
 
 // RegisterBlockEvent registers for block events. If the client is not authorized to receive
 // block events then an error is returned.
+// - filter is an optional list of filters. A block is delivered if any of the filters accepts it
+//   (all blocks are delivered if no filters are specified).
 func (s *Service) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	return s.RegisterBlockEventWithConnectionStatus(nil, filter...)
+}
+
+// RegisterBlockEventWithConnectionStatus registers for block events (see RegisterBlockEvent). In addition, the
+// status of the connection to the event producer is sent to connStatusCh (if not nil) whenever it changes, so that
+// the consumer can tell whether the event stream was lost. The channel should be buffered since a status is dropped
+// if the channel is full, and it isn't closed when the registration is removed.
+func (s *Service) RegisterBlockEventWithConnectionStatus(connStatusCh chan<- *dispatcher.ConnectionStatusEvent, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	return s.registerBlockEvent("", connStatusCh, filter...)
+}
+
+// RegisterChannelBlockEvent registers for the block events of the given channel (see RegisterBlockEvent). Events of
+// channels other than the default channel are only received if the dispatcher dispatches the events of multiple
+// channels (see dispatcher.WithChannelID).
+func (s *Service) RegisterChannelBlockEvent(channelID string, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	return s.registerBlockEvent(channelID, nil, filter...)
+}
+
+func (s *Service) registerBlockEvent(channelID string, connStatusCh chan<- *dispatcher.ConnectionStatusEvent, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
 	eventch := make(chan *fab.BlockEvent, s.eventConsumerBufferSize)
 	regch := make(chan fab.Registration)
 	errch := make(chan error)
 
-	blockFilter := blockfilter.AcceptAny
-	if len(filter) > 1 {
-		return nil, nil, errors.New("only one block filter may be specified")
-	}
+	event := dispatcher.NewRegisterBlockEvent(blockfilter.AnyOf(filter...), eventch, regch, errch)
+	event.Reg.ChannelID = channelID
+	event.ConnStatusCh = connStatusCh
 
-	if len(filter) == 1 {
-		blockFilter = filter[0]
-	}
+	return s.submitBlockRegistration(event, eventch, regch, errch)
+}
+
+// RegisterBlockEventFromBlock registers for block events starting at the given block (see RegisterBlockEvent).
+// If the block has already been dispatched then the blocks starting at the given block are replayed before live
+// delivery resumes (see dispatcher.NewRegisterBlockEventFromBlock); if the block is too old to be replayed then
+// delivery starts immediately at the oldest available block. If the block hasn't been dispatched yet then blocks
+// are delivered starting at that block.
+func (s *Service) RegisterBlockEventFromBlock(fromBlock uint64, filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	eventch := make(chan *fab.BlockEvent, s.eventConsumerBufferSize)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	event := dispatcher.NewRegisterBlockEventFromBlock(blockfilter.AnyOf(filter...), fromBlock, eventch, regch, errch)
 
-	if err := s.Submit(dispatcher.NewRegisterBlockEvent(blockFilter, eventch, regch, errch)); err != nil {
+	return s.submitBlockRegistration(event, eventch, regch, errch)
+}
+
+func (s *Service) submitBlockRegistration(event *dispatcher.RegisterBlockEvent, eventch <-chan *fab.BlockEvent, regch <-chan fab.Registration, errch <-chan error) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	if err := s.Submit(event); err != nil {
 		return nil, nil, errors.WithMessage(err, "error registering for block events")
 	}
 
@@ -147,11 +225,20 @@ func (s *Service) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registratio
 // RegisterFilteredBlockEvent registers for filtered block events. If the client is not authorized to receive
 // filtered block events then an error is returned.
 func (s *Service) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
+	return s.RegisterChannelFilteredBlockEvent("")
+}
+
+// RegisterChannelFilteredBlockEvent registers for the filtered block events of the given channel
+// (see RegisterFilteredBlockEvent and RegisterChannelBlockEvent).
+func (s *Service) RegisterChannelFilteredBlockEvent(channelID string) (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
 	eventch := make(chan *fab.FilteredBlockEvent, s.eventConsumerBufferSize)
 	regch := make(chan fab.Registration)
 	errch := make(chan error)
 
-	if err := s.Submit(dispatcher.NewRegisterFilteredBlockEvent(eventch, regch, errch)); err != nil {
+	event := dispatcher.NewRegisterFilteredBlockEvent(eventch, regch, errch)
+	event.Reg.ChannelID = channelID
+
+	if err := s.Submit(event); err != nil {
 		return nil, nil, errors.WithMessage(err, "error registering for filtered block events")
 	}
 
@@ -168,6 +255,23 @@ func (s *Service) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.Fi
 // - ccID is the chaincode ID for which events are to be received
 // - eventFilter is the chaincode event name for which events are to be received
 func (s *Service) RegisterChaincodeEvent(ccID, eventFilter string) (fab.Registration, <-chan *fab.CCEvent, error) {
+	return s.registerChaincodeEvent("", ccID, eventFilter, false)
+}
+
+// RegisterChaincodeEventExactMatch registers for chaincode events whose name is exactly the given event name
+// (the name isn't interpreted as a regular expression). If the client is not authorized to receive chaincode
+// events then an error is returned.
+func (s *Service) RegisterChaincodeEventExactMatch(ccID, eventName string) (fab.Registration, <-chan *fab.CCEvent, error) {
+	return s.registerChaincodeEvent("", ccID, eventName, true)
+}
+
+// RegisterChannelChaincodeEvent registers for the chaincode events of the given channel
+// (see RegisterChaincodeEvent and RegisterChannelBlockEvent).
+func (s *Service) RegisterChannelChaincodeEvent(channelID, ccID, eventFilter string) (fab.Registration, <-chan *fab.CCEvent, error) {
+	return s.registerChaincodeEvent(channelID, ccID, eventFilter, false)
+}
+
+func (s *Service) registerChaincodeEvent(channelID, ccID, eventFilter string, exactMatch bool) (fab.Registration, <-chan *fab.CCEvent, error) {
 	if ccID == "" {
 		return nil, nil, errors.New("chaincode ID is required")
 	}
@@ -179,7 +283,13 @@ func (s *Service) RegisterChaincodeEvent(ccID, eventFilter string) (fab.Registra
 	regch := make(chan fab.Registration)
 	errch := make(chan error)
 
-	if err := s.Submit(dispatcher.NewRegisterChaincodeEvent(ccID, eventFilter, eventch, regch, errch)); err != nil {
+	event := dispatcher.NewRegisterChaincodeEvent(ccID, eventFilter, eventch, regch, errch)
+	if exactMatch {
+		event = dispatcher.NewRegisterChaincodeEventExactMatch(ccID, eventFilter, eventch, regch, errch)
+	}
+	event.Reg.ChannelID = channelID
+
+	if err := s.Submit(event); err != nil {
 		return nil, nil, errors.WithMessage(err, "error registering for chaincode events")
 	}
 
@@ -195,6 +305,12 @@ func (s *Service) RegisterChaincodeEvent(ccID, eventFilter string) (fab.Registra
 // transaction status events then an error is returned.
 // - txID is the transaction ID for which events are to be received
 func (s *Service) RegisterTxStatusEvent(txID string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	return s.RegisterChannelTxStatusEvent("", txID)
+}
+
+// RegisterChannelTxStatusEvent registers for the status event of a transaction of the given channel
+// (see RegisterTxStatusEvent and RegisterChannelBlockEvent).
+func (s *Service) RegisterChannelTxStatusEvent(channelID, txID string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
 	if txID == "" {
 		return nil, nil, errors.New("txID must be provided")
 	}
@@ -203,7 +319,40 @@ func (s *Service) RegisterTxStatusEvent(txID string) (fab.Registration, <-chan *
 	regch := make(chan fab.Registration)
 	errch := make(chan error)
 
-	if err := s.Submit(dispatcher.NewRegisterTxStatusEvent(txID, eventch, regch, errch)); err != nil {
+	event := dispatcher.NewRegisterTxStatusEvent(txID, eventch, regch, errch)
+	event.Reg.ChannelID = channelID
+	return s.registerTxStatusEvent(event, eventch, regch, errch)
+}
+
+// RegisterMultiTxStatusEvent registers for the status events of multiple transactions with a single registration.
+// The status of each transaction is sent to the returned channel (the TxID of the event identifies the transaction)
+// and the channel is closed once the status of all of the transactions has been received.
+// - txIDs are the IDs of the transactions for which events are to be received
+func (s *Service) RegisterMultiTxStatusEvent(txIDs []string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	return s.registerMultiTxStatusEvent("", txIDs)
+}
+
+func (s *Service) registerMultiTxStatusEvent(channelID string, txIDs []string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	if len(txIDs) == 0 {
+		return nil, nil, errors.New("at least one txID must be provided")
+	}
+	for _, txID := range txIDs {
+		if txID == "" {
+			return nil, nil, errors.New("txID must not be empty")
+		}
+	}
+
+	eventch := make(chan *fab.TxStatusEvent, s.eventConsumerBufferSize)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	event := dispatcher.NewRegisterMultiTxStatusEvent(txIDs, eventch, regch, errch)
+	event.Reg.ChannelID = channelID
+	return s.registerTxStatusEvent(event, eventch, regch, errch)
+}
+
+func (s *Service) registerTxStatusEvent(event *dispatcher.RegisterTxStatusEvent, eventch <-chan *fab.TxStatusEvent, regch <-chan fab.Registration, errch <-chan error) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	if err := s.Submit(event); err != nil {
 		return nil, nil, errors.WithMessage(err, "error registering for Tx Status events")
 	}
 
@@ -215,6 +364,26 @@ func (s *Service) RegisterTxStatusEvent(txID string) (fab.Registration, <-chan *
 	}
 }
 
+// RegisterHeartbeatEvent registers for heartbeat events which are sent at the given interval and
+// carry the number of the last dispatched block, so that the consumer is notified even if no real events occur.
+// If skipWhenActive is true then heartbeats are not sent while blocks are being dispatched.
+func (s *Service) RegisterHeartbeatEvent(interval time.Duration, skipWhenActive bool) (fab.Registration, <-chan *dispatcher.HeartbeatEvent, error) {
+	eventch := make(chan *dispatcher.HeartbeatEvent, s.eventConsumerBufferSize)
+	regch := make(chan fab.Registration)
+	errch := make(chan error)
+
+	if err := s.Submit(dispatcher.NewRegisterHeartbeatEvent(interval, skipWhenActive, eventch, regch, errch)); err != nil {
+		return nil, nil, errors.WithMessage(err, "error registering for heartbeat events")
+	}
+
+	select {
+	case response := <-regch:
+		return response, eventch, nil
+	case err := <-errch:
+		return nil, nil, err
+	}
+}
+
 // Unregister unregisters the given registration.
 // - reg is the registration handle that was returned from one of the RegisterXXX functions
 func (s *Service) Unregister(reg fab.Registration) {
@@ -222,3 +391,139 @@ func (s *Service) Unregister(reg fab.Registration) {
 		logger.Warnf("Error unregistering: %s", err)
 	}
 }
+
+// RestoredRegistration binds a registration that was restored by ImportRegistrations to its new event channel.
+// Only the event channel corresponding to the type of the registration is set.
+type RestoredRegistration struct {
+	State                dispatcher.RegistrationState
+	Registration         fab.Registration
+	BlockEventCh         <-chan *fab.BlockEvent
+	FilteredBlockEventCh <-chan *fab.FilteredBlockEvent
+	CCEventCh            <-chan *fab.CCEvent
+	TxStatusEventCh      <-chan *fab.TxStatusEvent
+}
+
+// ChaincodeRegistrations returns the descriptors (chaincode ID and event filter) of the current
+// chaincode event registrations, sorted by chaincode ID and event filter. An error is returned if the
+// dispatcher doesn't respond (for example, since the service was stopped).
+func (s *Service) ChaincodeRegistrations() ([]*dispatcher.ChaincodeRegInfo, error) {
+	// The channel is buffered so that the dispatcher doesn't block if we time out
+	regInfoCh := make(chan []*dispatcher.ChaincodeRegInfo, 1)
+	if err := s.Submit(dispatcher.NewChaincodeRegInfoEvent(regInfoCh)); err != nil {
+		return nil, errors.WithMessage(err, "error getting chaincode registrations")
+	}
+
+	select {
+	case regInfos := <-regInfoCh:
+		return regInfos, nil
+	case <-time.After(queryTimeout):
+		return nil, errors.New("timed out waiting for chaincode registrations")
+	}
+}
+
+// ExportRegistrations returns the state of all current registrations, along with
+// the number of the last block that was dispatched, so that the registrations may
+// be restored with ImportRegistrations (for example, after a process restart).
+// Note that block filters are not exported. An error is returned if the dispatcher doesn't respond (for example,
+// since the service was stopped).
+func (s *Service) ExportRegistrations() ([]dispatcher.RegistrationState, error) {
+	// The channel is buffered so that the dispatcher doesn't block if we time out
+	regStateCh := make(chan []dispatcher.RegistrationState, 1)
+	if err := s.Submit(dispatcher.NewExportRegistrationsEvent(regStateCh)); err != nil {
+		return nil, errors.WithMessage(err, "error exporting registrations")
+	}
+
+	select {
+	case states := <-regStateCh:
+		return states, nil
+	case <-time.After(queryTimeout):
+		return nil, errors.New("timed out waiting for exported registrations")
+	}
+}
+
+// ImportRegistrations restores registrations that were previously exported with ExportRegistrations.
+// A new registration (with a new event channel) is created for each of the given states and the
+// registrations are returned in the same order as the states. Block registrations are restored without
+// a block filter. The last dispatched block number is restored to the lowest block number of the given states
+// so that blocks that were already dispatched before the export are not dispatched again. The block number is restored
+// for each channel of the channel-scoped registrations (see RegisterChannelBlockEvent). Registrations should
+// therefore be imported before any block is received, and the event client should be configured to seek
+// from the block following the restored block number (see deliverclient.WithBlockNum).
+// If any of the registrations fails then all of the restored registrations are unregistered. If the block number
+// cannot be restored then the restored registrations are returned along with the error.
+func (s *Service) ImportRegistrations(states []dispatcher.RegistrationState) ([]*RestoredRegistration, error) {
+	var restored []*RestoredRegistration
+	for _, state := range states {
+		reg, err := s.importRegistration(state)
+		if err != nil {
+			for _, r := range restored {
+				s.Unregister(r.Registration)
+			}
+			return nil, errors.WithMessage(err, "error importing registrations")
+		}
+		restored = append(restored, reg)
+	}
+
+	blockNums := lastBlockNumsFromStates(states)
+	channelIDs := make([]string, 0, len(blockNums))
+	for channelID := range blockNums {
+		channelIDs = append(channelIDs, channelID)
+	}
+	sort.Strings(channelIDs)
+
+	for _, channelID := range channelIDs {
+		errch := make(chan error)
+		event := dispatcher.NewRestoreLastBlockNumEvent(blockNums[channelID], errch)
+		event.ChannelID = channelID
+		if err := s.Submit(event); err != nil {
+			return restored, errors.WithMessage(err, "error restoring last block number")
+		}
+		if err := <-errch; err != nil {
+			return restored, err
+		}
+	}
+
+	return restored, nil
+}
+
+func (s *Service) importRegistration(state dispatcher.RegistrationState) (*RestoredRegistration, error) {
+	restored := &RestoredRegistration{State: state}
+
+	var err error
+	switch state.Type {
+	case dispatcher.BlockRegistration:
+		restored.Registration, restored.BlockEventCh, err = s.RegisterChannelBlockEvent(state.ChannelID)
+	case dispatcher.FilteredBlockRegistration:
+		restored.Registration, restored.FilteredBlockEventCh, err = s.RegisterChannelFilteredBlockEvent(state.ChannelID)
+	case dispatcher.ChaincodeRegistration:
+		restored.Registration, restored.CCEventCh, err = s.registerChaincodeEvent(state.ChannelID, state.ChaincodeID, state.EventFilter, state.ExactMatch)
+	case dispatcher.TxStatusRegistration:
+		if len(state.TxIDs) > 0 {
+			restored.Registration, restored.TxStatusEventCh, err = s.registerMultiTxStatusEvent(state.ChannelID, state.TxIDs)
+		} else {
+			restored.Registration, restored.TxStatusEventCh, err = s.RegisterChannelTxStatusEvent(state.ChannelID, state.TxID)
+		}
+	default:
+		err = errors.Errorf("unsupported registration type [%s]", state.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// lastBlockNumsFromStates returns the lowest block number of the given states for each channel (keyed by the
+// channel ID of the states). Channels for which none of the states contains a block number are omitted.
+func lastBlockNumsFromStates(states []dispatcher.RegistrationState) map[string]uint64 {
+	blockNums := make(map[string]uint64)
+	for _, state := range states {
+		if state.LastBlockNum == math.MaxUint64 {
+			continue
+		}
+		if blockNum, ok := blockNums[state.ChannelID]; !ok || state.LastBlockNum < blockNum {
+			blockNums[state.ChannelID] = state.LastBlockNum
+		}
+	}
+	return blockNums
+}
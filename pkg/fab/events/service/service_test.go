@@ -7,7 +7,10 @@ SPDX-License-Identifier: Apache-2.0
 package service
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -102,6 +105,13 @@ func TestBlockEventsWithFilter(t *testing.T) {
 	}
 	defer eventService.Unregister(breg)
 
+	// The same blocks with multiple filters
+	breg2, beventch2, err := eventService.RegisterBlockEvent(headertypefilter.New(cb.HeaderType_CONFIG), nil, headertypefilter.New(cb.HeaderType_CONFIG_UPDATE))
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	defer eventService.Unregister(breg2)
+
 	fbreg, fbeventch, err := eventService.RegisterFilteredBlockEvent()
 	if err != nil {
 		t.Fatalf("error registering for filtered block events: %s", err)
@@ -125,6 +135,7 @@ func TestBlockEventsWithFilter(t *testing.T) {
 
 	numBlockEventsReceived := 0
 	numBlockEventsExpected := 2
+	numBlockEvents2Received := 0
 	numFilteredBlockEventsReceived := 0
 	numFilteredBlockEventsExpected := 3
 
@@ -135,6 +146,11 @@ func TestBlockEventsWithFilter(t *testing.T) {
 				t.Fatalf("unexpected closed channel")
 			}
 			numBlockEventsReceived++
+		case _, ok := <-beventch2:
+			if !ok {
+				t.Fatalf("unexpected closed channel")
+			}
+			numBlockEvents2Received++
 		case _, ok := <-fbeventch:
 			if !ok {
 				t.Fatalf("unexpected closed channel")
@@ -144,6 +160,9 @@ func TestBlockEventsWithFilter(t *testing.T) {
 			if numBlockEventsReceived != numBlockEventsExpected {
 				t.Fatalf("Expecting %d block events but got %d", numBlockEventsExpected, numBlockEventsReceived)
 			}
+			if numBlockEvents2Received != numBlockEventsExpected {
+				t.Fatalf("Expecting %d block events with multiple filters but got %d", numBlockEventsExpected, numBlockEvents2Received)
+			}
 			if numFilteredBlockEventsReceived != numFilteredBlockEventsExpected {
 				t.Fatalf("Expecting %d filtered block events but got %d", numFilteredBlockEventsExpected, numFilteredBlockEventsReceived)
 			}
@@ -152,6 +171,60 @@ func TestBlockEventsWithFilter(t *testing.T) {
 	}
 }
 
+func TestBlockEventsFromBlock(t *testing.T) {
+	channelID := "mychannel"
+	eventService, eventProducer, err := newServiceWithMockProducer([]options.Opt{dispatcher.WithBlockReplayBufferSize(2)}, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+	defer eventService.Stop()
+
+	registration, eventch, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	defer eventService.Unregister(registration)
+
+	checkBlockNum := func(eventch <-chan *fab.BlockEvent, expectedBlockNum uint64) {
+		select {
+		case event := <-eventch:
+			if event.Block.Header.Number != expectedBlockNum {
+				t.Fatalf("expecting block #%d but received block #%d", expectedBlockNum, event.Block.Header.Number)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block #%d", expectedBlockNum)
+		}
+	}
+
+	// Blocks 1 and 2 are retained for replay
+	for i := uint64(0); i < 3; i++ {
+		eventProducer.Ledger().NewBlock(channelID)
+		checkBlockNum(eventch, i)
+	}
+
+	fromRegistration, fromEventch, err := eventService.RegisterBlockEventFromBlock(1)
+	if err != nil {
+		t.Fatalf("error registering for block events from block 1: %s", err)
+	}
+	defer eventService.Unregister(fromRegistration)
+
+	// Block 0 is no longer buffered so delivery starts at the oldest buffered block
+	evictedRegistration, evictedEventch, err := eventService.RegisterBlockEventFromBlock(0)
+	if err != nil {
+		t.Fatalf("error registering for block events from block 0: %s", err)
+	}
+	defer eventService.Unregister(evictedRegistration)
+
+	eventProducer.Ledger().NewBlock(channelID)
+
+	for _, eventch := range []<-chan *fab.BlockEvent{fromEventch, evictedEventch} {
+		checkBlockNum(eventch, 1)
+		checkBlockNum(eventch, 2)
+		checkBlockNum(eventch, 3)
+	}
+}
+
 func TestFilteredBlockEvents(t *testing.T) {
 	channelID := "mychannel"
 	eventService, eventProducer, err := newServiceWithMockProducer(defaultOpts, withFilteredBlockLedger())
@@ -272,6 +345,12 @@ func TestTxStatusEvents(t *testing.T) {
 	if _, _, err := eventService.RegisterTxStatusEvent(""); err == nil {
 		t.Fatalf("expecting error registering for TxStatus event without a TX ID but got none")
 	}
+	if _, _, err := eventService.RegisterMultiTxStatusEvent(nil); err == nil {
+		t.Fatalf("expecting error registering for TxStatus events without TX IDs but got none")
+	}
+	if _, _, err := eventService.RegisterMultiTxStatusEvent([]string{txID1, ""}); err == nil {
+		t.Fatalf("expecting error registering for TxStatus events with an empty TX ID but got none")
+	}
 	reg1, _, err := eventService.RegisterTxStatusEvent(txID1)
 	if err != nil {
 		t.Fatalf("error registering for TxStatus events: %s", err)
@@ -414,6 +493,552 @@ func TestCCEvents(t *testing.T) {
 }
 
 // TestConcurrentEvents ensures that the channel event client is thread-safe
+func TestExportImportRegistrations(t *testing.T) {
+	channelID := "mychannel"
+	eventService, eventProducer, err := newServiceWithMockProducer(defaultOpts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+	defer eventService.Stop()
+
+	breg, beventch, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	defer eventService.Unregister(breg)
+
+	ccreg, _, err := eventService.RegisterChaincodeEvent("mycc", "event1")
+	if err != nil {
+		t.Fatalf("error registering for chaincode events: %s", err)
+	}
+	defer eventService.Unregister(ccreg)
+
+	txreg, _, err := eventService.RegisterTxStatusEvent("txid1")
+	if err != nil {
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+	defer eventService.Unregister(txreg)
+
+	eventProducer.Ledger().NewBlock(channelID)
+	eventProducer.Ledger().NewBlock(channelID)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-beventch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block event")
+		}
+	}
+
+	ccRegInfos, err := eventService.ChaincodeRegistrations()
+	if err != nil {
+		t.Fatalf("error getting chaincode registrations: %s", err)
+	}
+	if len(ccRegInfos) != 1 || ccRegInfos[0].ChaincodeID != "mycc" || ccRegInfos[0].EventFilter != "event1" {
+		t.Fatalf("unexpected chaincode registrations: %+v", ccRegInfos)
+	}
+
+	states, err := eventService.ExportRegistrations()
+	if err != nil {
+		t.Fatalf("error exporting registrations: %s", err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("expecting 3 registration states but got %d", len(states))
+	}
+	for _, state := range states {
+		if state.LastBlockNum != 1 {
+			t.Fatalf("expecting last block number 1 but got %d", state.LastBlockNum)
+		}
+		switch state.Type {
+		case dispatcher.ChaincodeRegistration:
+			if state.ChaincodeID != "mycc" || state.EventFilter != "event1" {
+				t.Fatalf("unexpected chaincode registration state: %+v", state)
+			}
+		case dispatcher.TxStatusRegistration:
+			if state.TxID != "txid1" {
+				t.Fatalf("unexpected TxStatus registration state: %+v", state)
+			}
+		case dispatcher.BlockRegistration:
+		default:
+			t.Fatalf("unexpected registration type: %s", state.Type)
+		}
+	}
+
+	// Restore the registrations into a new service
+	newEventService, newEventProducer, err := newServiceWithMockProducer(defaultOpts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer newEventProducer.Close()
+	defer newEventService.Stop()
+
+	restored, err := newEventService.ImportRegistrations(states)
+	if err != nil {
+		t.Fatalf("error importing registrations: %s", err)
+	}
+	if len(restored) != len(states) {
+		t.Fatalf("expecting %d restored registrations but got %d", len(states), len(restored))
+	}
+	if newEventService.Dispatcher().LastBlockNum() != 1 {
+		t.Fatalf("expecting last block number 1 but got %d", newEventService.Dispatcher().LastBlockNum())
+	}
+
+	var blockEventCh <-chan *fab.BlockEvent
+	for _, r := range restored {
+		defer newEventService.Unregister(r.Registration)
+		if r.State.Type == dispatcher.BlockRegistration {
+			blockEventCh = r.BlockEventCh
+		}
+	}
+	if blockEventCh == nil {
+		t.Fatalf("expecting block registration to be restored")
+	}
+
+	// Blocks 0 and 1 were already dispatched before the export so only block 2 should be received
+	newEventProducer.Ledger().NewBlock(channelID)
+	newEventProducer.Ledger().NewBlock(channelID)
+	newEventProducer.Ledger().NewBlock(channelID)
+
+	select {
+	case event := <-blockEventCh:
+		if event.Block.Header.Number != 2 {
+			t.Fatalf("expecting block number 2 but got %d", event.Block.Header.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for block event")
+	}
+
+	_, err = newEventService.ImportRegistrations(states[:1])
+	if err == nil {
+		t.Fatalf("expecting error restoring last block number after blocks were dispatched")
+	}
+
+	_, err = newEventService.ImportRegistrations([]dispatcher.RegistrationState{{Type: "invalid"}})
+	if err == nil {
+		t.Fatalf("expecting error importing invalid registration type")
+	}
+}
+
+func TestQueryUnresponsiveDispatcher(t *testing.T) {
+	eventService := New(&unresponsiveDispatcher{eventch: make(chan interface{}, 10)})
+
+	// The queries are made concurrently since each of them waits for the query timeout
+	errch := make(chan error, 2)
+	go func() {
+		_, err := eventService.ChaincodeRegistrations()
+		errch <- err
+	}()
+	go func() {
+		_, err := eventService.ExportRegistrations()
+		errch <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errch; err == nil {
+			t.Fatalf("expecting error when the dispatcher doesn't respond")
+		}
+	}
+}
+
+// unresponsiveDispatcher accepts events but never handles them (as if it was stopped after the event was submitted)
+type unresponsiveDispatcher struct {
+	eventch chan interface{}
+}
+
+func (d *unresponsiveDispatcher) Start() error {
+	return nil
+}
+
+func (d *unresponsiveDispatcher) EventCh() (chan<- interface{}, error) {
+	return d.eventch, nil
+}
+
+func (d *unresponsiveDispatcher) LastBlockNum() uint64 {
+	return math.MaxUint64
+}
+
+func TestExportImportChannelRegistrations(t *testing.T) {
+	channelID1 := "channel1"
+	channelID2 := "channel2"
+	opts := []options.Opt{dispatcher.WithChannelID(channelID1)}
+
+	eventService, eventProducer, err := newServiceWithMockProducer(opts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+	defer eventService.Stop()
+
+	breg1, beventch1, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	defer eventService.Unregister(breg1)
+
+	breg2, beventch2, err := eventService.RegisterChannelBlockEvent(channelID2)
+	if err != nil {
+		t.Fatalf("error registering for block events of channel [%s]: %s", channelID2, err)
+	}
+	defer eventService.Unregister(breg2)
+
+	fbreg, _, err := eventService.RegisterChannelFilteredBlockEvent(channelID2)
+	if err != nil {
+		t.Fatalf("error registering for filtered block events of channel [%s]: %s", channelID2, err)
+	}
+	defer eventService.Unregister(fbreg)
+
+	ccreg, _, err := eventService.RegisterChannelChaincodeEvent(channelID2, "mycc", "event1")
+	if err != nil {
+		t.Fatalf("error registering for chaincode events of channel [%s]: %s", channelID2, err)
+	}
+	defer eventService.Unregister(ccreg)
+
+	txreg, _, err := eventService.RegisterChannelTxStatusEvent(channelID2, "txid1")
+	if err != nil {
+		t.Fatalf("error registering for TxStatus events of channel [%s]: %s", channelID2, err)
+	}
+	defer eventService.Unregister(txreg)
+
+	// Block 0 is a block of channel1 and blocks 1 and 2 are blocks of channel2 (the channel
+	// of a block is determined from its transactions)
+	eventProducer.Ledger().NewBlock(channelID1, servicemocks.NewTransaction("txid0", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION))
+	eventProducer.Ledger().NewBlock(channelID2, servicemocks.NewTransaction("txid1", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION))
+	eventProducer.Ledger().NewBlock(channelID2, servicemocks.NewTransaction("txid2", pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION))
+
+	for _, expected := range []struct {
+		eventch  <-chan *fab.BlockEvent
+		blockNum uint64
+	}{{beventch1, 0}, {beventch2, 1}, {beventch2, 2}} {
+		select {
+		case event := <-expected.eventch:
+			if event.Block.Header.Number != expected.blockNum {
+				t.Fatalf("expecting block number %d but got %d", expected.blockNum, event.Block.Header.Number)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block event")
+		}
+	}
+
+	states, err := eventService.ExportRegistrations()
+	if err != nil {
+		t.Fatalf("error exporting registrations: %s", err)
+	}
+	if len(states) != 5 {
+		t.Fatalf("expecting 5 registration states but got %d", len(states))
+	}
+	for _, state := range states {
+		expectedBlockNum := uint64(2)
+		if state.ChannelID == "" {
+			expectedBlockNum = 0
+		} else if state.ChannelID != channelID2 {
+			t.Fatalf("unexpected channel of registration state: %+v", state)
+		}
+		if state.LastBlockNum != expectedBlockNum {
+			t.Fatalf("expecting last block number %d but got %d for registration state: %+v", expectedBlockNum, state.LastBlockNum, state)
+		}
+	}
+
+	// Restore the registrations into a new service
+	newEventService, newEventProducer, err := newServiceWithMockProducer(opts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer newEventProducer.Close()
+	defer newEventService.Stop()
+
+	restored, err := newEventService.ImportRegistrations(states)
+	if err != nil {
+		t.Fatalf("error importing registrations: %s", err)
+	}
+	if len(restored) != len(states) {
+		t.Fatalf("expecting %d restored registrations but got %d", len(states), len(restored))
+	}
+	if newEventService.Dispatcher().LastBlockNum() != 0 {
+		t.Fatalf("expecting last block number 0 of the default channel but got %d", newEventService.Dispatcher().LastBlockNum())
+	}
+
+	var blockEventCh <-chan *fab.BlockEvent
+	for _, r := range restored {
+		defer newEventService.Unregister(r.Registration)
+		if r.State.Type == dispatcher.BlockRegistration && r.State.ChannelID == channelID2 {
+			blockEventCh = r.BlockEventCh
+		}
+	}
+	if blockEventCh == nil {
+		t.Fatalf("expecting block registration of channel [%s] to be restored", channelID2)
+	}
+
+	// Blocks 0 to 2 of channel2 were already dispatched before the export so only block 3 should be received
+	for i := 0; i < 4; i++ {
+		newEventProducer.Ledger().NewBlock(channelID2, servicemocks.NewTransaction(fmt.Sprintf("txid%d", i), pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION))
+	}
+
+	select {
+	case event := <-blockEventCh:
+		if event.Block.Header.Number != 3 {
+			t.Fatalf("expecting block number 3 but got %d", event.Block.Header.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for block event")
+	}
+
+	// Channel-scoped registrations require the default channel of the dispatcher to be set
+	singleChannelService, singleChannelProducer, err := newServiceWithMockProducer(defaultOpts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer singleChannelProducer.Close()
+	defer singleChannelService.Stop()
+
+	if _, _, err := singleChannelService.RegisterChannelBlockEvent(channelID2); err == nil {
+		t.Fatalf("expecting error registering for events of channel [%s] without a default channel", channelID2)
+	}
+	if _, err := singleChannelService.ImportRegistrations(states); err == nil {
+		t.Fatalf("expecting error importing channel-scoped registrations without a default channel")
+	}
+}
+
+func TestStopWithStats(t *testing.T) {
+	channelID := "mychannel"
+	eventService, eventProducer, err := newServiceWithMockProducer(defaultOpts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+
+	_, blockch, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	if _, _, err := eventService.RegisterTxStatusEvent("txid1"); err != nil {
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	// The block events are never consumed
+	eventProducer.Ledger().NewBlock(channelID)
+	eventProducer.Ledger().NewBlock(channelID)
+	for i := 0; len(blockch) < 2; i++ {
+		if i == 50 {
+			t.Fatalf("timed out waiting for block events to be queued")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	stats := eventService.StopWithStats()
+	if stats == nil {
+		t.Fatalf("expecting stop stats")
+	}
+	if stats.ActiveRegistrations[dispatcher.BlockRegistration] != 1 || stats.ActiveRegistrations[dispatcher.TxStatusRegistration] != 1 {
+		t.Fatalf("unexpected active registrations: %v", stats.ActiveRegistrations)
+	}
+	if stats.ActiveRegistrations[dispatcher.ChaincodeRegistration] != 0 {
+		t.Fatalf("unexpected active registrations: %v", stats.ActiveRegistrations)
+	}
+	if stats.QueuedEvents[dispatcher.BlockRegistration] != 2 {
+		t.Fatalf("expecting 2 queued block events but got %d", stats.QueuedEvents[dispatcher.BlockRegistration])
+	}
+
+	// Already stopped
+	if stats := eventService.StopWithStats(); stats != nil {
+		t.Fatalf("expecting no stats when the service is already stopped")
+	}
+}
+
+func TestStopWithRegistrationInfo(t *testing.T) {
+	channelID := "mychannel"
+	eventService, eventProducer, err := newServiceWithMockProducer(defaultOpts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+
+	_, blockch, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	if _, _, err := eventService.RegisterTxStatusEvent("txid1"); err != nil {
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	regInfo := eventService.StopWithRegistrationInfo()
+	if regInfo == nil {
+		t.Fatalf("expecting registration info")
+	}
+	if regInfo.TotalRegistrations != 2 || regInfo.NumBlockRegistrations != 1 || regInfo.NumTxStatusRegistrations != 1 {
+		t.Fatalf("unexpected registration info: %+v", regInfo)
+	}
+
+	// No events are delivered after the stop
+	eventProducer.Ledger().NewBlock(channelID)
+	select {
+	case _, ok := <-blockch:
+		if ok {
+			t.Fatalf("unexpected block event after stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for block event channel to close")
+	}
+
+	// Already stopped
+	if regInfo := eventService.StopWithRegistrationInfo(); regInfo != nil {
+		t.Fatalf("expecting no registration info when the service is already stopped")
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	channelID := "mychannel"
+	eventService, eventProducer, err := newServiceWithMockProducer(defaultOpts, withBlockLedger())
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+	defer eventService.Stop()
+
+	if _, err := NewWriterSink(eventService, nil, make(chan string), &bytes.Buffer{}, nil); err == nil {
+		t.Fatalf("expecting error for unsupported event channel")
+	}
+
+	txID := "txid1"
+	reg, eventch, err := eventService.RegisterTxStatusEvent(txID)
+	if err != nil {
+		t.Fatalf("error registering for TxStatus events: %s", err)
+	}
+
+	buf := &syncBuffer{}
+	sink, err := NewWriterSink(eventService, reg, eventch, buf, nil)
+	if err != nil {
+		t.Fatalf("error creating writer sink: %s", err)
+	}
+
+	eventProducer.Ledger().NewBlock(channelID,
+		servicemocks.NewTransaction(txID, pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION),
+	)
+
+	for i := 0; len(buf.Bytes()) == 0; i++ {
+		if i == 50 {
+			t.Fatalf("timed out waiting for event to be written")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The sink stops when the registration is removed
+	eventService.Unregister(reg)
+	select {
+	case <-sink.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for writer sink to stop")
+	}
+	if sink.Err() != nil {
+		t.Fatalf("unexpected writer sink error: %s", sink.Err())
+	}
+
+	event := &fab.TxStatusEvent{}
+	if err := json.Unmarshal(buf.Bytes(), event); err != nil {
+		t.Fatalf("error unmarshalling written event: %s", err)
+	}
+	checkTxStatusEvent(t, event, txID, pb.TxValidationCode_VALID)
+
+	reg, blockch, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+
+	sink, err = NewWriterSink(eventService, reg, blockch, &failingWriter{}, nil)
+	if err != nil {
+		t.Fatalf("error creating writer sink: %s", err)
+	}
+
+	eventProducer.Ledger().NewBlock(channelID)
+
+	select {
+	case <-sink.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for writer sink to stop")
+	}
+	if sink.Err() == nil {
+		t.Fatalf("expecting writer sink error")
+	}
+
+	// The registration was removed so another block registration may be made
+	reg, _, err = eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+	eventService.Unregister(reg)
+}
+
+func TestWriterSinkWithBlockingConsumer(t *testing.T) {
+	channelID := "mychannel"
+	eventService, eventProducer, err := newServiceWithMockProducer(
+		[]options.Opt{
+			dispatcher.WithEventConsumerBufferSize(1),
+			dispatcher.WithEventConsumerTimeout(0),
+		},
+		withBlockLedger(),
+	)
+	if err != nil {
+		t.Fatalf("error creating channel event client: %s", err)
+	}
+	defer eventProducer.Close()
+	defer eventService.Stop()
+
+	reg, blockch, err := eventService.RegisterBlockEvent()
+	if err != nil {
+		t.Fatalf("error registering for block events: %s", err)
+	}
+
+	// The dispatcher is blocked delivering the blocks to the sink, and the subsequent blocks are queued, so that
+	// the dispatcher is still blocked delivering blocks when the sink unregisters
+	for i := 0; i < 10; i++ {
+		eventProducer.Ledger().NewBlock(channelID,
+			servicemocks.NewTransaction(fmt.Sprintf("txid%d", i), pb.TxValidationCode_VALID, cb.HeaderType_ENDORSER_TRANSACTION),
+		)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	sink, err := NewWriterSink(eventService, reg, blockch, &failingWriter{delay: 100 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatalf("error creating writer sink: %s", err)
+	}
+
+	select {
+	case <-sink.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for writer sink to stop")
+	}
+	if sink.Err() == nil {
+		t.Fatalf("expecting writer sink error")
+	}
+}
+
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Bytes()
+}
+
+// failingWriter fails each write (after the given delay)
+type failingWriter struct {
+	delay time.Duration
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return 0, errors.New("disk full")
+}
+
 func TestConcurrentEvents(t *testing.T) {
 	var numEvents uint = 1000
 	channelID := "mychannel"
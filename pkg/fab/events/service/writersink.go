@@ -0,0 +1,160 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// EventEncoder encodes an event (*fab.BlockEvent, *fab.FilteredBlockEvent, *fab.CCEvent or
+// *fab.TxStatusEvent) for writing to a WriterSink
+type EventEncoder func(event interface{}) ([]byte, error)
+
+// JSONEventEncoder is the default EventEncoder. Each event is encoded as a single line of JSON.
+func JSONEventEncoder(event interface{}) ([]byte, error) {
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "JSON encoding of event failed")
+	}
+	return append(bytes, '\n'), nil
+}
+
+// WriterSink writes the events received by a registration to an io.Writer,
+// for example, in order to dump an event stream to a file for debugging or archival.
+// If a write fails then the registration is unregistered and the error is reported by Err.
+type WriterSink struct {
+	eventService fab.EventService
+	reg          fab.Registration
+	writer       io.Writer
+	encoder      EventEncoder
+	done         chan struct{}
+	mutex        sync.RWMutex
+	err          error
+}
+
+// NewWriterSink starts writing the events received on the given event channel (as returned
+// along with the registration by one of the Register functions of the event service) to the
+// given writer. If encoder is nil then events are encoded with JSONEventEncoder.
+// The sink stops when the registration is unregistered (which closes the event channel).
+func NewWriterSink(eventService fab.EventService, reg fab.Registration, eventch interface{}, writer io.Writer, encoder EventEncoder) (*WriterSink, error) {
+	if writer == nil {
+		return nil, errors.New("writer is required")
+	}
+
+	events, err := toEventChannel(eventch)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoder == nil {
+		encoder = JSONEventEncoder
+	}
+
+	s := &WriterSink{
+		eventService: eventService,
+		reg:          reg,
+		writer:       writer,
+		encoder:      encoder,
+		done:         make(chan struct{}),
+	}
+
+	go s.run(events)
+
+	return s, nil
+}
+
+// Done returns a channel that is closed when the sink stops writing events
+func (s *WriterSink) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that caused the sink to stop (or nil if the sink stopped
+// because the registration was unregistered)
+func (s *WriterSink) Err() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.err
+}
+
+func (s *WriterSink) run(events <-chan interface{}) {
+	defer close(s.done)
+
+	for event := range events {
+		if err := s.write(event); err != nil {
+			logger.Warnf("Unregistering event sink due to error: %s", err)
+
+			s.mutex.Lock()
+			s.err = err
+			s.mutex.Unlock()
+
+			// Unregister asynchronously since the dispatcher may be blocked delivering to this sink, in which
+			// case the unregister request isn't handled until the remaining events are drained
+			go s.eventService.Unregister(s.reg)
+
+			// Drain the remaining events until the channel is closed by Unregister
+			for range events {
+			}
+			return
+		}
+	}
+}
+
+func (s *WriterSink) write(event interface{}) error {
+	bytes, err := s.encoder(event)
+	if err != nil {
+		return errors.WithMessage(err, "encoding of event failed")
+	}
+	if _, err := s.writer.Write(bytes); err != nil {
+		return errors.Wrap(err, "write of event failed")
+	}
+	return nil
+}
+
+// toEventChannel adapts the typed event channel to a channel of events
+func toEventChannel(eventch interface{}) (<-chan interface{}, error) {
+	events := make(chan interface{})
+
+	switch ch := eventch.(type) {
+	case <-chan *fab.BlockEvent:
+		go func() {
+			defer close(events)
+			for event := range ch {
+				events <- event
+			}
+		}()
+	case <-chan *fab.FilteredBlockEvent:
+		go func() {
+			defer close(events)
+			for event := range ch {
+				events <- event
+			}
+		}()
+	case <-chan *fab.CCEvent:
+		go func() {
+			defer close(events)
+			for event := range ch {
+				events <- event
+			}
+		}()
+	case <-chan *fab.TxStatusEvent:
+		go func() {
+			defer close(events)
+			for event := range ch {
+				events <- event
+			}
+		}()
+	default:
+		return nil, errors.Errorf("unsupported event channel type: %T", eventch)
+	}
+
+	return events, nil
+}
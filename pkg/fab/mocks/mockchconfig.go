@@ -21,6 +21,7 @@ type MockChannelCfg struct {
 	MockAnchorPeers []*fab.OrgAnchorPeer
 	MockOrderers    []string
 	MockVersions    *fab.Versions
+	MockSequence    uint64
 	MockMembership  fab.ChannelMembership
 }
 
@@ -54,6 +55,11 @@ func (cfg *MockChannelCfg) Versions() *fab.Versions {
 	return cfg.MockVersions
 }
 
+// Sequence returns the config sequence
+func (cfg *MockChannelCfg) Sequence() uint64 {
+	return cfg.MockSequence
+}
+
 // MockChannelConfig mockcore query channel configuration
 type MockChannelConfig struct {
 	channelID string
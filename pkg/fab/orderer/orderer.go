@@ -8,6 +8,7 @@ package orderer
 
 import (
 	reqContext "context"
+	"crypto/tls"
 	"crypto/x509"
 	"time"
 
@@ -49,11 +50,16 @@ type Orderer struct {
 	failFast       bool
 	allowInsecure  bool
 	commManager    fab.CommManager
+	certProvider   ClientCertProvider
 }
 
 // Option describes a functional parameter for the New constructor
 type Option func(*Orderer) error
 
+// ClientCertProvider returns the current client TLS certificate. It's invoked on each TLS handshake with
+// the orderer so that a rotated certificate is picked up without recreating the orderer.
+type ClientCertProvider func() (*tls.Certificate, error)
+
 // New Returns a Orderer instance
 func New(config core.Config, opts ...Option) (*Orderer, error) {
 	orderer := &Orderer{
@@ -79,6 +85,12 @@ func New(config core.Config, opts ...Option) (*Orderer, error) {
 		if err != nil {
 			return nil, err
 		}
+		if orderer.certProvider != nil {
+			// The client certificate is obtained on each handshake rather than when dialing since a cached
+			// connection (see comm.CachingConnector) reconnects with the credentials that it was dialed with
+			tlsConfig.Certificates = nil
+			tlsConfig.GetClientCertificate = orderer.clientCertificate
+		}
 		grpcOpts = append(grpcOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
 	} else {
 		grpcOpts = append(grpcOpts, grpc.WithInsecure())
@@ -130,6 +142,22 @@ func WithInsecure() Option {
 	}
 }
 
+// WithClientCertProvider is a functional option for the orderer.New constructor that configures a provider of the
+// client TLS certificate. The certificate is obtained from the provider on each TLS handshake in which the orderer
+// requests a client certificate (including the handshakes of cached connections that reconnect) instead of once
+// from the config, which allows the certificate to be rotated. If the provider returns an error then the handshake
+// fails. The provider is only used for TLS connections.
+func WithClientCertProvider(provider ClientCertProvider) Option {
+	return func(o *Orderer) error {
+		if provider == nil {
+			return errors.New("client certificate provider is required")
+		}
+		o.certProvider = provider
+
+		return nil
+	}
+}
+
 // FromOrdererConfig is a functional option for the orderer.New constructor that configures a new orderer
 // from a apiconfig.OrdererConfig struct
 func FromOrdererConfig(ordererCfg *core.OrdererConfig) Option {
@@ -224,6 +252,18 @@ func (o *Orderer) conn(ctx reqContext.Context) (*grpc.ClientConn, error) {
 	return commManager.DialContext(ctx, o.url, o.grpcDialOption...)
 }
 
+// clientCertificate returns the current client certificate from the provider during a TLS handshake
+func (o *Orderer) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := o.certProvider()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to get client TLS certificate from provider")
+	}
+	if cert == nil {
+		return nil, errors.New("client TLS certificate provider returned no certificate")
+	}
+	return cert, nil
+}
+
 func (o *Orderer) releaseConn(ctx reqContext.Context, conn *grpc.ClientConn) {
 	commManager, ok := context.RequestCommManager(ctx)
 	if !ok {
@@ -8,17 +8,26 @@ package orderer
 
 import (
 	reqContext "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/endpoint"
 	"google.golang.org/grpc"
 	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 
 	"github.com/golang/mock/gomock"
 	ab "github.com/hyperledger/fabric-sdk-go/internal/github.com/hyperledger/fabric/protos/orderer"
@@ -26,6 +35,7 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	mockCore "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/test/mockcore"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/comm"
 	mocks "github.com/hyperledger/fabric-sdk-go/pkg/fab/mocks"
 	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
 	"github.com/pkg/errors"
@@ -183,6 +193,180 @@ func TestNewOrdererWithMutualTLS(t *testing.T) {
 	}
 }
 
+func TestNewOrdererWithClientCertProvider(t *testing.T) {
+	tlsConfig := endpoint.TLSConfig{Path: "../../../test/fixtures/fabricca/tls/ca/ca_root.pem"}
+	cert, err := tlsConfig.TLSCert()
+	if err != nil {
+		t.Fatalf("Testing New with TLS failed, cause [%s]", err)
+	}
+
+	// The provider returns a new certificate each time to simulate rotation
+	calls := 0
+	provider := func() (*tls.Certificate, error) {
+		calls++
+		return &tls.Certificate{Certificate: [][]byte{[]byte(fmt.Sprintf("cert%d", calls))}}, nil
+	}
+
+	orderer, err := New(mocks.NewMockConfigCustomized(true, false, false), WithURL("grpcs://localhost:7050"), WithTLSCert(cert), WithClientCertProvider(provider))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, calls, "expecting the certificate not to be obtained at construction")
+
+	clientCert, err := orderer.clientCertificate(&tls.CertificateRequestInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("cert1"), clientCert.Certificate[0])
+
+	clientCert, err = orderer.clientCertificate(&tls.CertificateRequestInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("cert2"), clientCert.Certificate[0], "expecting the rotated certificate")
+
+	// The handshake fails if the provider fails
+	orderer, err = New(mocks.NewMockConfigCustomized(true, false, false), WithURL("grpcs://localhost:7050"), WithTLSCert(cert), WithClientCertProvider(func() (*tls.Certificate, error) {
+		return nil, errors.New("certificate unavailable")
+	}))
+	assert.NoError(t, err)
+	_, err = orderer.clientCertificate(&tls.CertificateRequestInfo{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get client TLS certificate from provider")
+	assert.Contains(t, err.Error(), "certificate unavailable")
+
+	_, err = New(mocks.NewMockConfig(), WithURL("grpcs://localhost:7050"), WithClientCertProvider(nil))
+	assert.Error(t, err, "expecting error for nil provider")
+}
+
+func TestClientCertRotationWithCachingConnector(t *testing.T) {
+	caCert, caKey := newTestCertificate(t, "ca", nil, nil)
+	serverCert, serverKey := newTestCertificate(t, "server", caCert, caKey)
+	clientCert1, clientKey1 := newTestCertificate(t, "client1", caCert, caKey)
+	clientCert2, clientKey2 := newTestCertificate(t, "client2", caCert, caKey)
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert)
+
+	// The server records the common name of the client certificate of each stream
+	var mutex sync.Mutex
+	var clientNames []string
+	recordClient := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if p, ok := peer.FromContext(ss.Context()); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+				mutex.Lock()
+				clientNames = append(clientNames, tlsInfo.State.PeerCertificates[0].Subject.CommonName)
+				mutex.Unlock()
+			}
+		}
+		return handler(srv, ss)
+	}
+	lastClientName := func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(clientNames) == 0 {
+			return ""
+		}
+		return clientNames[len(clientNames)-1]
+	}
+
+	serverTLSConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	newServer := func() *grpc.Server {
+		return grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLSConfig)), grpc.StreamInterceptor(recordClient))
+	}
+
+	grpcServer := newServer()
+	addr := startCustomizedMockServer(t, testOrdererURL, grpcServer, &mocks.MockBroadcastServer{})
+
+	var certMutex sync.Mutex
+	clientCert := &tls.Certificate{Certificate: [][]byte{clientCert1.Raw}, PrivateKey: clientKey1}
+	provider := func() (*tls.Certificate, error) {
+		certMutex.Lock()
+		defer certMutex.Unlock()
+		return clientCert, nil
+	}
+
+	orderer, err := New(&tlsCAConfig{Config: mocks.NewMockConfigCustomized(true, false, false), pool: caPool},
+		WithURL("grpcs://"+addr), WithTLSCert(caCert), WithServerName("localhost"), WithClientCertProvider(provider))
+	assert.NoError(t, err)
+
+	connector := comm.NewCachingConnector(time.Second, time.Minute)
+	defer connector.Close()
+	orderer.commManager = connector
+
+	ctx, cancel := reqContext.WithTimeout(reqContext.Background(), 15*time.Second)
+	defer cancel()
+
+	_, err = orderer.SendBroadcast(ctx, &fab.SignedEnvelope{})
+	assert.NoError(t, err)
+	assert.Equal(t, "client1", lastClientName())
+
+	// Rotate the certificate and drop the connection: the cached connection reconnects with the rotated certificate
+	certMutex.Lock()
+	clientCert = &tls.Certificate{Certificate: [][]byte{clientCert2.Raw}, PrivateKey: clientKey2}
+	certMutex.Unlock()
+
+	grpcServer.Stop()
+	grpcServer = newServer()
+	defer grpcServer.Stop()
+	startCustomizedMockServer(t, addr, grpcServer, &mocks.MockBroadcastServer{})
+
+	// A request may fail while the connection is closing
+	for attempt := 0; attempt < 10; attempt++ {
+		if _, err = orderer.SendBroadcast(ctx, &fab.SignedEnvelope{}); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, "client2", lastClientName(), "expecting the rotated certificate to be used by the cached connection")
+}
+
+// tlsCAConfig is a config that trusts the TLS CA certificates in the given pool
+type tlsCAConfig struct {
+	core.Config
+	pool *x509.CertPool
+}
+
+func (c *tlsCAConfig) TLSCACertPool(certs ...*x509.Certificate) (*x509.CertPool, error) {
+	return c.pool, nil
+}
+
+// newTestCertificate creates a certificate (for localhost) with the given common name that's signed by the given
+// CA certificate, or a self-signed CA certificate if no CA is given
+func newTestCertificate(t *testing.T, commonName string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, parentKey := template, key
+	if caCert == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parent, parentKey = caCert, caKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %s", err)
+	}
+	return cert, key
+}
+
 func TestSendBroadcastHappy(t *testing.T) {
 
 	ordererConfig := getGRPCOpts(ordererAddr, true, false, true)
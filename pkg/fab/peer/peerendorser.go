@@ -17,7 +17,9 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 	grpcstatus "google.golang.org/grpc/status"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
@@ -141,8 +143,19 @@ func (p *peerEndorser) sendProposal(ctx reqContext.Context, proposal fab.Process
 	}
 	defer p.releaseConn(ctx, conn)
 
+	var callOpts []grpc.CallOption
+	if compressor, ok := context.RequestCompressor(ctx, p.target); ok {
+		logger.Debugf("Using compressor [%s] for endorser [%s]", compressor, p.target)
+		callOpts = append(callOpts, grpc.UseCompressor(compressor))
+	}
+
+	if correlationID, ok := context.RequestCorrelationID(ctx); ok {
+		logger.Debugf("Sending proposal to endorser [%s] with correlation ID [%s]", p.target, correlationID)
+		ctx = withOutgoingMetadata(ctx, context.CorrelationIDHeader, correlationID)
+	}
+
 	endorserClient := pb.NewEndorserClient(conn)
-	resp, err := endorserClient.ProcessProposal(ctx, proposal.SignedProposal)
+	resp, err := endorserClient.ProcessProposal(ctx, proposal.SignedProposal, callOpts...)
 	if err != nil {
 		logger.Errorf("process proposal failed [%s]", err)
 		rpcStatus, ok := grpcstatus.FromError(err)
@@ -159,6 +172,15 @@ func (p *peerEndorser) sendProposal(ctx reqContext.Context, proposal fab.Process
 	return resp, err
 }
 
+// withOutgoingMetadata returns a copy of the context with the given key/value added to the outgoing gRPC metadata
+func withOutgoingMetadata(ctx reqContext.Context, key, value string) reqContext.Context {
+	md := metadata.Pairs(key, value)
+	if existing, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = metadata.Join(existing, md)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
 func extractChaincodeError(status *grpcstatus.Status) (int, string, error) {
 	var code int
 	var message string
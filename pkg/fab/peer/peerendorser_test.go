@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,9 +21,11 @@ import (
 	"google.golang.org/grpc"
 	grpcCodes "google.golang.org/grpc/codes"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/stats"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/context"
 	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
@@ -202,7 +205,80 @@ func TestProcessProposalGoodDial(t *testing.T) {
 	}
 }
 
+// TestProcessProposalWithCorrelationID validates that the correlation ID of the
+// request context is sent to the endorser.
+func TestProcessProposalWithCorrelationID(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	defer grpcServer.Stop()
+	endorserServer, addr := startEndorserServer(t, grpcServer)
+
+	_, err := testProcessProposalWithContext(t, context.WithCorrelationID(reqContext.Background(), "corr-1234"), "grpc://"+addr)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"corr-1234"}, endorserServer.Metadata[context.CorrelationIDHeader])
+
+	_, err = testProcessProposal(t, "grpc://"+addr)
+	assert.NoError(t, err)
+	assert.Empty(t, endorserServer.Metadata[context.CorrelationIDHeader])
+}
+
+// TestProcessProposalWithCompressor validates that proposals are compressed with the compressor of the
+// request context unless the endorser is excluded, either by URL or by address.
+func TestProcessProposalWithCompressor(t *testing.T) {
+	recorder := &compressionRecorder{}
+	grpcServer := grpc.NewServer(grpc.StatsHandler(recorder))
+	defer grpcServer.Stop()
+	_, addr := startEndorserServer(t, grpcServer)
+	url := "grpc://" + addr
+
+	_, err := testProcessProposalWithContext(t, context.WithCompressor(reqContext.Background(), "gzip"), url)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", recorder.lastCompression())
+
+	_, err = testProcessProposalWithContext(t, context.WithCompressor(reqContext.Background(), "gzip", url), url)
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.lastCompression(), "expecting no compression for endorser excluded by URL")
+
+	_, err = testProcessProposalWithContext(t, context.WithCompressor(reqContext.Background(), "gzip", addr), url)
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.lastCompression(), "expecting no compression for endorser excluded by address")
+}
+
+// compressionRecorder is a gRPC server stats handler that records the compression of the last request
+type compressionRecorder struct {
+	mutex       sync.Mutex
+	compression string
+}
+
+func (r *compressionRecorder) TagRPC(ctx reqContext.Context, info *stats.RPCTagInfo) reqContext.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleRPC(ctx reqContext.Context, s stats.RPCStats) {
+	if header, ok := s.(*stats.InHeader); ok {
+		r.mutex.Lock()
+		r.compression = header.Compression
+		r.mutex.Unlock()
+	}
+}
+
+func (r *compressionRecorder) TagConn(ctx reqContext.Context, info *stats.ConnTagInfo) reqContext.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleConn(ctx reqContext.Context, s stats.ConnStats) {
+}
+
+func (r *compressionRecorder) lastCompression() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.compression
+}
+
 func testProcessProposal(t *testing.T, url string) (*fab.TransactionProposalResponse, error) {
+	return testProcessProposalWithContext(t, reqContext.Background(), url)
+}
+
+func testProcessProposalWithContext(t *testing.T, parentCtx reqContext.Context, url string) (*fab.TransactionProposalResponse, error) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	config := mockCore.DefaultMockConfig(mockCtrl)
@@ -213,7 +289,7 @@ func testProcessProposal(t *testing.T, url string) (*fab.TransactionProposalResp
 		t.Fatalf("Peer conn construction error (%v)", err)
 	}
 
-	ctx, cancel := reqContext.WithTimeout(reqContext.Background(), normalTimeout)
+	ctx, cancel := reqContext.WithTimeout(parentCtx, normalTimeout)
 	defer cancel()
 	return conn.ProcessTransactionProposal(ctx, mockProcessProposalRequest())
 }
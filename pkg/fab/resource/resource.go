@@ -9,6 +9,7 @@ package resource
 
 import (
 	reqContext "context"
+	"fmt"
 	"net/http"
 
 	"github.com/golang/protobuf/proto"
@@ -147,6 +148,25 @@ func LastConfigFromOrderer(reqCtx reqContext.Context, channelName string, ordere
 	return CreateConfigEnvelope(block.Data.Data[0])
 }
 
+// ConfigFromOrderer fetches the config block with the given number for the specified channel from the given
+// orderer. An error is returned if the block isn't a config block.
+func ConfigFromOrderer(reqCtx reqContext.Context, channelName string, orderer fab.Orderer, blockNumber uint64) (*common.ConfigEnvelope, error) {
+	block, err := retrieveBlock(reqCtx, []fab.Orderer{orderer}, channelName, newSpecificSeekPosition(blockNumber))
+	if err != nil {
+		return nil, errors.WithMessage(err, "retrieve block failed")
+	}
+
+	if block.Data == nil || len(block.Data.Data) != 1 {
+		return nil, errors.Errorf("block %d is not a config block: config block must contain one transaction", blockNumber)
+	}
+
+	configEnvelope, err := CreateConfigEnvelope(block.Data.Data[0])
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("block %d is not a config block", blockNumber))
+	}
+	return configEnvelope, nil
+}
+
 // JoinChannel sends a join channel proposal to the target peer.
 //
 // TODO extract targets from request into parameter.
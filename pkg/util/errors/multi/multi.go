@@ -34,12 +34,16 @@ func New(errs ...error) error {
 	return errors
 }
 
-// Append error to Errors. If the first arg is not an Errors object, one will be created
+// Append error to Errors. If the first arg is not an Errors object, one will be created.
+// A nil error is not appended.
 func Append(errs error, err error) error {
 	m, ok := errs.(Errors)
 	if !ok {
 		return New(errs, err)
 	}
+	if err == nil {
+		return m
+	}
 	return append(m, err)
 }
 
@@ -47,6 +47,11 @@ func TestAppend(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, testErr, m1[0])
 	assert.Equal(t, testErr2, m1[1])
+
+	m = Append(m, nil)
+	m1, ok = m.(Errors)
+	assert.True(t, ok)
+	assert.Len(t, m1, 2, "expecting nil error not to be appended")
 }
 
 func TestToError(t *testing.T) {
@@ -0,0 +1,50 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package protoutil
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// asn1BlockHeader is the ASN.1 structure of a block header that's hashed and signed by Fabric
+type asn1BlockHeader struct {
+	Number       *big.Int
+	PreviousHash []byte
+	DataHash     []byte
+}
+
+// BlockHeaderBytes returns the ASN.1 encoding of the block header (as hashed and signed by Fabric)
+func BlockHeaderBytes(header *common.BlockHeader) ([]byte, error) {
+	if header == nil {
+		return nil, errors.New("block header is required")
+	}
+	bytes, err := asn1.Marshal(asn1BlockHeader{
+		Number:       new(big.Int).SetUint64(header.Number),
+		PreviousHash: header.PreviousHash,
+		DataHash:     header.DataHash,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "ASN.1 encoding of block header failed")
+	}
+	return bytes, nil
+}
+
+// BlockHeaderHash returns the SHA-256 hash of the ASN.1 encoding of the block header (as computed by Fabric).
+// The hash of a block's header is the previous hash of the next block.
+func BlockHeaderHash(header *common.BlockHeader) ([]byte, error) {
+	headerBytes, err := BlockHeaderBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(headerBytes)
+	return hash[:], nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package protoutil
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockHeaderHash(t *testing.T) {
+	header := &common.BlockHeader{Number: 7, PreviousHash: []byte("previous"), DataHash: []byte("data")}
+
+	headerBytes, err := BlockHeaderBytes(header)
+	assert.NoError(t, err)
+
+	decoded := asn1BlockHeader{}
+	_, err = asn1.Unmarshal(headerBytes, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, asn1BlockHeader{Number: big.NewInt(7), PreviousHash: []byte("previous"), DataHash: []byte("data")}, decoded)
+
+	hash, err := BlockHeaderHash(header)
+	assert.NoError(t, err)
+	expected := sha256.Sum256(headerBytes)
+	assert.Equal(t, expected[:], hash)
+
+	header.Number = 8
+	otherHash, err := BlockHeaderHash(header)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, otherHash, "expecting different hash for different block number")
+
+	_, err = BlockHeaderHash(nil)
+	assert.Error(t, err, "expecting error for nil header")
+}